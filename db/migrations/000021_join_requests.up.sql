@@ -0,0 +1,15 @@
+ALTER TABLE groups ADD COLUMN requires_approval BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE join_requests (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    group_id UUID NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending',
+    decided_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    decided_at TIMESTAMP,
+    CONSTRAINT valid_join_request_status CHECK (status IN ('pending', 'approved', 'denied'))
+);
+
+CREATE UNIQUE INDEX unique_pending_join_request ON join_requests (group_id, user_id) WHERE status = 'pending';
+CREATE INDEX idx_join_requests_group_id ON join_requests (group_id);
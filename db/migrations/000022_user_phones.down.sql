@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS phone_verifications;
+DROP INDEX IF EXISTS unique_verified_phone;
+ALTER TABLE users DROP COLUMN IF EXISTS phone_verified_at;
+ALTER TABLE users DROP COLUMN IF EXISTS phone;
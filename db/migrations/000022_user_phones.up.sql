@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN phone TEXT;
+ALTER TABLE users ADD COLUMN phone_verified_at TIMESTAMP;
+
+-- A phone number can only be claimed by one verified account
+CREATE UNIQUE INDEX unique_verified_phone ON users (phone) WHERE phone_verified_at IS NOT NULL;
+
+CREATE TABLE phone_verifications (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    phone TEXT NOT NULL,
+    code_hash TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1 @@
+ALTER TABLE groups ADD COLUMN announcement_only BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,14 @@
+-- Uploaded message attachments. message_id is the client-generated ID of the image
+-- message the upload is for; an attachment with no matching message is orphaned.
+CREATE TABLE attachments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    group_id UUID NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    message_id UUID NOT NULL,
+    s3_key TEXT NOT NULL UNIQUE,
+    content_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_attachments_message_id ON attachments (message_id);
+CREATE INDEX idx_attachments_created_at ON attachments (created_at);
@@ -0,0 +1,11 @@
+-- Users mentioned in a message. Content is E2EE, so mentions come from a plaintext
+-- list the sender includes alongside the ciphertext.
+CREATE TABLE message_mentions (
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    group_id UUID NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (message_id, user_id)
+);
+
+CREATE INDEX idx_message_mentions_user_created ON message_mentions (user_id, created_at DESC);
@@ -0,0 +1,7 @@
+-- Admin-configurable per-group options that are not hot-path columns on groups.
+-- settings holds the JSON-encoded ws.GroupOptions; missing keys take their defaults.
+CREATE TABLE group_settings (
+    group_id UUID PRIMARY KEY REFERENCES groups(id) ON DELETE CASCADE,
+    settings JSONB NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
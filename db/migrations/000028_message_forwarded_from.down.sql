@@ -0,0 +1,4 @@
+ALTER TABLE messages
+    DROP COLUMN IF EXISTS forwarded_from_message_id,
+    DROP COLUMN IF EXISTS forwarded_from_group_id,
+    DROP COLUMN IF EXISTS forwarded_from_sender_id;
@@ -0,0 +1,6 @@
+-- Provenance of forwarded messages. The source message may since have been deleted,
+-- so its group and sender are copied rather than joined.
+ALTER TABLE messages
+    ADD COLUMN forwarded_from_message_id UUID,
+    ADD COLUMN forwarded_from_group_id UUID,
+    ADD COLUMN forwarded_from_sender_id UUID;
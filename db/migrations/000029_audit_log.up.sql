@@ -0,0 +1,14 @@
+-- Admin actions taken in a group, recorded in the same transaction as the action so
+-- members can see who changed what. Actor and target survive as NULL if the account
+-- is later deleted.
+CREATE TABLE audit_log (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    group_id UUID NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    action TEXT NOT NULL,
+    target_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    details JSONB,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_audit_log_group_created ON audit_log (group_id, created_at DESC, id DESC);
@@ -0,0 +1,5 @@
+-- Sender-chosen expiry for disappearing messages. Expired messages are hidden from
+-- GetRelevantMessages and deleted by the expire_messages job.
+ALTER TABLE messages ADD COLUMN expires_at TIMESTAMP;
+
+CREATE INDEX idx_messages_expires_at ON messages (expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1,4 @@
+-- How much a user's message pushes reveal. A group's notification_preview_mode setting
+-- (in group_settings) can only make it more private: full < name_only < generic.
+ALTER TABLE users ADD COLUMN notification_preview_mode TEXT NOT NULL DEFAULT 'full'
+    CHECK (notification_preview_mode IN ('full', 'name_only', 'generic'));
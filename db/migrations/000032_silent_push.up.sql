@@ -0,0 +1,2 @@
+-- Users who opt in get data-only pushes that wake the app to sync instead of alerts.
+ALTER TABLE users ADD COLUMN silent_push BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+-- While snooze_until is in the future the user gets no message pushes at all.
+ALTER TABLE users ADD COLUMN snooze_until TIMESTAMP;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_messages_group_created_at;
+ALTER TABLE user_groups DROP COLUMN IF EXISTS last_read_at;
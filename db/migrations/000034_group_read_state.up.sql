@@ -0,0 +1,6 @@
+-- When the member last marked the group read; NULL means never, so unread counts
+-- start from when they joined.
+ALTER TABLE user_groups ADD COLUMN last_read_at TIMESTAMP;
+
+-- Backs the group list's latest-message and unread-count lookups.
+CREATE INDEX idx_messages_group_created_at ON messages (group_id, created_at DESC);
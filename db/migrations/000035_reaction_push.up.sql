@@ -0,0 +1,2 @@
+-- Whether a reaction to one of the user's messages sends them a push. Off by default.
+ALTER TABLE users ADD COLUMN reaction_push BOOLEAN NOT NULL DEFAULT false;
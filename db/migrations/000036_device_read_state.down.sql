@@ -0,0 +1 @@
+DROP TABLE IF EXISTS device_group_reads;
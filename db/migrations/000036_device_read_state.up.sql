@@ -0,0 +1,11 @@
+-- How far each of a member's devices has read each group, so every device knows what
+-- it has already shown. user_groups.last_read_at stays the furthest any device has
+-- read and still drives unread counts.
+CREATE TABLE device_group_reads (
+    user_id UUID NOT NULL,
+    device_identifier TEXT NOT NULL,
+    group_id UUID NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    last_read_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, device_identifier, group_id),
+    FOREIGN KEY (user_id, device_identifier) REFERENCES device_keys (user_id, device_identifier) ON DELETE CASCADE
+);
@@ -0,0 +1,14 @@
+-- Earlier versions of edited messages, newest first per message. The server stores
+-- them as opaque ciphertext like messages; created_at is when the version was replaced.
+CREATE TABLE message_edits (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    ciphertext BYTEA NOT NULL,
+    msg_nonce BYTEA NOT NULL,
+    key_envelopes JSONB NOT NULL,
+    sender_device_identifier TEXT,
+    signature BYTEA,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_message_edits_message_created ON message_edits (message_id, created_at DESC);
@@ -0,0 +1,9 @@
+-- A requested email change awaiting confirmation from the new address. The account
+-- keeps its current email until the link is followed. Only the token's hash is stored.
+CREATE TABLE email_changes (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    new_email VARCHAR(255) NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+ALTER TABLE pending_notifications
+    DROP COLUMN channel_id,
+    DROP COLUMN sound;
@@ -0,0 +1,4 @@
+-- Deferred pushes keep the sound and Android channel they were built with.
+ALTER TABLE pending_notifications
+    ADD COLUMN sound TEXT NOT NULL DEFAULT 'default',
+    ADD COLUMN channel_id TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+-- The last per-sender counter accepted from each device in each group, so messages a
+-- device sends to a group are persisted in the order it numbered them.
+CREATE TABLE sender_sequences (
+    user_id UUID NOT NULL,
+    device_identifier TEXT NOT NULL,
+    group_id UUID NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    last_seq BIGINT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, device_identifier, group_id),
+    FOREIGN KEY (user_id, device_identifier) REFERENCES device_keys (user_id, device_identifier) ON DELETE CASCADE
+);
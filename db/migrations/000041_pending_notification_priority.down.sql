@@ -0,0 +1 @@
+ALTER TABLE pending_notifications DROP COLUMN priority;
@@ -0,0 +1,2 @@
+-- Deferred pushes keep the Expo priority they were built with.
+ALTER TABLE pending_notifications ADD COLUMN priority TEXT NOT NULL DEFAULT 'default';
@@ -0,0 +1,9 @@
+-- Who joined through each invite link and when, for the admin invite stats.
+CREATE TABLE invite_joins (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    invite_id UUID NOT NULL REFERENCES invites(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    joined_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_invite_joins_invite_id ON invite_joins (invite_id, joined_at DESC);
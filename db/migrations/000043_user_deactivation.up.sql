@@ -0,0 +1,6 @@
+-- Set when a user deactivates their account. Deactivated users are hidden and get no
+-- pushes; purge_deactivated_accounts deletes them once the grace period has passed,
+-- and logging in before then clears it.
+ALTER TABLE users ADD COLUMN deactivated_at TIMESTAMP;
+
+CREATE INDEX idx_users_deactivated_at ON users (deactivated_at) WHERE deactivated_at IS NOT NULL;
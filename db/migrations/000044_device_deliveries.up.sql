@@ -0,0 +1,13 @@
+-- The newest message each device reports having received in each group. Messages
+-- have no per-group counter, so the position is the message's (created_at, id), the
+-- order history is served in, and it only ever moves forward.
+CREATE TABLE device_group_deliveries (
+    user_id UUID NOT NULL,
+    device_identifier TEXT NOT NULL,
+    group_id UUID NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    message_id UUID NOT NULL,
+    delivered_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, device_identifier, group_id),
+    FOREIGN KEY (user_id, device_identifier) REFERENCES device_keys (user_id, device_identifier) ON DELETE CASCADE
+);
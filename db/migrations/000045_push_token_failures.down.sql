@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_push_receipts_push_token;
+DROP TABLE IF EXISTS push_token_failures;
@@ -0,0 +1,11 @@
+-- Error receipts per push token other than DeviceNotRegistered, which still clears
+-- the token straight away. cleanup_push_tokens removes tokens that keep failing; an
+-- ok receipt resets the count.
+CREATE TABLE push_token_failures (
+    push_token TEXT PRIMARY KEY,
+    failure_count INTEGER NOT NULL DEFAULT 1,
+    last_error TEXT NOT NULL DEFAULT '',
+    last_failed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_push_receipts_push_token ON push_receipts (push_token);
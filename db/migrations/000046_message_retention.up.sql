@@ -0,0 +1,3 @@
+-- trim_old_messages deletes the oldest messages across all groups once
+-- MESSAGE_RETENTION_DAYS is set.
+CREATE INDEX idx_messages_created_at ON messages (created_at);
@@ -0,0 +1,7 @@
+-- Plaintext labels admins put on a group (e.g. "work", "sports") so members can filter
+-- their group list. Stored lowercased; the ws package caps their number and length.
+CREATE TABLE group_tags (
+    group_id UUID NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (group_id, tag)
+);
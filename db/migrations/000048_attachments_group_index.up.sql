@@ -0,0 +1,2 @@
+-- GET /ws/groups/:groupID/media lists a group's attachments.
+CREATE INDEX idx_attachments_group_id ON attachments (group_id);
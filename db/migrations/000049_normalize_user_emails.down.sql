@@ -0,0 +1 @@
+-- Normalized emails cannot be restored to their original casing.
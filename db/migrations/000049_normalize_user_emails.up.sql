@@ -0,0 +1,14 @@
+-- unique_email_idx already rules out case-only duplicates, but stray whitespace can
+-- still leave several rows that normalize to the same address. Those rows are left
+-- untouched so the migration never fails and can be merged by hand.
+UPDATE users u
+SET email = LOWER(TRIM(u.email))
+WHERE u.email <> LOWER(TRIM(u.email))
+  AND NOT EXISTS (
+    SELECT 1 FROM users other
+    WHERE other.id <> u.id AND LOWER(TRIM(other.email)) = LOWER(TRIM(u.email))
+  );
+
+UPDATE email_changes
+SET new_email = LOWER(TRIM(new_email))
+WHERE new_email <> LOWER(TRIM(new_email));
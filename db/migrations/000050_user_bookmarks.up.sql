@@ -0,0 +1,11 @@
+-- Messages a user bookmarked for themselves. Private to the user; rows go away with
+-- the message or the group through the cascades.
+CREATE TABLE user_bookmarks (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    group_id UUID NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, message_id)
+);
+
+CREATE INDEX idx_user_bookmarks_user_created ON user_bookmarks (user_id, created_at DESC, message_id DESC);
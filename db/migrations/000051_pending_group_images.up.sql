@@ -0,0 +1,14 @@
+-- Group image uploads presigned by POST /images/group-image/presign and not yet
+-- confirmed. POST /images/confirm sets the group image and removes the row; rows left
+-- behind are unconfirmed uploads, cleaned up with their objects like orphaned
+-- attachments.
+CREATE TABLE pending_group_images (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    group_id UUID NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    s3_key TEXT NOT NULL UNIQUE,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_pending_group_images_created_at ON pending_group_images (created_at);
@@ -0,0 +1,2 @@
+ALTER TABLE attachments DROP COLUMN IF EXISTS bound_at;
+ALTER TABLE attachments DROP COLUMN IF EXISTS uploader_id;
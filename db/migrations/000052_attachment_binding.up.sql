@@ -0,0 +1,13 @@
+-- An attachment is recorded at presign time for the message ID the client names, but
+-- only counts as that message's once the uploader sends it as an image message:
+-- persistAndPublish sets bound_at then. Unbound rows are orphans to the cleanup job
+-- and never show in the group media list.
+ALTER TABLE attachments ADD COLUMN uploader_id UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE attachments ADD COLUMN bound_at TIMESTAMP;
+
+UPDATE attachments a
+SET uploader_id = m.user_id, bound_at = a.created_at
+FROM messages m
+WHERE m.id = a.message_id
+  AND m.group_id = a.group_id
+  AND m.message_type = 'image';
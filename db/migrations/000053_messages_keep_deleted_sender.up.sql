@@ -0,0 +1,5 @@
+-- Deleting an account keeps its messages in their groups: the sender is cleared
+-- rather than the history being removed out from under the other members.
+ALTER TABLE messages DROP CONSTRAINT messages_user_id_fkey;
+ALTER TABLE messages ADD CONSTRAINT messages_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
@@ -0,0 +1,7 @@
+ALTER TABLE pending_notifications ADD COLUMN push_token TEXT;
+UPDATE pending_notifications pn SET push_token = dk.expo_push_token
+FROM device_keys dk
+WHERE dk.user_id = pn.user_id AND dk.device_identifier = pn.device_identifier;
+DELETE FROM pending_notifications WHERE push_token IS NULL;
+ALTER TABLE pending_notifications ALTER COLUMN push_token SET NOT NULL;
+ALTER TABLE pending_notifications DROP COLUMN device_identifier;
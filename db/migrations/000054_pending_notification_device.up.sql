@@ -0,0 +1,10 @@
+-- Deferred pushes name the recipient device instead of its push token. The retry job
+-- looks up the device's current token, so a token cleared at logout, account deletion
+-- or device unregister never receives a retry.
+ALTER TABLE pending_notifications ADD COLUMN device_identifier TEXT;
+UPDATE pending_notifications pn SET device_identifier = dk.device_identifier
+FROM device_keys dk
+WHERE dk.user_id = pn.user_id AND dk.expo_push_token = pn.push_token;
+DELETE FROM pending_notifications WHERE device_identifier IS NULL;
+ALTER TABLE pending_notifications ALTER COLUMN device_identifier SET NOT NULL;
+ALTER TABLE pending_notifications DROP COLUMN push_token;
@@ -0,0 +1,58 @@
+-- name: InsertAttachment :one
+INSERT INTO attachments (group_id, message_id, s3_key, content_type, size, uploader_id)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: BindMessageAttachments :execrows
+-- Claims the uploads presigned for an image message once its uploader sends it.
+UPDATE attachments SET bound_at = NOW()
+WHERE message_id = $1 AND group_id = $2 AND uploader_id = $3 AND bound_at IS NULL;
+
+-- name: GetOrphanedAttachments :many
+SELECT a.id, a.s3_key FROM attachments a
+WHERE a.created_at < $1
+AND (a.bound_at IS NULL OR NOT EXISTS (SELECT 1 FROM messages m WHERE m.id = a.message_id))
+ORDER BY a.created_at
+LIMIT $2;
+
+-- name: DeleteAttachments :exec
+DELETE FROM attachments WHERE id = ANY($1::uuid[]);
+
+-- name: GetAttachmentsForMessages :many
+SELECT id, s3_key FROM attachments
+WHERE message_id = ANY(sqlc.arg('message_ids')::uuid[]);
+
+-- name: GetGroupMediaPage :many
+-- Attachments of group messages the user can see (sent after they joined, not
+-- expired), newest message first, keyset-paginated on (message created_at, id).
+SELECT a.id, a.message_id, a.s3_key, a.content_type, a.size, m.user_id AS sender_id, m.created_at AS sent_at
+FROM attachments a
+JOIN messages m ON m.id = a.message_id AND m.group_id = a.group_id
+JOIN user_groups ug ON ug.group_id = a.group_id AND ug.user_id = sqlc.arg('user_id')
+WHERE a.group_id = sqlc.arg('group_id')
+  AND a.bound_at IS NOT NULL
+  AND ug.deleted_at IS NULL
+  AND m.created_at > ug.created_at
+  AND (m.expires_at IS NULL OR m.expires_at > NOW())
+  AND (m.created_at, a.id) < (sqlc.arg('before_sent_at')::timestamp, sqlc.arg('before_id')::uuid)
+ORDER BY m.created_at DESC, a.id DESC
+LIMIT sqlc.arg('page_size');
+
+-- name: InsertPendingGroupImage :exec
+INSERT INTO pending_group_images (group_id, user_id, s3_key, size)
+VALUES ($1, $2, $3, $4);
+
+-- name: GetPendingGroupImage :one
+SELECT * FROM pending_group_images WHERE s3_key = $1;
+
+-- name: DeletePendingGroupImage :execrows
+DELETE FROM pending_group_images WHERE s3_key = $1;
+
+-- name: GetStalePendingGroupImages :many
+SELECT id, s3_key FROM pending_group_images
+WHERE created_at < $1
+ORDER BY created_at
+LIMIT $2;
+
+-- name: DeletePendingGroupImages :exec
+DELETE FROM pending_group_images WHERE id = ANY($1::uuid[]);
@@ -0,0 +1,22 @@
+-- name: InsertAuditLogEntry :exec
+INSERT INTO audit_log (group_id, actor_id, action, target_user_id, details)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: GetGroupAuditLog :many
+-- Newest first, keyset-paginated on (created_at, id).
+SELECT
+    al.id,
+    al.actor_id,
+    actor.username AS actor_username,
+    al.action,
+    al.target_user_id,
+    target.username AS target_username,
+    al.details,
+    al.created_at
+FROM audit_log al
+LEFT JOIN users actor ON actor.id = al.actor_id
+LEFT JOIN users target ON target.id = al.target_user_id
+WHERE al.group_id = sqlc.arg('group_id')
+  AND (al.created_at, al.id) < (sqlc.arg('before_created_at')::timestamp, sqlc.arg('before_id')::uuid)
+ORDER BY al.created_at DESC, al.id DESC
+LIMIT sqlc.arg('page_size');
@@ -14,6 +14,16 @@ JOIN users u ON u.id = bu.blocked_id
 WHERE bu.blocker_id = $1
 ORDER BY bu.created_at DESC;
 
+-- name: GetBlockedUsersPage :many
+-- Newest block first, keyset-paginated on (blocked_at, id).
+SELECT u.id, u.username, u.email, bu.created_at AS blocked_at
+FROM blocked_users bu
+JOIN users u ON u.id = bu.blocked_id
+WHERE bu.blocker_id = sqlc.arg('blocker_id')
+  AND (bu.created_at, u.id) < (sqlc.arg('before_blocked_at')::timestamp, sqlc.arg('before_id')::uuid)
+ORDER BY bu.created_at DESC, u.id DESC
+LIMIT sqlc.arg('page_size');
+
 -- name: CheckBlockExists :one
 SELECT EXISTS(
     SELECT 1 FROM blocked_users
@@ -27,6 +37,8 @@ WHERE ug1.user_id = $1 AND ug2.user_id = $2
   AND ug1.deleted_at IS NULL AND ug2.deleted_at IS NULL;
 
 -- name: CheckBlockConflictWithGroup :one
+-- Symmetric: true if $1 has blocked any current member of the group or any member
+-- has blocked $1. Used before $1 joins, so neither side ends up sharing a group.
 SELECT EXISTS(
     SELECT 1 FROM user_groups ug
     JOIN blocked_users bu ON
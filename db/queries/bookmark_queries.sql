@@ -0,0 +1,38 @@
+-- name: InsertUserBookmark :exec
+INSERT INTO user_bookmarks (user_id, message_id, group_id)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, message_id) DO NOTHING;
+
+-- name: DeleteUserBookmark :execrows
+DELETE FROM user_bookmarks WHERE user_id = $1 AND message_id = $2;
+
+-- name: GetUserBookmarksPage :many
+-- Bookmarked messages the user can still see (still a member, group not deleted,
+-- message not expired), most recently bookmarked first, keyset-paginated on
+-- (bookmarked_at, message_id).
+SELECT
+    b.message_id,
+    b.group_id,
+    b.created_at AS bookmarked_at,
+    m.user_id AS sender_id,
+    u.username AS sender_username,
+    m.created_at AS sent_at,
+    m.ciphertext,
+    m.message_type,
+    m.msg_nonce,
+    m.key_envelopes,
+    m.sender_device_identifier,
+    m.signature,
+    m.expires_at
+FROM user_bookmarks b
+JOIN messages m ON m.id = b.message_id
+LEFT JOIN users u ON u.id = m.user_id
+JOIN user_groups ug ON ug.group_id = b.group_id AND ug.user_id = b.user_id
+JOIN groups g ON g.id = b.group_id
+WHERE b.user_id = sqlc.arg('user_id')
+  AND ug.deleted_at IS NULL
+  AND g.deleted_at IS NULL
+  AND (m.expires_at IS NULL OR m.expires_at > NOW())
+  AND (b.created_at, b.message_id) < (sqlc.arg('before_bookmarked_at')::timestamp, sqlc.arg('before_message_id')::uuid)
+ORDER BY b.created_at DESC, b.message_id DESC
+LIMIT sqlc.arg('page_size');
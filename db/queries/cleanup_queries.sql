@@ -1,12 +1,12 @@
 -- Cleanup Expired Groups Queries
 
 -- name: GetExpiredGroups :many
--- Returns groups that have passed their end_time
+-- Returns groups whose end_time is before cutoff, i.e. past their retention window
 SELECT id, name, end_time
 FROM groups
-WHERE end_time < NOW() AND deleted_at IS NULL
+WHERE end_time < sqlc.arg('cutoff') AND deleted_at IS NULL
 ORDER BY end_time ASC
-LIMIT $1;
+LIMIT sqlc.arg('batch_size');
 
 -- name: DeleteMessagesForGroup :exec
 -- Deletes all messages for a specific group
@@ -52,7 +52,7 @@ LIMIT $1;
 
 -- name: ClearGroupImageUrl :exec
 -- Nulls out the image_url after S3 cleanup so the group isn't reprocessed
-UPDATE groups SET image_url = NULL, blurhash = NULL WHERE id = $1;
+UPDATE groups SET image_url = NULL, blurhash = NULL, updated_at = NOW() WHERE id = $1;
 
 -- name: UserHasActiveGroups :one
 -- Checks if user is in any groups that haven't expired yet
@@ -14,6 +14,19 @@ ON CONFLICT (user_id, device_identifier) DO UPDATE SET
     last_seen_at = now()
 RETURNING *;
 
+-- name: InsertDeviceKey :execrows
+-- Adds a device without touching an existing one; 0 rows means it is already registered.
+INSERT INTO device_keys (
+    user_id,
+    device_identifier,
+    public_key,
+    signing_public_key,
+    last_seen_at
+) VALUES (
+    $1, $2, $3, $4, now()
+)
+ON CONFLICT (user_id, device_identifier) DO NOTHING;
+
 -- name: GetDeviceKeyByIdentifier :one
 SELECT * FROM device_keys
 WHERE user_id = $1 AND device_identifier = $2
@@ -53,4 +66,24 @@ SELECT user_id, device_identifier, expo_push_token
 FROM device_keys
 WHERE user_id = ANY($1::uuid[])
   AND expo_push_token IS NOT NULL
-  AND notifications_enabled = true;
+  AND notifications_enabled = true
+  AND NOT EXISTS (
+    SELECT 1 FROM users u WHERE u.id = device_keys.user_id AND u.deactivated_at IS NOT NULL
+  );
+
+-- name: RotateDeviceKey :one
+UPDATE device_keys
+SET public_key = $3,
+    signing_public_key = $4,
+    last_seen_at = now()
+WHERE user_id = $1 AND device_identifier = $2
+RETURNING *;
+
+-- name: GetDeviceIdentifiersForGroup :many
+SELECT dk.device_identifier
+FROM device_keys dk
+JOIN user_groups ug ON ug.user_id = dk.user_id
+JOIN groups g ON g.id = ug.group_id
+WHERE ug.group_id = $1
+  AND ug.deleted_at IS NULL
+  AND g.deleted_at IS NULL;
@@ -2,10 +2,10 @@
 SELECT "id", "name", "description", "location", "image_url", "blurhash", "start_time", "end_time", "created_at", "updated_at" FROM groups WHERE deleted_at IS NULL;
 
 -- name: GetGroupById :one
-SELECT "id", "name", "description", "location", "image_url", "blurhash", "start_time", "end_time", "created_at", "updated_at" FROM groups WHERE id = $1 AND deleted_at IS NULL;
+SELECT "id", "name", "description", "location", "image_url", "blurhash", "start_time", "end_time", "created_at", "updated_at", "requires_approval", "announcement_only" FROM groups WHERE id = $1 AND deleted_at IS NULL;
 
 -- name: GetGroupsForUser :many
-SELECT groups.id, groups.name, groups."description", groups."location", groups."image_url", groups."blurhash", groups.start_time, groups.end_time, groups.created_at, ug.admin, ug.muted, groups.updated_at,
+SELECT groups.id, groups.name, groups."description", groups."location", groups."image_url", groups."blurhash", groups.start_time, groups.end_time, groups.created_at, ug.admin, ug.muted, groups.updated_at, groups.announcement_only,
 json_agg(jsonb_build_object('id', u2.id, 'username', u2.username, 'email', u2.email, 'admin', ug2.admin, 'invited_at', ug2.created_at)) AS group_users
 FROM groups
 JOIN user_groups ug ON ug.group_id = groups.id
@@ -13,7 +13,6 @@ JOIN users u ON u.id = ug.user_id
 JOIN user_groups ug2 ON ug2.group_id = groups.id
 JOIN users u2 ON u2.id = ug2.user_id
 WHERE u.id = $1 AND groups.deleted_at IS NULL AND ug.deleted_at IS NULL AND ug2.deleted_at IS NULL
-  AND (groups.end_time IS NULL OR groups.end_time > NOW())
 GROUP BY groups.id, ug.id, u.id;
 
 -- name: GetGroupWithUsersByID :one
@@ -28,6 +27,7 @@ SELECT
     g.end_time,
     g.created_at,
     g.updated_at,
+    g.announcement_only,
     (SELECT ug_check.admin FROM user_groups ug_check WHERE ug_check.group_id = g.id AND ug_check.user_id = sqlc.arg('requesting_user_id') AND ug_check.deleted_at IS NULL) AS admin, -- Admin status of the requesting user for THIS group
     COALESCE(
         (SELECT json_agg(jsonb_build_object('id', u.id, 'username', u.username, 'email', u.email, 'admin', ug.admin, 'invited_at', ug.created_at))
@@ -42,9 +42,11 @@ WHERE
     g.id = sqlc.arg('group_id') AND g.deleted_at IS NULL;
 
 -- name: InsertGroup :one
-INSERT INTO groups ("id", "name", "start_time", "end_time", "description", "location", "image_url", "blurhash") VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING *;
+INSERT INTO groups ("id", "name", "start_time", "end_time", "description", "location", "image_url", "blurhash", "requires_approval") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING *;
 
 -- name: UpdateGroup :one
+-- A new image_url without a blurhash clears the old image's blurhash, so clients don't
+-- show the previous image's placeholder until the server computes the new one.
 UPDATE groups
 SET
     "name" = coalesce(sqlc.narg('name'), "name"),
@@ -53,10 +55,60 @@ SET
     "description" = coalesce(sqlc.narg('description'), "description"),
     "location" = coalesce(sqlc.narg('location'), "location"),
     "image_url" = coalesce(sqlc.narg('image_url'), "image_url"),
-    "blurhash" = coalesce(sqlc.narg('blurhash'), "blurhash")
+    "blurhash" = CASE
+        WHEN sqlc.narg('blurhash')::text IS NOT NULL THEN sqlc.narg('blurhash')::text
+        WHEN sqlc.narg('image_url')::text IS DISTINCT FROM "image_url" AND sqlc.narg('image_url')::text IS NOT NULL THEN NULL
+        ELSE "blurhash"
+    END,
+    "requires_approval" = coalesce(sqlc.narg('requires_approval'), "requires_approval"),
+    "announcement_only" = coalesce(sqlc.narg('announcement_only'), "announcement_only"),
+    "updated_at" = NOW()
 WHERE id = $1 AND deleted_at IS NULL
 RETURNING "id", "name", "start_time", "end_time", "description", "location", "image_url", "blurhash", "created_at", "updated_at";
 
+-- name: SetGroupBlurhashForImage :execrows
+-- Only applies while the group still shows image_url, so a hash computed for an image
+-- that has since been replaced is dropped.
+UPDATE groups SET blurhash = $3, updated_at = NOW()
+WHERE id = $1 AND image_url = $2 AND deleted_at IS NULL;
+
+-- name: LockGroupImage :one
+-- The group's current image, locked so image changes replace it one at a time.
+-- attachment_key reports whether an attachment also points at that key.
+SELECT g.image_url, EXISTS (SELECT 1 FROM attachments a WHERE a.s3_key = g.image_url) AS attachment_key
+FROM groups g
+WHERE g.id = $1 AND g.deleted_at IS NULL
+FOR UPDATE OF g;
+
+-- name: SetGroupImage :execrows
+UPDATE groups SET image_url = $2, blurhash = $3, updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
 -- name: DeleteGroup :one
 UPDATE groups SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL
 RETURNING "id", "name", "created_at", "updated_at";
+
+-- name: GetGroupChangeTimesForUser :many
+-- When each of the user's current groups last changed in a way GetGroupsForUser
+-- reflects: the group row itself or any membership (joins, leaves, role and mute changes).
+SELECT
+    g.id,
+    GREATEST(
+        g.updated_at,
+        MAX(GREATEST(ug2.created_at, ug2.updated_at, ug2.deleted_at))
+    )::timestamp AS changed_at
+FROM groups g
+JOIN user_groups ug ON ug.group_id = g.id
+JOIN user_groups ug2 ON ug2.group_id = g.id
+WHERE ug.user_id = $1 AND ug.deleted_at IS NULL AND g.deleted_at IS NULL
+GROUP BY g.id;
+
+-- name: GetGroupStats :one
+-- Message, attachment and member totals for a group, for admins sizing it up. Every
+-- figure comes from an index on group_id.
+SELECT
+    (SELECT COUNT(*) FROM messages m WHERE m.group_id = sqlc.arg('group_id')::uuid) AS message_count,
+    (SELECT COUNT(*) FROM messages m WHERE m.group_id = sqlc.arg('group_id')::uuid AND m.created_at > NOW() - INTERVAL '24 hours') AS messages_last_24h,
+    (SELECT COUNT(*) FROM attachments a WHERE a.group_id = sqlc.arg('group_id')::uuid) AS attachment_count,
+    (SELECT COALESCE(SUM(a.size), 0) FROM attachments a WHERE a.group_id = sqlc.arg('group_id')::uuid)::bigint AS attachment_bytes,
+    (SELECT COUNT(*) FROM user_groups ug WHERE ug.group_id = sqlc.arg('group_id')::uuid AND ug.deleted_at IS NULL) AS member_count;
@@ -5,6 +5,7 @@ INSERT INTO group_reservations (
 ) VALUES (
     $1, $2
 )
+ON CONFLICT (group_id) DO NOTHING
 RETURNING *;
 
 -- name: GetGroupReservation :one
@@ -12,6 +13,11 @@ SELECT * FROM group_reservations
 WHERE group_id = $1
 LIMIT 1;
 
+-- name: GetGroupReservationForUpdate :one
+SELECT * FROM group_reservations
+WHERE group_id = $1
+FOR UPDATE;
+
 -- name: GetGroupReservationsForUser :many
 SELECT * FROM group_reservations
 WHERE user_id = $1
@@ -25,3 +31,14 @@ WHERE group_id = $1;
 DELETE FROM group_reservations
 WHERE user_id = $1;
 
+
+-- name: ReleaseGroupReservation :execrows
+DELETE FROM group_reservations
+WHERE group_id = $1 AND user_id = $2;
+
+-- name: TransferGroupReservation :execrows
+-- Hands the reservation over only while from_user_id still holds it. created_at is
+-- kept, so passing a reservation around doesn't extend it past the stale window.
+UPDATE group_reservations
+SET user_id = sqlc.arg('to_user_id')
+WHERE group_id = sqlc.arg('group_id') AND user_id = sqlc.arg('from_user_id');
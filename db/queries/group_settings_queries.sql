@@ -0,0 +1,26 @@
+-- name: GetGroupSettings :one
+SELECT settings FROM group_settings WHERE group_id = $1;
+
+-- name: UpsertGroupSettings :exec
+INSERT INTO group_settings (group_id, settings, updated_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (group_id) DO UPDATE SET settings = EXCLUDED.settings, updated_at = NOW();
+
+-- name: GetGroupTags :many
+SELECT tag FROM group_tags WHERE group_id = $1 ORDER BY tag;
+
+-- name: GetGroupTagsForUser :many
+-- Tags of every group the user is a current member of.
+SELECT gt.group_id, gt.tag
+FROM group_tags gt
+JOIN user_groups ug ON ug.group_id = gt.group_id
+WHERE ug.user_id = $1 AND ug.deleted_at IS NULL
+ORDER BY gt.group_id, gt.tag;
+
+-- name: DeleteGroupTags :exec
+DELETE FROM group_tags WHERE group_id = $1;
+
+-- name: InsertGroupTags :exec
+INSERT INTO group_tags (group_id, tag)
+SELECT sqlc.arg('group_id'), unnest(sqlc.arg('tags')::text[])
+ON CONFLICT DO NOTHING;
@@ -27,6 +27,32 @@ SELECT
     g.blurhash,
     g.start_time,
     g.end_time,
+    g.requires_approval,
     (SELECT COUNT(*) FROM user_groups ug WHERE ug.group_id = g.id AND ug.deleted_at IS NULL)::int AS member_count
 FROM groups g
 WHERE g.id = $1 AND g.deleted_at IS NULL;
+
+-- name: RecordInviteJoin :exec
+INSERT INTO invite_joins (invite_id, user_id) VALUES ($1, $2);
+
+-- name: GetRecentInviteJoinsForGroup :many
+-- The most recent joins_per_invite joins through each of the group's invites.
+SELECT invite_id, user_id, username, joined_at
+FROM (
+    SELECT ij.invite_id, ij.user_id, u.username, ij.joined_at,
+        ROW_NUMBER() OVER (PARTITION BY ij.invite_id ORDER BY ij.joined_at DESC) AS rn
+    FROM invite_joins ij
+    JOIN invites i ON i.id = ij.invite_id
+    JOIN users u ON u.id = ij.user_id
+    WHERE i.group_id = sqlc.arg('group_id')
+) recent
+WHERE rn <= sqlc.arg('joins_per_invite')::int
+ORDER BY invite_id, joined_at DESC;
+
+-- name: CapInviteExpiries :execrows
+-- Pulls in invites that would outlive the group's new end time, so expires_at never
+-- passes end_time after an end time is shortened.
+UPDATE invites
+SET expires_at = sqlc.arg('end_time')
+WHERE group_id = sqlc.arg('group_id')
+  AND (expires_at IS NULL OR expires_at > sqlc.arg('end_time'));
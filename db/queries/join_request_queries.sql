@@ -0,0 +1,18 @@
+-- name: InsertJoinRequest :one
+INSERT INTO join_requests (group_id, user_id)
+VALUES ($1, $2)
+ON CONFLICT (group_id, user_id) WHERE status = 'pending' DO NOTHING
+RETURNING *;
+
+-- name: GetPendingJoinRequestsForGroup :many
+SELECT jr.id, jr.user_id, u.username, jr.created_at
+FROM join_requests jr
+JOIN users u ON u.id = jr.user_id
+WHERE jr.group_id = $1 AND jr.status = 'pending'
+ORDER BY jr.created_at ASC;
+
+-- name: DecideJoinRequest :one
+UPDATE join_requests
+SET status = sqlc.arg('status'), decided_by = sqlc.arg('decided_by'), decided_at = NOW()
+WHERE group_id = sqlc.arg('group_id') AND user_id = sqlc.arg('user_id') AND status = 'pending'
+RETURNING *;
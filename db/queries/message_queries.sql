@@ -8,10 +8,16 @@ INSERT INTO messages (
     msg_nonce,
     key_envelopes,
     sender_device_identifier,
-    signature
+    signature,
+    forwarded_from_message_id,
+    forwarded_from_group_id,
+    forwarded_from_sender_id,
+    expires_at
 ) VALUES (
-    $1, $2, $3, $4, $5, $6, $7, $8, $9
-) RETURNING id, user_id, group_id, created_at, updated_at, ciphertext, message_type, msg_nonce, key_envelopes, sender_device_identifier, signature;
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
+)
+ON CONFLICT (id) DO NOTHING
+RETURNING id, user_id, group_id, created_at, updated_at, ciphertext, message_type, msg_nonce, key_envelopes, sender_device_identifier, signature;
 
 -- name: GetMessageById :one
 SELECT
@@ -48,6 +54,10 @@ JOIN users u ON m.user_id = u.id
 WHERE m.group_id = $1;
 
 -- name: GetRelevantMessages :many
+-- With a device_identifier, messages created more than replay_margin before that
+-- device's reported delivery position in each group are left out. created_at is when
+-- the inserting transaction started, so a message committed after the device's report
+-- can sort before it; the margin must cover the longest a message save can take.
 SELECT
     m.id,
     m.group_id,
@@ -59,17 +69,28 @@ SELECT
     m.msg_nonce,
     m.key_envelopes,
     m.sender_device_identifier,
-    m.signature
+    m.signature,
+    m.forwarded_from_message_id,
+    m.forwarded_from_group_id,
+    m.forwarded_from_sender_id,
+    m.expires_at
 FROM messages m
 JOIN user_groups ug ON ug.group_id = m.group_id
 JOIN users u_member ON ug.user_id = u_member.id 
-JOIN users u_sender ON m.user_id = u_sender.id
+LEFT JOIN users u_sender ON m.user_id = u_sender.id
 JOIN groups g ON m.group_id = g.id
-WHERE u_member.id = $1
+WHERE u_member.id = sqlc.arg('user_id')
 AND m.created_at > ug.created_at
 AND ug.deleted_at IS NULL
 AND g.deleted_at IS NULL
-AND (g.end_time IS NULL OR g.end_time > NOW())
+AND (m.expires_at IS NULL OR m.expires_at > NOW())
+AND NOT EXISTS (
+    SELECT 1 FROM device_group_deliveries dgd
+    WHERE dgd.user_id = ug.user_id
+      AND dgd.group_id = m.group_id
+      AND dgd.device_identifier = sqlc.narg('device_identifier')
+      AND m.created_at < dgd.delivered_at - sqlc.arg('replay_margin')::interval
+)
 ;
 
 -- name: DeleteMessage :one
@@ -97,3 +118,125 @@ SELECT
 FROM messages
 ORDER BY created_at DESC;
 
+-- name: GetMessagesSentByUserPage :many
+SELECT id, group_id, created_at, message_type, msg_nonce, ciphertext, sender_device_identifier, key_envelopes, signature
+FROM messages
+WHERE user_id = sqlc.arg('user_id')
+  AND (created_at, id) > (sqlc.arg('after_created_at')::timestamp, sqlc.arg('after_id')::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('page_size');
+
+-- name: InsertMessageMentions :exec
+INSERT INTO message_mentions (message_id, user_id, group_id)
+SELECT sqlc.arg('message_id')::uuid, unnest(sqlc.arg('user_ids')::UUID[]), sqlc.arg('group_id')::uuid
+ON CONFLICT DO NOTHING;
+
+-- name: GetForwardableMessage :one
+SELECT m.id, m.group_id, m.user_id, m.message_type
+FROM messages m
+JOIN user_groups ug ON ug.group_id = m.group_id
+JOIN groups g ON g.id = m.group_id
+WHERE m.id = sqlc.arg('message_id')
+  AND ug.user_id = sqlc.arg('user_id')
+  AND m.created_at > ug.created_at
+  AND ug.deleted_at IS NULL
+  AND g.deleted_at IS NULL
+  AND (m.expires_at IS NULL OR m.expires_at > NOW());
+
+-- name: DeleteExpiredMessages :many
+-- Deletes up to page_size messages whose sender-set expiry has passed.
+DELETE FROM messages
+WHERE id IN (
+    SELECT id FROM messages
+    WHERE expires_at <= NOW()
+    ORDER BY expires_at
+    LIMIT sqlc.arg('page_size')
+)
+RETURNING id, group_id;
+
+-- name: DeleteMessagesCreatedBefore :many
+-- Deletes up to page_size messages older than cutoff in live groups. Ended and
+-- soft-deleted groups are left to cleanup_expired_groups, which removes all their data.
+DELETE FROM messages
+WHERE id IN (
+    SELECT m.id FROM messages m
+    JOIN groups g ON g.id = m.group_id
+    WHERE m.created_at < sqlc.arg('cutoff')
+      AND g.deleted_at IS NULL
+      AND (g.end_time IS NULL OR g.end_time >= NOW())
+    ORDER BY m.created_at
+    LIMIT sqlc.arg('page_size')
+)
+RETURNING id, group_id;
+
+-- name: GetGroupActivityForUser :many
+-- Metadata about the latest visible message in each of the user's groups (content is
+-- E2EE) and how many messages from others arrived since they last marked the group
+-- read, or since they joined. Control messages are not counted.
+SELECT
+    ug.group_id,
+    last_msg.created_at AS last_message_at,
+    last_msg.user_id AS last_sender_id,
+    last_msg.username AS last_sender_username,
+    last_msg.message_type AS last_message_type,
+    (
+        SELECT COUNT(*)
+        FROM messages unread
+        WHERE unread.group_id = ug.group_id
+        AND unread.created_at > COALESCE(ug.last_read_at, ug.created_at)
+        AND unread.user_id IS DISTINCT FROM ug.user_id
+        AND unread.message_type <> 'control'
+        AND (unread.expires_at IS NULL OR unread.expires_at > NOW())
+    ) AS unread_count
+FROM user_groups ug
+LEFT JOIN LATERAL (
+    SELECT m.created_at, m.user_id, u.username, m.message_type
+    FROM messages m
+    LEFT JOIN users u ON u.id = m.user_id
+    WHERE m.group_id = ug.group_id
+    AND m.created_at > ug.created_at
+    AND m.message_type <> 'control'
+    AND (m.expires_at IS NULL OR m.expires_at > NOW())
+    ORDER BY m.created_at DESC
+    LIMIT 1
+) last_msg ON true
+WHERE ug.user_id = $1 AND ug.deleted_at IS NULL;
+
+-- name: InsertMessageEdit :exec
+-- Copies the message's current version into message_edits. Call it in the same
+-- transaction as the update that replaces the version.
+INSERT INTO message_edits (message_id, ciphertext, msg_nonce, key_envelopes, sender_device_identifier, signature)
+SELECT id, ciphertext, msg_nonce, key_envelopes, sender_device_identifier, signature
+FROM messages
+WHERE id = $1;
+
+-- name: PruneMessageEdits :exec
+-- Keeps only the newest keep versions of a message.
+DELETE FROM message_edits
+WHERE message_id = sqlc.arg('message_id')
+  AND id NOT IN (
+    SELECT id FROM message_edits
+    WHERE message_id = sqlc.arg('message_id')
+    ORDER BY created_at DESC
+    LIMIT sqlc.arg('keep')
+  );
+
+-- name: GetMessageEditHistory :many
+SELECT id, ciphertext, msg_nonce, key_envelopes, sender_device_identifier, signature, created_at
+FROM message_edits
+WHERE message_id = sqlc.arg('message_id')
+ORDER BY created_at DESC
+LIMIT sqlc.arg('page_size');
+
+-- name: UpdateMessageVersion :one
+-- Replaces the content of one of user_id's messages with a new version. Copy the
+-- current version with InsertMessageEdit first, in the same transaction.
+UPDATE messages
+SET ciphertext = sqlc.arg('ciphertext'),
+    msg_nonce = sqlc.arg('msg_nonce'),
+    key_envelopes = sqlc.arg('key_envelopes'),
+    sender_device_identifier = sqlc.arg('sender_device_identifier'),
+    signature = sqlc.arg('signature'),
+    updated_at = NOW()
+WHERE id = sqlc.arg('id') AND user_id = sqlc.arg('user_id')
+RETURNING updated_at;
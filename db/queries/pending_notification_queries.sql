@@ -0,0 +1,33 @@
+-- name: InsertPendingNotification :exec
+INSERT INTO pending_notifications (user_id, group_id, device_identifier, title, body, data, attempts, next_attempt_at, sound, channel_id, priority)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);
+
+-- name: GetDuePendingNotifications :many
+-- Resolves each push to its device's current token. The token is NULL when the device
+-- is gone, has cleared its token or turned notifications off, its user is deactivated,
+-- or its user has left the group since, e.g. because a member blocked them.
+SELECT pn.id, pn.user_id, pn.device_identifier, pn.title, pn.body, pn.data, pn.attempts,
+       pn.sound, pn.channel_id, pn.priority, dk.expo_push_token
+FROM pending_notifications pn
+LEFT JOIN device_keys dk
+  ON dk.user_id = pn.user_id
+ AND dk.device_identifier = pn.device_identifier
+ AND dk.notifications_enabled = true
+ AND NOT EXISTS (
+   SELECT 1 FROM users u WHERE u.id = pn.user_id AND u.deactivated_at IS NOT NULL
+ )
+ AND (pn.group_id IS NULL OR EXISTS (
+   SELECT 1 FROM user_groups ug
+   WHERE ug.user_id = pn.user_id AND ug.group_id = pn.group_id AND ug.deleted_at IS NULL
+ ))
+WHERE pn.next_attempt_at <= now()
+ORDER BY pn.next_attempt_at
+LIMIT $1;
+
+-- name: ReschedulePendingNotification :exec
+UPDATE pending_notifications
+SET attempts = attempts + 1, next_attempt_at = $2
+WHERE id = $1;
+
+-- name: DeletePendingNotifications :exec
+DELETE FROM pending_notifications WHERE id = ANY($1::uuid[]);
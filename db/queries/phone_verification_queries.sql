@@ -0,0 +1,21 @@
+-- name: UpsertPhoneVerification :exec
+INSERT INTO phone_verifications (user_id, phone, code_hash, expires_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id) DO UPDATE
+SET phone = EXCLUDED.phone,
+    code_hash = EXCLUDED.code_hash,
+    expires_at = EXCLUDED.expires_at,
+    attempts = 0,
+    created_at = NOW();
+
+-- name: GetPhoneVerification :one
+SELECT * FROM phone_verifications WHERE user_id = $1;
+
+-- name: ConsumePhoneVerificationAttempt :one
+-- Counts a guess before it is checked; no row means the attempts are used up.
+UPDATE phone_verifications SET attempts = attempts + 1
+WHERE user_id = $1 AND attempts < $2
+RETURNING attempts;
+
+-- name: DeletePhoneVerification :exec
+DELETE FROM phone_verifications WHERE user_id = $1;
@@ -18,3 +18,59 @@ WHERE expo_push_token = $1;
 
 -- name: DeleteOldReceipts :exec
 DELETE FROM push_receipts WHERE created_at < now() - interval '24 hours';
+
+-- name: DeleteReceiptsForUser :exec
+DELETE FROM push_receipts
+WHERE push_token IN (
+    SELECT expo_push_token FROM device_keys
+    WHERE user_id = $1 AND expo_push_token IS NOT NULL
+);
+
+-- name: DeletePushTokenFailuresForUser :exec
+DELETE FROM push_token_failures
+WHERE push_token IN (
+    SELECT expo_push_token FROM device_keys
+    WHERE user_id = $1 AND expo_push_token IS NOT NULL
+);
+
+-- name: RecordPushTokenFailure :exec
+INSERT INTO push_token_failures (push_token, last_error)
+VALUES ($1, $2)
+ON CONFLICT (push_token) DO UPDATE
+SET failure_count = push_token_failures.failure_count + 1,
+    last_error = EXCLUDED.last_error,
+    last_failed_at = NOW();
+
+-- name: ClearPushTokenFailures :exec
+DELETE FROM push_token_failures WHERE push_token = ANY(sqlc.arg('push_tokens')::text[]);
+
+-- name: GetFailingPushTokens :many
+SELECT push_token FROM push_token_failures
+WHERE failure_count >= sqlc.arg('min_failures')::int
+ORDER BY push_token
+LIMIT sqlc.arg('batch_size');
+
+-- name: DeletePushTokensByValue :exec
+-- The batch form of DeletePushTokenByValue.
+UPDATE device_keys SET expo_push_token = NULL
+WHERE expo_push_token = ANY(sqlc.arg('push_tokens')::text[]);
+
+-- name: DeleteStalePushTokenFailures :execrows
+-- Failure rows for tokens no device holds any more (usually cleared by the
+-- DeviceNotRegistered path) or that haven't failed in 30 days.
+DELETE FROM push_token_failures
+WHERE push_token IN (
+    SELECT f.push_token FROM push_token_failures f
+    WHERE f.last_failed_at < NOW() - INTERVAL '30 days'
+       OR NOT EXISTS (SELECT 1 FROM device_keys dk WHERE dk.expo_push_token = f.push_token)
+    LIMIT sqlc.arg('batch_size')
+);
+
+-- name: DeleteOrphanedReceipts :execrows
+-- Pending receipts for tokens no device holds any more; checking them can't change anything.
+DELETE FROM push_receipts
+WHERE id IN (
+    SELECT r.id FROM push_receipts r
+    WHERE NOT EXISTS (SELECT 1 FROM device_keys dk WHERE dk.expo_push_token = r.push_token)
+    LIMIT sqlc.arg('batch_size')
+);
@@ -0,0 +1,13 @@
+-- name: AdvanceSenderSequence :execrows
+-- Records seq unless it is not above the device's last one or is more than max_gap
+-- ahead of it. The first seq from a device in a group is always accepted.
+INSERT INTO sender_sequences (user_id, device_identifier, group_id, last_seq)
+VALUES (sqlc.arg('user_id'), sqlc.arg('device_identifier'), sqlc.arg('group_id'), sqlc.arg('seq'))
+ON CONFLICT (user_id, device_identifier, group_id) DO UPDATE
+SET last_seq = EXCLUDED.last_seq, updated_at = NOW()
+WHERE sender_sequences.last_seq < EXCLUDED.last_seq
+  AND EXCLUDED.last_seq <= sender_sequences.last_seq + sqlc.arg('max_gap')::bigint;
+
+-- name: GetSenderSequence :one
+SELECT last_seq FROM sender_sequences
+WHERE user_id = $1 AND device_identifier = $2 AND group_id = $3;
@@ -15,15 +15,16 @@ SELECT "id", "user_id", "group_id", "admin", "muted", "created_at", "updated_at"
 
 -- name: InsertUserGroup :one
 INSERT INTO user_groups
-    ("user_id", "group_id", "admin")
-VALUES ($1, $2, $3)
+    ("user_id", "group_id", "admin", "muted")
+VALUES ($1, $2, $3, $4)
 ON CONFLICT (user_id, group_id) WHERE deleted_at IS NULL DO NOTHING
 RETURNING *;
 
 -- name: UpdateUserGroup :one
 UPDATE user_groups
 SET
-    "admin" = $3
+    "admin" = $3,
+    "updated_at" = NOW()
 WHERE user_id = $1 AND group_id = $2 AND deleted_at IS NULL
 RETURNING "id", "user_id", "group_id", "admin", "muted", "created_at", "updated_at";
 
@@ -34,9 +35,75 @@ RETURNING "id", "user_id", "group_id", "admin", "muted", "created_at", "updated_
 
 -- name: ToggleGroupMuted :one
 UPDATE user_groups
-SET muted = NOT muted
+SET muted = NOT muted, updated_at = NOW()
 WHERE user_id = $1 AND group_id = $2 AND deleted_at IS NULL
 RETURNING "id", "user_id", "group_id", "admin", "muted", "created_at", "updated_at";
 
 -- name: GetMutedUserIDsForGroup :many
 SELECT user_id FROM user_groups WHERE group_id = $1 AND muted = true AND deleted_at IS NULL;
+
+-- name: DeleteAllUserGroupsForUser :exec
+DELETE FROM user_groups WHERE user_id = $1;
+
+-- name: GetGroupMembershipsForUser :many
+SELECT ug.group_id, g.name, ug.admin, ug.muted, ug.created_at AS joined_at
+FROM user_groups ug
+JOIN groups g ON g.id = ug.group_id
+WHERE ug.user_id = $1 AND ug.deleted_at IS NULL AND g.deleted_at IS NULL
+ORDER BY ug.created_at ASC;
+
+-- name: GetCoMemberIDs :many
+SELECT DISTINCT other.user_id
+FROM user_groups mine
+JOIN user_groups other ON other.group_id = mine.group_id
+JOIN groups g ON g.id = mine.group_id
+WHERE mine.user_id = $1 AND other.user_id <> $1
+  AND mine.deleted_at IS NULL AND other.deleted_at IS NULL
+  AND g.deleted_at IS NULL;
+
+-- name: GetPostingPermission :one
+SELECT ug.admin, g.announcement_only, g.end_time
+FROM user_groups ug
+JOIN groups g ON g.id = ug.group_id
+WHERE ug.user_id = $1 AND ug.group_id = $2 AND ug.deleted_at IS NULL AND g.deleted_at IS NULL;
+
+-- name: GetGroupMemberIDsAmong :many
+SELECT user_id FROM user_groups
+WHERE group_id = sqlc.arg('group_id') AND user_id = ANY(sqlc.arg('user_ids')::UUID[]) AND deleted_at IS NULL;
+
+-- name: MarkGroupRead :execrows
+-- Never moves last_read_at backwards, so it stays the furthest any device has read.
+UPDATE user_groups SET last_read_at = GREATEST(last_read_at, sqlc.arg('read_at')::timestamp)
+WHERE user_id = sqlc.arg('user_id') AND group_id = sqlc.arg('group_id') AND deleted_at IS NULL;
+
+-- name: MarkDeviceGroupRead :exec
+INSERT INTO device_group_reads (user_id, device_identifier, group_id, last_read_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, device_identifier, group_id) DO UPDATE
+SET last_read_at = GREATEST(device_group_reads.last_read_at, EXCLUDED.last_read_at);
+
+-- name: GetDeviceReadStateForUser :many
+SELECT ug.group_id, ug.last_read_at, dgr.last_read_at AS device_last_read_at
+FROM user_groups ug
+JOIN groups g ON g.id = ug.group_id
+LEFT JOIN device_group_reads dgr
+    ON dgr.user_id = ug.user_id AND dgr.group_id = ug.group_id AND dgr.device_identifier = sqlc.arg('device_identifier')
+WHERE ug.user_id = sqlc.arg('user_id') AND ug.deleted_at IS NULL AND g.deleted_at IS NULL;
+
+-- name: AdvanceDeviceGroupDelivery :execrows
+-- Records the device's newest delivered message in the group unless it already
+-- reported a later one. Re-reporting the same message counts as a success.
+INSERT INTO device_group_deliveries (user_id, device_identifier, group_id, message_id, delivered_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (user_id, device_identifier, group_id) DO UPDATE
+SET message_id = EXCLUDED.message_id, delivered_at = EXCLUDED.delivered_at, updated_at = NOW()
+WHERE (device_group_deliveries.delivered_at, device_group_deliveries.message_id)
+   <= (EXCLUDED.delivered_at, EXCLUDED.message_id);
+
+-- name: GetDeviceGroupDelivery :one
+SELECT message_id, delivered_at FROM device_group_deliveries
+WHERE user_id = $1 AND device_identifier = $2 AND group_id = $3;
+
+-- name: CountGroupMembers :one
+SELECT COUNT(*) FROM user_groups
+WHERE group_id = $1 AND deleted_at IS NULL;
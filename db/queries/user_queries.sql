@@ -2,7 +2,7 @@
 SELECT "id", "username", "email", "created_at", "updated_at" FROM users;
 
 -- name: GetUserById :one
-SELECT "id", "username", "email", "created_at", "updated_at" FROM users WHERE id = $1;
+SELECT "id", "username", "email", "created_at", "updated_at" FROM users WHERE id = $1 AND deactivated_at IS NULL;
 
 -- name: GetUserByUsername :one
 SELECT "id", "username", "email", "created_at", "updated_at" FROM users WHERE username = $1;
@@ -18,7 +18,8 @@ JOIN groups ON groups.id = user_groups.group_id
 WHERE groups.id = $1;
 
 -- name: GetUsersByEmails :many
-SELECT id, username, email, created_at, updated_at FROM users WHERE email = ANY(sqlc.arg('emails')::text[]);
+SELECT id, username, email, created_at, updated_at FROM users
+WHERE deactivated_at IS NULL AND LOWER(email) = ANY(sqlc.arg('emails')::text[]);
 
 -- name: GetUsersByIDs :many
 SELECT id, username, email, created_at, updated_at FROM users WHERE id = ANY(sqlc.arg('ids')::UUID[]);
@@ -56,8 +57,30 @@ WITH s AS (
 SELECT u.id, u.username, u.email, u.created_at, jsonb_object_agg(ug.group_id, ug.admin)::text AS group_admin_map FROM users u 
 JOIN user_groups ug ON ug.user_id = u.id
 JOIN s ON s.id = group_id
+WHERE u.deactivated_at IS NULL
 GROUP BY u.id;
 
+-- name: SearchRelevantUsers :many
+SELECT u.id, u.username, u.email, u.created_at
+FROM users u
+WHERE u.deactivated_at IS NULL
+  AND u.id <> sqlc.arg('user_id')
+  AND EXISTS (
+    SELECT 1 FROM user_groups mine
+    JOIN user_groups theirs ON theirs.group_id = mine.group_id
+    WHERE mine.user_id = sqlc.arg('user_id') AND theirs.user_id = u.id
+      AND mine.deleted_at IS NULL AND theirs.deleted_at IS NULL
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM blocked_users bu
+    WHERE (bu.blocker_id = sqlc.arg('user_id') AND bu.blocked_id = u.id)
+       OR (bu.blocker_id = u.id AND bu.blocked_id = sqlc.arg('user_id'))
+  )
+  AND (u.username ILIKE sqlc.arg('pattern') OR u.email ILIKE sqlc.arg('pattern'))
+  AND (u.username, u.id) > (sqlc.arg('after_username')::text, sqlc.arg('after_id')::uuid)
+ORDER BY u.username, u.id
+LIMIT sqlc.arg('page_size');
+
 -- name: GetRelevantUserDeviceKeys :many
 WITH user_target_groups AS (
     SELECT ug.group_id
@@ -91,3 +114,108 @@ GROUP BY
     ru.user_id
 HAVING
     count(dk.id) > 0; 
+
+-- name: GetCoMemberDeviceKeys :many
+-- Device keys for the requested users that share at least one group with the
+-- caller (or are the caller). Other IDs are silently dropped.
+SELECT
+    dk.user_id,
+    jsonb_agg(
+        jsonb_build_object(
+            'device_identifier', dk.device_identifier,
+            'public_key', encode(dk.public_key, 'base64'),
+            'signing_public_key', encode(dk.signing_public_key, 'base64')
+        ) ORDER BY dk.created_at DESC
+    ) AS device_keys
+FROM device_keys dk
+WHERE dk.user_id = ANY(sqlc.arg('user_ids')::uuid[])
+  AND (
+    dk.user_id = sqlc.arg('caller_id')::uuid
+    OR EXISTS (
+        SELECT 1 FROM user_groups mine
+        JOIN user_groups theirs ON theirs.group_id = mine.group_id
+        JOIN groups g ON g.id = mine.group_id
+        WHERE mine.user_id = sqlc.arg('caller_id')::uuid AND theirs.user_id = dk.user_id
+          AND mine.deleted_at IS NULL AND theirs.deleted_at IS NULL
+          AND g.deleted_at IS NULL
+    )
+  )
+GROUP BY dk.user_id;
+
+-- name: RehashUserPassword :exec
+-- Only replaces the hash the caller verified against, so a concurrent password change wins.
+UPDATE users SET password = sqlc.arg('new_password')
+WHERE id = sqlc.arg('id') AND password = sqlc.arg('old_password');
+
+-- name: GetUsersByPhones :many
+-- Contact discovery only: deactivated accounts are hidden. Use GetVerifiedPhoneOwner to
+-- check who holds a number.
+SELECT id, username, email, phone, created_at, updated_at FROM users
+WHERE phone_verified_at IS NOT NULL AND deactivated_at IS NULL AND phone = ANY(sqlc.arg('phones')::text[]);
+
+-- name: GetVerifiedPhoneOwner :one
+-- Unlike GetUsersByPhones it includes deactivated accounts, whose number still holds
+-- unique_verified_phone until they are purged.
+SELECT id FROM users WHERE phone_verified_at IS NOT NULL AND phone = $1;
+
+-- name: SetVerifiedPhone :exec
+UPDATE users SET phone = $2, phone_verified_at = NOW() WHERE id = $1;
+
+-- name: SetUserEmail :exec
+UPDATE users SET email = $2, updated_at = NOW() WHERE id = $1;
+
+-- name: ClearUserPhone :exec
+UPDATE users SET phone = NULL, phone_verified_at = NULL WHERE id = $1;
+
+-- name: SetNotificationPreviewMode :exec
+UPDATE users SET notification_preview_mode = $2 WHERE id = $1;
+
+-- name: GetNotificationPrefs :many
+SELECT id, notification_preview_mode, silent_push, snooze_until, reaction_push FROM users
+WHERE id = ANY(sqlc.arg('user_ids')::uuid[]);
+
+-- name: SetReactionPush :exec
+UPDATE users SET reaction_push = $2 WHERE id = $1;
+
+-- name: SetSilentPush :exec
+UPDATE users SET silent_push = $2 WHERE id = $1;
+
+-- name: SetSnoozeUntil :exec
+UPDATE users SET snooze_until = $2 WHERE id = $1;
+
+-- name: DeactivateUser :exec
+UPDATE users SET deactivated_at = NOW() WHERE id = $1 AND deactivated_at IS NULL;
+
+-- name: ReactivateUser :execrows
+UPDATE users SET deactivated_at = NULL WHERE id = $1 AND deactivated_at IS NOT NULL;
+
+-- name: GetUsersDeactivatedBefore :many
+-- Oldest first, so a backlog drains across runs in the order the grace periods ended.
+SELECT id FROM users
+WHERE deactivated_at < sqlc.arg('cutoff')::timestamp
+ORDER BY deactivated_at
+LIMIT sqlc.arg('batch_size');
+
+-- name: LockUserDeactivatedBefore :one
+-- Locks a purge candidate's row for the purge transaction. No row means the user was
+-- reactivated (or deactivated again after cutoff) since the candidates were listed.
+SELECT id FROM users
+WHERE id = sqlc.arg('id') AND deactivated_at < sqlc.arg('cutoff')::timestamp
+FOR UPDATE;
+
+-- name: AdminSearchUsers :many
+-- Operator user search, newest first, keyset-paginated on (created_at, id). Never
+-- select password or other secrets here.
+SELECT
+    u.id,
+    u.username,
+    u.email,
+    u.created_at,
+    u.phone_verified_at,
+    (SELECT COUNT(*) FROM device_keys dk WHERE dk.user_id = u.id) AS device_count,
+    (SELECT COUNT(*) FROM user_groups ug WHERE ug.user_id = u.id AND ug.deleted_at IS NULL) AS group_count
+FROM users u
+WHERE (u.username ILIKE sqlc.arg('pattern') OR u.email ILIKE sqlc.arg('pattern'))
+  AND (u.created_at, u.id) < (sqlc.arg('before_created_at')::timestamp, sqlc.arg('before_id')::uuid)
+ORDER BY u.created_at DESC, u.id DESC
+LIMIT sqlc.arg('page_size');
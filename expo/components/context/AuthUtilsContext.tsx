@@ -226,11 +226,14 @@ export const AuthUtilsProvider = (props: { children: React.ReactNode }) => {
     }
     loggingOutRef.current = true;
     try {
-      // Clear push token BEFORE clearing JWT (request needs auth)
+      // Clear push token BEFORE clearing JWT (request needs auth). The server
+      // also drops this device's key and closes its socket on logout.
       if (globalDeviceId) {
-        await clearPushTokenOnServer(globalDeviceId).catch((error) => {
-          console.error("Error clearing push token:", error);
-        });
+        await clearPushTokenOnServer(globalDeviceId, { logout: true }).catch(
+          (error) => {
+            console.error("Error clearing push token:", error);
+          },
+        );
       }
       await clear("jwt");
       setUser(undefined);
@@ -84,6 +84,8 @@ const INITIAL_RETRY_DELAY = 1000;
 const MAX_RETRY_DELAY = 30000;
 
 const CLOSE_CODE_AUTH_FAILED = 4001;
+// auth_failure reasons that don't mean the credentials are bad.
+const RETRYABLE_AUTH_FAILURE_REASONS = new Set(["timeout", "unavailable"]);
 const CLOSE_CODE_UNAUTHENTICATED = 4003;
 
 export const WebSocketProvider: React.FC<{ children: React.ReactNode }> = ({
@@ -297,6 +299,16 @@ export const WebSocketProvider: React.FC<{ children: React.ReactNode }> = ({
                   promiseSettled = true;
                   resolve();
                 }
+              } else if (
+                parsedData.type === "auth_failure" &&
+                RETRYABLE_AUTH_FAILURE_REASONS.has(parsedData.reason)
+              ) {
+                // Transient server-side failure: the server closes the socket next and
+                // the onclose handler's backoff retries the connection.
+                console.warn(
+                  "WebSocket authentication failed, will retry:",
+                  parsedData.reason,
+                );
               } else if (parsedData.type === "auth_failure") {
                 preventRetriesRef.current = true;
                 socket.close(CLOSE_CODE_AUTH_FAILED, "Authentication Failed");
@@ -350,6 +362,24 @@ export const WebSocketProvider: React.FC<{ children: React.ReactNode }> = ({
                     console.error("Error in message handler:", handlerError);
                   }
                 });
+              } else if (parsedData.type === "reauth_required") {
+                // The server closes the socket when the current token expires;
+                // hand it the latest stored token so the connection can stay open.
+                get("jwt")
+                  .then((latestToken) => {
+                    if (latestToken && socketRef.current === socket) {
+                      socket.send(
+                        JSON.stringify({ type: "reauth", token: latestToken }),
+                      );
+                    }
+                  })
+                  .catch((error) => {
+                    console.error("Failed to load token for reauth:", error);
+                  });
+              } else if (parsedData.type === "reauth_success") {
+                // Nothing to do; the connection stays authenticated.
+              } else if (parsedData.type === "reauth_failure") {
+                console.warn("WebSocket reauth failed:", parsedData.error);
               } else if (parsedData.type && parsedData.type === "error") {
                 console.error(
                   "Received operational error from server:",
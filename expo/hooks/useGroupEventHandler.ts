@@ -30,6 +30,9 @@ export function useGroupEventHandler(
             removeGroupMessages(event.group_id);
             refreshGroups();
             break;
+          case "device_keys_updated":
+            await fetchDeviceKeys();
+            break;
           default:
             console.warn(`Received unknown group event type: ${event.event}`);
             break;
@@ -135,6 +135,7 @@ export const useSendImage = (): UseSendImageReturn => {
           filename: imageAsset.uri.split("/").pop() || "upload.jpg",
           groupId: groupId,
           size: encryptedBlob.length,
+          messageId: id,
         });
         const { uploadUrl, objectKey } = presignResponse.data;
 
@@ -87,11 +87,12 @@ export async function sendPushTokenToServer(
 }
 
 export async function clearPushTokenOnServer(
-  deviceIdentifier: string
+  deviceIdentifier: string,
+  options: { logout?: boolean } = {}
 ): Promise<boolean> {
   try {
     await http.delete(`${API_BASE_URL}/notifications/token`, {
-      data: { deviceIdentifier },
+      data: { deviceIdentifier, logout: options.logout ?? false },
     });
     console.log("Push token cleared from server");
     return true;
@@ -36,8 +36,18 @@ export type Group = {
   image_url?: string | null;
   blurhash?: string | null;
   muted?: boolean;
+  announcement_only?: boolean;
   last_read_timestamp?: string | null;
   last_message_timestamp?: string | null;
+  last_message?: GroupLastMessage | null;
+  unread_count?: number;
+};
+
+export type GroupLastMessage = {
+  sender_id: string | null;
+  sender_username?: string;
+  message_type: "text" | "image" | "control";
+  timestamp: string;
 };
 
 export interface CreateGroupParams {
@@ -127,6 +137,14 @@ export type RawMessage = {
     keyNonce: string; // Nonce for this box (Base64 encoded)
     sealedKey: string; // The symKey sealed for this recipient (Base64 encoded)
   }[];
+  mentions?: string[]; // Plaintext IDs of mentioned users (not signed)
+  forwarded_from?: {
+    message_id: string;
+    group_id: string;
+    sender_id: string;
+  }; // Set on forwarded messages (not signed)
+  expires_at?: string; // Disappearing messages only (not signed)
+  reaction_to?: string; // Control messages reacting to another message (not signed)
 };
 
 export type ImageMessageContent = {
@@ -181,8 +199,17 @@ export type BlockedUser = {
 
 export type GroupEvent = {
   type: "group_event";
-  event: "user_invited" | "user_removed" | "group_updated" | "group_deleted";
+  event:
+    | "user_invited"
+    | "user_removed"
+    | "group_updated"
+    | "group_deleted"
+    | "device_keys_updated"
+    | "message_deleted"
+    | "maintenance"
+    | "maintenance_ended";
   group_id: string;
+  message_ids?: string[]; // Set on message_deleted
 };
 
 export type InvitePreview = {
@@ -207,4 +234,5 @@ export type CreateInviteResponse = {
 export type AcceptInviteResponse = {
   group_id: string;
   message: string;
+  muted?: boolean;
 };
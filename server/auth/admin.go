@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// adminUserIDs holds the operators allowed to call /api/admin endpoints.
+var adminUserIDs = map[uuid.UUID]bool{}
+
+// LoadAdmins reads ADMIN_USER_IDS, a comma-separated list of user IDs with operator
+// access. It must be called once at startup. An empty list disables the admin API.
+func LoadAdmins() error {
+	admins := make(map[uuid.UUID]bool)
+	for _, raw := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return fmt.Errorf("ADMIN_USER_IDS contains an invalid user ID %q", raw)
+		}
+		admins[id] = true
+	}
+	adminUserIDs = admins
+	return nil
+}
+
+// AdminMiddleware rejects requests from users not listed in ADMIN_USER_IDS. It must
+// run after JWTAuthMiddleware.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("userID")
+		if id, isUUID := userID.(uuid.UUID); !ok || !isUUID || !adminUserIDs[id] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
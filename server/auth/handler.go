@@ -2,13 +2,13 @@ package auth
 
 import (
 	"chat-app-server/db"
+	"chat-app-server/util"
 	"context"
 	"crypto/ed25519"
 	"encoding/base64"
 	"errors"
 	"log"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
@@ -98,23 +98,38 @@ func (h *AuthHandler) Signup(c *gin.Context) {
 		return
 	}
 
-	pwd := []byte(req.Password)
-	hash, err := bcrypt.GenerateFromPassword(pwd, 12)
+	req.Email = util.NormalizeEmail(req.Email)
+	if rejectWeakPassword(c, req.Password, req.Username, req.Email) {
+		return
+	}
+
+	hash, err := hashPassword(req.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Signup failed"})
 		return
 	}
 
+	dbCtx, cancel := util.WithQueryTimeout(ctx)
+	defer cancel()
+
 	pgBirthday := pgtype.Date{Time: birthday, Valid: true}
-	user, err := h.db.InsertUser(ctx, db.InsertUserParams{Username: strings.TrimSpace(req.Username), Email: req.Email, Password: pgtype.Text{String: string(hash), Valid: true}, Birthday: pgBirthday})
+	user, err := h.db.InsertUser(dbCtx, db.InsertUserParams{Username: strings.TrimSpace(req.Username), Email: req.Email, Password: pgtype.Text{String: string(hash), Valid: true}, Birthday: pgBirthday})
 	if err != nil {
 		log.Printf("Error inserting user during signup for %s: %v", req.Email, err)
+		if util.IsDBTimeout(err) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Signup failed: the server is busy, please retry."})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Signup failed, possibly due to existing user or database issue."})
 		return
 	}
 
-	if err := h.registerOrUpdateDeviceKey(ctx, user.ID, req.DeviceIdentifier, req.PublicKey, req.SigningPublicKey); err != nil {
+	if err := h.registerOrUpdateDeviceKey(dbCtx, user.ID, req.DeviceIdentifier, req.PublicKey, req.SigningPublicKey); err != nil {
 		log.Printf("Warning: User %s signed up, but device key registration failed: %v", user.ID, err)
+		if util.IsDBTimeout(err) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Signup succeeded but the server is busy; log in to register this device."})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Signup succeeded but failed to register device."})
 		return
 	}
@@ -127,9 +142,7 @@ func (h *AuthHandler) Signup(c *gin.Context) {
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	tokenString, err := SignToken(claims)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
@@ -138,17 +151,42 @@ func (h *AuthHandler) Signup(c *gin.Context) {
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
-	ctx := c.Request.Context()
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
 		return
 	}
+	h.login(c, req, true)
+}
 
-	user, err := h.db.GetUserByEmailInternal(ctx, req.Email)
-	if err != nil {
-		dummyHash := []byte("$2a$12$ZHc6p51/1IsM/4/hz/sUvezdkXuT1IF75EF5nyKyRTu7XyGDd0PM2")
+// LoginWithoutDevice serves POST /auth/login/keyless: the same as Login but without a
+// device key. The token works for the REST API, but the WebSocket (and so E2EE
+// messaging) rejects the device until its key is registered with POST
+// /api/devices/register.
+func (h *AuthHandler) LoginWithoutDevice(c *gin.Context) {
+	var req KeylessLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+	h.login(c, LoginRequest{Email: req.Email, Password: req.Password}, false)
+}
+
+// login checks the credentials, reactivates a deactivated account and, if
+// registerDevice is set, registers the request's device key before issuing a token.
+func (h *AuthHandler) login(c *gin.Context, req LoginRequest, registerDevice bool) {
+	ctx := c.Request.Context()
+	req.Email = util.NormalizeEmail(req.Email)
 
+	lookupCtx, cancelLookup := util.WithQueryTimeout(ctx)
+	user, err := h.db.GetUserByEmailInternal(lookupCtx, req.Email)
+	cancelLookup()
+	if util.IsDBTimeout(err) {
+		log.Printf("Login lookup for %s timed out: %v", req.Email, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Login failed: the server is busy, please retry."})
+		return
+	}
+	if err != nil {
 		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(req.Password))
 
 		log.Printf("Login attempt for non-existent or problematic email %s (timing mitigation active): %v", req.Email, err)
@@ -169,9 +207,34 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"message": "Login failed: Invalid credentials"})
 		return
 	}
+	if needsRehash(pwd) {
+		h.upgradePasswordHash(ctx, user.ID, user.Password, req.Password)
+	}
+
+	dbCtx, cancel := util.WithQueryTimeout(ctx)
+	defer cancel()
+
+	// Logging in during the deactivation grace period restores the account.
+	if reactivated, err := h.db.ReactivateUser(dbCtx, user.ID); err != nil {
+		log.Printf("Error: User %s login failed while reactivating account: %v", user.ID, err)
+		if util.IsDBTimeout(err) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Login failed: the server is busy, please retry."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed: could not reactivate account."})
+		return
+	} else if reactivated > 0 {
+		log.Printf("Account %s reactivated on login.", user.ID)
+	}
 
-	if err := h.registerOrUpdateDeviceKey(ctx, user.ID, req.DeviceIdentifier, req.PublicKey, req.SigningPublicKey); err != nil {
+	if !registerDevice {
+		log.Printf("User %s logged in without a device key.", user.ID)
+	} else if err := h.registerOrUpdateDeviceKey(dbCtx, user.ID, req.DeviceIdentifier, req.PublicKey, req.SigningPublicKey); err != nil {
 		log.Printf("Error: User %s login failed due to device key registration/update error: %v", user.ID, err)
+		if util.IsDBTimeout(err) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Login failed: the server is busy, please retry."})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed: could not register device key."})
 		return
 	}
@@ -184,13 +247,30 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	tokenString, err := SignToken(claims)
 	if err != nil {
 		log.Printf("Error signing token for user %s after login: %v", user.ID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": tokenString, "user_id": user.ID, "username": user.Username})
+	c.JSON(http.StatusOK, gin.H{"token": tokenString, "user_id": user.ID, "username": user.Username, "device_registered": registerDevice})
+}
+
+// upgradePasswordHash re-hashes a just-verified password at the configured cost. The
+// update only applies if the stored hash is still oldHash. Failure is logged and
+// otherwise ignored; the upgrade is retried on the next login.
+func (h *AuthHandler) upgradePasswordHash(ctx context.Context, userID uuid.UUID, oldHash pgtype.Text, password string) {
+	hash, err := hashPassword(password)
+	if err != nil {
+		log.Printf("Error re-hashing password for user %s: %v", userID, err)
+		return
+	}
+	if err := h.db.RehashUserPassword(ctx, db.RehashUserPasswordParams{
+		NewPassword: pgtype.Text{String: string(hash), Valid: true},
+		ID:          userID,
+		OldPassword: oldHash,
+	}); err != nil {
+		log.Printf("Error saving upgraded password hash for user %s: %v", userID, err)
+	}
 }
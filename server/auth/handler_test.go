@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"bytes"
+	"chat-app-server/db"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeUserDB answers the queries a login makes for a single stored user and records
+// every statement executed.
+type fakeUserDB struct {
+	id       uuid.UUID
+	email    string
+	password string
+	execs    []fakeExec
+}
+
+type fakeExec struct {
+	sql  string
+	args []any
+}
+
+func (f *fakeUserDB) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	f.execs = append(f.execs, fakeExec{sql: sql, args: args})
+	return pgconn.NewCommandTag("UPDATE 1"), nil
+}
+
+func (f *fakeUserDB) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	return nil, errors.New("unexpected query")
+}
+
+func (f *fakeUserDB) QueryRow(_ context.Context, sql string, args ...any) pgx.Row {
+	if strings.Contains(sql, "-- name: RegisterDeviceKey ") {
+		f.execs = append(f.execs, fakeExec{sql: sql, args: args})
+		return fakeRow{scan: func(...any) {}}
+	}
+	if !strings.Contains(sql, "-- name: GetUserByEmailInternal ") || args[0] != f.email {
+		return fakeRow{err: pgx.ErrNoRows}
+	}
+	return fakeRow{scan: func(dest ...any) {
+		*dest[0].(*uuid.UUID) = f.id
+		*dest[1].(*string) = "tester"
+		*dest[2].(*string) = f.email
+		*dest[3].(*pgtype.Text) = pgtype.Text{String: f.password, Valid: true}
+	}}
+}
+
+func (f *fakeUserDB) CopyFrom(context.Context, pgx.Identifier, []string, pgx.CopyFromSource) (int64, error) {
+	return 0, errors.New("unexpected copy")
+}
+
+// rehashes returns the new hashes written by RehashUserPassword.
+func (f *fakeUserDB) rehashes() []string {
+	var hashes []string
+	for _, exec := range f.execs {
+		if strings.Contains(exec.sql, "-- name: RehashUserPassword ") {
+			hashes = append(hashes, exec.args[0].(pgtype.Text).String)
+		}
+	}
+	return hashes
+}
+
+type fakeRow struct {
+	scan func(dest ...any)
+	err  error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.scan(dest...)
+	return nil
+}
+
+// loginWithStoredCost logs in, registering a device if registerDevice is set, as a user
+// whose password was hashed at storedCost while BCRYPT_COST is configuredCost.
+func loginWithStoredCost(t *testing.T, storedCost, configuredCost int, attempt string, registerDevice bool) (*fakeUserDB, int) {
+	t.Helper()
+	useHS256(t)
+	previousCost, previousDummy := bcryptCost, dummyHash
+	t.Cleanup(func() { bcryptCost, dummyHash = previousCost, previousDummy })
+	t.Setenv("BCRYPT_COST", strconv.Itoa(configuredCost))
+	if err := LoadPasswordCost(); err != nil {
+		t.Fatalf("LoadPasswordCost: %v", err)
+	}
+
+	stored, err := bcrypt.GenerateFromPassword([]byte("correct horse battery"), storedCost)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	fake := &fakeUserDB{id: uuid.New(), email: "tester@example.com", password: string(stored)}
+	handler := NewAuthHandler(db.New(fake), context.Background(), nil)
+
+	path, login := "/auth/login/keyless", handler.LoginWithoutDevice
+	var body []byte
+	if registerDevice {
+		path, login = "/auth/login", handler.Login
+		body, _ = json.Marshal(LoginRequest{
+			Email:            fake.email,
+			Password:         attempt,
+			DeviceIdentifier: "device-1",
+			PublicKey:        base64.StdEncoding.EncodeToString(make([]byte, 32)),
+			SigningPublicKey: base64.StdEncoding.EncodeToString(make([]byte, ed25519.PublicKeySize)),
+		})
+	} else {
+		body, _ = json.Marshal(KeylessLoginRequest{Email: fake.email, Password: attempt})
+	}
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	login(c)
+	return fake, recorder.Code
+}
+
+func TestLoginUpgradesLowCostHash(t *testing.T) {
+	tests := []struct {
+		name           string
+		registerDevice bool
+	}{
+		{"keyless", false},
+		{"with device", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, status := loginWithStoredCost(t, 10, 11, "correct horse battery", tt.registerDevice)
+			if status != http.StatusOK {
+				t.Fatalf("login status %d, want 200", status)
+			}
+			rehashes := fake.rehashes()
+			if len(rehashes) != 1 {
+				t.Fatalf("got %d password rehashes, want 1", len(rehashes))
+			}
+			cost, err := bcrypt.Cost([]byte(rehashes[0]))
+			if err != nil || cost != 11 {
+				t.Fatalf("rehashed at cost %d (err %v), want 11", cost, err)
+			}
+			if err := bcrypt.CompareHashAndPassword([]byte(rehashes[0]), []byte("correct horse battery")); err != nil {
+				t.Fatalf("rehashed password doesn't verify: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoginLeavesHashAloneOnFailedLogin(t *testing.T) {
+	fake, status := loginWithStoredCost(t, 10, 11, "wrong password", false)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("login status %d, want 401", status)
+	}
+	if rehashes := fake.rehashes(); len(rehashes) != 0 {
+		t.Fatalf("failed login rehashed the password %d times", len(rehashes))
+	}
+}
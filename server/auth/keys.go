@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// keySet holds the key used to sign new tokens plus every key still accepted for
+// verification, indexed by the kid header.
+type keySet struct {
+	method     jwt.SigningMethod
+	currentKID string
+	signingKey any
+	verifyKeys map[string]any
+}
+
+var keys *keySet
+
+// minSecretLength is the shortest HS256 secret accepted: 256 bits, matching the hash size.
+const minSecretLength = 32
+
+// LoadKeys reads JWT key configuration from the environment. It must be called once at
+// startup, before any token is signed or validated.
+//
+//   - JWT_ALGORITHM: HS256 (default), RS256 or ES256
+//   - JWT_KEY_ID: kid stamped on new tokens (default "default")
+//   - HS256: JWT_SECRET or JWT_SECRET_FILE
+//   - RS256/ES256: JWT_PRIVATE_KEY (PEM) or JWT_PRIVATE_KEY_FILE
+//   - JWT_RETIRED_KEYS: optional comma-separated kid=source pairs that are still accepted
+//     for verification during rotation. For HS256 the source is the old secret; for
+//     RS256/ES256 it is the path to the old PEM public key.
+func LoadKeys() error {
+	ks, err := loadKeySet()
+	if err != nil {
+		return err
+	}
+	keys = ks
+	return nil
+}
+
+func loadKeySet() (*keySet, error) {
+	alg := os.Getenv("JWT_ALGORITHM")
+	if alg == "" {
+		alg = jwt.SigningMethodHS256.Alg()
+	}
+	kid := os.Getenv("JWT_KEY_ID")
+	if kid == "" {
+		kid = "default"
+	}
+
+	ks := &keySet{currentKID: kid, verifyKeys: make(map[string]any)}
+	switch alg {
+	case jwt.SigningMethodHS256.Alg():
+		ks.method = jwt.SigningMethodHS256
+		secret, err := envOrFile("JWT_SECRET")
+		if err != nil {
+			return nil, err
+		}
+		if len(secret) < minSecretLength {
+			return nil, fmt.Errorf("JWT_SECRET must be at least %d bytes", minSecretLength)
+		}
+		ks.signingKey = secret
+		ks.verifyKeys[kid] = secret
+	case jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg():
+		ks.method = jwt.GetSigningMethod(alg)
+		pemBytes, err := envOrFile("JWT_PRIVATE_KEY")
+		if err != nil {
+			return nil, err
+		}
+		private, public, err := parsePrivateKey(alg, pemBytes)
+		if err != nil {
+			return nil, err
+		}
+		ks.signingKey = private
+		ks.verifyKeys[kid] = public
+	default:
+		return nil, fmt.Errorf("unsupported JWT_ALGORITHM %q", alg)
+	}
+
+	if retired := os.Getenv("JWT_RETIRED_KEYS"); retired != "" {
+		for _, entry := range strings.Split(retired, ",") {
+			retiredKID, source, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if !ok || retiredKID == "" || source == "" {
+				return nil, errors.New("JWT_RETIRED_KEYS entries must look like kid=source")
+			}
+			if retiredKID == kid {
+				return nil, fmt.Errorf("retired key id %q collides with JWT_KEY_ID", retiredKID)
+			}
+			key, err := parseRetiredKey(alg, source)
+			if err != nil {
+				return nil, fmt.Errorf("retired key %q: %w", retiredKID, err)
+			}
+			ks.verifyKeys[retiredKID] = key
+		}
+	}
+
+	return ks, nil
+}
+
+// envOrFile returns the value of name, or the contents of the file named by name_FILE.
+func envOrFile(name string) ([]byte, error) {
+	if v := os.Getenv(name); v != "" {
+		return []byte(v), nil
+	}
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s_FILE: %w", name, err)
+		}
+		return []byte(strings.TrimSpace(string(b))), nil
+	}
+	return nil, fmt.Errorf("%s or %s_FILE must be set", name, name)
+}
+
+func parsePrivateKey(alg string, pemBytes []byte) (any, any, error) {
+	if alg == jwt.SigningMethodRS256.Alg() {
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing RSA private key: %w", err)
+		}
+		return key, &key.PublicKey, nil
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(pemBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing EC private key: %w", err)
+	}
+	return key, &key.PublicKey, nil
+}
+
+func parseRetiredKey(alg, source string) (any, error) {
+	switch alg {
+	case jwt.SigningMethodHS256.Alg():
+		if len(source) < minSecretLength {
+			return nil, fmt.Errorf("secret must be at least %d bytes", minSecretLength)
+		}
+		return []byte(source), nil
+	case jwt.SigningMethodRS256.Alg():
+		pemBytes, err := os.ReadFile(source)
+		if err != nil {
+			return nil, err
+		}
+		return jwt.ParseRSAPublicKeyFromPEM(pemBytes)
+	default:
+		pemBytes, err := os.ReadFile(source)
+		if err != nil {
+			return nil, err
+		}
+		return jwt.ParseECPublicKeyFromPEM(pemBytes)
+	}
+}
+
+// SignToken signs claims with the current key and stamps its kid in the header.
+func SignToken(claims jwt.Claims) (string, error) {
+	if keys == nil {
+		return "", errors.New("JWT keys not loaded")
+	}
+	token := jwt.NewWithClaims(keys.method, claims)
+	token.Header["kid"] = keys.currentKID
+	return token.SignedString(keys.signingKey)
+}
+
+// verificationKey is the jwt.Keyfunc used by ValidateToken. Tokens issued before kid
+// headers were introduced carry none and are checked against the current key.
+func verificationKey(token *jwt.Token) (any, error) {
+	if keys == nil {
+		return nil, errors.New("JWT keys not loaded")
+	}
+	if token.Method.Alg() != keys.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = keys.currentKID
+	}
+	key, ok := keys.verifyKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"chat-app-server/util"
+	"crypto/rand"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const defaultBcryptCost = 12
+
+var (
+	// bcryptCost is the cost new password hashes are created with.
+	bcryptCost = defaultBcryptCost
+	// dummyHash is compared against when a login names an unknown account, so that
+	// failure takes as long as a wrong password would. It must use bcryptCost.
+	dummyHash = []byte("$2a$12$ZHc6p51/1IsM/4/hz/sUvezdkXuT1IF75EF5nyKyRTu7XyGDd0PM2")
+)
+
+// LoadPasswordCost reads BCRYPT_COST (default 12). It must be called once at startup,
+// before any password is hashed. Raising it upgrades existing hashes as their owners
+// log in.
+func LoadPasswordCost() error {
+	cost := util.GetEnvInt("BCRYPT_COST", defaultBcryptCost)
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword(secret, cost)
+	if err != nil {
+		return err
+	}
+	bcryptCost = cost
+	dummyHash = hash
+	return nil
+}
+
+func hashPassword(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+}
+
+// needsRehash reports whether hash was created at a lower cost than is now configured.
+func needsRehash(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+	return err == nil && cost < bcryptCost
+}
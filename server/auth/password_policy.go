@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"bufio"
+	"chat-app-server/util"
+	"context"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+// Reasons reported with a weak_password rejection, so the client can show guidance.
+const (
+	weakReasonCommon   = "common"
+	weakReasonVariety  = "too_simple"
+	weakReasonIdentity = "contains_identity"
+	weakReasonBreached = "breached"
+)
+
+const pwnedRangeURL = "https://api.pwnedpasswords.com/range/"
+
+// passwordPolicy is how strict new passwords are checked. Length is enforced by the
+// request binding.
+type passwordPolicy struct {
+	minCharClasses int
+	rejectCommon   bool
+	checkPwned     bool
+}
+
+var (
+	policy          = passwordPolicy{minCharClasses: 2, rejectCommon: true}
+	commonPasswords = parseCommonPasswords(commonPasswordList)
+	pwnedClient     = &http.Client{Timeout: 3 * time.Second}
+)
+
+// LoadPasswordPolicy reads PASSWORD_MIN_CHAR_CLASSES (how many of lowercase,
+// uppercase, digits and symbols a new password needs, default 2),
+// PASSWORD_REJECT_COMMON (default true) and PASSWORD_CHECK_PWNED (default false). Call
+// once at startup.
+func LoadPasswordPolicy() error {
+	classes := util.GetEnvInt("PASSWORD_MIN_CHAR_CLASSES", 2)
+	if classes < 1 || classes > 4 {
+		return fmt.Errorf("PASSWORD_MIN_CHAR_CLASSES must be between 1 and 4, got %d", classes)
+	}
+	policy = passwordPolicy{
+		minCharClasses: classes,
+		rejectCommon:   util.GetEnvBool("PASSWORD_REJECT_COMMON", true),
+		checkPwned:     util.GetEnvBool("PASSWORD_CHECK_PWNED", false),
+	}
+	return nil
+}
+
+func parseCommonPasswords(list string) map[string]struct{} {
+	set := make(map[string]struct{})
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		set[line] = struct{}{}
+	}
+	return set
+}
+
+// checkPasswordStrength returns the reason password is too weak for the account
+// identified by username and email, or "" if it is acceptable.
+func checkPasswordStrength(ctx context.Context, password, username, email string) string {
+	lower := strings.ToLower(password)
+	if policy.rejectCommon {
+		if _, ok := commonPasswords[lower]; ok {
+			return weakReasonCommon
+		}
+		base := strings.TrimRightFunc(lower, func(r rune) bool { return !unicode.IsLetter(r) })
+		if _, ok := commonPasswords[base]; ok {
+			return weakReasonCommon
+		}
+	}
+
+	if charClasses(password) < policy.minCharClasses {
+		return weakReasonVariety
+	}
+
+	localPart, _, _ := strings.Cut(strings.ToLower(email), "@")
+	for _, ident := range []string{strings.ToLower(strings.TrimSpace(username)), localPart} {
+		if len(ident) >= 4 && strings.Contains(lower, ident) {
+			return weakReasonIdentity
+		}
+	}
+
+	if policy.checkPwned && passwordPwned(ctx, password) {
+		return weakReasonBreached
+	}
+	return ""
+}
+
+func charClasses(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	n := 0
+	for _, has := range []bool{lower, upper, digit, other} {
+		if has {
+			n++
+		}
+	}
+	return n
+}
+
+// passwordPwned asks Have I Been Pwned whether password appears in a known breach.
+// Only the first five hex characters of its SHA-1 leave the server (k-anonymity), and
+// padding hides the response size. Any failure counts as not pwned, so an outage
+// doesn't block signups.
+func passwordPwned(ctx context.Context, password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pwnedRangeURL+prefix, nil)
+	if err != nil {
+		log.Printf("Error building breached password request: %v", err)
+		return false
+	}
+	req.Header.Set("Add-Padding", "true")
+	resp, err := pwnedClient.Do(req)
+	if err != nil {
+		log.Printf("Breached password check failed, allowing password: %v", err)
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Breached password check returned status %d, allowing password", resp.StatusCode)
+		return false
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		candidate, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		// Padding entries have a count of 0.
+		if ok && candidate == suffix && count != "0" {
+			return true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("Error reading breached password response, allowing password: %v", err)
+	}
+	return false
+}
+
+// rejectWeakPassword writes a 400 with code weak_password and returns true if
+// password doesn't meet the configured policy.
+func rejectWeakPassword(c *gin.Context, password, username, email string) bool {
+	reason := checkPasswordStrength(c.Request.Context(), password, username, email)
+	if reason == "" {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"message": weakPasswordMessage(reason),
+		"code":    "weak_password",
+		"reason":  reason,
+	})
+	return true
+}
+
+func weakPasswordMessage(reason string) string {
+	switch reason {
+	case weakReasonCommon:
+		return "This password is too common. Please choose a less predictable one"
+	case weakReasonVariety:
+		return fmt.Sprintf("Password must mix at least %d of lowercase letters, uppercase letters, digits and symbols", policy.minCharClasses)
+	case weakReasonIdentity:
+		return "Password must not contain your username or email"
+	default:
+		return "This password has appeared in a data breach. Please choose a different one"
+	}
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+// usePolicy applies p for the test and restores the previous policy after.
+func usePolicy(t *testing.T, p passwordPolicy) {
+	t.Helper()
+	previous := policy
+	policy = p
+	t.Cleanup(func() { policy = previous })
+}
+
+func TestSignupPasswordLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		valid    bool
+	}{
+		{"seven characters", "Tr0ub4d", false},
+		{"eight characters", "Tr0ub4d!", true},
+		{"72 characters", strings.Repeat("aB3!", 18), true},
+		{"73 characters", strings.Repeat("aB3!", 18) + "x", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := SignupRequest{
+				Username:         "sam",
+				Email:            "sam@example.com",
+				Password:         tt.password,
+				Birthday:         "2000-01-01",
+				DeviceIdentifier: "device-1",
+				PublicKey:        "key",
+				SigningPublicKey: "signing-key",
+			}
+			err := binding.Validator.ValidateStruct(req)
+			if (err == nil) != tt.valid {
+				t.Fatalf("validating a %d character password: err %v, want valid %t", len(tt.password), err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestCheckPasswordStrength(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   passwordPolicy
+		password string
+		want     string
+	}{
+		{"common password", passwordPolicy{minCharClasses: 1, rejectCommon: true}, "12345678", weakReasonCommon},
+		{"common password in another case", passwordPolicy{minCharClasses: 1, rejectCommon: true}, "AdMinIsTrAtOr", weakReasonCommon},
+		{"common password with trailing digits and symbols", passwordPolicy{minCharClasses: 1, rejectCommon: true}, "Asdfgh2024!", weakReasonCommon},
+		{"common password allowed when the check is off", passwordPolicy{minCharClasses: 1}, "12345678", ""},
+		{"one class when two are required", passwordPolicy{minCharClasses: 2, rejectCommon: true}, "quietlantern", weakReasonVariety},
+		{"two classes when two are required", passwordPolicy{minCharClasses: 2, rejectCommon: true}, "quietlantern7", ""},
+		{"three classes when four are required", passwordPolicy{minCharClasses: 4, rejectCommon: true}, "Quietlantern7", weakReasonVariety},
+		{"four classes when four are required", passwordPolicy{minCharClasses: 4, rejectCommon: true}, "Quietlantern7!", ""},
+		{"contains the username", passwordPolicy{minCharClasses: 2, rejectCommon: true}, "xSamwise99", weakReasonIdentity},
+		{"contains the email local part", passwordPolicy{minCharClasses: 2, rejectCommon: true}, "gamgee-2024", weakReasonIdentity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usePolicy(t, tt.policy)
+			if got := checkPasswordStrength(context.Background(), tt.password, "samwise", "gamgee@example.com"); got != tt.want {
+				t.Fatalf("checkPasswordStrength(%q) = %q, want %q", tt.password, got, tt.want)
+			}
+		})
+	}
+}
@@ -4,73 +4,82 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"os"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
-
 func ValidateToken(tokenString string) (uuid.UUID, error) {
+	userID, _, err := ValidateTokenWithExpiry(tokenString)
+	return userID, err
+}
+
+// ValidateTokenWithExpiry validates like ValidateToken and also returns the token's
+// exp claim, for long-lived connections that must act before the token lapses.
+func ValidateTokenWithExpiry(tokenString string) (uuid.UUID, time.Time, error) {
 	if tokenString == "" {
-		return uuid.Nil, fmt.Errorf("authorization token required")
+		return uuid.Nil, time.Time{}, fmt.Errorf("authorization token required")
 	}
-	if len(jwtSecret) == 0 {
-		log.Println("Warning: JWT_SECRET environment variable not set.")
-		return uuid.Nil, fmt.Errorf("JWT secret not configured on server")
+	if keys == nil {
+		return uuid.Nil, time.Time{}, fmt.Errorf("JWT keys not loaded")
 	}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return jwtSecret, nil
-	})
+	// Pinning the method makes the parser reject "none" and any algorithm other than the
+	// configured one before the keyfunc runs, closing off algorithm-confusion attacks.
+	token, err := jwt.Parse(tokenString, verificationKey,
+		jwt.WithValidMethods([]string{keys.method.Alg()}),
+		jwt.WithExpirationRequired(),
+	)
 
 	if err != nil {
 		log.Printf("Token parsing error: %v", err)
 		if errors.Is(err, jwt.ErrTokenMalformed) {
-			return uuid.Nil, fmt.Errorf("malformed token")
+			return uuid.Nil, time.Time{}, fmt.Errorf("malformed token: %w", jwt.ErrTokenMalformed)
 		} else if errors.Is(err, jwt.ErrTokenExpired) {
-			return uuid.Nil, fmt.Errorf("token is expired")
+			return uuid.Nil, time.Time{}, fmt.Errorf("token is expired: %w", jwt.ErrTokenExpired)
 		} else if errors.Is(err, jwt.ErrTokenNotValidYet) {
-			return uuid.Nil, fmt.Errorf("token not yet valid")
+			return uuid.Nil, time.Time{}, fmt.Errorf("token not yet valid: %w", jwt.ErrTokenNotValidYet)
 		} else if errors.Is(err, jwt.ErrTokenSignatureInvalid) {
-			return uuid.Nil, fmt.Errorf("token signature is invalid")
+			return uuid.Nil, time.Time{}, fmt.Errorf("token signature is invalid: %w", jwt.ErrTokenSignatureInvalid)
 		} else {
-			return uuid.Nil, fmt.Errorf("couldn't handle token: %w", err)
+			return uuid.Nil, time.Time{}, fmt.Errorf("couldn't handle token: %w", err)
 		}
 	}
 	if !token.Valid {
 		log.Printf("Token marked as invalid, though no specific error matched: %v", err)
-		return uuid.Nil, fmt.Errorf("invalid token")
+		return uuid.Nil, time.Time{}, fmt.Errorf("invalid token")
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return uuid.Nil, fmt.Errorf("invalid token claims format")
+		return uuid.Nil, time.Time{}, fmt.Errorf("invalid token claims format")
 	}
 
 	userIDClaim, exists := claims["userID"]
 	if !exists {
-		return uuid.Nil, fmt.Errorf("userID claim missing in token")
+		return uuid.Nil, time.Time{}, fmt.Errorf("userID claim missing in token")
 	}
 
 	userIDStr, ok := userIDClaim.(string)
 	if !ok {
-		return uuid.Nil, fmt.Errorf("userID claim is not a string")
+		return uuid.Nil, time.Time{}, fmt.Errorf("userID claim is not a string")
 	}
 
 	userID, err := uuid.Parse(userIDStr)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("failed to parse userID as UUID: %w", err)
+		return uuid.Nil, time.Time{}, fmt.Errorf("failed to parse userID as UUID: %w", err)
 	}
 
 	if userID == uuid.Nil {
-		return uuid.Nil, fmt.Errorf("parsed userID is a Nil UUID")
+		return uuid.Nil, time.Time{}, fmt.Errorf("parsed userID is a Nil UUID")
+	}
+
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil || expiresAt == nil {
+		return uuid.Nil, time.Time{}, fmt.Errorf("invalid exp claim")
 	}
 
 	log.Printf("Token validated successfully for userID: %s", userID)
-	return userID, nil
+	return userID, expiresAt.Time, nil
 }
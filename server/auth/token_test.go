@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// useHS256 loads an HS256 key set for the test and restores the previous one after.
+func useHS256(t *testing.T) {
+	t.Helper()
+	t.Setenv("JWT_ALGORITHM", "HS256")
+	t.Setenv("JWT_SECRET", testSecret)
+	loadTestKeys(t)
+}
+
+// useRS256 loads an RS256 key set with a fresh key and returns its PEM public key.
+func useRS256(t *testing.T) []byte {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)})
+	publicDER, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal RSA public key: %v", err)
+	}
+	t.Setenv("JWT_ALGORITHM", "RS256")
+	t.Setenv("JWT_PRIVATE_KEY", string(privatePEM))
+	loadTestKeys(t)
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+}
+
+func loadTestKeys(t *testing.T) {
+	t.Helper()
+	previous := keys
+	t.Cleanup(func() { keys = previous })
+	if err := LoadKeys(); err != nil {
+		t.Fatalf("LoadKeys: %v", err)
+	}
+}
+
+func validClaims() Claims {
+	return Claims{
+		UserID: uuid.New(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+}
+
+func TestValidateTokenAcceptsSignedToken(t *testing.T) {
+	useHS256(t)
+	claims := validClaims()
+	token, err := SignToken(claims)
+	if err != nil {
+		t.Fatalf("SignToken: %v", err)
+	}
+	userID, err := ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken rejected a valid token: %v", err)
+	}
+	if userID != claims.UserID {
+		t.Fatalf("got user %s, want %s", userID, claims.UserID)
+	}
+}
+
+func TestValidateTokenRejectsTamperedSignature(t *testing.T) {
+	useHS256(t)
+	token, err := SignToken(validClaims())
+	if err != nil {
+		t.Fatalf("SignToken: %v", err)
+	}
+	// Flip a bit in the first signature character; the last one may only carry padding bits.
+	dot := strings.LastIndex(token, ".")
+	signature := []byte(token[dot+1:])
+	signature[0] ^= 0x01
+	tampered := token[:dot+1] + string(signature)
+
+	if _, err := ValidateToken(tampered); err == nil {
+		t.Fatal("ValidateToken accepted a token with a tampered signature")
+	}
+}
+
+func TestValidateTokenRejectsAlgNone(t *testing.T) {
+	useHS256(t)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("sign alg none: %v", err)
+	}
+	if _, err := ValidateToken(token); err == nil {
+		t.Fatal("ValidateToken accepted an alg none token")
+	}
+}
+
+func TestValidateTokenRejectsHS256SignedWithRS256PublicKey(t *testing.T) {
+	publicPEM := useRS256(t)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims()).SignedString(publicPEM)
+	if err != nil {
+		t.Fatalf("sign HS256 with public key: %v", err)
+	}
+	if _, err := ValidateToken(token); err == nil {
+		t.Fatal("ValidateToken accepted an HS256 token keyed with the RS256 public key")
+	}
+}
+
+func TestValidateTokenRejectsExpiredToken(t *testing.T) {
+	useHS256(t)
+	claims := validClaims()
+	claims.IssuedAt = jwt.NewNumericDate(time.Now().Add(-2 * time.Hour))
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+	token, err := SignToken(claims)
+	if err != nil {
+		t.Fatalf("SignToken: %v", err)
+	}
+	if _, err := ValidateToken(token); err == nil {
+		t.Fatal("ValidateToken accepted an expired token")
+	}
+}
+
+func TestValidateTokenRejectsMissingExpiry(t *testing.T) {
+	useHS256(t)
+	claims := validClaims()
+	claims.ExpiresAt = nil
+	token, err := SignToken(claims)
+	if err != nil {
+		t.Fatalf("SignToken: %v", err)
+	}
+	if _, err := ValidateToken(token); err == nil {
+		t.Fatal("ValidateToken accepted a token without exp")
+	}
+}
@@ -17,7 +17,7 @@ type SignupRequest struct {
 	Birthday         string `json:"birthday" binding:"required"`
 	DeviceIdentifier string `json:"device_identifier" binding:"required"`
 	PublicKey        string `json:"public_key" binding:"required"`
-	SigningPublicKey  string `json:"signing_public_key" binding:"required"`
+	SigningPublicKey string `json:"signing_public_key" binding:"required"`
 }
 type LoginRequest struct {
 	Email            string `json:"email" binding:"required,email"`
@@ -26,3 +26,7 @@ type LoginRequest struct {
 	PublicKey        string `json:"public_key" binding:"required"`
 	SigningPublicKey string `json:"signing_public_key" binding:"required"`
 }
+type KeylessLoginRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
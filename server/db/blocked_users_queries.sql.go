@@ -51,6 +51,8 @@ type CheckBlockConflictWithGroupParams struct {
 	GroupID   *uuid.UUID `json:"group_id"`
 }
 
+// Symmetric: true if $1 has blocked any current member of the group or any member
+// has blocked $1. Used before $1 joins, so neither side ends up sharing a group.
 func (q *Queries) CheckBlockConflictWithGroup(ctx context.Context, arg CheckBlockConflictWithGroupParams) (bool, error) {
 	row := q.db.QueryRow(ctx, checkBlockConflictWithGroup, arg.BlockedID, arg.GroupID)
 	var has_conflict bool
@@ -121,6 +123,61 @@ func (q *Queries) GetBlockedUsers(ctx context.Context, blockerID uuid.UUID) ([]G
 	return items, nil
 }
 
+const getBlockedUsersPage = `-- name: GetBlockedUsersPage :many
+SELECT u.id, u.username, u.email, bu.created_at AS blocked_at
+FROM blocked_users bu
+JOIN users u ON u.id = bu.blocked_id
+WHERE bu.blocker_id = $1
+  AND (bu.created_at, u.id) < ($2::timestamp, $3::uuid)
+ORDER BY bu.created_at DESC, u.id DESC
+LIMIT $4
+`
+
+type GetBlockedUsersPageParams struct {
+	BlockerID       uuid.UUID        `json:"blocker_id"`
+	BeforeBlockedAt pgtype.Timestamp `json:"before_blocked_at"`
+	BeforeID        uuid.UUID        `json:"before_id"`
+	PageSize        int32            `json:"page_size"`
+}
+
+type GetBlockedUsersPageRow struct {
+	ID        uuid.UUID        `json:"id"`
+	Username  string           `json:"username"`
+	Email     string           `json:"email"`
+	BlockedAt pgtype.Timestamp `json:"blocked_at"`
+}
+
+// Newest block first, keyset-paginated on (blocked_at, id).
+func (q *Queries) GetBlockedUsersPage(ctx context.Context, arg GetBlockedUsersPageParams) ([]GetBlockedUsersPageRow, error) {
+	rows, err := q.db.Query(ctx, getBlockedUsersPage,
+		arg.BlockerID,
+		arg.BeforeBlockedAt,
+		arg.BeforeID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetBlockedUsersPageRow
+	for rows.Next() {
+		var i GetBlockedUsersPageRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.Email,
+			&i.BlockedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getSharedGroupIDs = `-- name: GetSharedGroupIDs :many
 SELECT ug1.group_id FROM user_groups ug1
 JOIN user_groups ug2 ON ug1.group_id = ug2.group_id
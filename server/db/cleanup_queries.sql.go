@@ -13,7 +13,7 @@ import (
 )
 
 const clearGroupImageUrl = `-- name: ClearGroupImageUrl :exec
-UPDATE groups SET image_url = NULL, blurhash = NULL WHERE id = $1
+UPDATE groups SET image_url = NULL, blurhash = NULL, updated_at = NOW() WHERE id = $1
 `
 
 // Nulls out the image_url after S3 cleanup so the group isn't reprocessed
@@ -48,11 +48,16 @@ const getExpiredGroups = `-- name: GetExpiredGroups :many
 
 SELECT id, name, end_time
 FROM groups
-WHERE end_time < NOW() AND deleted_at IS NULL
+WHERE end_time < $1 AND deleted_at IS NULL
 ORDER BY end_time ASC
-LIMIT $1
+LIMIT $2
 `
 
+type GetExpiredGroupsParams struct {
+	Cutoff    pgtype.Timestamp `json:"cutoff"`
+	BatchSize int32            `json:"batch_size"`
+}
+
 type GetExpiredGroupsRow struct {
 	ID      uuid.UUID        `json:"id"`
 	Name    string           `json:"name"`
@@ -60,9 +65,9 @@ type GetExpiredGroupsRow struct {
 }
 
 // Cleanup Expired Groups Queries
-// Returns groups that have passed their end_time
-func (q *Queries) GetExpiredGroups(ctx context.Context, limit int32) ([]GetExpiredGroupsRow, error) {
-	rows, err := q.db.Query(ctx, getExpiredGroups, limit)
+// Returns groups whose end_time is before cutoff, i.e. past their retention window
+func (q *Queries) GetExpiredGroups(ctx context.Context, arg GetExpiredGroupsParams) ([]GetExpiredGroupsRow, error) {
+	rows, err := q.db.Query(ctx, getExpiredGroups, arg.Cutoff, arg.BatchSize)
 	if err != nil {
 		return nil, err
 	}
@@ -53,6 +53,36 @@ func (q *Queries) DeleteDeviceKey(ctx context.Context, arg DeleteDeviceKeyParams
 	return err
 }
 
+const getDeviceIdentifiersForGroup = `-- name: GetDeviceIdentifiersForGroup :many
+SELECT dk.device_identifier
+FROM device_keys dk
+JOIN user_groups ug ON ug.user_id = dk.user_id
+JOIN groups g ON g.id = ug.group_id
+WHERE ug.group_id = $1
+  AND ug.deleted_at IS NULL
+  AND g.deleted_at IS NULL
+`
+
+func (q *Queries) GetDeviceIdentifiersForGroup(ctx context.Context, groupID *uuid.UUID) ([]string, error) {
+	rows, err := q.db.Query(ctx, getDeviceIdentifiersForGroup, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var device_identifier string
+		if err := rows.Scan(&device_identifier); err != nil {
+			return nil, err
+		}
+		items = append(items, device_identifier)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getDeviceKeyByIdentifier = `-- name: GetDeviceKeyByIdentifier :one
 SELECT id, user_id, device_identifier, public_key, created_at, last_seen_at, expo_push_token, notifications_enabled, signing_public_key FROM device_keys
 WHERE user_id = $1 AND device_identifier = $2
@@ -123,6 +153,9 @@ FROM device_keys
 WHERE user_id = ANY($1::uuid[])
   AND expo_push_token IS NOT NULL
   AND notifications_enabled = true
+  AND NOT EXISTS (
+    SELECT 1 FROM users u WHERE u.id = device_keys.user_id AND u.deactivated_at IS NOT NULL
+  )
 `
 
 type GetPushTokensForUsersRow struct {
@@ -151,6 +184,40 @@ func (q *Queries) GetPushTokensForUsers(ctx context.Context, dollar_1 []uuid.UUI
 	return items, nil
 }
 
+const insertDeviceKey = `-- name: InsertDeviceKey :execrows
+INSERT INTO device_keys (
+    user_id,
+    device_identifier,
+    public_key,
+    signing_public_key,
+    last_seen_at
+) VALUES (
+    $1, $2, $3, $4, now()
+)
+ON CONFLICT (user_id, device_identifier) DO NOTHING
+`
+
+type InsertDeviceKeyParams struct {
+	UserID           uuid.UUID `json:"user_id"`
+	DeviceIdentifier string    `json:"device_identifier"`
+	PublicKey        []byte    `json:"public_key"`
+	SigningPublicKey []byte    `json:"signing_public_key"`
+}
+
+// Adds a device without touching an existing one; 0 rows means it is already registered.
+func (q *Queries) InsertDeviceKey(ctx context.Context, arg InsertDeviceKeyParams) (int64, error) {
+	result, err := q.db.Exec(ctx, insertDeviceKey,
+		arg.UserID,
+		arg.DeviceIdentifier,
+		arg.PublicKey,
+		arg.SigningPublicKey,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const registerDeviceKey = `-- name: RegisterDeviceKey :one
 INSERT INTO device_keys (
     user_id,
@@ -197,6 +264,44 @@ func (q *Queries) RegisterDeviceKey(ctx context.Context, arg RegisterDeviceKeyPa
 	return i, err
 }
 
+const rotateDeviceKey = `-- name: RotateDeviceKey :one
+UPDATE device_keys
+SET public_key = $3,
+    signing_public_key = $4,
+    last_seen_at = now()
+WHERE user_id = $1 AND device_identifier = $2
+RETURNING id, user_id, device_identifier, public_key, created_at, last_seen_at, expo_push_token, notifications_enabled, signing_public_key
+`
+
+type RotateDeviceKeyParams struct {
+	UserID           uuid.UUID `json:"user_id"`
+	DeviceIdentifier string    `json:"device_identifier"`
+	PublicKey        []byte    `json:"public_key"`
+	SigningPublicKey []byte    `json:"signing_public_key"`
+}
+
+func (q *Queries) RotateDeviceKey(ctx context.Context, arg RotateDeviceKeyParams) (DeviceKey, error) {
+	row := q.db.QueryRow(ctx, rotateDeviceKey,
+		arg.UserID,
+		arg.DeviceIdentifier,
+		arg.PublicKey,
+		arg.SigningPublicKey,
+	)
+	var i DeviceKey
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.DeviceIdentifier,
+		&i.PublicKey,
+		&i.CreatedAt,
+		&i.LastSeenAt,
+		&i.ExpoPushToken,
+		&i.NotificationsEnabled,
+		&i.SigningPublicKey,
+	)
+	return i, err
+}
+
 const updateDeviceKeyLastSeen = `-- name: UpdateDeviceKeyLastSeen :exec
 UPDATE device_keys
 SET last_seen_at = now()
@@ -86,20 +86,22 @@ func (q *Queries) GetAllGroups(ctx context.Context) ([]GetAllGroupsRow, error) {
 }
 
 const getGroupById = `-- name: GetGroupById :one
-SELECT "id", "name", "description", "location", "image_url", "blurhash", "start_time", "end_time", "created_at", "updated_at" FROM groups WHERE id = $1 AND deleted_at IS NULL
+SELECT "id", "name", "description", "location", "image_url", "blurhash", "start_time", "end_time", "created_at", "updated_at", "requires_approval", "announcement_only" FROM groups WHERE id = $1 AND deleted_at IS NULL
 `
 
 type GetGroupByIdRow struct {
-	ID          uuid.UUID        `json:"id"`
-	Name        string           `json:"name"`
-	Description pgtype.Text      `json:"description"`
-	Location    pgtype.Text      `json:"location"`
-	ImageUrl    pgtype.Text      `json:"image_url"`
-	Blurhash    pgtype.Text      `json:"blurhash"`
-	StartTime   pgtype.Timestamp `json:"start_time"`
-	EndTime     pgtype.Timestamp `json:"end_time"`
-	CreatedAt   pgtype.Timestamp `json:"created_at"`
-	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
+	ID               uuid.UUID        `json:"id"`
+	Name             string           `json:"name"`
+	Description      pgtype.Text      `json:"description"`
+	Location         pgtype.Text      `json:"location"`
+	ImageUrl         pgtype.Text      `json:"image_url"`
+	Blurhash         pgtype.Text      `json:"blurhash"`
+	StartTime        pgtype.Timestamp `json:"start_time"`
+	EndTime          pgtype.Timestamp `json:"end_time"`
+	CreatedAt        pgtype.Timestamp `json:"created_at"`
+	UpdatedAt        pgtype.Timestamp `json:"updated_at"`
+	RequiresApproval bool             `json:"requires_approval"`
+	AnnouncementOnly bool             `json:"announcement_only"`
 }
 
 func (q *Queries) GetGroupById(ctx context.Context, id uuid.UUID) (GetGroupByIdRow, error) {
@@ -116,6 +118,81 @@ func (q *Queries) GetGroupById(ctx context.Context, id uuid.UUID) (GetGroupByIdR
 		&i.EndTime,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.RequiresApproval,
+		&i.AnnouncementOnly,
+	)
+	return i, err
+}
+
+const getGroupChangeTimesForUser = `-- name: GetGroupChangeTimesForUser :many
+SELECT
+    g.id,
+    GREATEST(
+        g.updated_at,
+        MAX(GREATEST(ug2.created_at, ug2.updated_at, ug2.deleted_at))
+    )::timestamp AS changed_at
+FROM groups g
+JOIN user_groups ug ON ug.group_id = g.id
+JOIN user_groups ug2 ON ug2.group_id = g.id
+WHERE ug.user_id = $1 AND ug.deleted_at IS NULL AND g.deleted_at IS NULL
+GROUP BY g.id
+`
+
+type GetGroupChangeTimesForUserRow struct {
+	ID        uuid.UUID        `json:"id"`
+	ChangedAt pgtype.Timestamp `json:"changed_at"`
+}
+
+// When each of the user's current groups last changed in a way GetGroupsForUser
+// reflects: the group row itself or any membership (joins, leaves, role and mute changes).
+func (q *Queries) GetGroupChangeTimesForUser(ctx context.Context, userID *uuid.UUID) ([]GetGroupChangeTimesForUserRow, error) {
+	rows, err := q.db.Query(ctx, getGroupChangeTimesForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetGroupChangeTimesForUserRow
+	for rows.Next() {
+		var i GetGroupChangeTimesForUserRow
+		if err := rows.Scan(&i.ID, &i.ChangedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getGroupStats = `-- name: GetGroupStats :one
+SELECT
+    (SELECT COUNT(*) FROM messages m WHERE m.group_id = $1::uuid) AS message_count,
+    (SELECT COUNT(*) FROM messages m WHERE m.group_id = $1::uuid AND m.created_at > NOW() - INTERVAL '24 hours') AS messages_last_24h,
+    (SELECT COUNT(*) FROM attachments a WHERE a.group_id = $1::uuid) AS attachment_count,
+    (SELECT COALESCE(SUM(a.size), 0) FROM attachments a WHERE a.group_id = $1::uuid)::bigint AS attachment_bytes,
+    (SELECT COUNT(*) FROM user_groups ug WHERE ug.group_id = $1::uuid AND ug.deleted_at IS NULL) AS member_count
+`
+
+type GetGroupStatsRow struct {
+	MessageCount    int64 `json:"message_count"`
+	MessagesLast24h int64 `json:"messages_last_24h"`
+	AttachmentCount int64 `json:"attachment_count"`
+	AttachmentBytes int64 `json:"attachment_bytes"`
+	MemberCount     int64 `json:"member_count"`
+}
+
+// Message, attachment and member totals for a group, for admins sizing it up. Every
+// figure comes from an index on group_id.
+func (q *Queries) GetGroupStats(ctx context.Context, groupID uuid.UUID) (GetGroupStatsRow, error) {
+	row := q.db.QueryRow(ctx, getGroupStats, groupID)
+	var i GetGroupStatsRow
+	err := row.Scan(
+		&i.MessageCount,
+		&i.MessagesLast24h,
+		&i.AttachmentCount,
+		&i.AttachmentBytes,
+		&i.MemberCount,
 	)
 	return i, err
 }
@@ -132,6 +209,7 @@ SELECT
     g.end_time,
     g.created_at,
     g.updated_at,
+    g.announcement_only,
     (SELECT ug_check.admin FROM user_groups ug_check WHERE ug_check.group_id = g.id AND ug_check.user_id = $1 AND ug_check.deleted_at IS NULL) AS admin, -- Admin status of the requesting user for THIS group
     COALESCE(
         (SELECT json_agg(jsonb_build_object('id', u.id, 'username', u.username, 'email', u.email, 'admin', ug.admin, 'invited_at', ug.created_at))
@@ -152,18 +230,19 @@ type GetGroupWithUsersByIDParams struct {
 }
 
 type GetGroupWithUsersByIDRow struct {
-	ID          uuid.UUID        `json:"id"`
-	Name        string           `json:"name"`
-	Description pgtype.Text      `json:"description"`
-	Location    pgtype.Text      `json:"location"`
-	ImageUrl    pgtype.Text      `json:"image_url"`
-	Blurhash    pgtype.Text      `json:"blurhash"`
-	StartTime   pgtype.Timestamp `json:"start_time"`
-	EndTime     pgtype.Timestamp `json:"end_time"`
-	CreatedAt   pgtype.Timestamp `json:"created_at"`
-	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
-	Admin       bool             `json:"admin"`
-	GroupUsers  json.RawMessage  `json:"group_users"`
+	ID               uuid.UUID        `json:"id"`
+	Name             string           `json:"name"`
+	Description      pgtype.Text      `json:"description"`
+	Location         pgtype.Text      `json:"location"`
+	ImageUrl         pgtype.Text      `json:"image_url"`
+	Blurhash         pgtype.Text      `json:"blurhash"`
+	StartTime        pgtype.Timestamp `json:"start_time"`
+	EndTime          pgtype.Timestamp `json:"end_time"`
+	CreatedAt        pgtype.Timestamp `json:"created_at"`
+	UpdatedAt        pgtype.Timestamp `json:"updated_at"`
+	AnnouncementOnly bool             `json:"announcement_only"`
+	Admin            bool             `json:"admin"`
+	GroupUsers       json.RawMessage  `json:"group_users"`
 }
 
 func (q *Queries) GetGroupWithUsersByID(ctx context.Context, arg GetGroupWithUsersByIDParams) (GetGroupWithUsersByIDRow, error) {
@@ -180,6 +259,7 @@ func (q *Queries) GetGroupWithUsersByID(ctx context.Context, arg GetGroupWithUse
 		&i.EndTime,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.AnnouncementOnly,
 		&i.Admin,
 		&i.GroupUsers,
 	)
@@ -187,7 +267,7 @@ func (q *Queries) GetGroupWithUsersByID(ctx context.Context, arg GetGroupWithUse
 }
 
 const getGroupsForUser = `-- name: GetGroupsForUser :many
-SELECT groups.id, groups.name, groups."description", groups."location", groups."image_url", groups."blurhash", groups.start_time, groups.end_time, groups.created_at, ug.admin, ug.muted, groups.updated_at,
+SELECT groups.id, groups.name, groups."description", groups."location", groups."image_url", groups."blurhash", groups.start_time, groups.end_time, groups.created_at, ug.admin, ug.muted, groups.updated_at, groups.announcement_only,
 json_agg(jsonb_build_object('id', u2.id, 'username', u2.username, 'email', u2.email, 'admin', ug2.admin, 'invited_at', ug2.created_at)) AS group_users
 FROM groups
 JOIN user_groups ug ON ug.group_id = groups.id
@@ -195,24 +275,24 @@ JOIN users u ON u.id = ug.user_id
 JOIN user_groups ug2 ON ug2.group_id = groups.id
 JOIN users u2 ON u2.id = ug2.user_id
 WHERE u.id = $1 AND groups.deleted_at IS NULL AND ug.deleted_at IS NULL AND ug2.deleted_at IS NULL
-  AND (groups.end_time IS NULL OR groups.end_time > NOW())
 GROUP BY groups.id, ug.id, u.id
 `
 
 type GetGroupsForUserRow struct {
-	ID          uuid.UUID        `json:"id"`
-	Name        string           `json:"name"`
-	Description pgtype.Text      `json:"description"`
-	Location    pgtype.Text      `json:"location"`
-	ImageUrl    pgtype.Text      `json:"image_url"`
-	Blurhash    pgtype.Text      `json:"blurhash"`
-	StartTime   pgtype.Timestamp `json:"start_time"`
-	EndTime     pgtype.Timestamp `json:"end_time"`
-	CreatedAt   pgtype.Timestamp `json:"created_at"`
-	Admin       bool             `json:"admin"`
-	Muted       bool             `json:"muted"`
-	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
-	GroupUsers  json.RawMessage  `json:"group_users"`
+	ID               uuid.UUID        `json:"id"`
+	Name             string           `json:"name"`
+	Description      pgtype.Text      `json:"description"`
+	Location         pgtype.Text      `json:"location"`
+	ImageUrl         pgtype.Text      `json:"image_url"`
+	Blurhash         pgtype.Text      `json:"blurhash"`
+	StartTime        pgtype.Timestamp `json:"start_time"`
+	EndTime          pgtype.Timestamp `json:"end_time"`
+	CreatedAt        pgtype.Timestamp `json:"created_at"`
+	Admin            bool             `json:"admin"`
+	Muted            bool             `json:"muted"`
+	UpdatedAt        pgtype.Timestamp `json:"updated_at"`
+	AnnouncementOnly bool             `json:"announcement_only"`
+	GroupUsers       json.RawMessage  `json:"group_users"`
 }
 
 func (q *Queries) GetGroupsForUser(ctx context.Context, id uuid.UUID) ([]GetGroupsForUserRow, error) {
@@ -237,6 +317,7 @@ func (q *Queries) GetGroupsForUser(ctx context.Context, id uuid.UUID) ([]GetGrou
 			&i.Admin,
 			&i.Muted,
 			&i.UpdatedAt,
+			&i.AnnouncementOnly,
 			&i.GroupUsers,
 		); err != nil {
 			return nil, err
@@ -250,18 +331,19 @@ func (q *Queries) GetGroupsForUser(ctx context.Context, id uuid.UUID) ([]GetGrou
 }
 
 const insertGroup = `-- name: InsertGroup :one
-INSERT INTO groups ("id", "name", "start_time", "end_time", "description", "location", "image_url", "blurhash") VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, name, created_at, updated_at, start_time, end_time, description, location, image_url, blurhash, deleted_at
+INSERT INTO groups ("id", "name", "start_time", "end_time", "description", "location", "image_url", "blurhash", "requires_approval") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, name, created_at, updated_at, start_time, end_time, description, location, image_url, blurhash, deleted_at, requires_approval, announcement_only
 `
 
 type InsertGroupParams struct {
-	ID          uuid.UUID        `json:"id"`
-	Name        string           `json:"name"`
-	StartTime   pgtype.Timestamp `json:"start_time"`
-	EndTime     pgtype.Timestamp `json:"end_time"`
-	Description pgtype.Text      `json:"description"`
-	Location    pgtype.Text      `json:"location"`
-	ImageUrl    pgtype.Text      `json:"image_url"`
-	Blurhash    pgtype.Text      `json:"blurhash"`
+	ID               uuid.UUID        `json:"id"`
+	Name             string           `json:"name"`
+	StartTime        pgtype.Timestamp `json:"start_time"`
+	EndTime          pgtype.Timestamp `json:"end_time"`
+	Description      pgtype.Text      `json:"description"`
+	Location         pgtype.Text      `json:"location"`
+	ImageUrl         pgtype.Text      `json:"image_url"`
+	Blurhash         pgtype.Text      `json:"blurhash"`
+	RequiresApproval bool             `json:"requires_approval"`
 }
 
 func (q *Queries) InsertGroup(ctx context.Context, arg InsertGroupParams) (Group, error) {
@@ -274,6 +356,7 @@ func (q *Queries) InsertGroup(ctx context.Context, arg InsertGroupParams) (Group
 		arg.Location,
 		arg.ImageUrl,
 		arg.Blurhash,
+		arg.RequiresApproval,
 	)
 	var i Group
 	err := row.Scan(
@@ -288,10 +371,73 @@ func (q *Queries) InsertGroup(ctx context.Context, arg InsertGroupParams) (Group
 		&i.ImageUrl,
 		&i.Blurhash,
 		&i.DeletedAt,
+		&i.RequiresApproval,
+		&i.AnnouncementOnly,
 	)
 	return i, err
 }
 
+const setGroupBlurhashForImage = `-- name: SetGroupBlurhashForImage :execrows
+UPDATE groups SET blurhash = $3, updated_at = NOW()
+WHERE id = $1 AND image_url = $2 AND deleted_at IS NULL
+`
+
+type SetGroupBlurhashForImageParams struct {
+	ID       uuid.UUID   `json:"id"`
+	ImageUrl pgtype.Text `json:"image_url"`
+	Blurhash pgtype.Text `json:"blurhash"`
+}
+
+// Only applies while the group still shows image_url, so a hash computed for an image
+// that has since been replaced is dropped.
+func (q *Queries) SetGroupBlurhashForImage(ctx context.Context, arg SetGroupBlurhashForImageParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setGroupBlurhashForImage, arg.ID, arg.ImageUrl, arg.Blurhash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const lockGroupImage = `-- name: LockGroupImage :one
+SELECT g.image_url, EXISTS (SELECT 1 FROM attachments a WHERE a.s3_key = g.image_url) AS attachment_key
+FROM groups g
+WHERE g.id = $1 AND g.deleted_at IS NULL
+FOR UPDATE OF g
+`
+
+type LockGroupImageRow struct {
+	ImageUrl      pgtype.Text `json:"image_url"`
+	AttachmentKey bool        `json:"attachment_key"`
+}
+
+// The group's current image, locked so image changes replace it one at a time.
+// attachment_key reports whether an attachment also points at that key.
+func (q *Queries) LockGroupImage(ctx context.Context, id uuid.UUID) (LockGroupImageRow, error) {
+	row := q.db.QueryRow(ctx, lockGroupImage, id)
+	var i LockGroupImageRow
+	err := row.Scan(&i.ImageUrl, &i.AttachmentKey)
+	return i, err
+}
+
+const setGroupImage = `-- name: SetGroupImage :execrows
+UPDATE groups SET image_url = $2, blurhash = $3, updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+type SetGroupImageParams struct {
+	ID       uuid.UUID   `json:"id"`
+	ImageUrl pgtype.Text `json:"image_url"`
+	Blurhash pgtype.Text `json:"blurhash"`
+}
+
+func (q *Queries) SetGroupImage(ctx context.Context, arg SetGroupImageParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setGroupImage, arg.ID, arg.ImageUrl, arg.Blurhash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const updateGroup = `-- name: UpdateGroup :one
 UPDATE groups
 SET
@@ -301,20 +447,29 @@ SET
     "description" = coalesce($5, "description"),
     "location" = coalesce($6, "location"),
     "image_url" = coalesce($7, "image_url"),
-    "blurhash" = coalesce($8, "blurhash")
+    "blurhash" = CASE
+        WHEN $8::text IS NOT NULL THEN $8::text
+        WHEN $7::text IS DISTINCT FROM "image_url" AND $7::text IS NOT NULL THEN NULL
+        ELSE "blurhash"
+    END,
+    "requires_approval" = coalesce($9, "requires_approval"),
+    "announcement_only" = coalesce($10, "announcement_only"),
+    "updated_at" = NOW()
 WHERE id = $1 AND deleted_at IS NULL
 RETURNING "id", "name", "start_time", "end_time", "description", "location", "image_url", "blurhash", "created_at", "updated_at"
 `
 
 type UpdateGroupParams struct {
-	ID          uuid.UUID        `json:"id"`
-	Name        pgtype.Text      `json:"name"`
-	StartTime   pgtype.Timestamp `json:"start_time"`
-	EndTime     pgtype.Timestamp `json:"end_time"`
-	Description pgtype.Text      `json:"description"`
-	Location    pgtype.Text      `json:"location"`
-	ImageUrl    pgtype.Text      `json:"image_url"`
-	Blurhash    pgtype.Text      `json:"blurhash"`
+	ID               uuid.UUID        `json:"id"`
+	Name             pgtype.Text      `json:"name"`
+	StartTime        pgtype.Timestamp `json:"start_time"`
+	EndTime          pgtype.Timestamp `json:"end_time"`
+	Description      pgtype.Text      `json:"description"`
+	Location         pgtype.Text      `json:"location"`
+	ImageUrl         pgtype.Text      `json:"image_url"`
+	Blurhash         pgtype.Text      `json:"blurhash"`
+	RequiresApproval pgtype.Bool      `json:"requires_approval"`
+	AnnouncementOnly pgtype.Bool      `json:"announcement_only"`
 }
 
 type UpdateGroupRow struct {
@@ -330,6 +485,8 @@ type UpdateGroupRow struct {
 	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
 }
 
+// A new image_url without a blurhash clears the old image's blurhash, so clients don't
+// show the previous image's placeholder until the server computes the new one.
 func (q *Queries) UpdateGroup(ctx context.Context, arg UpdateGroupParams) (UpdateGroupRow, error) {
 	row := q.db.QueryRow(ctx, updateGroup,
 		arg.ID,
@@ -340,6 +497,8 @@ func (q *Queries) UpdateGroup(ctx context.Context, arg UpdateGroupParams) (Updat
 		arg.Location,
 		arg.ImageUrl,
 		arg.Blurhash,
+		arg.RequiresApproval,
+		arg.AnnouncementOnly,
 	)
 	var i UpdateGroupRow
 	err := row.Scan(
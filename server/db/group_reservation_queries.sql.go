@@ -44,6 +44,19 @@ func (q *Queries) GetGroupReservation(ctx context.Context, groupID uuid.UUID) (G
 	return i, err
 }
 
+const getGroupReservationForUpdate = `-- name: GetGroupReservationForUpdate :one
+SELECT group_id, user_id, created_at FROM group_reservations
+WHERE group_id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetGroupReservationForUpdate(ctx context.Context, groupID uuid.UUID) (GroupReservation, error) {
+	row := q.db.QueryRow(ctx, getGroupReservationForUpdate, groupID)
+	var i GroupReservation
+	err := row.Scan(&i.GroupID, &i.UserID, &i.CreatedAt)
+	return i, err
+}
+
 const getGroupReservationsForUser = `-- name: GetGroupReservationsForUser :many
 SELECT group_id, user_id, created_at FROM group_reservations
 WHERE user_id = $1
@@ -70,6 +83,24 @@ func (q *Queries) GetGroupReservationsForUser(ctx context.Context, userID uuid.U
 	return items, nil
 }
 
+const releaseGroupReservation = `-- name: ReleaseGroupReservation :execrows
+DELETE FROM group_reservations
+WHERE group_id = $1 AND user_id = $2
+`
+
+type ReleaseGroupReservationParams struct {
+	GroupID uuid.UUID `json:"group_id"`
+	UserID  uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) ReleaseGroupReservation(ctx context.Context, arg ReleaseGroupReservationParams) (int64, error) {
+	result, err := q.db.Exec(ctx, releaseGroupReservation, arg.GroupID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const reserveGroup = `-- name: ReserveGroup :one
 INSERT INTO group_reservations (
     group_id,
@@ -77,6 +108,7 @@ INSERT INTO group_reservations (
 ) VALUES (
     $1, $2
 )
+ON CONFLICT (group_id) DO NOTHING
 RETURNING group_id, user_id, created_at
 `
 
@@ -91,3 +123,25 @@ func (q *Queries) ReserveGroup(ctx context.Context, arg ReserveGroupParams) (Gro
 	err := row.Scan(&i.GroupID, &i.UserID, &i.CreatedAt)
 	return i, err
 }
+
+const transferGroupReservation = `-- name: TransferGroupReservation :execrows
+UPDATE group_reservations
+SET user_id = $1
+WHERE group_id = $2 AND user_id = $3
+`
+
+type TransferGroupReservationParams struct {
+	ToUserID   uuid.UUID `json:"to_user_id"`
+	GroupID    uuid.UUID `json:"group_id"`
+	FromUserID uuid.UUID `json:"from_user_id"`
+}
+
+// Hands the reservation over only while from_user_id still holds it. created_at is
+// kept, so passing a reservation around doesn't extend it past the stale window.
+func (q *Queries) TransferGroupReservation(ctx context.Context, arg TransferGroupReservationParams) (int64, error) {
+	result, err := q.db.Exec(ctx, transferGroupReservation, arg.ToUserID, arg.GroupID, arg.FromUserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
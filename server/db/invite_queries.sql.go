@@ -12,6 +12,28 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const capInviteExpiries = `-- name: CapInviteExpiries :execrows
+UPDATE invites
+SET expires_at = $1
+WHERE group_id = $2
+  AND (expires_at IS NULL OR expires_at > $1)
+`
+
+type CapInviteExpiriesParams struct {
+	EndTime pgtype.Timestamptz `json:"end_time"`
+	GroupID uuid.UUID          `json:"group_id"`
+}
+
+// Pulls in invites that would outlive the group's new end time, so expires_at never
+// passes end_time after an end time is shortened.
+func (q *Queries) CapInviteExpiries(ctx context.Context, arg CapInviteExpiriesParams) (int64, error) {
+	result, err := q.db.Exec(ctx, capInviteExpiries, arg.EndTime, arg.GroupID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const deleteInvite = `-- name: DeleteInvite :exec
 DELETE FROM invites WHERE id = $1
 `
@@ -30,20 +52,22 @@ SELECT
     g.blurhash,
     g.start_time,
     g.end_time,
+    g.requires_approval,
     (SELECT COUNT(*) FROM user_groups ug WHERE ug.group_id = g.id AND ug.deleted_at IS NULL)::int AS member_count
 FROM groups g
 WHERE g.id = $1 AND g.deleted_at IS NULL
 `
 
 type GetGroupPreviewByIDRow struct {
-	ID          uuid.UUID        `json:"id"`
-	Name        string           `json:"name"`
-	Description pgtype.Text      `json:"description"`
-	ImageUrl    pgtype.Text      `json:"image_url"`
-	Blurhash    pgtype.Text      `json:"blurhash"`
-	StartTime   pgtype.Timestamp `json:"start_time"`
-	EndTime     pgtype.Timestamp `json:"end_time"`
-	MemberCount int32            `json:"member_count"`
+	ID               uuid.UUID        `json:"id"`
+	Name             string           `json:"name"`
+	Description      pgtype.Text      `json:"description"`
+	ImageUrl         pgtype.Text      `json:"image_url"`
+	Blurhash         pgtype.Text      `json:"blurhash"`
+	StartTime        pgtype.Timestamp `json:"start_time"`
+	EndTime          pgtype.Timestamp `json:"end_time"`
+	RequiresApproval bool             `json:"requires_approval"`
+	MemberCount      int32            `json:"member_count"`
 }
 
 func (q *Queries) GetGroupPreviewByID(ctx context.Context, id uuid.UUID) (GetGroupPreviewByIDRow, error) {
@@ -57,6 +81,7 @@ func (q *Queries) GetGroupPreviewByID(ctx context.Context, id uuid.UUID) (GetGro
 		&i.Blurhash,
 		&i.StartTime,
 		&i.EndTime,
+		&i.RequiresApproval,
 		&i.MemberCount,
 	)
 	return i, err
@@ -115,6 +140,58 @@ func (q *Queries) GetInvitesByGroup(ctx context.Context, groupID uuid.UUID) ([]I
 	return items, nil
 }
 
+const getRecentInviteJoinsForGroup = `-- name: GetRecentInviteJoinsForGroup :many
+SELECT invite_id, user_id, username, joined_at
+FROM (
+    SELECT ij.invite_id, ij.user_id, u.username, ij.joined_at,
+        ROW_NUMBER() OVER (PARTITION BY ij.invite_id ORDER BY ij.joined_at DESC) AS rn
+    FROM invite_joins ij
+    JOIN invites i ON i.id = ij.invite_id
+    JOIN users u ON u.id = ij.user_id
+    WHERE i.group_id = $1
+) recent
+WHERE rn <= $2::int
+ORDER BY invite_id, joined_at DESC
+`
+
+type GetRecentInviteJoinsForGroupParams struct {
+	GroupID        uuid.UUID `json:"group_id"`
+	JoinsPerInvite int32     `json:"joins_per_invite"`
+}
+
+type GetRecentInviteJoinsForGroupRow struct {
+	InviteID uuid.UUID          `json:"invite_id"`
+	UserID   uuid.UUID          `json:"user_id"`
+	Username string             `json:"username"`
+	JoinedAt pgtype.Timestamptz `json:"joined_at"`
+}
+
+// The most recent joins_per_invite joins through each of the group's invites.
+func (q *Queries) GetRecentInviteJoinsForGroup(ctx context.Context, arg GetRecentInviteJoinsForGroupParams) ([]GetRecentInviteJoinsForGroupRow, error) {
+	rows, err := q.db.Query(ctx, getRecentInviteJoinsForGroup, arg.GroupID, arg.JoinsPerInvite)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRecentInviteJoinsForGroupRow
+	for rows.Next() {
+		var i GetRecentInviteJoinsForGroupRow
+		if err := rows.Scan(
+			&i.InviteID,
+			&i.UserID,
+			&i.Username,
+			&i.JoinedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const incrementInviteUseCount = `-- name: IncrementInviteUseCount :execrows
 UPDATE invites
 SET use_count = use_count + 1
@@ -165,3 +242,17 @@ func (q *Queries) InsertInvite(ctx context.Context, arg InsertInviteParams) (Inv
 	)
 	return i, err
 }
+
+const recordInviteJoin = `-- name: RecordInviteJoin :exec
+INSERT INTO invite_joins (invite_id, user_id) VALUES ($1, $2)
+`
+
+type RecordInviteJoinParams struct {
+	InviteID uuid.UUID `json:"invite_id"`
+	UserID   uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) RecordInviteJoin(ctx context.Context, arg RecordInviteJoinParams) error {
+	_, err := q.db.Exec(ctx, recordInviteJoin, arg.InviteID, arg.UserID)
+	return err
+}
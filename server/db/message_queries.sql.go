@@ -12,6 +12,43 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const deleteExpiredMessages = `-- name: DeleteExpiredMessages :many
+DELETE FROM messages
+WHERE id IN (
+    SELECT id FROM messages
+    WHERE expires_at <= NOW()
+    ORDER BY expires_at
+    LIMIT $1
+)
+RETURNING id, group_id
+`
+
+type DeleteExpiredMessagesRow struct {
+	ID      uuid.UUID  `json:"id"`
+	GroupID *uuid.UUID `json:"group_id"`
+}
+
+// Deletes up to page_size messages whose sender-set expiry has passed.
+func (q *Queries) DeleteExpiredMessages(ctx context.Context, pageSize int32) ([]DeleteExpiredMessagesRow, error) {
+	rows, err := q.db.Query(ctx, deleteExpiredMessages, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DeleteExpiredMessagesRow
+	for rows.Next() {
+		var i DeleteExpiredMessagesRow
+		if err := rows.Scan(&i.ID, &i.GroupID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const deleteMessage = `-- name: DeleteMessage :one
 DELETE FROM messages
 WHERE id = $1
@@ -39,6 +76,52 @@ func (q *Queries) DeleteMessage(ctx context.Context, id uuid.UUID) (DeleteMessag
 	return i, err
 }
 
+const deleteMessagesCreatedBefore = `-- name: DeleteMessagesCreatedBefore :many
+DELETE FROM messages
+WHERE id IN (
+    SELECT m.id FROM messages m
+    JOIN groups g ON g.id = m.group_id
+    WHERE m.created_at < $1
+      AND g.deleted_at IS NULL
+      AND (g.end_time IS NULL OR g.end_time >= NOW())
+    ORDER BY m.created_at
+    LIMIT $2
+)
+RETURNING id, group_id
+`
+
+type DeleteMessagesCreatedBeforeParams struct {
+	Cutoff   pgtype.Timestamp `json:"cutoff"`
+	PageSize int32            `json:"page_size"`
+}
+
+type DeleteMessagesCreatedBeforeRow struct {
+	ID      uuid.UUID  `json:"id"`
+	GroupID *uuid.UUID `json:"group_id"`
+}
+
+// Deletes up to page_size messages older than cutoff in live groups. Ended and
+// soft-deleted groups are left to cleanup_expired_groups, which removes all their data.
+func (q *Queries) DeleteMessagesCreatedBefore(ctx context.Context, arg DeleteMessagesCreatedBeforeParams) ([]DeleteMessagesCreatedBeforeRow, error) {
+	rows, err := q.db.Query(ctx, deleteMessagesCreatedBefore, arg.Cutoff, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DeleteMessagesCreatedBeforeRow
+	for rows.Next() {
+		var i DeleteMessagesCreatedBeforeRow
+		if err := rows.Scan(&i.ID, &i.GroupID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getAllMessages = `-- name: GetAllMessages :many
 SELECT
     id,
@@ -104,6 +187,113 @@ func (q *Queries) GetAllMessages(ctx context.Context) ([]GetAllMessagesRow, erro
 	return items, nil
 }
 
+const getForwardableMessage = `-- name: GetForwardableMessage :one
+SELECT m.id, m.group_id, m.user_id, m.message_type
+FROM messages m
+JOIN user_groups ug ON ug.group_id = m.group_id
+JOIN groups g ON g.id = m.group_id
+WHERE m.id = $1
+  AND ug.user_id = $2
+  AND m.created_at > ug.created_at
+  AND ug.deleted_at IS NULL
+  AND g.deleted_at IS NULL
+  AND (m.expires_at IS NULL OR m.expires_at > NOW())
+`
+
+type GetForwardableMessageParams struct {
+	MessageID uuid.UUID  `json:"message_id"`
+	UserID    *uuid.UUID `json:"user_id"`
+}
+
+type GetForwardableMessageRow struct {
+	ID          uuid.UUID   `json:"id"`
+	GroupID     *uuid.UUID  `json:"group_id"`
+	UserID      *uuid.UUID  `json:"user_id"`
+	MessageType MessageType `json:"message_type"`
+}
+
+func (q *Queries) GetForwardableMessage(ctx context.Context, arg GetForwardableMessageParams) (GetForwardableMessageRow, error) {
+	row := q.db.QueryRow(ctx, getForwardableMessage, arg.MessageID, arg.UserID)
+	var i GetForwardableMessageRow
+	err := row.Scan(
+		&i.ID,
+		&i.GroupID,
+		&i.UserID,
+		&i.MessageType,
+	)
+	return i, err
+}
+
+const getGroupActivityForUser = `-- name: GetGroupActivityForUser :many
+SELECT
+    ug.group_id,
+    last_msg.created_at AS last_message_at,
+    last_msg.user_id AS last_sender_id,
+    last_msg.username AS last_sender_username,
+    last_msg.message_type AS last_message_type,
+    (
+        SELECT COUNT(*)
+        FROM messages unread
+        WHERE unread.group_id = ug.group_id
+        AND unread.created_at > COALESCE(ug.last_read_at, ug.created_at)
+        AND unread.user_id IS DISTINCT FROM ug.user_id
+        AND unread.message_type <> 'control'
+        AND (unread.expires_at IS NULL OR unread.expires_at > NOW())
+    ) AS unread_count
+FROM user_groups ug
+LEFT JOIN LATERAL (
+    SELECT m.created_at, m.user_id, u.username, m.message_type
+    FROM messages m
+    LEFT JOIN users u ON u.id = m.user_id
+    WHERE m.group_id = ug.group_id
+    AND m.created_at > ug.created_at
+    AND m.message_type <> 'control'
+    AND (m.expires_at IS NULL OR m.expires_at > NOW())
+    ORDER BY m.created_at DESC
+    LIMIT 1
+) last_msg ON true
+WHERE ug.user_id = $1 AND ug.deleted_at IS NULL
+`
+
+type GetGroupActivityForUserRow struct {
+	GroupID            *uuid.UUID       `json:"group_id"`
+	LastMessageAt      pgtype.Timestamp `json:"last_message_at"`
+	LastSenderID       *uuid.UUID       `json:"last_sender_id"`
+	LastSenderUsername pgtype.Text      `json:"last_sender_username"`
+	LastMessageType    NullMessageType  `json:"last_message_type"`
+	UnreadCount        int64            `json:"unread_count"`
+}
+
+// Metadata about the latest visible message in each of the user's groups (content is
+// E2EE) and how many messages from others arrived since they last marked the group
+// read, or since they joined. Control messages are not counted.
+func (q *Queries) GetGroupActivityForUser(ctx context.Context, userID *uuid.UUID) ([]GetGroupActivityForUserRow, error) {
+	rows, err := q.db.Query(ctx, getGroupActivityForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetGroupActivityForUserRow
+	for rows.Next() {
+		var i GetGroupActivityForUserRow
+		if err := rows.Scan(
+			&i.GroupID,
+			&i.LastMessageAt,
+			&i.LastSenderID,
+			&i.LastSenderUsername,
+			&i.LastMessageType,
+			&i.UnreadCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getMessageById = `-- name: GetMessageById :one
 SELECT
     id,
@@ -154,6 +344,57 @@ func (q *Queries) GetMessageById(ctx context.Context, id uuid.UUID) (GetMessageB
 	return i, err
 }
 
+const getMessageEditHistory = `-- name: GetMessageEditHistory :many
+SELECT id, ciphertext, msg_nonce, key_envelopes, sender_device_identifier, signature, created_at
+FROM message_edits
+WHERE message_id = $1
+ORDER BY created_at DESC
+LIMIT $2
+`
+
+type GetMessageEditHistoryParams struct {
+	MessageID uuid.UUID `json:"message_id"`
+	PageSize  int32     `json:"page_size"`
+}
+
+type GetMessageEditHistoryRow struct {
+	ID                     uuid.UUID        `json:"id"`
+	Ciphertext             []byte           `json:"ciphertext"`
+	MsgNonce               []byte           `json:"msg_nonce"`
+	KeyEnvelopes           []byte           `json:"key_envelopes"`
+	SenderDeviceIdentifier pgtype.Text      `json:"sender_device_identifier"`
+	Signature              []byte           `json:"signature"`
+	CreatedAt              pgtype.Timestamp `json:"created_at"`
+}
+
+func (q *Queries) GetMessageEditHistory(ctx context.Context, arg GetMessageEditHistoryParams) ([]GetMessageEditHistoryRow, error) {
+	rows, err := q.db.Query(ctx, getMessageEditHistory, arg.MessageID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetMessageEditHistoryRow
+	for rows.Next() {
+		var i GetMessageEditHistoryRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Ciphertext,
+			&i.MsgNonce,
+			&i.KeyEnvelopes,
+			&i.SenderDeviceIdentifier,
+			&i.Signature,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getMessagesForGroup = `-- name: GetMessagesForGroup :many
 SELECT
     m.id,
@@ -221,6 +462,69 @@ func (q *Queries) GetMessagesForGroup(ctx context.Context, groupID *uuid.UUID) (
 	return items, nil
 }
 
+const getMessagesSentByUserPage = `-- name: GetMessagesSentByUserPage :many
+SELECT id, group_id, created_at, message_type, msg_nonce, ciphertext, sender_device_identifier, key_envelopes, signature
+FROM messages
+WHERE user_id = $1
+  AND (created_at, id) > ($2::timestamp, $3::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type GetMessagesSentByUserPageParams struct {
+	UserID         *uuid.UUID       `json:"user_id"`
+	AfterCreatedAt pgtype.Timestamp `json:"after_created_at"`
+	AfterID        uuid.UUID        `json:"after_id"`
+	PageSize       int32            `json:"page_size"`
+}
+
+type GetMessagesSentByUserPageRow struct {
+	ID                     uuid.UUID        `json:"id"`
+	GroupID                *uuid.UUID       `json:"group_id"`
+	CreatedAt              pgtype.Timestamp `json:"created_at"`
+	MessageType            MessageType      `json:"message_type"`
+	MsgNonce               []byte           `json:"msg_nonce"`
+	Ciphertext             []byte           `json:"ciphertext"`
+	SenderDeviceIdentifier pgtype.Text      `json:"sender_device_identifier"`
+	KeyEnvelopes           []byte           `json:"key_envelopes"`
+	Signature              []byte           `json:"signature"`
+}
+
+func (q *Queries) GetMessagesSentByUserPage(ctx context.Context, arg GetMessagesSentByUserPageParams) ([]GetMessagesSentByUserPageRow, error) {
+	rows, err := q.db.Query(ctx, getMessagesSentByUserPage,
+		arg.UserID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetMessagesSentByUserPageRow
+	for rows.Next() {
+		var i GetMessagesSentByUserPageRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.GroupID,
+			&i.CreatedAt,
+			&i.MessageType,
+			&i.MsgNonce,
+			&i.Ciphertext,
+			&i.SenderDeviceIdentifier,
+			&i.KeyEnvelopes,
+			&i.Signature,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getRelevantMessages = `-- name: GetRelevantMessages :many
 SELECT
     m.id,
@@ -233,24 +537,41 @@ SELECT
     m.msg_nonce,
     m.key_envelopes,
     m.sender_device_identifier,
-    m.signature
+    m.signature,
+    m.forwarded_from_message_id,
+    m.forwarded_from_group_id,
+    m.forwarded_from_sender_id,
+    m.expires_at
 FROM messages m
 JOIN user_groups ug ON ug.group_id = m.group_id
 JOIN users u_member ON ug.user_id = u_member.id 
-JOIN users u_sender ON m.user_id = u_sender.id
+LEFT JOIN users u_sender ON m.user_id = u_sender.id
 JOIN groups g ON m.group_id = g.id
 WHERE u_member.id = $1
 AND m.created_at > ug.created_at
 AND ug.deleted_at IS NULL
 AND g.deleted_at IS NULL
-AND (g.end_time IS NULL OR g.end_time > NOW())
+AND (m.expires_at IS NULL OR m.expires_at > NOW())
+AND NOT EXISTS (
+    SELECT 1 FROM device_group_deliveries dgd
+    WHERE dgd.user_id = ug.user_id
+      AND dgd.group_id = m.group_id
+      AND dgd.device_identifier = $2
+      AND m.created_at < dgd.delivered_at - $3::interval
+)
 `
 
+type GetRelevantMessagesParams struct {
+	UserID           uuid.UUID       `json:"user_id"`
+	DeviceIdentifier pgtype.Text     `json:"device_identifier"`
+	ReplayMargin     pgtype.Interval `json:"replay_margin"`
+}
+
 type GetRelevantMessagesRow struct {
 	ID                     uuid.UUID        `json:"id"`
 	GroupID                *uuid.UUID       `json:"group_id"`
 	SenderID               *uuid.UUID       `json:"sender_id"`
-	SenderUsername         string           `json:"sender_username"`
+	SenderUsername         pgtype.Text      `json:"sender_username"`
 	Timestamp              pgtype.Timestamp `json:"timestamp"`
 	Ciphertext             []byte           `json:"ciphertext"`
 	MessageType            MessageType      `json:"message_type"`
@@ -258,10 +579,18 @@ type GetRelevantMessagesRow struct {
 	KeyEnvelopes           []byte           `json:"key_envelopes"`
 	SenderDeviceIdentifier pgtype.Text      `json:"sender_device_identifier"`
 	Signature              []byte           `json:"signature"`
+	ForwardedFromMessageID *uuid.UUID       `json:"forwarded_from_message_id"`
+	ForwardedFromGroupID   *uuid.UUID       `json:"forwarded_from_group_id"`
+	ForwardedFromSenderID  *uuid.UUID       `json:"forwarded_from_sender_id"`
+	ExpiresAt              pgtype.Timestamp `json:"expires_at"`
 }
 
-func (q *Queries) GetRelevantMessages(ctx context.Context, id uuid.UUID) ([]GetRelevantMessagesRow, error) {
-	rows, err := q.db.Query(ctx, getRelevantMessages, id)
+// With a device_identifier, messages created more than replay_margin before that
+// device's reported delivery position in each group are left out. created_at is when
+// the inserting transaction started, so a message committed after the device's report
+// can sort before it; the margin must cover the longest a message save can take.
+func (q *Queries) GetRelevantMessages(ctx context.Context, arg GetRelevantMessagesParams) ([]GetRelevantMessagesRow, error) {
+	rows, err := q.db.Query(ctx, getRelevantMessages, arg.UserID, arg.DeviceIdentifier, arg.ReplayMargin)
 	if err != nil {
 		return nil, err
 	}
@@ -281,6 +610,10 @@ func (q *Queries) GetRelevantMessages(ctx context.Context, id uuid.UUID) ([]GetR
 			&i.KeyEnvelopes,
 			&i.SenderDeviceIdentifier,
 			&i.Signature,
+			&i.ForwardedFromMessageID,
+			&i.ForwardedFromGroupID,
+			&i.ForwardedFromSenderID,
+			&i.ExpiresAt,
 		); err != nil {
 			return nil, err
 		}
@@ -302,22 +635,32 @@ INSERT INTO messages (
     msg_nonce,
     key_envelopes,
     sender_device_identifier,
-    signature
+    signature,
+    forwarded_from_message_id,
+    forwarded_from_group_id,
+    forwarded_from_sender_id,
+    expires_at
 ) VALUES (
-    $1, $2, $3, $4, $5, $6, $7, $8, $9
-) RETURNING id, user_id, group_id, created_at, updated_at, ciphertext, message_type, msg_nonce, key_envelopes, sender_device_identifier, signature
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
+)
+ON CONFLICT (id) DO NOTHING
+RETURNING id, user_id, group_id, created_at, updated_at, ciphertext, message_type, msg_nonce, key_envelopes, sender_device_identifier, signature
 `
 
 type InsertMessageParams struct {
-	ID                     uuid.UUID   `json:"id"`
-	UserID                 *uuid.UUID  `json:"user_id"`
-	GroupID                *uuid.UUID  `json:"group_id"`
-	Ciphertext             []byte      `json:"ciphertext"`
-	MessageType            MessageType `json:"message_type"`
-	MsgNonce               []byte      `json:"msg_nonce"`
-	KeyEnvelopes           []byte      `json:"key_envelopes"`
-	SenderDeviceIdentifier pgtype.Text `json:"sender_device_identifier"`
-	Signature              []byte      `json:"signature"`
+	ID                     uuid.UUID        `json:"id"`
+	UserID                 *uuid.UUID       `json:"user_id"`
+	GroupID                *uuid.UUID       `json:"group_id"`
+	Ciphertext             []byte           `json:"ciphertext"`
+	MessageType            MessageType      `json:"message_type"`
+	MsgNonce               []byte           `json:"msg_nonce"`
+	KeyEnvelopes           []byte           `json:"key_envelopes"`
+	SenderDeviceIdentifier pgtype.Text      `json:"sender_device_identifier"`
+	Signature              []byte           `json:"signature"`
+	ForwardedFromMessageID *uuid.UUID       `json:"forwarded_from_message_id"`
+	ForwardedFromGroupID   *uuid.UUID       `json:"forwarded_from_group_id"`
+	ForwardedFromSenderID  *uuid.UUID       `json:"forwarded_from_sender_id"`
+	ExpiresAt              pgtype.Timestamp `json:"expires_at"`
 }
 
 type InsertMessageRow struct {
@@ -345,6 +688,10 @@ func (q *Queries) InsertMessage(ctx context.Context, arg InsertMessageParams) (I
 		arg.KeyEnvelopes,
 		arg.SenderDeviceIdentifier,
 		arg.Signature,
+		arg.ForwardedFromMessageID,
+		arg.ForwardedFromGroupID,
+		arg.ForwardedFromSenderID,
+		arg.ExpiresAt,
 	)
 	var i InsertMessageRow
 	err := row.Scan(
@@ -362,3 +709,95 @@ func (q *Queries) InsertMessage(ctx context.Context, arg InsertMessageParams) (I
 	)
 	return i, err
 }
+
+const insertMessageEdit = `-- name: InsertMessageEdit :exec
+INSERT INTO message_edits (message_id, ciphertext, msg_nonce, key_envelopes, sender_device_identifier, signature)
+SELECT id, ciphertext, msg_nonce, key_envelopes, sender_device_identifier, signature
+FROM messages
+WHERE id = $1
+`
+
+// Copies the message's current version into message_edits. Call it in the same
+// transaction as the update that replaces the version.
+func (q *Queries) InsertMessageEdit(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, insertMessageEdit, id)
+	return err
+}
+
+const insertMessageMentions = `-- name: InsertMessageMentions :exec
+INSERT INTO message_mentions (message_id, user_id, group_id)
+SELECT $1::uuid, unnest($2::UUID[]), $3::uuid
+ON CONFLICT DO NOTHING
+`
+
+type InsertMessageMentionsParams struct {
+	MessageID uuid.UUID   `json:"message_id"`
+	UserIds   []uuid.UUID `json:"user_ids"`
+	GroupID   uuid.UUID   `json:"group_id"`
+}
+
+func (q *Queries) InsertMessageMentions(ctx context.Context, arg InsertMessageMentionsParams) error {
+	_, err := q.db.Exec(ctx, insertMessageMentions, arg.MessageID, arg.UserIds, arg.GroupID)
+	return err
+}
+
+const pruneMessageEdits = `-- name: PruneMessageEdits :exec
+DELETE FROM message_edits
+WHERE message_id = $1
+  AND id NOT IN (
+    SELECT id FROM message_edits
+    WHERE message_id = $1
+    ORDER BY created_at DESC
+    LIMIT $2
+  )
+`
+
+type PruneMessageEditsParams struct {
+	MessageID uuid.UUID `json:"message_id"`
+	Keep      int32     `json:"keep"`
+}
+
+// Keeps only the newest keep versions of a message.
+func (q *Queries) PruneMessageEdits(ctx context.Context, arg PruneMessageEditsParams) error {
+	_, err := q.db.Exec(ctx, pruneMessageEdits, arg.MessageID, arg.Keep)
+	return err
+}
+
+const updateMessageVersion = `-- name: UpdateMessageVersion :one
+UPDATE messages
+SET ciphertext = $1,
+    msg_nonce = $2,
+    key_envelopes = $3,
+    sender_device_identifier = $4,
+    signature = $5,
+    updated_at = NOW()
+WHERE id = $6 AND user_id = $7
+RETURNING updated_at
+`
+
+type UpdateMessageVersionParams struct {
+	Ciphertext             []byte      `json:"ciphertext"`
+	MsgNonce               []byte      `json:"msg_nonce"`
+	KeyEnvelopes           []byte      `json:"key_envelopes"`
+	SenderDeviceIdentifier pgtype.Text `json:"sender_device_identifier"`
+	Signature              []byte      `json:"signature"`
+	ID                     uuid.UUID   `json:"id"`
+	UserID                 *uuid.UUID  `json:"user_id"`
+}
+
+// Replaces the content of one of user_id's messages with a new version. Copy the
+// current version with InsertMessageEdit first, in the same transaction.
+func (q *Queries) UpdateMessageVersion(ctx context.Context, arg UpdateMessageVersionParams) (pgtype.Timestamp, error) {
+	row := q.db.QueryRow(ctx, updateMessageVersion,
+		arg.Ciphertext,
+		arg.MsgNonce,
+		arg.KeyEnvelopes,
+		arg.SenderDeviceIdentifier,
+		arg.Signature,
+		arg.ID,
+		arg.UserID,
+	)
+	var updated_at pgtype.Timestamp
+	err := row.Scan(&updated_at)
+	return updated_at, err
+}
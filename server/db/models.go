@@ -55,6 +55,28 @@ func (ns NullMessageType) Value() (driver.Value, error) {
 	return string(ns.MessageType), nil
 }
 
+type Attachment struct {
+	ID          uuid.UUID        `json:"id"`
+	GroupID     uuid.UUID        `json:"group_id"`
+	MessageID   uuid.UUID        `json:"message_id"`
+	S3Key       string           `json:"s3_key"`
+	ContentType string           `json:"content_type"`
+	Size        int64            `json:"size"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+	UploaderID  *uuid.UUID       `json:"uploader_id"`
+	BoundAt     pgtype.Timestamp `json:"bound_at"`
+}
+
+type AuditLog struct {
+	ID           uuid.UUID        `json:"id"`
+	GroupID      uuid.UUID        `json:"group_id"`
+	ActorID      *uuid.UUID       `json:"actor_id"`
+	Action       string           `json:"action"`
+	TargetUserID *uuid.UUID       `json:"target_user_id"`
+	Details      []byte           `json:"details"`
+	CreatedAt    pgtype.Timestamp `json:"created_at"`
+}
+
 type BlockedUser struct {
 	ID        uuid.UUID        `json:"id"`
 	BlockerID uuid.UUID        `json:"blocker_id"`
@@ -62,6 +84,22 @@ type BlockedUser struct {
 	CreatedAt pgtype.Timestamp `json:"created_at"`
 }
 
+type DeviceGroupDelivery struct {
+	UserID           uuid.UUID        `json:"user_id"`
+	DeviceIdentifier string           `json:"device_identifier"`
+	GroupID          uuid.UUID        `json:"group_id"`
+	MessageID        uuid.UUID        `json:"message_id"`
+	DeliveredAt      pgtype.Timestamp `json:"delivered_at"`
+	UpdatedAt        pgtype.Timestamp `json:"updated_at"`
+}
+
+type DeviceGroupRead struct {
+	UserID           uuid.UUID        `json:"user_id"`
+	DeviceIdentifier string           `json:"device_identifier"`
+	GroupID          uuid.UUID        `json:"group_id"`
+	LastReadAt       pgtype.Timestamp `json:"last_read_at"`
+}
+
 type DeviceKey struct {
 	ID     uuid.UUID `json:"id"`
 	UserID uuid.UUID `json:"user_id"`
@@ -77,18 +115,34 @@ type DeviceKey struct {
 	SigningPublicKey []byte `json:"signing_public_key"`
 }
 
+type EmailChange struct {
+	UserID    uuid.UUID        `json:"user_id"`
+	NewEmail  string           `json:"new_email"`
+	TokenHash string           `json:"token_hash"`
+	ExpiresAt pgtype.Timestamp `json:"expires_at"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
 type Group struct {
-	ID          uuid.UUID        `json:"id"`
-	Name        string           `json:"name"`
-	CreatedAt   pgtype.Timestamp `json:"created_at"`
-	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
-	StartTime   pgtype.Timestamp `json:"start_time"`
-	EndTime     pgtype.Timestamp `json:"end_time"`
-	Description pgtype.Text      `json:"description"`
-	Location    pgtype.Text      `json:"location"`
-	ImageUrl    pgtype.Text      `json:"image_url"`
-	Blurhash    pgtype.Text      `json:"blurhash"`
-	DeletedAt   pgtype.Timestamp `json:"deleted_at"`
+	ID               uuid.UUID        `json:"id"`
+	Name             string           `json:"name"`
+	CreatedAt        pgtype.Timestamp `json:"created_at"`
+	UpdatedAt        pgtype.Timestamp `json:"updated_at"`
+	StartTime        pgtype.Timestamp `json:"start_time"`
+	EndTime          pgtype.Timestamp `json:"end_time"`
+	Description      pgtype.Text      `json:"description"`
+	Location         pgtype.Text      `json:"location"`
+	ImageUrl         pgtype.Text      `json:"image_url"`
+	Blurhash         pgtype.Text      `json:"blurhash"`
+	DeletedAt        pgtype.Timestamp `json:"deleted_at"`
+	RequiresApproval bool             `json:"requires_approval"`
+	AnnouncementOnly bool             `json:"announcement_only"`
+}
+
+type GroupSetting struct {
+	GroupID   uuid.UUID        `json:"group_id"`
+	Settings  []byte           `json:"settings"`
+	UpdatedAt pgtype.Timestamp `json:"updated_at"`
 }
 
 type GroupReservation struct {
@@ -97,6 +151,11 @@ type GroupReservation struct {
 	CreatedAt pgtype.Timestamp `json:"created_at"`
 }
 
+type GroupTag struct {
+	GroupID uuid.UUID `json:"group_id"`
+	Tag     string    `json:"tag"`
+}
+
 type Invite struct {
 	ID        uuid.UUID          `json:"id"`
 	Code      string             `json:"code"`
@@ -108,6 +167,23 @@ type Invite struct {
 	CreatedAt pgtype.Timestamptz `json:"created_at"`
 }
 
+type InviteJoin struct {
+	ID       uuid.UUID          `json:"id"`
+	InviteID uuid.UUID          `json:"invite_id"`
+	UserID   uuid.UUID          `json:"user_id"`
+	JoinedAt pgtype.Timestamptz `json:"joined_at"`
+}
+
+type JoinRequest struct {
+	ID        uuid.UUID        `json:"id"`
+	GroupID   uuid.UUID        `json:"group_id"`
+	UserID    uuid.UUID        `json:"user_id"`
+	Status    string           `json:"status"`
+	DecidedBy *uuid.UUID       `json:"decided_by"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+	DecidedAt pgtype.Timestamp `json:"decided_at"`
+}
+
 type Message struct {
 	ID        uuid.UUID        `json:"id"`
 	UserID    *uuid.UUID       `json:"user_id"`
@@ -124,7 +200,63 @@ type Message struct {
 	// Device identifier that signed the message payload
 	SenderDeviceIdentifier pgtype.Text `json:"sender_device_identifier"`
 	// Ed25519 detached signature over canonical message payload
-	Signature []byte `json:"signature"`
+	Signature              []byte           `json:"signature"`
+	ForwardedFromMessageID *uuid.UUID       `json:"forwarded_from_message_id"`
+	ForwardedFromGroupID   *uuid.UUID       `json:"forwarded_from_group_id"`
+	ForwardedFromSenderID  *uuid.UUID       `json:"forwarded_from_sender_id"`
+	ExpiresAt              pgtype.Timestamp `json:"expires_at"`
+}
+
+type MessageEdit struct {
+	ID                     uuid.UUID        `json:"id"`
+	MessageID              uuid.UUID        `json:"message_id"`
+	Ciphertext             []byte           `json:"ciphertext"`
+	MsgNonce               []byte           `json:"msg_nonce"`
+	KeyEnvelopes           []byte           `json:"key_envelopes"`
+	SenderDeviceIdentifier pgtype.Text      `json:"sender_device_identifier"`
+	Signature              []byte           `json:"signature"`
+	CreatedAt              pgtype.Timestamp `json:"created_at"`
+}
+
+type MessageMention struct {
+	MessageID uuid.UUID        `json:"message_id"`
+	UserID    uuid.UUID        `json:"user_id"`
+	GroupID   uuid.UUID        `json:"group_id"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type PendingGroupImage struct {
+	ID        uuid.UUID        `json:"id"`
+	GroupID   uuid.UUID        `json:"group_id"`
+	UserID    uuid.UUID        `json:"user_id"`
+	S3Key     string           `json:"s3_key"`
+	Size      int64            `json:"size"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type PendingNotification struct {
+	ID               uuid.UUID        `json:"id"`
+	UserID           uuid.UUID        `json:"user_id"`
+	GroupID          *uuid.UUID       `json:"group_id"`
+	Title            string           `json:"title"`
+	Body             string           `json:"body"`
+	Data             []byte           `json:"data"`
+	Attempts         int32            `json:"attempts"`
+	NextAttemptAt    pgtype.Timestamp `json:"next_attempt_at"`
+	CreatedAt        pgtype.Timestamp `json:"created_at"`
+	Sound            string           `json:"sound"`
+	ChannelID        string           `json:"channel_id"`
+	Priority         string           `json:"priority"`
+	DeviceIdentifier string           `json:"device_identifier"`
+}
+
+type PhoneVerification struct {
+	UserID    uuid.UUID        `json:"user_id"`
+	Phone     string           `json:"phone"`
+	CodeHash  string           `json:"code_hash"`
+	Attempts  int32            `json:"attempts"`
+	ExpiresAt pgtype.Timestamp `json:"expires_at"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
 }
 
 type PushReceipt struct {
@@ -134,23 +266,53 @@ type PushReceipt struct {
 	CreatedAt pgtype.Timestamp `json:"created_at"`
 }
 
+type PushTokenFailure struct {
+	PushToken    string           `json:"push_token"`
+	FailureCount int32            `json:"failure_count"`
+	LastError    string           `json:"last_error"`
+	LastFailedAt pgtype.Timestamp `json:"last_failed_at"`
+}
+
+type SenderSequence struct {
+	UserID           uuid.UUID        `json:"user_id"`
+	DeviceIdentifier string           `json:"device_identifier"`
+	GroupID          uuid.UUID        `json:"group_id"`
+	LastSeq          int64            `json:"last_seq"`
+	UpdatedAt        pgtype.Timestamp `json:"updated_at"`
+}
+
 type User struct {
-	ID        uuid.UUID        `json:"id"`
-	Username  string           `json:"username"`
+	ID                      uuid.UUID        `json:"id"`
+	Username                string           `json:"username"`
+	CreatedAt               pgtype.Timestamp `json:"created_at"`
+	UpdatedAt               pgtype.Timestamp `json:"updated_at"`
+	Email                   string           `json:"email"`
+	Password                pgtype.Text      `json:"password"`
+	Birthday                pgtype.Date      `json:"birthday"`
+	Phone                   pgtype.Text      `json:"phone"`
+	PhoneVerifiedAt         pgtype.Timestamp `json:"phone_verified_at"`
+	NotificationPreviewMode string           `json:"notification_preview_mode"`
+	SilentPush              bool             `json:"silent_push"`
+	SnoozeUntil             pgtype.Timestamp `json:"snooze_until"`
+	ReactionPush            bool             `json:"reaction_push"`
+	DeactivatedAt           pgtype.Timestamp `json:"deactivated_at"`
+}
+
+type UserBookmark struct {
+	UserID    uuid.UUID        `json:"user_id"`
+	MessageID uuid.UUID        `json:"message_id"`
+	GroupID   uuid.UUID        `json:"group_id"`
 	CreatedAt pgtype.Timestamp `json:"created_at"`
-	UpdatedAt pgtype.Timestamp `json:"updated_at"`
-	Email     string           `json:"email"`
-	Password  pgtype.Text      `json:"password"`
-	Birthday  pgtype.Date      `json:"birthday"`
 }
 
 type UserGroup struct {
-	ID        uuid.UUID        `json:"id"`
-	UserID    *uuid.UUID       `json:"user_id"`
-	GroupID   *uuid.UUID       `json:"group_id"`
-	CreatedAt pgtype.Timestamp `json:"created_at"`
-	UpdatedAt pgtype.Timestamp `json:"updated_at"`
-	Admin     bool             `json:"admin"`
-	DeletedAt pgtype.Timestamp `json:"deleted_at"`
-	Muted     bool             `json:"muted"`
+	ID         uuid.UUID        `json:"id"`
+	UserID     *uuid.UUID       `json:"user_id"`
+	GroupID    *uuid.UUID       `json:"group_id"`
+	CreatedAt  pgtype.Timestamp `json:"created_at"`
+	UpdatedAt  pgtype.Timestamp `json:"updated_at"`
+	Admin      bool             `json:"admin"`
+	DeletedAt  pgtype.Timestamp `json:"deleted_at"`
+	Muted      bool             `json:"muted"`
+	LastReadAt pgtype.Timestamp `json:"last_read_at"`
 }
@@ -8,9 +8,19 @@ package db
 import (
 	"context"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const clearPushTokenFailures = `-- name: ClearPushTokenFailures :exec
+DELETE FROM push_token_failures WHERE push_token = ANY($1::text[])
+`
+
+func (q *Queries) ClearPushTokenFailures(ctx context.Context, pushTokens []string) error {
+	_, err := q.db.Exec(ctx, clearPushTokenFailures, pushTokens)
+	return err
+}
+
 const deleteOldReceipts = `-- name: DeleteOldReceipts :exec
 DELETE FROM push_receipts WHERE created_at < now() - interval '24 hours'
 `
@@ -20,6 +30,24 @@ func (q *Queries) DeleteOldReceipts(ctx context.Context) error {
 	return err
 }
 
+const deleteOrphanedReceipts = `-- name: DeleteOrphanedReceipts :execrows
+DELETE FROM push_receipts
+WHERE id IN (
+    SELECT r.id FROM push_receipts r
+    WHERE NOT EXISTS (SELECT 1 FROM device_keys dk WHERE dk.expo_push_token = r.push_token)
+    LIMIT $1
+)
+`
+
+// Pending receipts for tokens no device holds any more; checking them can't change anything.
+func (q *Queries) DeleteOrphanedReceipts(ctx context.Context, batchSize int32) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteOrphanedReceipts, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const deletePushTokenByValue = `-- name: DeletePushTokenByValue :exec
 UPDATE device_keys SET expo_push_token = NULL
 WHERE expo_push_token = $1
@@ -30,6 +58,30 @@ func (q *Queries) DeletePushTokenByValue(ctx context.Context, expoPushToken pgty
 	return err
 }
 
+const deletePushTokenFailuresForUser = `-- name: DeletePushTokenFailuresForUser :exec
+DELETE FROM push_token_failures
+WHERE push_token IN (
+    SELECT expo_push_token FROM device_keys
+    WHERE user_id = $1 AND expo_push_token IS NOT NULL
+)
+`
+
+func (q *Queries) DeletePushTokenFailuresForUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deletePushTokenFailuresForUser, userID)
+	return err
+}
+
+const deletePushTokensByValue = `-- name: DeletePushTokensByValue :exec
+UPDATE device_keys SET expo_push_token = NULL
+WHERE expo_push_token = ANY($1::text[])
+`
+
+// The batch form of DeletePushTokenByValue.
+func (q *Queries) DeletePushTokensByValue(ctx context.Context, pushTokens []string) error {
+	_, err := q.db.Exec(ctx, deletePushTokensByValue, pushTokens)
+	return err
+}
+
 const deleteReceipts = `-- name: DeleteReceipts :exec
 DELETE FROM push_receipts WHERE ticket_id = ANY($1::text[])
 `
@@ -39,6 +91,71 @@ func (q *Queries) DeleteReceipts(ctx context.Context, dollar_1 []string) error {
 	return err
 }
 
+const deleteReceiptsForUser = `-- name: DeleteReceiptsForUser :exec
+DELETE FROM push_receipts
+WHERE push_token IN (
+    SELECT expo_push_token FROM device_keys
+    WHERE user_id = $1 AND expo_push_token IS NOT NULL
+)
+`
+
+func (q *Queries) DeleteReceiptsForUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteReceiptsForUser, userID)
+	return err
+}
+
+const deleteStalePushTokenFailures = `-- name: DeleteStalePushTokenFailures :execrows
+DELETE FROM push_token_failures
+WHERE push_token IN (
+    SELECT f.push_token FROM push_token_failures f
+    WHERE f.last_failed_at < NOW() - INTERVAL '30 days'
+       OR NOT EXISTS (SELECT 1 FROM device_keys dk WHERE dk.expo_push_token = f.push_token)
+    LIMIT $1
+)
+`
+
+// Failure rows for tokens no device holds any more (usually cleared by the
+// DeviceNotRegistered path) or that haven't failed in 30 days.
+func (q *Queries) DeleteStalePushTokenFailures(ctx context.Context, batchSize int32) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteStalePushTokenFailures, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getFailingPushTokens = `-- name: GetFailingPushTokens :many
+SELECT push_token FROM push_token_failures
+WHERE failure_count >= $1::int
+ORDER BY push_token
+LIMIT $2
+`
+
+type GetFailingPushTokensParams struct {
+	MinFailures int32 `json:"min_failures"`
+	BatchSize   int32 `json:"batch_size"`
+}
+
+func (q *Queries) GetFailingPushTokens(ctx context.Context, arg GetFailingPushTokensParams) ([]string, error) {
+	rows, err := q.db.Query(ctx, getFailingPushTokens, arg.MinFailures, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var push_token string
+		if err := rows.Scan(&push_token); err != nil {
+			return nil, err
+		}
+		items = append(items, push_token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getPendingReceipts = `-- name: GetPendingReceipts :many
 SELECT ticket_id, push_token FROM push_receipts
 WHERE created_at < now() - interval '15 minutes'
@@ -88,3 +205,22 @@ type InsertPushReceiptsParams struct {
 	TicketID  string `json:"ticket_id"`
 	PushToken string `json:"push_token"`
 }
+
+const recordPushTokenFailure = `-- name: RecordPushTokenFailure :exec
+INSERT INTO push_token_failures (push_token, last_error)
+VALUES ($1, $2)
+ON CONFLICT (push_token) DO UPDATE
+SET failure_count = push_token_failures.failure_count + 1,
+    last_error = EXCLUDED.last_error,
+    last_failed_at = NOW()
+`
+
+type RecordPushTokenFailureParams struct {
+	PushToken string `json:"push_token"`
+	LastError string `json:"last_error"`
+}
+
+func (q *Queries) RecordPushTokenFailure(ctx context.Context, arg RecordPushTokenFailureParams) error {
+	_, err := q.db.Exec(ctx, recordPushTokenFailure, arg.PushToken, arg.LastError)
+	return err
+}
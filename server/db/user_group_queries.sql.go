@@ -12,6 +12,60 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const advanceDeviceGroupDelivery = `-- name: AdvanceDeviceGroupDelivery :execrows
+INSERT INTO device_group_deliveries (user_id, device_identifier, group_id, message_id, delivered_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (user_id, device_identifier, group_id) DO UPDATE
+SET message_id = EXCLUDED.message_id, delivered_at = EXCLUDED.delivered_at, updated_at = NOW()
+WHERE (device_group_deliveries.delivered_at, device_group_deliveries.message_id)
+   <= (EXCLUDED.delivered_at, EXCLUDED.message_id)
+`
+
+type AdvanceDeviceGroupDeliveryParams struct {
+	UserID           uuid.UUID        `json:"user_id"`
+	DeviceIdentifier string           `json:"device_identifier"`
+	GroupID          uuid.UUID        `json:"group_id"`
+	MessageID        uuid.UUID        `json:"message_id"`
+	DeliveredAt      pgtype.Timestamp `json:"delivered_at"`
+}
+
+// Records the device's newest delivered message in the group unless it already
+// reported a later one. Re-reporting the same message counts as a success.
+func (q *Queries) AdvanceDeviceGroupDelivery(ctx context.Context, arg AdvanceDeviceGroupDeliveryParams) (int64, error) {
+	result, err := q.db.Exec(ctx, advanceDeviceGroupDelivery,
+		arg.UserID,
+		arg.DeviceIdentifier,
+		arg.GroupID,
+		arg.MessageID,
+		arg.DeliveredAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const countGroupMembers = `-- name: CountGroupMembers :one
+SELECT COUNT(*) FROM user_groups
+WHERE group_id = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) CountGroupMembers(ctx context.Context, groupID *uuid.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, countGroupMembers, groupID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const deleteAllUserGroupsForUser = `-- name: DeleteAllUserGroupsForUser :exec
+DELETE FROM user_groups WHERE user_id = $1
+`
+
+func (q *Queries) DeleteAllUserGroupsForUser(ctx context.Context, userID *uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteAllUserGroupsForUser, userID)
+	return err
+}
+
 const deleteUserGroup = `-- name: DeleteUserGroup :one
 UPDATE user_groups SET deleted_at = NOW()
 WHERE user_id = $1 AND group_id = $2 AND deleted_at IS NULL
@@ -174,6 +228,171 @@ func (q *Queries) GetAllUserGroupsForUser(ctx context.Context, userID *uuid.UUID
 	return items, nil
 }
 
+const getCoMemberIDs = `-- name: GetCoMemberIDs :many
+SELECT DISTINCT other.user_id
+FROM user_groups mine
+JOIN user_groups other ON other.group_id = mine.group_id
+JOIN groups g ON g.id = mine.group_id
+WHERE mine.user_id = $1 AND other.user_id <> $1
+  AND mine.deleted_at IS NULL AND other.deleted_at IS NULL
+  AND g.deleted_at IS NULL
+`
+
+func (q *Queries) GetCoMemberIDs(ctx context.Context, userID *uuid.UUID) ([]*uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, getCoMemberIDs, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*uuid.UUID
+	for rows.Next() {
+		var user_id *uuid.UUID
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, err
+		}
+		items = append(items, user_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDeviceGroupDelivery = `-- name: GetDeviceGroupDelivery :one
+SELECT message_id, delivered_at FROM device_group_deliveries
+WHERE user_id = $1 AND device_identifier = $2 AND group_id = $3
+`
+
+type GetDeviceGroupDeliveryParams struct {
+	UserID           uuid.UUID `json:"user_id"`
+	DeviceIdentifier string    `json:"device_identifier"`
+	GroupID          uuid.UUID `json:"group_id"`
+}
+
+type GetDeviceGroupDeliveryRow struct {
+	MessageID   uuid.UUID        `json:"message_id"`
+	DeliveredAt pgtype.Timestamp `json:"delivered_at"`
+}
+
+func (q *Queries) GetDeviceGroupDelivery(ctx context.Context, arg GetDeviceGroupDeliveryParams) (GetDeviceGroupDeliveryRow, error) {
+	row := q.db.QueryRow(ctx, getDeviceGroupDelivery, arg.UserID, arg.DeviceIdentifier, arg.GroupID)
+	var i GetDeviceGroupDeliveryRow
+	err := row.Scan(&i.MessageID, &i.DeliveredAt)
+	return i, err
+}
+
+const getDeviceReadStateForUser = `-- name: GetDeviceReadStateForUser :many
+SELECT ug.group_id, ug.last_read_at, dgr.last_read_at AS device_last_read_at
+FROM user_groups ug
+JOIN groups g ON g.id = ug.group_id
+LEFT JOIN device_group_reads dgr
+    ON dgr.user_id = ug.user_id AND dgr.group_id = ug.group_id AND dgr.device_identifier = $1
+WHERE ug.user_id = $2 AND ug.deleted_at IS NULL AND g.deleted_at IS NULL
+`
+
+type GetDeviceReadStateForUserParams struct {
+	DeviceIdentifier string     `json:"device_identifier"`
+	UserID           *uuid.UUID `json:"user_id"`
+}
+
+type GetDeviceReadStateForUserRow struct {
+	GroupID          *uuid.UUID       `json:"group_id"`
+	LastReadAt       pgtype.Timestamp `json:"last_read_at"`
+	DeviceLastReadAt pgtype.Timestamp `json:"device_last_read_at"`
+}
+
+func (q *Queries) GetDeviceReadStateForUser(ctx context.Context, arg GetDeviceReadStateForUserParams) ([]GetDeviceReadStateForUserRow, error) {
+	rows, err := q.db.Query(ctx, getDeviceReadStateForUser, arg.DeviceIdentifier, arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDeviceReadStateForUserRow
+	for rows.Next() {
+		var i GetDeviceReadStateForUserRow
+		if err := rows.Scan(&i.GroupID, &i.LastReadAt, &i.DeviceLastReadAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getGroupMemberIDsAmong = `-- name: GetGroupMemberIDsAmong :many
+SELECT user_id FROM user_groups
+WHERE group_id = $1 AND user_id = ANY($2::UUID[]) AND deleted_at IS NULL
+`
+
+type GetGroupMemberIDsAmongParams struct {
+	GroupID *uuid.UUID  `json:"group_id"`
+	UserIds []uuid.UUID `json:"user_ids"`
+}
+
+func (q *Queries) GetGroupMemberIDsAmong(ctx context.Context, arg GetGroupMemberIDsAmongParams) ([]*uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, getGroupMemberIDsAmong, arg.GroupID, arg.UserIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*uuid.UUID
+	for rows.Next() {
+		var user_id *uuid.UUID
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, err
+		}
+		items = append(items, user_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getGroupMembershipsForUser = `-- name: GetGroupMembershipsForUser :many
+SELECT ug.group_id, g.name, ug.admin, ug.muted, ug.created_at AS joined_at
+FROM user_groups ug
+JOIN groups g ON g.id = ug.group_id
+WHERE ug.user_id = $1 AND ug.deleted_at IS NULL AND g.deleted_at IS NULL
+ORDER BY ug.created_at ASC
+`
+
+type GetGroupMembershipsForUserRow struct {
+	GroupID  *uuid.UUID       `json:"group_id"`
+	Name     string           `json:"name"`
+	Admin    bool             `json:"admin"`
+	Muted    bool             `json:"muted"`
+	JoinedAt pgtype.Timestamp `json:"joined_at"`
+}
+
+func (q *Queries) GetGroupMembershipsForUser(ctx context.Context, userID *uuid.UUID) ([]GetGroupMembershipsForUserRow, error) {
+	rows, err := q.db.Query(ctx, getGroupMembershipsForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetGroupMembershipsForUserRow
+	for rows.Next() {
+		var i GetGroupMembershipsForUserRow
+		if err := rows.Scan(
+			&i.GroupID,
+			&i.Name,
+			&i.Admin,
+			&i.Muted,
+			&i.JoinedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getMutedUserIDsForGroup = `-- name: GetMutedUserIDsForGroup :many
 SELECT user_id FROM user_groups WHERE group_id = $1 AND muted = true AND deleted_at IS NULL
 `
@@ -198,6 +417,31 @@ func (q *Queries) GetMutedUserIDsForGroup(ctx context.Context, groupID *uuid.UUI
 	return items, nil
 }
 
+const getPostingPermission = `-- name: GetPostingPermission :one
+SELECT ug.admin, g.announcement_only, g.end_time
+FROM user_groups ug
+JOIN groups g ON g.id = ug.group_id
+WHERE ug.user_id = $1 AND ug.group_id = $2 AND ug.deleted_at IS NULL AND g.deleted_at IS NULL
+`
+
+type GetPostingPermissionParams struct {
+	UserID  *uuid.UUID `json:"user_id"`
+	GroupID *uuid.UUID `json:"group_id"`
+}
+
+type GetPostingPermissionRow struct {
+	Admin            bool             `json:"admin"`
+	AnnouncementOnly bool             `json:"announcement_only"`
+	EndTime          pgtype.Timestamp `json:"end_time"`
+}
+
+func (q *Queries) GetPostingPermission(ctx context.Context, arg GetPostingPermissionParams) (GetPostingPermissionRow, error) {
+	row := q.db.QueryRow(ctx, getPostingPermission, arg.UserID, arg.GroupID)
+	var i GetPostingPermissionRow
+	err := row.Scan(&i.Admin, &i.AnnouncementOnly, &i.EndTime)
+	return i, err
+}
+
 const getUserGroupByGroupIDAndUserID = `-- name: GetUserGroupByGroupIDAndUserID :one
 SELECT "id", "user_id", "group_id", "admin", "muted", "created_at", "updated_at" FROM user_groups WHERE user_id = $1 AND group_id = $2 AND deleted_at IS NULL
 `
@@ -263,20 +507,26 @@ func (q *Queries) GetUserGroupByID(ctx context.Context, id uuid.UUID) (GetUserGr
 
 const insertUserGroup = `-- name: InsertUserGroup :one
 INSERT INTO user_groups
-    ("user_id", "group_id", "admin")
-VALUES ($1, $2, $3)
+    ("user_id", "group_id", "admin", "muted")
+VALUES ($1, $2, $3, $4)
 ON CONFLICT (user_id, group_id) WHERE deleted_at IS NULL DO NOTHING
-RETURNING id, user_id, group_id, created_at, updated_at, admin, deleted_at, muted
+RETURNING id, user_id, group_id, created_at, updated_at, admin, deleted_at, muted, last_read_at
 `
 
 type InsertUserGroupParams struct {
 	UserID  *uuid.UUID `json:"user_id"`
 	GroupID *uuid.UUID `json:"group_id"`
 	Admin   bool       `json:"admin"`
+	Muted   bool       `json:"muted"`
 }
 
 func (q *Queries) InsertUserGroup(ctx context.Context, arg InsertUserGroupParams) (UserGroup, error) {
-	row := q.db.QueryRow(ctx, insertUserGroup, arg.UserID, arg.GroupID, arg.Admin)
+	row := q.db.QueryRow(ctx, insertUserGroup,
+		arg.UserID,
+		arg.GroupID,
+		arg.Admin,
+		arg.Muted,
+	)
 	var i UserGroup
 	err := row.Scan(
 		&i.ID,
@@ -287,13 +537,58 @@ func (q *Queries) InsertUserGroup(ctx context.Context, arg InsertUserGroupParams
 		&i.Admin,
 		&i.DeletedAt,
 		&i.Muted,
+		&i.LastReadAt,
 	)
 	return i, err
 }
 
+const markDeviceGroupRead = `-- name: MarkDeviceGroupRead :exec
+INSERT INTO device_group_reads (user_id, device_identifier, group_id, last_read_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, device_identifier, group_id) DO UPDATE
+SET last_read_at = GREATEST(device_group_reads.last_read_at, EXCLUDED.last_read_at)
+`
+
+type MarkDeviceGroupReadParams struct {
+	UserID           uuid.UUID        `json:"user_id"`
+	DeviceIdentifier string           `json:"device_identifier"`
+	GroupID          uuid.UUID        `json:"group_id"`
+	LastReadAt       pgtype.Timestamp `json:"last_read_at"`
+}
+
+func (q *Queries) MarkDeviceGroupRead(ctx context.Context, arg MarkDeviceGroupReadParams) error {
+	_, err := q.db.Exec(ctx, markDeviceGroupRead,
+		arg.UserID,
+		arg.DeviceIdentifier,
+		arg.GroupID,
+		arg.LastReadAt,
+	)
+	return err
+}
+
+const markGroupRead = `-- name: MarkGroupRead :execrows
+UPDATE user_groups SET last_read_at = GREATEST(last_read_at, $1::timestamp)
+WHERE user_id = $2 AND group_id = $3 AND deleted_at IS NULL
+`
+
+type MarkGroupReadParams struct {
+	ReadAt  pgtype.Timestamp `json:"read_at"`
+	UserID  *uuid.UUID       `json:"user_id"`
+	GroupID *uuid.UUID       `json:"group_id"`
+}
+
+// Never moves last_read_at backwards, so it stays the furthest any device has read.
+func (q *Queries) MarkGroupRead(ctx context.Context, arg MarkGroupReadParams) (int64, error) {
+	result, err := q.db.Exec(ctx, markGroupRead, arg.ReadAt, arg.UserID, arg.GroupID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const toggleGroupMuted = `-- name: ToggleGroupMuted :one
 UPDATE user_groups
-SET muted = NOT muted
+SET muted = NOT muted, updated_at = NOW()
 WHERE user_id = $1 AND group_id = $2 AND deleted_at IS NULL
 RETURNING "id", "user_id", "group_id", "admin", "muted", "created_at", "updated_at"
 `
@@ -331,7 +626,8 @@ func (q *Queries) ToggleGroupMuted(ctx context.Context, arg ToggleGroupMutedPara
 const updateUserGroup = `-- name: UpdateUserGroup :one
 UPDATE user_groups
 SET
-    "admin" = $3
+    "admin" = $3,
+    "updated_at" = NOW()
 WHERE user_id = $1 AND group_id = $2 AND deleted_at IS NULL
 RETURNING "id", "user_id", "group_id", "admin", "muted", "created_at", "updated_at"
 `
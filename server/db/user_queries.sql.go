@@ -12,6 +12,92 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const adminSearchUsers = `-- name: AdminSearchUsers :many
+SELECT
+    u.id,
+    u.username,
+    u.email,
+    u.created_at,
+    u.phone_verified_at,
+    (SELECT COUNT(*) FROM device_keys dk WHERE dk.user_id = u.id) AS device_count,
+    (SELECT COUNT(*) FROM user_groups ug WHERE ug.user_id = u.id AND ug.deleted_at IS NULL) AS group_count
+FROM users u
+WHERE (u.username ILIKE $1 OR u.email ILIKE $1)
+  AND (u.created_at, u.id) < ($2::timestamp, $3::uuid)
+ORDER BY u.created_at DESC, u.id DESC
+LIMIT $4
+`
+
+type AdminSearchUsersParams struct {
+	Pattern         string           `json:"pattern"`
+	BeforeCreatedAt pgtype.Timestamp `json:"before_created_at"`
+	BeforeID        uuid.UUID        `json:"before_id"`
+	PageSize        int32            `json:"page_size"`
+}
+
+type AdminSearchUsersRow struct {
+	ID              uuid.UUID        `json:"id"`
+	Username        string           `json:"username"`
+	Email           string           `json:"email"`
+	CreatedAt       pgtype.Timestamp `json:"created_at"`
+	PhoneVerifiedAt pgtype.Timestamp `json:"phone_verified_at"`
+	DeviceCount     int64            `json:"device_count"`
+	GroupCount      int64            `json:"group_count"`
+}
+
+// Operator user search, newest first, keyset-paginated on (created_at, id). Never
+// select password or other secrets here.
+func (q *Queries) AdminSearchUsers(ctx context.Context, arg AdminSearchUsersParams) ([]AdminSearchUsersRow, error) {
+	rows, err := q.db.Query(ctx, adminSearchUsers,
+		arg.Pattern,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AdminSearchUsersRow
+	for rows.Next() {
+		var i AdminSearchUsersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.Email,
+			&i.CreatedAt,
+			&i.PhoneVerifiedAt,
+			&i.DeviceCount,
+			&i.GroupCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const clearUserPhone = `-- name: ClearUserPhone :exec
+UPDATE users SET phone = NULL, phone_verified_at = NULL WHERE id = $1
+`
+
+func (q *Queries) ClearUserPhone(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, clearUserPhone, id)
+	return err
+}
+
+const deactivateUser = `-- name: DeactivateUser :exec
+UPDATE users SET deactivated_at = NOW() WHERE id = $1 AND deactivated_at IS NULL
+`
+
+func (q *Queries) DeactivateUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deactivateUser, id)
+	return err
+}
+
 const deleteUser = `-- name: DeleteUser :one
 DELETE FROM users
 WHERE id = $1 RETURNING "id", "username", "email", "created_at", "updated_at"
@@ -160,6 +246,103 @@ func (q *Queries) GetAllUsersInternal(ctx context.Context) ([]GetAllUsersInterna
 	return items, nil
 }
 
+const getCoMemberDeviceKeys = `-- name: GetCoMemberDeviceKeys :many
+SELECT
+    dk.user_id,
+    jsonb_agg(
+        jsonb_build_object(
+            'device_identifier', dk.device_identifier,
+            'public_key', encode(dk.public_key, 'base64'),
+            'signing_public_key', encode(dk.signing_public_key, 'base64')
+        ) ORDER BY dk.created_at DESC
+    ) AS device_keys
+FROM device_keys dk
+WHERE dk.user_id = ANY($1::uuid[])
+  AND (
+    dk.user_id = $2::uuid
+    OR EXISTS (
+        SELECT 1 FROM user_groups mine
+        JOIN user_groups theirs ON theirs.group_id = mine.group_id
+        JOIN groups g ON g.id = mine.group_id
+        WHERE mine.user_id = $2::uuid AND theirs.user_id = dk.user_id
+          AND mine.deleted_at IS NULL AND theirs.deleted_at IS NULL
+          AND g.deleted_at IS NULL
+    )
+  )
+GROUP BY dk.user_id
+`
+
+type GetCoMemberDeviceKeysParams struct {
+	UserIds  []uuid.UUID `json:"user_ids"`
+	CallerID uuid.UUID   `json:"caller_id"`
+}
+
+type GetCoMemberDeviceKeysRow struct {
+	UserID     uuid.UUID `json:"user_id"`
+	DeviceKeys []byte    `json:"device_keys"`
+}
+
+// Device keys for the requested users that share at least one group with the
+// caller (or are the caller). Other IDs are silently dropped.
+func (q *Queries) GetCoMemberDeviceKeys(ctx context.Context, arg GetCoMemberDeviceKeysParams) ([]GetCoMemberDeviceKeysRow, error) {
+	rows, err := q.db.Query(ctx, getCoMemberDeviceKeys, arg.UserIds, arg.CallerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetCoMemberDeviceKeysRow
+	for rows.Next() {
+		var i GetCoMemberDeviceKeysRow
+		if err := rows.Scan(&i.UserID, &i.DeviceKeys); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getNotificationPrefs = `-- name: GetNotificationPrefs :many
+SELECT id, notification_preview_mode, silent_push, snooze_until, reaction_push FROM users
+WHERE id = ANY($1::uuid[])
+`
+
+type GetNotificationPrefsRow struct {
+	ID                      uuid.UUID        `json:"id"`
+	NotificationPreviewMode string           `json:"notification_preview_mode"`
+	SilentPush              bool             `json:"silent_push"`
+	SnoozeUntil             pgtype.Timestamp `json:"snooze_until"`
+	ReactionPush            bool             `json:"reaction_push"`
+}
+
+func (q *Queries) GetNotificationPrefs(ctx context.Context, userIds []uuid.UUID) ([]GetNotificationPrefsRow, error) {
+	rows, err := q.db.Query(ctx, getNotificationPrefs, userIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetNotificationPrefsRow
+	for rows.Next() {
+		var i GetNotificationPrefsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.NotificationPreviewMode,
+			&i.SilentPush,
+			&i.SnoozeUntil,
+			&i.ReactionPush,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getRelevantUserDeviceKeys = `-- name: GetRelevantUserDeviceKeys :many
 WITH user_target_groups AS (
     SELECT ug.group_id
@@ -229,6 +412,7 @@ WITH s AS (
 SELECT u.id, u.username, u.email, u.created_at, jsonb_object_agg(ug.group_id, ug.admin)::text AS group_admin_map FROM users u 
 JOIN user_groups ug ON ug.user_id = u.id
 JOIN s ON s.id = group_id
+WHERE u.deactivated_at IS NULL
 GROUP BY u.id
 `
 
@@ -319,7 +503,7 @@ func (q *Queries) GetUserByEmailInternal(ctx context.Context, lower string) (Get
 }
 
 const getUserById = `-- name: GetUserById :one
-SELECT "id", "username", "email", "created_at", "updated_at" FROM users WHERE id = $1
+SELECT "id", "username", "email", "created_at", "updated_at" FROM users WHERE id = $1 AND deactivated_at IS NULL
 `
 
 type GetUserByIdRow struct {
@@ -396,7 +580,8 @@ func (q *Queries) GetUserByUsername(ctx context.Context, username string) (GetUs
 }
 
 const getUsersByEmails = `-- name: GetUsersByEmails :many
-SELECT id, username, email, created_at, updated_at FROM users WHERE email = ANY($1::text[])
+SELECT id, username, email, created_at, updated_at FROM users
+WHERE deactivated_at IS NULL AND LOWER(email) = ANY($1::text[])
 `
 
 type GetUsersByEmailsRow struct {
@@ -471,6 +656,95 @@ func (q *Queries) GetUsersByIDs(ctx context.Context, ids []uuid.UUID) ([]GetUser
 	return items, nil
 }
 
+const getUsersByPhones = `-- name: GetUsersByPhones :many
+SELECT id, username, email, phone, created_at, updated_at FROM users
+WHERE phone_verified_at IS NOT NULL AND deactivated_at IS NULL AND phone = ANY($1::text[])
+`
+
+type GetUsersByPhonesRow struct {
+	ID        uuid.UUID        `json:"id"`
+	Username  string           `json:"username"`
+	Email     string           `json:"email"`
+	Phone     pgtype.Text      `json:"phone"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+	UpdatedAt pgtype.Timestamp `json:"updated_at"`
+}
+
+// Contact discovery only: deactivated accounts are hidden. Use GetVerifiedPhoneOwner to
+// check who holds a number.
+func (q *Queries) GetUsersByPhones(ctx context.Context, phones []string) ([]GetUsersByPhonesRow, error) {
+	rows, err := q.db.Query(ctx, getUsersByPhones, phones)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUsersByPhonesRow
+	for rows.Next() {
+		var i GetUsersByPhonesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.Email,
+			&i.Phone,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUsersDeactivatedBefore = `-- name: GetUsersDeactivatedBefore :many
+SELECT id FROM users
+WHERE deactivated_at < $1::timestamp
+ORDER BY deactivated_at
+LIMIT $2
+`
+
+type GetUsersDeactivatedBeforeParams struct {
+	Cutoff    pgtype.Timestamp `json:"cutoff"`
+	BatchSize int32            `json:"batch_size"`
+}
+
+// Oldest first, so a backlog drains across runs in the order the grace periods ended.
+func (q *Queries) GetUsersDeactivatedBefore(ctx context.Context, arg GetUsersDeactivatedBeforeParams) ([]uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, getUsersDeactivatedBefore, arg.Cutoff, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getVerifiedPhoneOwner = `-- name: GetVerifiedPhoneOwner :one
+SELECT id FROM users WHERE phone_verified_at IS NOT NULL AND phone = $1
+`
+
+// Unlike GetUsersByPhones it includes deactivated accounts, whose number still holds
+// unique_verified_phone until they are purged.
+func (q *Queries) GetVerifiedPhoneOwner(ctx context.Context, phone pgtype.Text) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, getVerifiedPhoneOwner, phone)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
 const insertUser = `-- name: InsertUser :one
 INSERT INTO users (username, email, password, birthday) VALUES ($1, $2, $3, $4) RETURNING "id", "username", "email", "created_at", "updated_at"
 `
@@ -508,6 +782,207 @@ func (q *Queries) InsertUser(ctx context.Context, arg InsertUserParams) (InsertU
 	return i, err
 }
 
+const lockUserDeactivatedBefore = `-- name: LockUserDeactivatedBefore :one
+SELECT id FROM users
+WHERE id = $1 AND deactivated_at < $2::timestamp
+FOR UPDATE
+`
+
+type LockUserDeactivatedBeforeParams struct {
+	ID     uuid.UUID        `json:"id"`
+	Cutoff pgtype.Timestamp `json:"cutoff"`
+}
+
+// Locks a purge candidate's row for the purge transaction. No row means the user was
+// reactivated (or deactivated again after cutoff) since the candidates were listed.
+func (q *Queries) LockUserDeactivatedBefore(ctx context.Context, arg LockUserDeactivatedBeforeParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, lockUserDeactivatedBefore, arg.ID, arg.Cutoff)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const reactivateUser = `-- name: ReactivateUser :execrows
+UPDATE users SET deactivated_at = NULL WHERE id = $1 AND deactivated_at IS NOT NULL
+`
+
+func (q *Queries) ReactivateUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, reactivateUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const rehashUserPassword = `-- name: RehashUserPassword :exec
+UPDATE users SET password = $1
+WHERE id = $2 AND password = $3
+`
+
+type RehashUserPasswordParams struct {
+	NewPassword pgtype.Text `json:"new_password"`
+	ID          uuid.UUID   `json:"id"`
+	OldPassword pgtype.Text `json:"old_password"`
+}
+
+// Only replaces the hash the caller verified against, so a concurrent password change wins.
+func (q *Queries) RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) error {
+	_, err := q.db.Exec(ctx, rehashUserPassword, arg.NewPassword, arg.ID, arg.OldPassword)
+	return err
+}
+
+const searchRelevantUsers = `-- name: SearchRelevantUsers :many
+SELECT u.id, u.username, u.email, u.created_at
+FROM users u
+WHERE u.deactivated_at IS NULL
+  AND u.id <> $1
+  AND EXISTS (
+    SELECT 1 FROM user_groups mine
+    JOIN user_groups theirs ON theirs.group_id = mine.group_id
+    WHERE mine.user_id = $1 AND theirs.user_id = u.id
+      AND mine.deleted_at IS NULL AND theirs.deleted_at IS NULL
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM blocked_users bu
+    WHERE (bu.blocker_id = $1 AND bu.blocked_id = u.id)
+       OR (bu.blocker_id = u.id AND bu.blocked_id = $1)
+  )
+  AND (u.username ILIKE $2 OR u.email ILIKE $2)
+  AND (u.username, u.id) > ($3::text, $4::uuid)
+ORDER BY u.username, u.id
+LIMIT $5
+`
+
+type SearchRelevantUsersParams struct {
+	UserID        uuid.UUID `json:"user_id"`
+	Pattern       string    `json:"pattern"`
+	AfterUsername string    `json:"after_username"`
+	AfterID       uuid.UUID `json:"after_id"`
+	PageSize      int32     `json:"page_size"`
+}
+
+type SearchRelevantUsersRow struct {
+	ID        uuid.UUID        `json:"id"`
+	Username  string           `json:"username"`
+	Email     string           `json:"email"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+func (q *Queries) SearchRelevantUsers(ctx context.Context, arg SearchRelevantUsersParams) ([]SearchRelevantUsersRow, error) {
+	rows, err := q.db.Query(ctx, searchRelevantUsers,
+		arg.UserID,
+		arg.Pattern,
+		arg.AfterUsername,
+		arg.AfterID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchRelevantUsersRow
+	for rows.Next() {
+		var i SearchRelevantUsersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.Email,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setNotificationPreviewMode = `-- name: SetNotificationPreviewMode :exec
+UPDATE users SET notification_preview_mode = $2 WHERE id = $1
+`
+
+type SetNotificationPreviewModeParams struct {
+	ID                      uuid.UUID `json:"id"`
+	NotificationPreviewMode string    `json:"notification_preview_mode"`
+}
+
+func (q *Queries) SetNotificationPreviewMode(ctx context.Context, arg SetNotificationPreviewModeParams) error {
+	_, err := q.db.Exec(ctx, setNotificationPreviewMode, arg.ID, arg.NotificationPreviewMode)
+	return err
+}
+
+const setReactionPush = `-- name: SetReactionPush :exec
+UPDATE users SET reaction_push = $2 WHERE id = $1
+`
+
+type SetReactionPushParams struct {
+	ID           uuid.UUID `json:"id"`
+	ReactionPush bool      `json:"reaction_push"`
+}
+
+func (q *Queries) SetReactionPush(ctx context.Context, arg SetReactionPushParams) error {
+	_, err := q.db.Exec(ctx, setReactionPush, arg.ID, arg.ReactionPush)
+	return err
+}
+
+const setSilentPush = `-- name: SetSilentPush :exec
+UPDATE users SET silent_push = $2 WHERE id = $1
+`
+
+type SetSilentPushParams struct {
+	ID         uuid.UUID `json:"id"`
+	SilentPush bool      `json:"silent_push"`
+}
+
+func (q *Queries) SetSilentPush(ctx context.Context, arg SetSilentPushParams) error {
+	_, err := q.db.Exec(ctx, setSilentPush, arg.ID, arg.SilentPush)
+	return err
+}
+
+const setSnoozeUntil = `-- name: SetSnoozeUntil :exec
+UPDATE users SET snooze_until = $2 WHERE id = $1
+`
+
+type SetSnoozeUntilParams struct {
+	ID          uuid.UUID        `json:"id"`
+	SnoozeUntil pgtype.Timestamp `json:"snooze_until"`
+}
+
+func (q *Queries) SetSnoozeUntil(ctx context.Context, arg SetSnoozeUntilParams) error {
+	_, err := q.db.Exec(ctx, setSnoozeUntil, arg.ID, arg.SnoozeUntil)
+	return err
+}
+
+const setUserEmail = `-- name: SetUserEmail :exec
+UPDATE users SET email = $2, updated_at = NOW() WHERE id = $1
+`
+
+type SetUserEmailParams struct {
+	ID    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+}
+
+func (q *Queries) SetUserEmail(ctx context.Context, arg SetUserEmailParams) error {
+	_, err := q.db.Exec(ctx, setUserEmail, arg.ID, arg.Email)
+	return err
+}
+
+const setVerifiedPhone = `-- name: SetVerifiedPhone :exec
+UPDATE users SET phone = $2, phone_verified_at = NOW() WHERE id = $1
+`
+
+type SetVerifiedPhoneParams struct {
+	ID    uuid.UUID   `json:"id"`
+	Phone pgtype.Text `json:"phone"`
+}
+
+func (q *Queries) SetVerifiedPhone(ctx context.Context, arg SetVerifiedPhoneParams) error {
+	_, err := q.db.Exec(ctx, setVerifiedPhone, arg.ID, arg.Phone)
+	return err
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users 
 SET
@@ -0,0 +1,143 @@
+package images
+
+import (
+	"errors"
+	"image"
+	"math"
+	"strings"
+)
+
+// blurhashComponentsX and blurhashComponentsY match what the app computes on device.
+const (
+	blurhashComponentsX = 4
+	blurhashComponentsY = 3
+)
+
+// blurhashSampleSize is the longest side, in pixels, of the grid sampled for the
+// hash. The hash only keeps a few low-frequency components, so sampling a large
+// photo this coarsely gives the same placeholder for a fraction of the work.
+const blurhashSampleSize = 64
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// encodeBlurhash computes the blurhash (https://blurha.sh) of img with xComponents
+// by yComponents components, each between 1 and 9.
+func encodeBlurhash(img image.Image, xComponents, yComponents int) (string, error) {
+	if xComponents < 1 || xComponents > 9 || yComponents < 1 || yComponents > 9 {
+		return "", errors.New("blurhash components must be between 1 and 9")
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() <= 0 || bounds.Dy() <= 0 {
+		return "", errors.New("image is empty")
+	}
+
+	pixels, width, height := sampleLinear(img)
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for y := 0; y < yComponents; y++ {
+		for x := 0; x < xComponents; x++ {
+			normalisation := 2.0
+			if x == 0 && y == 0 {
+				normalisation = 1
+			}
+			var r, g, b float64
+			for j := 0; j < height; j++ {
+				basisY := math.Cos(math.Pi * float64(y) * float64(j) / float64(height))
+				for i := 0; i < width; i++ {
+					basis := basisY * math.Cos(math.Pi*float64(x)*float64(i)/float64(width))
+					p := pixels[j*width+i]
+					r += basis * p[0]
+					g += basis * p[1]
+					b += basis * p[2]
+				}
+			}
+			scale := normalisation / float64(width*height)
+			factors = append(factors, [3]float64{r * scale, g * scale, b * scale})
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encodeBase83((xComponents-1)+(yComponents-1)*9, 1))
+
+	dc, ac := factors[0], factors[1:]
+	maximumValue := 1.0
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, f := range ac {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maximumValue = float64(quantisedMax+1) / 166
+		hash.WriteString(encodeBase83(quantisedMax, 1))
+	} else {
+		hash.WriteString(encodeBase83(0, 1))
+	}
+
+	hash.WriteString(encodeBase83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+	for _, f := range ac {
+		hash.WriteString(encodeBase83(encodeAC(f, maximumValue), 2))
+	}
+	return hash.String(), nil
+}
+
+// sampleLinear point-samples img onto a grid no larger than blurhashSampleSize on its
+// longest side and returns the pixels as linear RGB, row by row.
+func sampleLinear(img image.Image) ([][3]float64, int, int) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if longest := max(width, height); longest > blurhashSampleSize {
+		width = max(1, width*blurhashSampleSize/longest)
+		height = max(1, height*blurhashSampleSize/longest)
+	}
+
+	pixels := make([][3]float64, 0, width*height)
+	for j := 0; j < height; j++ {
+		srcY := bounds.Min.Y + j*bounds.Dy()/height
+		for i := 0; i < width; i++ {
+			srcX := bounds.Min.X + i*bounds.Dx()/width
+			r, g, b, _ := img.At(srcX, srcY).RGBA()
+			pixels = append(pixels, [3]float64{
+				sRGBToLinear(int(r >> 8)),
+				sRGBToLinear(int(g >> 8)),
+				sRGBToLinear(int(b >> 8)),
+			})
+		}
+	}
+	return pixels, width, height
+}
+
+func encodeAC(f [3]float64, maximumValue float64) int {
+	quant := func(v float64) int {
+		return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximumValue, 0.5)*9+9.5))))
+	}
+	return quant(f[0])*19*19 + quant(f[1])*19 + quant(f[2])
+}
+
+func encodeBase83(value, length int) string {
+	var out strings.Builder
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		out.WriteByte(base83Chars[digit])
+	}
+	return out.String()
+}
+
+func sRGBToLinear(value int) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
@@ -0,0 +1,274 @@
+package images
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"chat-app-server/db"
+	"chat-app-server/s3store"
+	"chat-app-server/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// GroupNotifier tells a group's members that the group changed. The hub implements it.
+type GroupNotifier interface {
+	NotifyGroup(groupID uuid.UUID, event string)
+}
+
+type presignGroupImageReq struct {
+	GroupID  uuid.UUID `json:"groupId" binding:"required"`
+	Filename string    `json:"filename" binding:"required"`
+	Size     int64     `json:"size" binding:"required"`
+}
+
+type confirmGroupImageReq struct {
+	ObjectKey string  `json:"objectKey" binding:"required"`
+	Blurhash  *string `json:"blurhash"`
+}
+
+type confirmGroupImageRes struct {
+	GroupID  uuid.UUID `json:"groupId"`
+	ImageURL string    `json:"imageUrl"`
+	Blurhash *string   `json:"blurhash,omitempty"`
+}
+
+// PresignGroupImage serves POST /images/group-image/presign: it signs an upload URL
+// for a new image of an existing group and records the key as a pending group image.
+// Group admins only. The image is shown once the upload is confirmed with
+// ConfirmGroupImage; unconfirmed uploads are deleted by cleanup_orphaned_attachments.
+func (h *ImageHandler) PresignGroupImage(c *gin.Context) {
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var req presignGroupImageReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	if status, message := h.authorizeGroupImage(ctx, user.ID, req.GroupID); status != http.StatusOK {
+		c.JSON(status, gin.H{"message": message})
+		return
+	}
+
+	if req.Size <= 0 || req.Size > MaxImageBytes {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "File has invalid size"})
+		return
+	}
+	ext := getSafeExtension(req.Filename)
+	if ext == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Filename must have a valid and supported extension (e.g., .jpg, .png)."})
+		return
+	}
+
+	s3Key := s3store.GroupObjectKey(req.GroupID, user.ID, uuid.New(), ext)
+	expiresAt := time.Now().Add(h.uploadExpiry)
+	uploadURL, err := h.store.PresignUpload(ctx, s3Key, h.uploadExpiry, req.Size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not generate presigned URL: " + err.Error()})
+		return
+	}
+
+	if err := h.db.InsertPendingGroupImage(ctx, db.InsertPendingGroupImageParams{
+		GroupID: req.GroupID,
+		UserID:  user.ID,
+		S3Key:   s3Key,
+		Size:    req.Size,
+	}); err != nil {
+		log.Printf("Error recording pending image for group %s: %v", req.GroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not record upload"})
+		return
+	}
+
+	c.JSON(http.StatusOK, presignUploadRes{
+		UploadURL: uploadURL,
+		ObjectKey: s3Key,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// ConfirmGroupImage serves POST /images/confirm: once the client has uploaded an image
+// presigned by PresignGroupImage, it checks the object exists and, in one transaction,
+// sets it as the group image and clears the pending record. Only the uploader may
+// confirm, and they must still be a group admin. Without a blurhash the server derives
+// one, as for UpdateGroup. Once committed, the object of the replaced image is deleted.
+func (h *ImageHandler) ConfirmGroupImage(c *gin.Context) {
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var req confirmGroupImageReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	pending, err := h.db.GetPendingGroupImage(ctx, req.ObjectKey)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "No pending group image for this key"})
+		} else {
+			log.Printf("Error loading pending group image for user %s: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error loading upload"})
+		}
+		return
+	}
+	if pending.UserID != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"message": "You did not upload this image"})
+		return
+	}
+	if status, message := h.authorizeGroupImage(ctx, user.ID, pending.GroupID); status != http.StatusOK {
+		c.JSON(status, gin.H{"message": message})
+		return
+	}
+
+	size, err := h.store.HeadObject(ctx, pending.S3Key)
+	if err != nil {
+		if errors.Is(err, s3store.ErrObjectNotFound) {
+			c.JSON(http.StatusConflict, gin.H{"message": "Image has not been uploaded yet"})
+		} else {
+			log.Printf("Error checking uploaded image for group %s: %v", pending.GroupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error checking upload"})
+		}
+		return
+	}
+	if size <= 0 || size > MaxImageBytes {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "File has invalid size"})
+		return
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for group image confirm: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to start database operation"})
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := h.db.WithTx(tx)
+
+	// Deleting the pending row first makes a concurrent confirm of the same key a no-op.
+	if removed, err := qtx.DeletePendingGroupImage(ctx, pending.S3Key); err != nil {
+		log.Printf("Error clearing pending image for group %s: %v", pending.GroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to set group image"})
+		return
+	} else if removed == 0 {
+		c.JSON(http.StatusConflict, gin.H{"message": "Image already confirmed"})
+		return
+	}
+	previous, err := qtx.LockGroupImage(ctx, pending.GroupID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Group not found"})
+		} else {
+			log.Printf("Error loading current image of group %s: %v", pending.GroupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to set group image"})
+		}
+		return
+	}
+	updated, err := qtx.SetGroupImage(ctx, db.SetGroupImageParams{
+		ID:       pending.GroupID,
+		ImageUrl: pgtype.Text{String: pending.S3Key, Valid: true},
+		Blurhash: util.NullablePgText(req.Blurhash),
+	})
+	if err != nil {
+		log.Printf("Error setting image of group %s: %v", pending.GroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to set group image"})
+		return
+	}
+	if updated == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Group not found"})
+		return
+	}
+	// Recorded like an UpdateGroup that changes only image_url and blurhash.
+	details, err := json.Marshal(map[string]any{"image_url": pending.S3Key, "blurhash": req.Blurhash})
+	if err == nil {
+		err = qtx.InsertAuditLogEntry(ctx, db.InsertAuditLogEntryParams{
+			GroupID: pending.GroupID,
+			ActorID: &user.ID,
+			Action:  "group_updated",
+			Details: details,
+		})
+	}
+	if err != nil {
+		log.Printf("Error recording image change of group %s: %v", pending.GroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to set group image"})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit image change of group %s: %v", pending.GroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to set group image"})
+		return
+	}
+	log.Printf("Group %s image set to confirmed upload by user %s", pending.GroupID, user.ID)
+	h.deleteReplacedGroupImage(ctx, pending.GroupID, previous, pending.S3Key)
+
+	if req.Blurhash == nil || *req.Blurhash == "" {
+		h.GroupImageSet(pending.GroupID, pending.S3Key)
+	}
+	if h.groups != nil {
+		h.groups.NotifyGroup(pending.GroupID, "group_updated")
+	}
+
+	c.JSON(http.StatusOK, confirmGroupImageRes{
+		GroupID:  pending.GroupID,
+		ImageURL: pending.S3Key,
+		Blurhash: req.Blurhash,
+	})
+}
+
+// deleteReplacedGroupImage removes the object of a group image that a confirmed upload
+// replaced. It only deletes keys under the group's own prefix that no attachment uses,
+// since UpdateGroup accepts any image_url; failures are only logged and leave the
+// object behind.
+func (h *ImageHandler) deleteReplacedGroupImage(ctx context.Context, groupID uuid.UUID, previous db.LockGroupImageRow, current string) {
+	if !previous.ImageUrl.Valid || previous.ImageUrl.String == current || previous.AttachmentKey {
+		return
+	}
+	if keyGroupID, _, err := s3store.ParseGroupObjectKey(previous.ImageUrl.String); err != nil || keyGroupID != groupID {
+		return
+	}
+	if err := h.store.DeleteObject(ctx, previous.ImageUrl.String); err != nil {
+		log.Printf("Error deleting replaced image %s of group %s: %v", previous.ImageUrl.String, groupID, err)
+	}
+}
+
+// authorizeGroupImage checks that userID may change groupID's image: the group must
+// exist and the user must be one of its admins. It returns http.StatusOK, or the status
+// and message to respond with.
+func (h *ImageHandler) authorizeGroupImage(ctx context.Context, userID, groupID uuid.UUID) (int, string) {
+	if _, err := h.db.GetGroupById(ctx, groupID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return http.StatusNotFound, "Group not found"
+		}
+		return http.StatusInternalServerError, "Error loading group"
+	}
+	membership, err := h.db.GetUserGroupByGroupIDAndUserID(ctx, db.GetUserGroupByGroupIDAndUserIDParams{
+		GroupID: &groupID,
+		UserID:  &userID,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return http.StatusForbidden, "You are not a member of this group"
+		}
+		return http.StatusInternalServerError, "Error checking group membership"
+	}
+	if !membership.Admin {
+		return http.StatusForbidden, "Only group admins can change the group image"
+	}
+	return http.StatusOK, ""
+}
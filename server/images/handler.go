@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"path/filepath"
 	"strings"
@@ -24,35 +25,73 @@ type ImageHandler struct {
 	db    *db.Queries
 	ctx   context.Context
 	conn  *pgxpool.Pool
+	// uploadExpiry and downloadExpiry are how long presigned URLs stay valid.
+	uploadExpiry   time.Duration
+	downloadExpiry time.Duration
+	// blurhashSlots limits concurrent GroupImageSet work; see placeholder.go.
+	blurhashSlots chan struct{}
+	// groups is told when ConfirmGroupImage or GroupImageSet changes a group; may be nil.
+	groups GroupNotifier
 }
 
 const MaxImageBytes = 5 * 1024 * 1024
 
+// maxPresignExpiry is the longest lifetime S3 accepts for a SigV4 presigned URL.
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+// maxRequestedUploadExpiry caps the expiry a client may ask for in presignUploadReq,
+// unless the configured upload expiry is longer.
+const maxRequestedUploadExpiry = 1 * time.Hour
+
+const defaultPresignExpiry = 15 * time.Minute
+
 func NewImageHandler(
 	store s3store.Store,
 	db *db.Queries,
 	ctx context.Context,
 	conn *pgxpool.Pool,
+	groups GroupNotifier,
 ) *ImageHandler {
 	return &ImageHandler{
-		store: store,
-		db:    db,
-		ctx:   ctx,
-		conn:  conn,
+		store:          store,
+		db:             db,
+		ctx:            ctx,
+		conn:           conn,
+		uploadExpiry:   presignExpiryFromEnv("PRESIGN_UPLOAD_EXPIRY_SECONDS"),
+		downloadExpiry: presignExpiryFromEnv("PRESIGN_DOWNLOAD_EXPIRY_SECONDS"),
+		blurhashSlots:  make(chan struct{}, maxConcurrentBlurhashes),
+		groups:         groups,
 	}
 }
 
+// presignExpiryFromEnv reads a presign lifetime in seconds, falling back to the default
+// when it is unset, not positive, or longer than S3 allows.
+func presignExpiryFromEnv(key string) time.Duration {
+	seconds := util.GetEnvInt(key, int(defaultPresignExpiry/time.Second))
+	expiry := time.Duration(seconds) * time.Second
+	if expiry <= 0 || expiry > maxPresignExpiry {
+		log.Printf("%s must be between 1 and %d seconds, using default %s",
+			key, int(maxPresignExpiry/time.Second), defaultPresignExpiry)
+		return defaultPresignExpiry
+	}
+	return expiry
+}
+
 type presignUploadReq struct {
 	Filename  string    `json:"filename" binding:"required"`
 	GroupID   uuid.UUID `json:"groupId" binding:"required"`
 	Size      int64     `json:"size" binding:"required"`
 	Expires   int       `json:"expires"`
 	ForCreate bool      `json:"forCreate"`
+	// MessageID is the ID of the image message the upload belongs to. When set, the
+	// upload is recorded as an attachment so it can be cleaned up if never sent.
+	MessageID *uuid.UUID `json:"messageId"`
 }
 
 type presignUploadRes struct {
-	UploadURL string `json:"uploadUrl"`
-	ObjectKey string `json:"objectKey"`
+	UploadURL string    `json:"uploadUrl"`
+	ObjectKey string    `json:"objectKey"`
+	ExpiresAt time.Time `json:"expiresAt"`
 }
 
 type presignDownloadReq struct {
@@ -60,27 +99,36 @@ type presignDownloadReq struct {
 }
 
 type presignDownloadRes struct {
-	DownloadURL string `json:"downloadUrl"`
+	DownloadURL string    `json:"downloadUrl"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+var allowedExtensions = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
 }
 
 func getSafeExtension(filename string) string {
 	base := filepath.Base(filename)
 	ext := strings.ToLower(filepath.Ext(base))
 
-	allowedExtensions := map[string]bool{
-		".jpg":  true,
-		".jpeg": true,
-		".png":  true,
-		".gif":  true,
-		".webp": true,
-	}
-
-	if allowedExtensions[ext] {
+	if _, ok := allowedExtensions[ext]; ok {
 		return ext
 	}
 	return ""
 }
 
+// contentTypeForExtension returns the MIME type for an extension from getSafeExtension.
+func contentTypeForExtension(ext string) string {
+	if contentType, ok := allowedExtensions[ext]; ok {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
 func (h *ImageHandler) PresignUpload(c *gin.Context) {
 	user, err := util.GetUser(c, h.db)
 	if err != nil {
@@ -128,7 +176,15 @@ func (h *ImageHandler) PresignUpload(c *gin.Context) {
 
 	} else {
 		isMember, err := util.UserInGroup(ctx, user.ID, req.GroupID, h.db)
-		if err != nil || !isMember {
+		if err != nil {
+			log.Printf("Error checking membership of user %s in group %s for upload: %v", user.ID, req.GroupID, err)
+			c.JSON(
+				http.StatusInternalServerError,
+				gin.H{"message": "Error checking group membership"},
+			)
+			return
+		}
+		if !isMember {
 			c.JSON(
 				http.StatusForbidden,
 				gin.H{"message": "You are not authorized to upload to this group."},
@@ -154,24 +210,18 @@ func (h *ImageHandler) PresignUpload(c *gin.Context) {
 		return
 	}
 
-	// Format: groups/{groupID}/{uploaderUserID}/{fileUUID}.ext
-	s3KeyPrefix := fmt.Sprintf(
-		"groups/%s/%s/",
-		req.GroupID.String(),
-		user.ID.String(),
-	)
-	s3ObjectUUID := uuid.New().String()
-	s3Key := s3KeyPrefix + s3ObjectUUID + ext
+	s3Key := s3store.GroupObjectKey(req.GroupID, user.ID, uuid.New(), ext)
 
 	expiresDuration := time.Duration(req.Expires) * time.Second
 	if req.Expires <= 0 {
-		expiresDuration = 15 * time.Minute
+		expiresDuration = h.uploadExpiry
 	}
-	maxExpiration := 1 * time.Hour
+	maxExpiration := max(maxRequestedUploadExpiry, h.uploadExpiry)
 	if expiresDuration > maxExpiration {
 		expiresDuration = maxExpiration
 	}
 
+	expiresAt := time.Now().Add(expiresDuration)
 	uploadURL, err := h.store.PresignUpload(ctx, s3Key, expiresDuration, req.Size)
 	if err != nil {
 		c.JSON(
@@ -181,9 +231,28 @@ func (h *ImageHandler) PresignUpload(c *gin.Context) {
 		return
 	}
 
+	if req.MessageID != nil && !req.ForCreate {
+		if _, err := h.db.InsertAttachment(ctx, db.InsertAttachmentParams{
+			GroupID:     req.GroupID,
+			MessageID:   *req.MessageID,
+			S3Key:       s3Key,
+			ContentType: contentTypeForExtension(ext),
+			Size:        req.Size,
+			UploaderID:  &user.ID,
+		}); err != nil {
+			log.Printf("Error recording attachment for group %s: %v", req.GroupID, err)
+			c.JSON(
+				http.StatusInternalServerError,
+				gin.H{"message": "Could not record attachment"},
+			)
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, presignUploadRes{
 		UploadURL: uploadURL,
 		ObjectKey: s3Key,
+		ExpiresAt: expiresAt,
 	})
 }
 
@@ -204,80 +273,172 @@ func (h *ImageHandler) PresignDownload(c *gin.Context) {
 		return
 	}
 
-	parts := strings.Split(req.ObjectKey, "/")
-	// expect "groups/{groupID}/{userID}/{fileUUID}.ext"
-	if len(parts) < 4 || parts[0] != "groups" {
+	groupID, err := groupIDFromObjectKey(req.ObjectKey)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "Invalid or malformed object key",
+			"message": err.Error(),
 		})
 		return
 	}
 
-	groupID, err := uuid.Parse(parts[1])
+	ctx := c.Request.Context()
+
+	if status, message := h.authorizeGroupDownload(ctx, user.ID, groupID); status != http.StatusOK {
+		c.JSON(status, gin.H{
+			"message": message,
+		})
+		return
+	}
+
+	expiresAt := time.Now().Add(h.downloadExpiry)
+	downloadURL, err := h.store.PresignDownload(
+		ctx, req.ObjectKey, h.downloadExpiry,
+	)
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Could not generate presigned URL: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, presignDownloadRes{
+		DownloadURL: downloadURL,
+		ExpiresAt:   expiresAt,
+	})
+}
+
+// MaxDownloadBatchSize caps the number of keys accepted by PresignDownloadBatch.
+const MaxDownloadBatchSize = 50
+
+type presignDownloadBatchReq struct {
+	ObjectKeys []string `json:"objectKeys" binding:"required"`
+}
+
+type presignDownloadBatchRes struct {
+	DownloadURLs map[string]string `json:"downloadUrls"`
+	// ExpiresAt applies to every URL in the batch.
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// PresignDownloadBatch signs GET URLs for several objects at once. Every key must be
+// downloadable by the caller under the same rules as PresignDownload, otherwise the
+// whole batch is rejected.
+func (h *ImageHandler) PresignDownloadBatch(c *gin.Context) {
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not found or unauthorized",
+		})
+		return
+	}
+
+	var req presignDownloadBatchReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Invalid request: " + err.Error(),
+		})
+		return
+	}
+	if len(req.ObjectKeys) == 0 || len(req.ObjectKeys) > MaxDownloadBatchSize {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "Invalid group ID in object key",
+			"message": fmt.Sprintf("objectKeys must contain between 1 and %d keys", MaxDownloadBatchSize),
 		})
 		return
 	}
 
 	ctx := c.Request.Context()
 
-	if _, err := h.db.GetGroupById(ctx, groupID); err == nil {
-		isMember, err := util.UserInGroup(ctx, user.ID, groupID, h.db)
+	// Authorize each distinct group once
+	authorized := make(map[uuid.UUID]bool)
+	for _, key := range req.ObjectKeys {
+		groupID, err := groupIDFromObjectKey(key)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"message": "Error checking group membership",
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message":   err.Error(),
+				"objectKey": key,
 			})
 			return
 		}
-		if !isMember {
-			c.JSON(http.StatusForbidden, gin.H{
-				"message": "Not authorized to download from this group",
+		if authorized[groupID] {
+			continue
+		}
+		if status, message := h.authorizeGroupDownload(ctx, user.ID, groupID); status != http.StatusOK {
+			c.JSON(status, gin.H{
+				"message":   message,
+				"objectKey": key,
 			})
 			return
 		}
+		authorized[groupID] = true
+	}
 
-	} else if errors.Is(err, pgx.ErrNoRows) {
-		resv, err := h.db.GetGroupReservation(ctx, groupID)
-		if err != nil {
-			if errors.Is(err, pgx.ErrNoRows) {
-				c.JSON(http.StatusNotFound, gin.H{
-					"message": "Group not found",
-				})
-			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"message": "Error checking group reservation",
-				})
-			}
-			return
+	expiresAt := time.Now().Add(h.downloadExpiry)
+	urls := make(map[string]string, len(req.ObjectKeys))
+	for _, key := range req.ObjectKeys {
+		if _, done := urls[key]; done {
+			continue
 		}
-		if resv.UserID != user.ID {
-			c.JSON(http.StatusForbidden, gin.H{
-				"message": "Not authorized to download pre-created avatar",
+		downloadURL, err := h.store.PresignDownload(ctx, key, h.downloadExpiry)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "Could not generate presigned URL: " + err.Error(),
 			})
 			return
 		}
-
-	} else {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"message": "Error loading group",
-		})
-		return
+		urls[key] = downloadURL
 	}
 
-	expires := 15 * time.Minute
-	downloadURL, err := h.store.PresignDownload(
-		ctx, req.ObjectKey, expires,
-	)
+	c.JSON(http.StatusOK, presignDownloadBatchRes{
+		DownloadURLs: urls,
+		ExpiresAt:    expiresAt,
+	})
+}
+
+// groupIDFromObjectKey extracts the group ID from a key in the format PresignUpload
+// generates (see s3store.GroupObjectKey), rejecting anything else.
+func groupIDFromObjectKey(objectKey string) (uuid.UUID, error) {
+	groupID, filename, err := s3store.ParseGroupObjectKey(objectKey)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"message": "Could not generate presigned URL: " + err.Error(),
-		})
-		return
+		return uuid.Nil, err
+	}
+	ext := filepath.Ext(filename)
+	if _, err := uuid.Parse(strings.TrimSuffix(filename, ext)); err != nil {
+		return uuid.Nil, errors.New("Invalid or malformed object key")
 	}
+	if _, ok := allowedExtensions[ext]; ext != "" && !ok {
+		return uuid.Nil, errors.New("Invalid or malformed object key")
+	}
+	return groupID, nil
+}
 
-	c.JSON(http.StatusOK, presignDownloadRes{
-		DownloadURL: downloadURL,
-	})
+// authorizeGroupDownload checks that userID may download objects under groupID: members
+// of an existing group, or the reserving user of a group still being created. It
+// returns http.StatusOK, or the status and message to respond with.
+func (h *ImageHandler) authorizeGroupDownload(ctx context.Context, userID, groupID uuid.UUID) (int, string) {
+	_, err := h.db.GetGroupById(ctx, groupID)
+	if err == nil {
+		isMember, err := util.UserInGroup(ctx, userID, groupID, h.db)
+		if err != nil {
+			return http.StatusInternalServerError, "Error checking group membership"
+		}
+		if !isMember {
+			return http.StatusForbidden, "Not authorized to download from this group"
+		}
+		return http.StatusOK, ""
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return http.StatusInternalServerError, "Error loading group"
+	}
+
+	resv, err := h.db.GetGroupReservation(ctx, groupID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return http.StatusNotFound, "Group not found"
+		}
+		return http.StatusInternalServerError, "Error checking group reservation"
+	}
+	if resv.UserID != userID {
+		return http.StatusForbidden, "Not authorized to download pre-created avatar"
+	}
+	return http.StatusOK, ""
 }
@@ -0,0 +1,103 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"chat-app-server/db"
+	"chat-app-server/s3store"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// maxBlurhashPixels refuses to decode images with more pixels than this, since a
+// small compressed file can still expand into a huge bitmap.
+const maxBlurhashPixels = 40_000_000
+
+// blurhashTimeout bounds fetching and hashing one group image.
+const blurhashTimeout = 30 * time.Second
+
+// maxConcurrentBlurhashes caps the images hashed at once on this instance; further
+// requests are skipped rather than queued.
+const maxConcurrentBlurhashes = 4
+
+// GroupImageSet computes a blurhash for a group image the client uploaded without
+// one, stores it on the group and sends members group_updated so they pick it up. It
+// returns immediately; the work is best-effort and failures are only logged. Keys
+// outside the group and formats the server can't decode (such as WebP) are skipped.
+func (h *ImageHandler) GroupImageSet(groupID uuid.UUID, objectKey string) {
+	keyGroupID, filename, err := s3store.ParseGroupObjectKey(objectKey)
+	if err != nil || keyGroupID != groupID {
+		return
+	}
+	if !strings.HasPrefix(contentTypeForExtension(strings.ToLower(filepath.Ext(filename))), "image/") {
+		return
+	}
+
+	select {
+	case h.blurhashSlots <- struct{}{}:
+	default:
+		log.Printf("Skipping blurhash for group %s: too many in progress", groupID)
+		return
+	}
+
+	go func() {
+		defer func() { <-h.blurhashSlots }()
+
+		ctx, cancel := context.WithTimeout(h.ctx, blurhashTimeout)
+		defer cancel()
+
+		hash, err := h.computeBlurhash(ctx, objectKey)
+		if err != nil {
+			if !errors.Is(err, image.ErrFormat) {
+				log.Printf("Error computing blurhash for group %s: %v", groupID, err)
+			}
+			return
+		}
+		updated, err := h.db.SetGroupBlurhashForImage(ctx, db.SetGroupBlurhashForImageParams{
+			ID:       groupID,
+			ImageUrl: pgtype.Text{String: objectKey, Valid: true},
+			Blurhash: pgtype.Text{String: hash, Valid: true},
+		})
+		if err != nil {
+			log.Printf("Error storing blurhash for group %s: %v", groupID, err)
+			return
+		}
+		// Nothing changed if the image was replaced while it was being hashed.
+		if updated > 0 && h.groups != nil {
+			h.groups.NotifyGroup(groupID, "group_updated")
+		}
+	}()
+}
+
+func (h *ImageHandler) computeBlurhash(ctx context.Context, objectKey string) (string, error) {
+	body, err := h.store.GetObject(ctx, objectKey, MaxImageBytes)
+	if err != nil {
+		return "", fmt.Errorf("fetch object: %w", err)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	if config.Width*config.Height > maxBlurhashPixels {
+		return "", fmt.Errorf("image is %dx%d, too large to decode", config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	return encodeBlurhash(img, blurhashComponentsX, blurhashComponentsY)
+}
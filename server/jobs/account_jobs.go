@@ -0,0 +1,84 @@
+package jobs
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// AccountPurger permanently deletes a deactivated user and tells the rest of the
+// system. It must re-check, in the deleting transaction, that the user is still
+// deactivated since before cutoff, and report false without deleting when not. The
+// WebSocket hub implements it with the same logic as account deletion.
+type AccountPurger interface {
+	PurgeDeactivatedAccount(ctx context.Context, userID uuid.UUID, cutoff time.Time) (bool, error)
+}
+
+// deactivatedAccountBatchSize caps the accounts purged per run.
+const deactivatedAccountBatchSize = 100
+
+// PurgeDeactivatedAccountsJob hard-deletes accounts that have stayed deactivated for
+// longer than ACCOUNT_DEACTIVATION_GRACE_DAYS.
+type PurgeDeactivatedAccountsJob struct {
+	BaseJob
+	purger AccountPurger
+}
+
+// NewPurgeDeactivatedAccountsJob creates a new PurgeDeactivatedAccountsJob that deletes accounts through purger
+func NewPurgeDeactivatedAccountsJob(baseJob BaseJob, purger AccountPurger) *PurgeDeactivatedAccountsJob {
+	return &PurgeDeactivatedAccountsJob{
+		BaseJob: baseJob,
+		purger:  purger,
+	}
+}
+
+func (j *PurgeDeactivatedAccountsJob) Name() string {
+	return "purge_deactivated_accounts"
+}
+
+func (j *PurgeDeactivatedAccountsJob) Schedule() string {
+	return "15 * * * *" // Every hour at :15
+}
+
+func (j *PurgeDeactivatedAccountsJob) LockTimeout() time.Duration {
+	return 15 * time.Minute
+}
+
+func (j *PurgeDeactivatedAccountsJob) Execute(ctx context.Context) error {
+	grace := time.Duration(util.GetEnvInt("ACCOUNT_DEACTIVATION_GRACE_DAYS", 30)) * 24 * time.Hour
+	cutoff := time.Now().Add(-grace)
+	userIDs, err := j.db.GetUsersDeactivatedBefore(ctx, db.GetUsersDeactivatedBeforeParams{
+		Cutoff:    pgtype.Timestamp{Time: cutoff, Valid: true},
+		BatchSize: deactivatedAccountBatchSize,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get deactivated accounts: %w", err)
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	// One failed purge shouldn't hold up the rest; it is retried on the next run.
+	purged := 0
+	for _, userID := range userIDs {
+		deleted, err := j.purger.PurgeDeactivatedAccount(ctx, userID, cutoff)
+		if err != nil {
+			log.Printf("Job %s: Error purging deactivated account %s: %v", j.Name(), userID, err)
+			continue
+		}
+		if !deleted {
+			log.Printf("Job %s: Account %s was reactivated before its purge, keeping it", j.Name(), userID)
+			continue
+		}
+		purged++
+	}
+
+	log.Printf("Job %s: Purged %d of %d deactivated accounts", j.Name(), purged, len(userIDs))
+	return nil
+}
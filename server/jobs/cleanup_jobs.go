@@ -3,6 +3,8 @@ package jobs
 import (
 	"chat-app-server/db"
 	"chat-app-server/notifications"
+	"chat-app-server/s3store"
+	"chat-app-server/util"
 	"context"
 	"fmt"
 	"log"
@@ -12,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 // deleteS3ObjectsWithPrefix deletes all S3 objects with the given prefix, handling pagination
@@ -58,7 +61,21 @@ func deleteS3ObjectsWithPrefix(ctx context.Context, s3Client *s3.Client, bucket,
 	return totalDeleted, nil
 }
 
-// CleanupExpiredGroupsJob deletes groups that have passed their end_time
+// failedObjectKeys returns the keys a DeleteObjects call reports it could not delete,
+// logging each one. DeleteObjects succeeds even when some keys fail, so callers keep
+// the rows of these keys for the next run to retry.
+func failedObjectKeys(jobName string, output *s3.DeleteObjectsOutput) map[string]bool {
+	failed := make(map[string]bool, len(output.Errors))
+	for _, objectErr := range output.Errors {
+		key := aws.ToString(objectErr.Key)
+		failed[key] = true
+		log.Printf("Job %s: Error deleting S3 object %s: %s %s", jobName, key, aws.ToString(objectErr.Code), aws.ToString(objectErr.Message))
+	}
+	return failed
+}
+
+// CleanupExpiredGroupsJob deletes groups once their end_time is further in the past
+// than the retention window (see expiredGroupRetention).
 type CleanupExpiredGroupsJob struct {
 	BaseJob
 }
@@ -75,9 +92,22 @@ func (j *CleanupExpiredGroupsJob) LockTimeout() time.Duration {
 	return 30 * time.Minute
 }
 
+// expiredGroupRetention is how long an ended group is kept before cleanup:
+// EXPIRED_GROUP_RETENTION_HOURS (default 0, deleted on the next run after it ends), but
+// never less than ENDED_GROUP_GRACE_SECONDS, during which the group still accepts
+// messages. Members can read the group until it is deleted.
+func expiredGroupRetention() time.Duration {
+	retention := time.Duration(util.GetEnvInt("EXPIRED_GROUP_RETENTION_HOURS", 0)) * time.Hour
+	postingGrace := time.Duration(util.GetEnvInt("ENDED_GROUP_GRACE_SECONDS", 0)) * time.Second
+	return max(retention, postingGrace)
+}
+
 func (j *CleanupExpiredGroupsJob) Execute(ctx context.Context) error {
 	// Get expired groups in batches of 50
-	expiredGroups, err := j.db.GetExpiredGroups(ctx, 50)
+	expiredGroups, err := j.db.GetExpiredGroups(ctx, db.GetExpiredGroupsParams{
+		Cutoff:    pgtype.Timestamp{Time: time.Now().Add(-expiredGroupRetention()), Valid: true},
+		BatchSize: 50,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to get expired groups: %w", err)
 	}
@@ -157,6 +187,15 @@ func (j *CleanupExpiredGroupsJob) cleanupGroup(ctx context.Context, groupID uuid
 		return fmt.Errorf("failed to delete group: %w", err)
 	}
 
+	// Recorded without an actor, like any other audit entry for a system action.
+	if err := qtx.InsertAuditLogEntry(ctx, db.InsertAuditLogEntryParams{
+		GroupID: groupID,
+		Action:  "group_deleted",
+		Details: []byte(`{"reason":"expired"}`),
+	}); err != nil {
+		return fmt.Errorf("failed to record group deletion: %w", err)
+	}
+
 	if err := tx.Commit(ctx); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -196,7 +235,7 @@ func (j *CleanupExpiredGroupsJob) cleanupOrphanedGroupData(ctx context.Context,
 }
 
 func (j *CleanupExpiredGroupsJob) deleteS3Objects(ctx context.Context, groupID uuid.UUID) error {
-	prefix := fmt.Sprintf("groups/%s/", groupID)
+	prefix := s3store.GroupObjectPrefix(groupID)
 
 	deleted, err := deleteS3ObjectsWithPrefix(ctx, j.s3Client, j.s3Bucket, prefix, j.Name())
 	if err != nil {
@@ -296,7 +335,7 @@ func (j *CleanupStaleReservationsJob) Execute(ctx context.Context) error {
 }
 
 func (j *CleanupStaleReservationsJob) deleteS3Objects(ctx context.Context, groupID uuid.UUID) error {
-	prefix := fmt.Sprintf("groups/%s/", groupID)
+	prefix := s3store.GroupObjectPrefix(groupID)
 
 	deleted, err := deleteS3ObjectsWithPrefix(ctx, j.s3Client, j.s3Bucket, prefix, j.Name())
 	if err != nil {
@@ -373,6 +412,205 @@ func (j *CleanupStaleDeviceKeysJob) Execute(ctx context.Context) error {
 	return nil
 }
 
+// CleanupOrphanedAttachmentsJob deletes uploads that no image message from their
+// uploader claimed (or whose message has since been deleted), and group images that
+// were never confirmed, once they are older than ORPHANED_ATTACHMENT_MAX_AGE_HOURS
+type CleanupOrphanedAttachmentsJob struct {
+	BaseJob
+}
+
+func (j *CleanupOrphanedAttachmentsJob) Name() string {
+	return "cleanup_orphaned_attachments"
+}
+
+func (j *CleanupOrphanedAttachmentsJob) Schedule() string {
+	return "30 * * * *" // Every hour at :30
+}
+
+func (j *CleanupOrphanedAttachmentsJob) LockTimeout() time.Duration {
+	return 15 * time.Minute
+}
+
+func (j *CleanupOrphanedAttachmentsJob) Execute(ctx context.Context) error {
+	maxAge := time.Duration(util.GetEnvInt("ORPHANED_ATTACHMENT_MAX_AGE_HOURS", 24)) * time.Hour
+	cutoff := pgtype.Timestamp{Time: time.Now().Add(-maxAge), Valid: true}
+	if err := j.deleteOrphanedAttachments(ctx, cutoff); err != nil {
+		return err
+	}
+	return j.deleteUnconfirmedGroupImages(ctx, cutoff)
+}
+
+func (j *CleanupOrphanedAttachmentsJob) deleteOrphanedAttachments(ctx context.Context, cutoff pgtype.Timestamp) error {
+	orphans, err := j.db.GetOrphanedAttachments(ctx, db.GetOrphanedAttachmentsParams{
+		CreatedAt: cutoff,
+		Limit:     1000,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get orphaned attachments: %w", err)
+	}
+
+	if len(orphans) == 0 {
+		log.Printf("Job %s: No orphaned attachments found", j.Name())
+		return nil
+	}
+
+	objectIds := make([]types.ObjectIdentifier, 0, len(orphans))
+	for _, orphan := range orphans {
+		objectIds = append(objectIds, types.ObjectIdentifier{Key: aws.String(orphan.S3Key)})
+	}
+
+	// DeleteObjects accepts up to 1000 keys, matching the query limit
+	output, err := j.s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(j.s3Bucket),
+		Delete: &types.Delete{Objects: objectIds},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete orphaned S3 objects: %w", err)
+	}
+
+	failed := failedObjectKeys(j.Name(), output)
+	attachmentIDs := make([]uuid.UUID, 0, len(orphans))
+	for _, orphan := range orphans {
+		if !failed[orphan.S3Key] {
+			attachmentIDs = append(attachmentIDs, orphan.ID)
+		}
+	}
+	if len(attachmentIDs) > 0 {
+		if err := j.db.DeleteAttachments(ctx, attachmentIDs); err != nil {
+			return fmt.Errorf("failed to delete orphaned attachment records: %w", err)
+		}
+	}
+
+	log.Printf("Job %s: Deleted %d orphaned attachments, %d left for the next run", j.Name(), len(attachmentIDs), len(orphans)-len(attachmentIDs))
+	return nil
+}
+
+// deleteUnconfirmedGroupImages removes uploads from PresignGroupImage that were never
+// confirmed with POST /images/confirm.
+func (j *CleanupOrphanedAttachmentsJob) deleteUnconfirmedGroupImages(ctx context.Context, cutoff pgtype.Timestamp) error {
+	stale, err := j.db.GetStalePendingGroupImages(ctx, db.GetStalePendingGroupImagesParams{
+		CreatedAt: cutoff,
+		Limit:     1000,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get unconfirmed group images: %w", err)
+	}
+
+	if len(stale) == 0 {
+		log.Printf("Job %s: No unconfirmed group images found", j.Name())
+		return nil
+	}
+
+	objectIds := make([]types.ObjectIdentifier, 0, len(stale))
+	for _, pending := range stale {
+		objectIds = append(objectIds, types.ObjectIdentifier{Key: aws.String(pending.S3Key)})
+	}
+
+	output, err := j.s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(j.s3Bucket),
+		Delete: &types.Delete{Objects: objectIds},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete unconfirmed group image objects: %w", err)
+	}
+
+	failed := failedObjectKeys(j.Name(), output)
+	pendingIDs := make([]uuid.UUID, 0, len(stale))
+	for _, pending := range stale {
+		if !failed[pending.S3Key] {
+			pendingIDs = append(pendingIDs, pending.ID)
+		}
+	}
+	if len(pendingIDs) > 0 {
+		if err := j.db.DeletePendingGroupImages(ctx, pendingIDs); err != nil {
+			return fmt.Errorf("failed to delete pending group image records: %w", err)
+		}
+	}
+
+	log.Printf("Job %s: Deleted %d unconfirmed group images, %d left for the next run", j.Name(), len(pendingIDs), len(stale)-len(pendingIDs))
+	return nil
+}
+
+// pushTokenCleanupBatchSize caps the rows each step of CleanupPushTokensJob touches per query.
+const pushTokenCleanupBatchSize = 500
+
+// CleanupPushTokensJob clears push tokens that have failed on at least
+// PUSH_TOKEN_MAX_FAILURES receipts in a row, drops failure counts that no longer
+// matter, and deletes pending receipts for tokens no device holds. DeviceNotRegistered
+// receipts still clear tokens immediately in ProcessReceipts; this only catches tokens
+// that keep failing for other reasons. Every step is safe to repeat.
+type CleanupPushTokensJob struct {
+	BaseJob
+}
+
+func (j *CleanupPushTokensJob) Name() string {
+	return "cleanup_push_tokens"
+}
+
+func (j *CleanupPushTokensJob) Schedule() string {
+	return "45 3 * * *" // Daily at 3:45 AM
+}
+
+func (j *CleanupPushTokensJob) LockTimeout() time.Duration {
+	return 15 * time.Minute
+}
+
+func (j *CleanupPushTokensJob) Execute(ctx context.Context) error {
+	maxFailures := int32(util.GetEnvIntAtLeast("PUSH_TOKEN_MAX_FAILURES", 3, 1))
+
+	removedTokens := 0
+	for {
+		tokens, err := j.db.GetFailingPushTokens(ctx, db.GetFailingPushTokensParams{
+			MinFailures: maxFailures,
+			BatchSize:   pushTokenCleanupBatchSize,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get failing push tokens: %w", err)
+		}
+		if len(tokens) == 0 {
+			break
+		}
+		if err := j.db.DeletePushTokensByValue(ctx, tokens); err != nil {
+			return fmt.Errorf("failed to clear failing push tokens: %w", err)
+		}
+		if err := j.db.ClearPushTokenFailures(ctx, tokens); err != nil {
+			return fmt.Errorf("failed to clear push token failures: %w", err)
+		}
+		removedTokens += len(tokens)
+		if len(tokens) < pushTokenCleanupBatchSize {
+			break
+		}
+	}
+
+	staleFailures, err := deleteInBatches(ctx, j.db.DeleteStalePushTokenFailures)
+	if err != nil {
+		return fmt.Errorf("failed to delete stale push token failures: %w", err)
+	}
+	orphanedReceipts, err := deleteInBatches(ctx, j.db.DeleteOrphanedReceipts)
+	if err != nil {
+		return fmt.Errorf("failed to delete orphaned push receipts: %w", err)
+	}
+
+	log.Printf("Job %s: Cleared %d failing push tokens, %d stale failure records and %d orphaned receipts",
+		j.Name(), removedTokens, staleFailures, orphanedReceipts)
+	return nil
+}
+
+// deleteInBatches runs a batched :execrows delete until it removes less than a full batch.
+func deleteInBatches(ctx context.Context, deleteBatch func(context.Context, int32) (int64, error)) (int64, error) {
+	var total int64
+	for {
+		deleted, err := deleteBatch(ctx, pushTokenCleanupBatchSize)
+		if err != nil {
+			return total, err
+		}
+		total += deleted
+		if deleted < pushTokenCleanupBatchSize {
+			return total, nil
+		}
+	}
+}
+
 // ProcessPushReceiptsJob checks pending push notification receipts and removes invalid tokens
 type ProcessPushReceiptsJob struct {
 	BaseJob
@@ -409,3 +647,36 @@ func (j *ProcessPushReceiptsJob) Execute(ctx context.Context) error {
 	log.Printf("Job %s: Completed push receipt processing", j.Name())
 	return nil
 }
+
+// RetryPendingNotificationsJob resends push notifications Expo failed to accept
+type RetryPendingNotificationsJob struct {
+	BaseJob
+	notificationService *notifications.NotificationService
+}
+
+// NewRetryPendingNotificationsJob creates a new RetryPendingNotificationsJob with the notification service
+func NewRetryPendingNotificationsJob(baseJob BaseJob, notificationService *notifications.NotificationService) *RetryPendingNotificationsJob {
+	return &RetryPendingNotificationsJob{
+		BaseJob:             baseJob,
+		notificationService: notificationService,
+	}
+}
+
+func (j *RetryPendingNotificationsJob) Name() string {
+	return "retry_pending_notifications"
+}
+
+func (j *RetryPendingNotificationsJob) Schedule() string {
+	return "* * * * *" // Every minute
+}
+
+func (j *RetryPendingNotificationsJob) LockTimeout() time.Duration {
+	return 2 * time.Minute
+}
+
+func (j *RetryPendingNotificationsJob) Execute(ctx context.Context) error {
+	if err := j.notificationService.RetryPendingNotifications(ctx); err != nil {
+		return fmt.Errorf("failed to retry pending notifications: %w", err)
+	}
+	return nil
+}
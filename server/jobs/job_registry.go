@@ -2,8 +2,10 @@ package jobs
 
 import (
 	"chat-app-server/notifications"
+	"chat-app-server/util"
 	"os"
 	"strings"
+	"time"
 )
 
 // JobConfig represents a job and its enabled status
@@ -33,6 +35,8 @@ func (c *JobConfig) IsEnabled() bool {
 // JobDependencies holds optional dependencies for jobs that need them
 type JobDependencies struct {
 	NotificationService *notifications.NotificationService
+	MessageNotifier     MessageDeletionNotifier
+	AccountPurger       AccountPurger
 }
 
 // GetJobConfigs returns all registered jobs with their configurations
@@ -50,12 +54,52 @@ func GetJobConfigs(baseJob BaseJob, deps *JobDependencies) []JobConfig {
 			Job:     &CleanupStaleDeviceKeysJob{BaseJob: baseJob},
 			Enabled: true,
 		},
+		{
+			Job:     &CleanupOrphanedAttachmentsJob{BaseJob: baseJob},
+			Enabled: true,
+		},
+		{
+			Job:     &ReconcileMembershipJob{BaseJob: baseJob},
+			Enabled: true,
+		},
+		{
+			Job:     &CleanupPushTokensJob{BaseJob: baseJob},
+			Enabled: true,
+		},
 	}
 
 	// Add notification-related jobs if notification service is available
 	if deps != nil && deps.NotificationService != nil {
+		configs = append(configs,
+			JobConfig{
+				Job:     NewProcessPushReceiptsJob(baseJob, deps.NotificationService),
+				Enabled: true,
+			},
+			JobConfig{
+				Job:     NewRetryPendingNotificationsJob(baseJob, deps.NotificationService),
+				Enabled: true,
+			},
+		)
+	}
+
+	if deps != nil && deps.MessageNotifier != nil {
+		// Message retention is off unless MESSAGE_RETENTION_DAYS is set.
+		retentionDays := util.GetEnvInt("MESSAGE_RETENTION_DAYS", 0)
+		configs = append(configs,
+			JobConfig{
+				Job:     NewExpireMessagesJob(baseJob, deps.MessageNotifier),
+				Enabled: true,
+			},
+			JobConfig{
+				Job:     NewTrimOldMessagesJob(baseJob, deps.MessageNotifier, time.Duration(retentionDays)*24*time.Hour),
+				Enabled: retentionDays > 0,
+			},
+		)
+	}
+
+	if deps != nil && deps.AccountPurger != nil {
 		configs = append(configs, JobConfig{
-			Job:     NewProcessPushReceiptsJob(baseJob, deps.NotificationService),
+			Job:     NewPurgeDeactivatedAccountsJob(baseJob, deps.AccountPurger),
 			Enabled: true,
 		})
 	}
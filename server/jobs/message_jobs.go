@@ -0,0 +1,214 @@
+package jobs
+
+import (
+	"chat-app-server/db"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// MessageDeletionNotifier tells connected members that messages were deleted. The
+// WebSocket hub implements it.
+type MessageDeletionNotifier interface {
+	NotifyMessagesDeleted(groupID uuid.UUID, messageIDs []uuid.UUID)
+}
+
+// expiredMessageBatchSize caps the messages deleted per batch, and so the attachment
+// keys passed to a single DeleteObjects call.
+const expiredMessageBatchSize = 1000
+
+// trimMessageBatchesPerRun caps the batches trim_old_messages deletes per run, so a
+// first run against a large backlog is spread over several runs.
+const trimMessageBatchesPerRun = 20
+
+// ExpireMessagesJob deletes disappearing messages once their expires_at has passed,
+// along with their attachments, and tells group members to drop them.
+type ExpireMessagesJob struct {
+	BaseJob
+	notifier MessageDeletionNotifier
+}
+
+// NewExpireMessagesJob creates a new ExpireMessagesJob that reports deletions to notifier
+func NewExpireMessagesJob(baseJob BaseJob, notifier MessageDeletionNotifier) *ExpireMessagesJob {
+	return &ExpireMessagesJob{
+		BaseJob:  baseJob,
+		notifier: notifier,
+	}
+}
+
+func (j *ExpireMessagesJob) Name() string {
+	return "expire_messages"
+}
+
+func (j *ExpireMessagesJob) Schedule() string {
+	return "* * * * *" // Every minute
+}
+
+func (j *ExpireMessagesJob) LockTimeout() time.Duration {
+	return 2 * time.Minute
+}
+
+func (j *ExpireMessagesJob) Execute(ctx context.Context) error {
+	deleted, err := j.db.DeleteExpiredMessages(ctx, expiredMessageBatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to delete expired messages: %w", err)
+	}
+	if len(deleted) == 0 {
+		return nil
+	}
+
+	messageIDs := make([]uuid.UUID, 0, len(deleted))
+	byGroup := make(map[uuid.UUID][]uuid.UUID)
+	for _, msg := range deleted {
+		messageIDs = append(messageIDs, msg.ID)
+		if msg.GroupID != nil {
+			byGroup[*msg.GroupID] = append(byGroup[*msg.GroupID], msg.ID)
+		}
+	}
+
+	// The messages are already gone, so a failure here only leaves orphaned
+	// attachments for cleanup_orphaned_attachments to pick up later.
+	if err := j.deleteMessageAttachments(ctx, j.Name(), messageIDs); err != nil {
+		log.Printf("Job %s: Warning - failed to delete attachments for expired messages: %v", j.Name(), err)
+	}
+
+	for groupID, ids := range byGroup {
+		j.notifier.NotifyMessagesDeleted(groupID, ids)
+	}
+
+	log.Printf("Job %s: Deleted %d expired messages across %d groups", j.Name(), len(deleted), len(byGroup))
+	return nil
+}
+
+// deleteMessageAttachments removes the S3 objects and attachment rows of deleted
+// messages. Callers pass at most expiredMessageBatchSize IDs. The rows of objects S3
+// fails to delete are kept; with their message gone, cleanup_orphaned_attachments
+// retries them.
+func (j *BaseJob) deleteMessageAttachments(ctx context.Context, jobName string, messageIDs []uuid.UUID) error {
+	attachments, err := j.db.GetAttachmentsForMessages(ctx, messageIDs)
+	if err != nil {
+		return fmt.Errorf("failed to get attachments: %w", err)
+	}
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	objectIds := make([]types.ObjectIdentifier, 0, len(attachments))
+	for _, attachment := range attachments {
+		objectIds = append(objectIds, types.ObjectIdentifier{Key: aws.String(attachment.S3Key)})
+	}
+
+	// Image messages carry a single attachment, so this stays within DeleteObjects' 1000 key limit
+	output, err := j.s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(j.s3Bucket),
+		Delete: &types.Delete{Objects: objectIds},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete S3 objects: %w", err)
+	}
+
+	failed := failedObjectKeys(jobName, output)
+	attachmentIDs := make([]uuid.UUID, 0, len(attachments))
+	for _, attachment := range attachments {
+		if !failed[attachment.S3Key] {
+			attachmentIDs = append(attachmentIDs, attachment.ID)
+		}
+	}
+	if len(attachmentIDs) == 0 {
+		return nil
+	}
+	if err := j.db.DeleteAttachments(ctx, attachmentIDs); err != nil {
+		return fmt.Errorf("failed to delete attachment records: %w", err)
+	}
+	return nil
+}
+
+// TrimOldMessagesJob enforces a deployment-wide retention: messages older than
+// MESSAGE_RETENTION_DAYS are deleted from every live group, along with their
+// attachments, and group members are told to drop them. Ended and soft-deleted groups
+// are left to CleanupExpiredGroupsJob.
+type TrimOldMessagesJob struct {
+	BaseJob
+	notifier  MessageDeletionNotifier
+	retention time.Duration
+}
+
+// NewTrimOldMessagesJob creates a new TrimOldMessagesJob that deletes messages older than retention and reports deletions to notifier
+func NewTrimOldMessagesJob(baseJob BaseJob, notifier MessageDeletionNotifier, retention time.Duration) *TrimOldMessagesJob {
+	return &TrimOldMessagesJob{
+		BaseJob:   baseJob,
+		notifier:  notifier,
+		retention: retention,
+	}
+}
+
+func (j *TrimOldMessagesJob) Name() string {
+	return "trim_old_messages"
+}
+
+func (j *TrimOldMessagesJob) Schedule() string {
+	return "30 * * * *" // Every hour at :30
+}
+
+func (j *TrimOldMessagesJob) LockTimeout() time.Duration {
+	return 20 * time.Minute
+}
+
+func (j *TrimOldMessagesJob) Execute(ctx context.Context) error {
+	// A fixed cutoff keeps the batches of one run consistent with each other.
+	cutoff := pgtype.Timestamp{Time: time.Now().Add(-j.retention), Valid: true}
+
+	total := 0
+	groups := make(map[uuid.UUID]struct{})
+	for range trimMessageBatchesPerRun {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		deleted, err := j.db.DeleteMessagesCreatedBefore(ctx, db.DeleteMessagesCreatedBeforeParams{
+			Cutoff:   cutoff,
+			PageSize: expiredMessageBatchSize,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete old messages: %w", err)
+		}
+		if len(deleted) == 0 {
+			break
+		}
+
+		messageIDs := make([]uuid.UUID, 0, len(deleted))
+		byGroup := make(map[uuid.UUID][]uuid.UUID)
+		for _, msg := range deleted {
+			messageIDs = append(messageIDs, msg.ID)
+			if msg.GroupID != nil {
+				byGroup[*msg.GroupID] = append(byGroup[*msg.GroupID], msg.ID)
+			}
+		}
+
+		// As in ExpireMessagesJob, leftovers are picked up by cleanup_orphaned_attachments.
+		if err := j.deleteMessageAttachments(ctx, j.Name(), messageIDs); err != nil {
+			log.Printf("Job %s: Warning - failed to delete attachments for trimmed messages: %v", j.Name(), err)
+		}
+
+		for groupID, ids := range byGroup {
+			j.notifier.NotifyMessagesDeleted(groupID, ids)
+			groups[groupID] = struct{}{}
+		}
+		total += len(deleted)
+
+		if len(deleted) < expiredMessageBatchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Printf("Job %s: Deleted %d messages older than %s across %d groups", j.Name(), total, j.retention, len(groups))
+	}
+	return nil
+}
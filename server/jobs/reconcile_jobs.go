@@ -0,0 +1,154 @@
+package jobs
+
+import (
+	"chat-app-server/rediskeys"
+	"chat-app-server/util"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReconcileMembershipJob repairs drift between Postgres user_groups and the Redis
+// user:{id}:groups / group:{id}:members sets, which the hub only updates best-effort.
+type ReconcileMembershipJob struct {
+	BaseJob
+}
+
+func (j *ReconcileMembershipJob) Name() string {
+	return "reconcile_membership"
+}
+
+func (j *ReconcileMembershipJob) Schedule() string {
+	return "*/30 * * * *" // Every 30 minutes
+}
+
+func (j *ReconcileMembershipJob) LockTimeout() time.Duration {
+	return 10 * time.Minute
+}
+
+// membershipSets maps a set owner (user or group ID) to the IDs it should contain.
+type membershipSets map[string]map[string]bool
+
+func (m membershipSets) add(owner, member string) {
+	if m[owner] == nil {
+		m[owner] = make(map[string]bool)
+	}
+	m[owner][member] = true
+}
+
+func (j *ReconcileMembershipJob) Execute(ctx context.Context) error {
+	links, err := j.db.GetAllUserGroups(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load user groups: %w", err)
+	}
+
+	userGroups := make(membershipSets)
+	groupMembers := make(membershipSets)
+	for _, link := range links {
+		if link.UserID == nil || link.GroupID == nil {
+			continue
+		}
+		userGroups.add(link.UserID.String(), link.GroupID.String())
+		groupMembers.add(link.GroupID.String(), link.UserID.String())
+	}
+
+	userFixes, err := j.reconcileSets(ctx, rediskeys.UserGroupsPrefix, ":groups", userGroups, false)
+	if err != nil {
+		return err
+	}
+	groupFixes, err := j.reconcileSets(ctx, rediskeys.GroupMembersPrefix, ":members", groupMembers, true)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Job %s: Reconciled membership for %d links, %d user set fixes, %d group set fixes",
+		j.Name(), len(links), userFixes, groupFixes)
+	return nil
+}
+
+// reconcileSets makes every prefix{owner}suffix set in Redis match expected. Sets in
+// Redis whose owner has no memberships are removed entirely. Each difference is
+// rechecked against Postgres first, since membership may have changed since the
+// snapshot was taken. ownerIsGroup says whether owners are group IDs or user IDs.
+func (j *ReconcileMembershipJob) reconcileSets(ctx context.Context, prefix, suffix string, expected membershipSets, ownerIsGroup bool) (int, error) {
+	owners := make(map[string]bool, len(expected))
+	for owner := range expected {
+		owners[owner] = true
+	}
+	iter := j.redisClient.Scan(ctx, 0, prefix+"*"+suffix, 500).Iterator()
+	for iter.Next(ctx) {
+		owner := strings.TrimSuffix(strings.TrimPrefix(iter.Val(), prefix), suffix)
+		owners[owner] = true
+	}
+	if err := iter.Err(); err != nil {
+		return 0, fmt.Errorf("failed to scan %s*%s keys: %w", prefix, suffix, err)
+	}
+
+	fixes := 0
+	for owner := range owners {
+		key := prefix + owner + suffix
+		actual, err := j.redisClient.SMembers(ctx, key).Result()
+		if err != nil {
+			log.Printf("Job %s: Failed to read %s: %v", j.Name(), key, err)
+			continue
+		}
+		want := expected[owner]
+		have := make(map[string]bool, len(actual))
+		for _, member := range actual {
+			have[member] = true
+			if want[member] {
+				continue
+			}
+			if isMember, err := j.stillMember(ctx, owner, member, ownerIsGroup); err != nil || isMember {
+				continue
+			}
+			if err := j.redisClient.SRem(ctx, key, member).Err(); err != nil {
+				log.Printf("Job %s: Failed to remove %s from %s: %v", j.Name(), member, key, err)
+				continue
+			}
+			log.Printf("Job %s: Removed stale %s from %s", j.Name(), member, key)
+			fixes++
+		}
+		for member := range want {
+			if have[member] {
+				continue
+			}
+			if isMember, err := j.stillMember(ctx, owner, member, ownerIsGroup); err != nil || !isMember {
+				continue
+			}
+			if err := j.redisClient.SAdd(ctx, key, member).Err(); err != nil {
+				log.Printf("Job %s: Failed to add %s to %s: %v", j.Name(), member, key, err)
+				continue
+			}
+			log.Printf("Job %s: Added missing %s to %s", j.Name(), member, key)
+			fixes++
+		}
+	}
+	return fixes, nil
+}
+
+// stillMember checks current membership in Postgres. Callers leave Redis untouched
+// when it returns an error. Malformed IDs are never members.
+func (j *ReconcileMembershipJob) stillMember(ctx context.Context, owner, member string, ownerIsGroup bool) (bool, error) {
+	userIDStr, groupIDStr := owner, member
+	if ownerIsGroup {
+		userIDStr, groupIDStr = member, owner
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return false, nil
+	}
+	groupID, err := uuid.Parse(groupIDStr)
+	if err != nil {
+		return false, nil
+	}
+	isMember, err := util.UserInGroup(ctx, userID, groupID, j.db)
+	if err != nil {
+		log.Printf("Job %s: Failed to verify membership of user %s in group %s: %v", j.Name(), userID, groupID, err)
+	}
+	return isMember, err
+}
@@ -3,17 +3,23 @@ package main
 import (
 	"chat-app-server/auth"
 	"chat-app-server/db"
+	"chat-app-server/email"
 	"chat-app-server/images"
 	"chat-app-server/jobs"
 	"chat-app-server/notifications"
+	"chat-app-server/ratelimit"
+	"chat-app-server/rediskeys"
 	"chat-app-server/router"
 	"chat-app-server/s3store"
 	"chat-app-server/server"
+	"chat-app-server/sms"
+	"chat-app-server/util"
 	"chat-app-server/ws"
 	"context"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/google/uuid"
@@ -35,11 +41,54 @@ func InitializeRedis(ctx context.Context) {
 	if err != nil {
 		log.Fatalf("Could not parse REDIS_URL: %v", err)
 	}
+	applyRedisPoolConfig(opts)
 	RedisClient = redis.NewClient(opts)
-	if err := RedisClient.Ping(ctx).Err(); err != nil {
-		log.Fatalf("Could not connect to Redis: %v", err)
+
+	// Redis may still be starting (or briefly down) when we boot. Retry for a while, then
+	// carry on degraded: the hub re-seeds Redis and the Pub/Sub listener reconnects once
+	// it is reachable again.
+	startupTimeout := time.Duration(util.GetEnvInt("REDIS_STARTUP_TIMEOUT_SECONDS", 60)) * time.Second
+	deadline := time.Now().Add(startupTimeout)
+	backoff := 500 * time.Millisecond
+	for {
+		err := RedisClient.Ping(ctx).Err()
+		if err == nil {
+			log.Println("Successfully connected to Redis.")
+			return
+		}
+		if time.Now().After(deadline) {
+			log.Printf("Could not connect to Redis within %s, starting in degraded mode: %v", startupTimeout, err)
+			return
+		}
+		log.Printf("Redis not reachable yet, retrying in %s: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, 10*time.Second)
+	}
+}
+
+// applyRedisPoolConfig overrides go-redis pool defaults with any REDIS_* tuning variables that are set.
+func applyRedisPoolConfig(opts *redis.Options) {
+	if v := util.GetEnvInt("REDIS_POOL_SIZE", 0); v > 0 {
+		opts.PoolSize = v
+	}
+	if v := util.GetEnvInt("REDIS_MIN_IDLE_CONNS", 0); v > 0 {
+		opts.MinIdleConns = v
+	}
+	if v := util.GetEnvInt("REDIS_MAX_RETRIES", 0); v != 0 {
+		opts.MaxRetries = v
+	}
+	if v := util.GetEnvInt("REDIS_DIAL_TIMEOUT_MS", 0); v > 0 {
+		opts.DialTimeout = time.Duration(v) * time.Millisecond
+	}
+	if v := util.GetEnvInt("REDIS_READ_TIMEOUT_MS", 0); v > 0 {
+		opts.ReadTimeout = time.Duration(v) * time.Millisecond
+	}
+	if v := util.GetEnvInt("REDIS_WRITE_TIMEOUT_MS", 0); v > 0 {
+		opts.WriteTimeout = time.Duration(v) * time.Millisecond
+	}
+	if v := util.GetEnvInt("REDIS_POOL_TIMEOUT_MS", 0); v > 0 {
+		opts.PoolTimeout = time.Duration(v) * time.Millisecond
 	}
-	log.Println("Successfully connected to Redis.")
 }
 
 func init() {
@@ -50,9 +99,38 @@ func init() {
 func main() {
 	ctx := context.Background()
 
+	if err := auth.LoadKeys(); err != nil {
+		log.Fatalf("Could not load JWT signing keys: %v", err)
+	}
+	if err := auth.LoadPasswordCost(); err != nil {
+		log.Fatalf("Invalid password hashing configuration: %v", err)
+	}
+	if err := auth.LoadPasswordPolicy(); err != nil {
+		log.Fatalf("Invalid password policy configuration: %v", err)
+	}
+	if err := auth.LoadAdmins(); err != nil {
+		log.Fatalf("Invalid admin configuration: %v", err)
+	}
+	if err := router.LoadCORSOrigins(); err != nil {
+		log.Fatalf("Invalid CORS configuration: %v", err)
+	}
+	if err := s3store.LoadKeyPrefix(); err != nil {
+		log.Fatalf("Invalid S3 configuration: %v", err)
+	}
+	if err := util.LoadPageLimits(); err != nil {
+		log.Fatalf("Invalid pagination configuration: %v", err)
+	}
+	if err := notifications.LoadPushStyles(); err != nil {
+		log.Fatalf("Invalid notification configuration: %v", err)
+	}
+
 	InitializeRedis(ctx)
 
-	connPool, err := pgxpool.New(ctx, os.Getenv("DB_URL"))
+	dbConfig, err := util.LoadDBConfig()
+	if err != nil {
+		log.Fatalf("Invalid database configuration: %v", err)
+	}
+	connPool, err := pgxpool.NewWithConfig(ctx, dbConfig)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Unable to connect to database: %v\n", err)
 		os.Exit(1)
@@ -61,15 +139,28 @@ func main() {
 
 	authHandler := auth.NewAuthHandler(db, ctx, connPool)
 
-	// Initialize notification service
-	notificationService := notifications.NewNotificationService(db, RedisClient)
-	notificationHandler := notifications.NewNotificationHandler(db)
+	// Push goes through Expo unless disabled, e.g. for self-hosted deployments without
+	// an Expo project. notificationService stays nil then, so its jobs aren't registered.
+	var notificationService *notifications.NotificationService
+	var pushProvider notifications.PushProvider = notifications.NoopPushProvider{}
+	if util.GetEnvBool("PUSH_NOTIFICATIONS_ENABLED", true) {
+		notificationService = notifications.NewNotificationService(db, RedisClient, os.Getenv("EXPO_ACCESS_TOKEN"))
+		pushProvider = notificationService
+	} else {
+		log.Printf("Push notifications disabled (PUSH_NOTIFICATIONS_ENABLED=false).")
+	}
 
-	hub := ws.NewHub(db, ctx, connPool, RedisClient, ServerInstanceID, notificationService)
-	wsHandler := ws.NewHandler(hub, db, ctx, connPool)
+	hub := ws.NewHub(db, ctx, connPool, RedisClient, ServerInstanceID, pushProvider)
+	notificationHandler := notifications.NewNotificationHandler(db, hub)
+	groupCreationLimiter := ratelimit.New(RedisClient, rediskeys.GroupCreationRatePrefix,
+		util.GetEnvInt("GROUP_CREATION_LIMIT_PER_HOUR", 10), time.Hour)
 	go hub.Run()
 
-	api := server.NewAPI(db, ctx, connPool)
+	adminLimiter := ratelimit.New(RedisClient, rediskeys.AdminRatePrefix,
+		util.GetEnvInt("ADMIN_REQUESTS_PER_MINUTE", 60), time.Minute)
+	phoneCodeLimiter := ratelimit.New(RedisClient, rediskeys.PhoneCodeRatePrefix,
+		util.GetEnvInt("PHONE_CODES_PER_DAY", 5), 24*time.Hour)
+	api := server.NewAPI(db, ctx, connPool, sms.New(os.Getenv("SMS_WEBHOOK_URL")), email.New(os.Getenv("EMAIL_WEBHOOK_URL")), groupCreationLimiter, adminLimiter, phoneCodeLimiter)
 
 	cfg, err := config.LoadDefaultConfig(context.Background())
 	if err != nil {
@@ -81,11 +172,14 @@ func main() {
 	// Initialize and start job scheduler (after S3 store creation)
 	jobDeps := &jobs.JobDependencies{
 		NotificationService: notificationService,
+		MessageNotifier:     hub,
+		AccountPurger:       hub,
 	}
 	scheduler := jobs.NewScheduler(db, ctx, connPool, RedisClient, store.GetS3Client(), store.GetBucket(), ServerInstanceID, jobDeps)
 	go scheduler.Start()
 
-	imageHandler := images.NewImageHandler(store, db, ctx, connPool)
+	imageHandler := images.NewImageHandler(store, db, ctx, connPool, hub)
+	wsHandler := ws.NewHandler(hub, db, ctx, connPool, groupCreationLimiter, imageHandler)
 
 	defer connPool.Close()
 	defer scheduler.Stop()
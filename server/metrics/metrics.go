@@ -0,0 +1,52 @@
+// Package metrics holds process-wide counters exported through expvar at /api/admin/metrics.
+package metrics
+
+import "expvar"
+
+var (
+	// ActiveConnections is the number of WebSocket clients registered with this instance's hub.
+	ActiveConnections = expvar.NewInt("ws_active_connections")
+	// MaxConnections is the configured per-instance connection cap (0 means unlimited).
+	MaxConnections = expvar.NewInt("ws_max_connections")
+	// RejectedConnections counts connections refused because the instance was at capacity
+	// or the user had reached the per-user connection limit.
+	RejectedConnections = expvar.NewInt("ws_rejected_connections")
+	// ResumedConnections counts reconnects that took over a suspended session within the grace period.
+	ResumedConnections = expvar.NewInt("ws_resumed_connections")
+	// StaleConnections is the number of connections the last heartbeat sweep found past pongWait.
+	StaleConnections = expvar.NewInt("ws_stale_connections")
+	// ReapedConnections counts connections closed by the heartbeat sweep for missing pongs.
+	ReapedConnections = expvar.NewInt("ws_reaped_connections")
+	// DroppedOutbound counts payloads dropped because a client's send buffer was full.
+	DroppedOutbound = expvar.NewInt("ws_dropped_outbound")
+	// DroppedOutboundByUser and DroppedOutboundByGroup show the users and groups with the
+	// most drops in the last minute (payloads not about a group are only counted per
+	// user), so slow clients and overloaded groups stand out without keeping every ID.
+	DroppedOutboundByUser  = NewTopCounts("ws_dropped_outbound_by_user")
+	DroppedOutboundByGroup = NewTopCounts("ws_dropped_outbound_by_group")
+	// BroadcastQueueFull counts incoming chat messages refused with server_busy because
+	// their group's broadcast shard was full; BroadcastQueueFullByGroup shows the groups
+	// with the most refusals in the last minute.
+	BroadcastQueueFull        = expvar.NewInt("ws_broadcast_queue_full")
+	BroadcastQueueFullByGroup = NewTopCounts("ws_broadcast_queue_full_by_group")
+)
+
+var (
+	// ExpoBreakerState is the state of the Expo push circuit breaker: closed, open or half_open.
+	ExpoBreakerState = expvar.NewString("expo_breaker_state")
+	// ExpoBreakerTrips counts how many times the Expo circuit breaker has opened.
+	ExpoBreakerTrips = expvar.NewInt("expo_breaker_trips")
+	// ExpoDeferredNotifications counts push messages stored in pending_notifications for retry.
+	ExpoDeferredNotifications = expvar.NewInt("expo_deferred_notifications")
+	// ExpoAbandonedNotifications counts push messages dropped after exhausting their retries.
+	ExpoAbandonedNotifications = expvar.NewInt("expo_abandoned_notifications")
+	// NotificationQueueDepth is the number of messages waiting for a push notification worker.
+	NotificationQueueDepth = expvar.NewInt("notification_queue_depth")
+	// NotificationsDropped counts message notifications dropped because the worker queue was full.
+	NotificationsDropped = expvar.NewInt("notifications_dropped")
+)
+
+var (
+	// RecoveredPanics counts panics caught in HTTP handlers and long-lived hub goroutines.
+	RecoveredPanics = expvar.NewInt("recovered_panics")
+)
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"sort"
+	"sync"
+	"time"
+)
+
+// topInterval is how long a TopCounts window lasts, and topLimit how many keys of the
+// last full window it publishes.
+const (
+	topInterval = time.Minute
+	topLimit    = 20
+)
+
+// topTrackedKeys caps the keys a TopCounts window counts. A new key past the cap
+// replaces the key with the lowest count and inherits that count, so a key that turns
+// busy late in a window still surfaces; counts near the cut are approximate.
+const topTrackedKeys = 10 * topLimit
+
+// TopCounts counts events by key, such as a user or group ID, and publishes only the
+// topLimit busiest keys of the last full topInterval. The breakdown resets every
+// window, so the IDs it holds stay bounded however many clients or groups ever appear.
+type TopCounts struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	started  time.Time
+	current  map[string]int64
+	previous map[string]int64
+}
+
+// NewTopCounts creates a TopCounts and publishes it through expvar under name.
+func NewTopCounts(name string) *TopCounts {
+	t := newTopCounts(time.Now)
+	expvar.Publish(name, t)
+	return t
+}
+
+func newTopCounts(now func() time.Time) *TopCounts {
+	return &TopCounts{
+		now:     now,
+		started: now(),
+		current: make(map[string]int64),
+	}
+}
+
+// Add counts delta events for key in the current window.
+func (t *TopCounts) Add(key string, delta int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rotate()
+	if _, ok := t.current[key]; !ok && len(t.current) >= topTrackedKeys {
+		lowest, lowestCount := "", int64(0)
+		for tracked, count := range t.current {
+			if lowest == "" || count < lowestCount {
+				lowest, lowestCount = tracked, count
+			}
+		}
+		delete(t.current, lowest)
+		t.current[key] = lowestCount
+	}
+	t.current[key] += delta
+}
+
+// String returns the last full window's busiest keys as a JSON object, as expvar.Var
+// requires.
+func (t *TopCounts) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rotate()
+	if t.previous == nil {
+		return "{}"
+	}
+	out, err := json.Marshal(t.previous)
+	if err != nil {
+		return "{}"
+	}
+	return string(out)
+}
+
+// rotate closes the current window once topInterval has passed, keeping its topLimit
+// keys. A window followed by an idle one is forgotten. t.mu must be held.
+func (t *TopCounts) rotate() {
+	elapsed := t.now().Sub(t.started)
+	if elapsed < topInterval {
+		return
+	}
+	if elapsed < 2*topInterval {
+		t.previous = topKeys(t.current, topLimit)
+	} else {
+		t.previous = nil
+	}
+	t.started = t.started.Add(elapsed.Truncate(topInterval))
+	t.current = make(map[string]int64)
+}
+
+// topKeys returns the limit keys of counts with the highest counts.
+func topKeys(counts map[string]int64, limit int) map[string]int64 {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+	top := make(map[string]int64, len(keys))
+	for _, key := range keys {
+		top[key] = counts[key]
+	}
+	return top
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTopCountsPublishesLastWindowsBusiestKeys(t *testing.T) {
+	clock := time.Date(2026, 1, 2, 3, 4, 0, 0, time.UTC)
+	counts := newTopCounts(func() time.Time { return clock })
+
+	for i := range topTrackedKeys + 5 {
+		counts.Add(fmt.Sprintf("key-%03d", i), int64(i%7+1))
+	}
+	counts.Add("busy", 100)
+	if got := counts.String(); got != "{}" {
+		t.Fatalf("counts published %s before the first window closed", got)
+	}
+
+	clock = clock.Add(topInterval)
+	var published map[string]int64
+	if err := json.Unmarshal([]byte(counts.String()), &published); err != nil {
+		t.Fatalf("decode published counts: %v", err)
+	}
+	if len(published) != topLimit {
+		t.Fatalf("published %d keys, want %d", len(published), topLimit)
+	}
+	if published["busy"] < 100 {
+		t.Fatalf("key that turned busy after the cap published as %d, want at least 100", published["busy"])
+	}
+
+	clock = clock.Add(2 * topInterval)
+	if got := counts.String(); got != "{}" {
+		t.Fatalf("counts still published %s after an idle window", got)
+	}
+}
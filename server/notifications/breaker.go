@@ -0,0 +1,100 @@
+package notifications
+
+import (
+	"chat-app-server/metrics"
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker stops calls to Expo after failureThreshold consecutive failures.
+// Once cooldown has elapsed a single trial call is let through: success closes the
+// breaker, failure re-opens it for another cooldown.
+type circuitBreaker struct {
+	mu               sync.Mutex
+	state            breakerState
+	failures         int
+	openedAt         time.Time
+	trialInFlight    bool
+	failureThreshold int
+	cooldown         time.Duration
+}
+
+func newCircuitBreaker(failureThreshold int, cooldown time.Duration) *circuitBreaker {
+	metrics.ExpoBreakerState.Set(breakerClosed.String())
+	return &circuitBreaker{failureThreshold: failureThreshold, cooldown: cooldown}
+}
+
+// Allow reports whether a call may be made now. Every allowed call must be followed
+// by Success or Failure.
+func (b *circuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(breakerHalfOpen)
+		b.trialInFlight = true
+		return true
+	case breakerHalfOpen:
+		if b.trialInFlight {
+			return false
+		}
+		b.trialInFlight = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.trialInFlight = false
+	b.setState(breakerClosed)
+}
+
+func (b *circuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trialInFlight = false
+	if b.state == breakerHalfOpen || b.failures >= b.failureThreshold {
+		if b.state != breakerOpen {
+			metrics.ExpoBreakerTrips.Add(1)
+		}
+		b.openedAt = time.Now()
+		b.setState(breakerOpen)
+	}
+}
+
+// setState must be called with b.mu held.
+func (b *circuitBreaker) setState(state breakerState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	metrics.ExpoBreakerState.Set(state.String())
+}
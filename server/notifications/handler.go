@@ -3,21 +3,31 @@ package notifications
 import (
 	"chat-app-server/db"
 	"chat-app-server/util"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+// DeviceDisconnector closes live connections for a single device
+type DeviceDisconnector interface {
+	DisconnectDevice(userID uuid.UUID, deviceIdentifier string)
+}
+
 // NotificationHandler handles push notification related HTTP requests
 type NotificationHandler struct {
-	db *db.Queries
+	db           *db.Queries
+	disconnector DeviceDisconnector
 }
 
 // NewNotificationHandler creates a new notification handler
-func NewNotificationHandler(dbQueries *db.Queries) *NotificationHandler {
+func NewNotificationHandler(dbQueries *db.Queries, disconnector DeviceDisconnector) *NotificationHandler {
 	return &NotificationHandler{
-		db: dbQueries,
+		db:           dbQueries,
+		disconnector: disconnector,
 	}
 }
 
@@ -26,8 +36,14 @@ type registerTokenRequest struct {
 	ExpoPushToken    string `json:"expoPushToken" binding:"required"`
 }
 
+type snoozeRequest struct {
+	// Until is when pushes resume; null or a past time ends the snooze.
+	Until *time.Time `json:"until"`
+}
+
 type clearTokenRequest struct {
 	DeviceIdentifier string `json:"deviceIdentifier" binding:"required"`
+	Logout           bool   `json:"logout"`
 }
 
 // RegisterPushToken registers or updates a push token for a device
@@ -68,7 +84,8 @@ func (h *NotificationHandler) RegisterPushToken(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Push token registered successfully"})
 }
 
-// ClearPushToken removes the push token for a device (used on logout)
+// ClearPushToken removes the push token for a device. On logout it also removes
+// the device key and closes the device's WebSocket connection.
 func (h *NotificationHandler) ClearPushToken(c *gin.Context) {
 	// Get user from JWT (set by JWTAuthMiddleware)
 	user, err := util.GetUser(c, h.db)
@@ -85,6 +102,24 @@ func (h *NotificationHandler) ClearPushToken(c *gin.Context) {
 
 	ctx := c.Request.Context()
 
+	if req.Logout {
+		// Deleting the device key also drops its push token, and stops other
+		// devices from sealing envelopes for a key that is about to be discarded.
+		err = h.db.DeleteDeviceKey(ctx, db.DeleteDeviceKeyParams{
+			UserID:           user.ID,
+			DeviceIdentifier: req.DeviceIdentifier,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear push token"})
+			return
+		}
+		if h.disconnector != nil {
+			h.disconnector.DisconnectDevice(user.ID, req.DeviceIdentifier)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Push token cleared successfully"})
+		return
+	}
+
 	// Clear the device's push token
 	err = h.db.ClearDevicePushToken(ctx, db.ClearDevicePushTokenParams{
 		UserID:           user.ID,
@@ -98,3 +133,51 @@ func (h *NotificationHandler) ClearPushToken(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Push token cleared successfully"})
 }
+
+// maxSnooze caps how far ahead a snooze may run.
+const maxSnooze = 30 * 24 * time.Hour
+
+// SnoozeActive reports whether a user's snooze_until is still in the future. An expired
+// snooze needs no cleanup: it simply stops suppressing pushes.
+func SnoozeActive(until pgtype.Timestamp) bool {
+	return until.Valid && until.Time.After(time.Now())
+}
+
+// Snooze silences all of the caller's message pushes, mentions included, until the
+// given time, or ends the snooze early.
+func (h *NotificationHandler) Snooze(c *gin.Context) {
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	var req snoozeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	snoozeUntil := pgtype.Timestamp{}
+	if req.Until != nil && req.Until.After(time.Now()) {
+		if req.Until.After(time.Now().Add(maxSnooze)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Snooze can last at most 30 days"})
+			return
+		}
+		snoozeUntil = pgtype.Timestamp{Time: req.Until.UTC(), Valid: true}
+	}
+
+	if err := h.db.SetSnoozeUntil(c.Request.Context(), db.SetSnoozeUntilParams{
+		ID:          user.ID,
+		SnoozeUntil: snoozeUntil,
+	}); err != nil {
+		log.Printf("Error saving snooze for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update snooze"})
+		return
+	}
+	if snoozeUntil.Valid {
+		c.JSON(http.StatusOK, gin.H{"snooze_until": snoozeUntil.Time})
+	} else {
+		c.JSON(http.StatusOK, gin.H{"snooze_until": nil})
+	}
+}
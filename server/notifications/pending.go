@@ -0,0 +1,178 @@
+package notifications
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/metrics"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	expo "github.com/oliveroneill/exponent-server-sdk-golang/sdk"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// A deferred notification is attempted at most this many times in total.
+	maxPushAttempts = 6
+	// Retry delay after the first failed attempt; doubles with each further failure.
+	pushRetryBaseDelay = time.Minute
+	pushRetryMaxDelay  = time.Hour
+	// Rows picked up per retry run.
+	pendingRetryBatchSize = 500
+)
+
+// outgoingPush is a single-recipient push message plus what is needed to persist it
+// if Expo cannot take it. A deferred push is stored against deviceIdentifier, not the
+// token, so a retry goes to whatever token the device holds then. pendingID is set
+// when the push was loaded from pending_notifications.
+type outgoingPush struct {
+	message          expo.PushMessage
+	userID           uuid.UUID
+	deviceIdentifier string
+	pendingID        uuid.UUID
+	attempts         int32
+}
+
+// RetryPendingNotifications resends deferred notifications whose backoff has elapsed to
+// each device's current token. Pushes whose device no longer has a valid token are
+// dropped; pushes that fail again are rescheduled, or dropped once they reach
+// maxPushAttempts.
+func (s *NotificationService) RetryPendingNotifications(ctx context.Context) error {
+	rows, err := s.db.GetDuePendingNotifications(ctx, pendingRetryBatchSize)
+	if err != nil {
+		return fmt.Errorf("error getting pending notifications: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	var pushes []outgoingPush
+	var invalid []uuid.UUID
+	for _, row := range rows {
+		if !row.ExpoPushToken.Valid || !ValidateToken(row.ExpoPushToken.String) {
+			invalid = append(invalid, row.ID)
+			continue
+		}
+		pushToken, err := expo.NewExponentPushToken(row.ExpoPushToken.String)
+		if err != nil {
+			invalid = append(invalid, row.ID)
+			continue
+		}
+		var data map[string]string
+		if err := json.Unmarshal(row.Data, &data); err != nil {
+			log.Printf("NotificationService: Error decoding pending notification %s data: %v", row.ID, err)
+		}
+		pushes = append(pushes, outgoingPush{
+			userID:           row.UserID,
+			deviceIdentifier: row.DeviceIdentifier,
+			pendingID:        row.ID,
+			attempts:         row.Attempts,
+			message: expo.PushMessage{
+				To:        []expo.ExponentPushToken{pushToken},
+				Title:     row.Title,
+				Body:      row.Body,
+				Sound:     row.Sound,
+				ChannelID: row.ChannelID,
+				Priority:  row.Priority,
+				Data:      data,
+			},
+		})
+	}
+	if len(invalid) > 0 {
+		if err := s.db.DeletePendingNotifications(ctx, invalid); err != nil {
+			log.Printf("NotificationService: Error deleting pending notifications without a token: %v", err)
+		}
+	}
+
+	sent := s.publish(ctx, pushes)
+	log.Printf("NotificationService: Retried %d pending notifications, %d sent", len(pushes), sent)
+	return nil
+}
+
+// deferPushes records pushes Expo did not accept so the retry job can resend them.
+func (s *NotificationService) deferPushes(ctx context.Context, pushes []outgoingPush) {
+	var abandoned []uuid.UUID
+	for _, push := range pushes {
+		attempts := push.attempts + 1
+		if attempts >= maxPushAttempts {
+			if push.pendingID != uuid.Nil {
+				abandoned = append(abandoned, push.pendingID)
+			}
+			metrics.ExpoAbandonedNotifications.Add(1)
+			continue
+		}
+		nextAttempt := pgtype.Timestamp{Time: time.Now().Add(pushRetryDelay(attempts)), Valid: true}
+
+		if push.pendingID != uuid.Nil {
+			if err := s.db.ReschedulePendingNotification(ctx, db.ReschedulePendingNotificationParams{
+				ID:            push.pendingID,
+				NextAttemptAt: nextAttempt,
+			}); err != nil {
+				log.Printf("NotificationService: Error rescheduling pending notification %s: %v", push.pendingID, err)
+			}
+			continue
+		}
+
+		data, err := json.Marshal(push.message.Data)
+		if err != nil {
+			log.Printf("NotificationService: Error encoding notification data for user %s: %v", push.userID, err)
+			continue
+		}
+		var groupID *uuid.UUID
+		if id, err := uuid.Parse(push.message.Data["groupId"]); err == nil {
+			groupID = &id
+		}
+		if err := s.db.InsertPendingNotification(ctx, db.InsertPendingNotificationParams{
+			UserID:           push.userID,
+			GroupID:          groupID,
+			DeviceIdentifier: push.deviceIdentifier,
+			Title:            push.message.Title,
+			Body:             push.message.Body,
+			Data:             data,
+			Attempts:         attempts,
+			NextAttemptAt:    nextAttempt,
+			Sound:            push.message.Sound,
+			ChannelID:        push.message.ChannelID,
+			Priority:         push.message.Priority,
+		}); err != nil {
+			log.Printf("NotificationService: Error storing pending notification for user %s: %v", push.userID, err)
+			continue
+		}
+		metrics.ExpoDeferredNotifications.Add(1)
+	}
+
+	if len(abandoned) > 0 {
+		if err := s.db.DeletePendingNotifications(ctx, abandoned); err != nil {
+			log.Printf("NotificationService: Error deleting abandoned pending notifications: %v", err)
+		}
+		log.Printf("NotificationService: Gave up on %d notifications after %d attempts", len(abandoned), maxPushAttempts)
+	}
+}
+
+// clearPending removes pushes that were loaded from pending_notifications once Expo accepts them.
+func (s *NotificationService) clearPending(ctx context.Context, pushes []outgoingPush) {
+	var ids []uuid.UUID
+	for _, push := range pushes {
+		if push.pendingID != uuid.Nil {
+			ids = append(ids, push.pendingID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	if err := s.db.DeletePendingNotifications(ctx, ids); err != nil {
+		log.Printf("NotificationService: Error deleting delivered pending notifications: %v", err)
+	}
+}
+
+func pushRetryDelay(attempts int32) time.Duration {
+	delay := pushRetryBaseDelay << (attempts - 1)
+	if delay <= 0 || delay > pushRetryMaxDelay {
+		return pushRetryMaxDelay
+	}
+	return delay
+}
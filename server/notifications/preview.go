@@ -0,0 +1,65 @@
+package notifications
+
+import "fmt"
+
+// PreviewMode controls how much a message push reveals. Modes are ordered from least
+// to most private; when a group and a user both set one, the more private applies.
+type PreviewMode string
+
+const (
+	// PreviewFull shows the group name and "<sender>: sent a message".
+	PreviewFull PreviewMode = "full"
+	// PreviewNameOnly shows the group name but not the sender.
+	PreviewNameOnly PreviewMode = "name_only"
+	// PreviewGeneric shows neither the group nor the sender.
+	PreviewGeneric PreviewMode = "generic"
+)
+
+func (m PreviewMode) rank() int {
+	switch m {
+	case PreviewNameOnly:
+		return 1
+	case PreviewGeneric:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// Valid reports whether m is a known mode.
+func (m PreviewMode) Valid() bool {
+	return m == PreviewFull || m == PreviewNameOnly || m == PreviewGeneric
+}
+
+// MostPrivate returns whichever of a and b reveals less. Unknown or empty modes count
+// as PreviewFull.
+func MostPrivate(a, b PreviewMode) PreviewMode {
+	if b.rank() > a.rank() {
+		return b
+	}
+	if !a.Valid() {
+		return PreviewFull
+	}
+	return a
+}
+
+// messageContent returns the push title and body for a message under mode.
+func messageContent(mode PreviewMode, groupName, senderName, messagePreview string, mentioned bool) (string, string) {
+	switch mode {
+	case PreviewGeneric:
+		if mentioned {
+			return "New message", "You were mentioned in a group"
+		}
+		return "New message", "You have a new message"
+	case PreviewNameOnly:
+		if mentioned {
+			return groupName, fmt.Sprintf("You were mentioned in %s", groupName)
+		}
+		return groupName, "New message"
+	default:
+		if mentioned {
+			return groupName, fmt.Sprintf("You were mentioned in %s", groupName)
+		}
+		return groupName, fmt.Sprintf("%s: %s", senderName, messagePreview)
+	}
+}
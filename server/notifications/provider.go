@@ -0,0 +1,71 @@
+package notifications
+
+import (
+	"chat-app-server/db"
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// PushProvider sends push notifications. NotificationService delivers them through
+// Expo; deployments without push use NoopPushProvider, so callers never need to
+// check whether push is configured.
+type PushProvider interface {
+	SendMessageNotification(
+		ctx context.Context,
+		groupID uuid.UUID,
+		groupName string,
+		senderID uuid.UUID,
+		senderName string,
+		messageType db.MessageType,
+		messagePreview string,
+		mentionedUserIDs []uuid.UUID,
+		groupMode PreviewMode,
+		style PushStyle,
+	)
+	SendReactionNotification(
+		ctx context.Context,
+		groupID uuid.UUID,
+		groupName string,
+		reactorID uuid.UUID,
+		reactorName string,
+		authorID uuid.UUID,
+		groupMode PreviewMode,
+		style PushStyle,
+	)
+	SendUserNotification(
+		ctx context.Context,
+		userIDs []uuid.UUID,
+		title string,
+		body string,
+		data map[string]string,
+	)
+}
+
+var (
+	_ PushProvider = (*NotificationService)(nil)
+	_ PushProvider = NoopPushProvider{}
+)
+
+// NoopPushProvider drops every notification. It stands in for NotificationService
+// when PUSH_NOTIFICATIONS_ENABLED is false.
+type NoopPushProvider struct{}
+
+func (NoopPushProvider) SendMessageNotification(context.Context, uuid.UUID, string, uuid.UUID, string, db.MessageType, string, []uuid.UUID, PreviewMode, PushStyle) {
+}
+
+func (NoopPushProvider) SendReactionNotification(context.Context, uuid.UUID, string, uuid.UUID, string, uuid.UUID, PreviewMode, PushStyle) {
+}
+
+func (NoopPushProvider) SendUserNotification(context.Context, []uuid.UUID, string, string, map[string]string) {
+}
+
+// Enabled reports whether provider actually delivers pushes, so callers can skip the
+// work of preparing notifications that NoopPushProvider would drop.
+func Enabled(provider PushProvider) bool {
+	if provider == nil {
+		return false
+	}
+	_, noop := provider.(NoopPushProvider)
+	return !noop
+}
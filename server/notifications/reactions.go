@@ -0,0 +1,99 @@
+package notifications
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/rediskeys"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	expo "github.com/oliveroneill/exponent-server-sdk-golang/sdk"
+
+	"github.com/google/uuid"
+)
+
+// reactionCollapseWindow is how long after a reaction push further reactions in the
+// same group stay silent for that author, so a flurry of reactions sends one push.
+const reactionCollapseWindow = time.Minute
+
+// SendReactionNotification tells the author of a message that reactorName reacted to
+// it. It is only sent if the author is offline, opted into reaction pushes, has not
+// muted the group and is not snoozed; reaction content is E2EE, so the push never
+// names the emoji. style is the group's sound, channel and priority override; reactions
+// are low value, so they otherwise go out at normal priority.
+func (s *NotificationService) SendReactionNotification(
+	ctx context.Context,
+	groupID uuid.UUID,
+	groupName string,
+	reactorID uuid.UUID,
+	reactorName string,
+	authorID uuid.UUID,
+	groupMode PreviewMode,
+	style PushStyle,
+) {
+	if authorID == reactorID {
+		return
+	}
+
+	online, err := s.redisClient.Exists(ctx, redisClientServerPrefix+authorID.String()+":server_id").Result()
+	if err != nil {
+		log.Printf("NotificationService: Error checking online status for user %s: %v", authorID, err)
+		return
+	}
+	if online > 0 {
+		return
+	}
+
+	prefs, err := s.db.GetNotificationPrefs(ctx, []uuid.UUID{authorID})
+	if err != nil || len(prefs) == 0 {
+		log.Printf("NotificationService: Error getting notification preferences for user %s: %v", authorID, err)
+		return
+	}
+	pref := prefs[0]
+	if !pref.ReactionPush || SnoozeActive(pref.SnoozeUntil) {
+		return
+	}
+
+	membership, err := s.db.GetUserGroupByGroupIDAndUserID(ctx, db.GetUserGroupByGroupIDAndUserIDParams{
+		UserID:  &authorID,
+		GroupID: &groupID,
+	})
+	if err != nil {
+		log.Printf("NotificationService: Error checking membership of user %s in group %s: %v", authorID, groupID, err)
+		return
+	}
+	if membership.Muted {
+		return
+	}
+
+	collapseKey := rediskeys.ReactionPushPrefix + authorID.String() + ":" + groupID.String()
+	first, err := s.redisClient.SetNX(ctx, collapseKey, 1, reactionCollapseWindow).Result()
+	if err != nil {
+		log.Printf("NotificationService: Error checking reaction push window for user %s: %v", authorID, err)
+		return
+	}
+	if !first {
+		return
+	}
+
+	data := map[string]string{"groupId": groupID.String(), "reaction": "true"}
+	if pref.SilentPush {
+		s.sendSilent(ctx, []uuid.UUID{authorID}, data)
+		return
+	}
+	title, body := reactionContent(MostPrivate(groupMode, PreviewMode(pref.NotificationPreviewMode)), groupName, reactorName)
+	s.notifyGroupMembers(ctx, []uuid.UUID{authorID}, title, body, data, style.withAutoPriority(expo.NormalPriority))
+}
+
+// reactionContent returns the push title and body for a reaction under mode.
+func reactionContent(mode PreviewMode, groupName, reactorName string) (string, string) {
+	switch mode {
+	case PreviewGeneric:
+		return "New reaction", "Someone reacted to your message"
+	case PreviewNameOnly:
+		return groupName, "Someone reacted to your message"
+	default:
+		return groupName, fmt.Sprintf("%s reacted to your message", reactorName)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"chat-app-server/db"
 	"chat-app-server/rediskeys"
+	"chat-app-server/util"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -28,6 +29,14 @@ const (
 
 	// Expo receipts API endpoint
 	expoReceiptsURL = "https://exp.host/--/api/v2/push/getReceipts"
+
+	// Circuit breaker: open after this many consecutive Expo failures and stay open for
+	// the cooldown before letting a trial request through.
+	breakerFailureThreshold = 5
+	breakerCooldown         = 60 * time.Second
+
+	// iOS throttles background pushes, so silent pushes are limited per user.
+	defaultSilentPushInterval = 5 * time.Minute
 )
 
 // tokenPattern validates Expo push token format
@@ -39,15 +48,31 @@ type NotificationService struct {
 	db          *db.Queries
 	redisClient *redis.Client
 	httpClient  *http.Client
+	breaker     *circuitBreaker
+	accessToken string
+
+	silentPushInterval time.Duration
 }
 
-// NewNotificationService creates a new notification service
-func NewNotificationService(dbQueries *db.Queries, redisClient *redis.Client) *NotificationService {
+// NewNotificationService creates a new notification service. accessToken is the Expo
+// access token sent with push and receipt requests; when empty, requests are sent
+// unauthenticated.
+func NewNotificationService(dbQueries *db.Queries, redisClient *redis.Client, accessToken string) *NotificationService {
+	if accessToken == "" {
+		log.Printf("NotificationService: EXPO_ACCESS_TOKEN not set, sending push requests unauthenticated")
+	}
 	return &NotificationService{
-		client:      expo.NewPushClient(nil),
+		client: expo.NewPushClient(&expo.ClientConfig{
+			HTTPClient:  &http.Client{Timeout: 10 * time.Second},
+			AccessToken: accessToken,
+		}),
 		db:          dbQueries,
 		redisClient: redisClient,
 		httpClient:  &http.Client{Timeout: 30 * time.Second},
+		breaker:     newCircuitBreaker(breakerFailureThreshold, breakerCooldown),
+		accessToken: accessToken,
+		silentPushInterval: time.Duration(util.GetEnvIntAtLeast("SILENT_PUSH_MIN_INTERVAL_SECONDS",
+			int(defaultSilentPushInterval/time.Second), 1)) * time.Second,
 	}
 }
 
@@ -56,14 +81,23 @@ func ValidateToken(token string) bool {
 	return tokenPattern.MatchString(token)
 }
 
-// SendMessageNotification sends push notifications to offline group members
+// SendMessageNotification sends push notifications to offline group members.
+// Mentioned members get a mention notification instead, even if they muted the group.
+// groupMode is the group's preview policy; each recipient's own preference may make
+// their notification more private but not less. style is the group's sound, channel
+// and priority override; without an override the priority follows messageType and
+// whether the recipient was mentioned (see autoPriority).
 func (s *NotificationService) SendMessageNotification(
 	ctx context.Context,
 	groupID uuid.UUID,
 	groupName string,
 	senderID uuid.UUID,
 	senderName string,
+	messageType db.MessageType,
 	messagePreview string,
+	mentionedUserIDs []uuid.UUID,
+	groupMode PreviewMode,
+	style PushStyle,
 ) {
 	// Get group members from Redis
 	groupMembersKey := redisGroupMembersPrefix + groupID.String() + ":members"
@@ -109,50 +143,168 @@ func (s *NotificationService) SendMessageNotification(
 		return
 	}
 
+	// Mentioned users are notified separately and bypass mute
+	mentioned := make(map[uuid.UUID]bool, len(mentionedUserIDs))
+	for _, id := range mentionedUserIDs {
+		mentioned[id] = true
+	}
+	var mentionedOffline, regularOffline []uuid.UUID
+	for _, uid := range offlineUserIDs {
+		if mentioned[uid] {
+			mentionedOffline = append(mentionedOffline, uid)
+		} else {
+			regularOffline = append(regularOffline, uid)
+		}
+	}
+
 	// Filter out users who have muted this group
-	mutedUserIDs, err := s.db.GetMutedUserIDsForGroup(ctx, &groupID)
-	if err != nil {
-		log.Printf("NotificationService: Error getting muted users for group %s: %v", groupID.String(), err)
-		// Continue without filtering — better to over-notify than silently fail
-	} else if len(mutedUserIDs) > 0 {
-		mutedSet := make(map[uuid.UUID]bool, len(mutedUserIDs))
-		for _, id := range mutedUserIDs {
-			if id != nil {
-				mutedSet[*id] = true
+	if len(regularOffline) > 0 {
+		mutedUserIDs, err := s.db.GetMutedUserIDsForGroup(ctx, &groupID)
+		if err != nil {
+			log.Printf("NotificationService: Error getting muted users for group %s: %v", groupID.String(), err)
+			// Continue without filtering — better to over-notify than silently fail
+		} else if len(mutedUserIDs) > 0 {
+			mutedSet := make(map[uuid.UUID]bool, len(mutedUserIDs))
+			for _, id := range mutedUserIDs {
+				if id != nil {
+					mutedSet[*id] = true
+				}
 			}
-		}
-		filtered := offlineUserIDs[:0]
-		for _, uid := range offlineUserIDs {
-			if !mutedSet[uid] {
-				filtered = append(filtered, uid)
+			filtered := regularOffline[:0]
+			for _, uid := range regularOffline {
+				if !mutedSet[uid] {
+					filtered = append(filtered, uid)
+				}
 			}
+			regularOffline = filtered
 		}
-		offlineUserIDs = filtered
 	}
 
-	if len(offlineUserIDs) == 0 {
+	if len(regularOffline) == 0 && len(mentionedOffline) == 0 {
 		log.Printf("NotificationService: All offline users have muted group %s", groupID.String())
 		return
 	}
 
-	// Get push tokens for offline users
-	tokens, err := s.db.GetPushTokensForUsers(ctx, offlineUserIDs)
+	sent := 0
+	if len(mentionedOffline) > 0 {
+		mentionStyle := style.withAutoPriority(autoPriority(messageType, true))
+		sent += s.notifyWithPreferences(ctx, mentionedOffline, groupMode, mentionStyle, groupName, senderName, messagePreview, true,
+			map[string]string{"groupId": groupID.String(), "mention": "true"})
+	}
+	if len(regularOffline) > 0 {
+		regularStyle := style.withAutoPriority(autoPriority(messageType, false))
+		sent += s.notifyWithPreferences(ctx, regularOffline, groupMode, regularStyle, groupName, senderName, messagePreview, false,
+			map[string]string{"groupId": groupID.String()})
+	}
+	log.Printf("NotificationService: Sent %d notifications for group %s (%d mentioned)", sent, groupID.String(), len(mentionedOffline))
+}
+
+// notifyWithPreferences sends a message notification to userIDs, building each user's
+// title and body from the more private of groupMode and their own preference. Users who
+// opted into silent pushes get a data-only push instead, and snoozed users get nothing.
+// If the preferences can't be loaded everyone gets the generic text.
+func (s *NotificationService) notifyWithPreferences(
+	ctx context.Context,
+	userIDs []uuid.UUID,
+	groupMode PreviewMode,
+	style PushStyle,
+	groupName string,
+	senderName string,
+	messagePreview string,
+	mentioned bool,
+	data map[string]string,
+) int {
+	byMode := make(map[PreviewMode][]uuid.UUID)
+	var silent []uuid.UUID
+	prefs, err := s.db.GetNotificationPrefs(ctx, userIDs)
+	if err != nil {
+		log.Printf("NotificationService: Error getting notification preferences: %v", err)
+		byMode[PreviewGeneric] = userIDs
+	} else {
+		for _, pref := range prefs {
+			if SnoozeActive(pref.SnoozeUntil) {
+				continue
+			}
+			if pref.SilentPush {
+				silent = append(silent, pref.ID)
+				continue
+			}
+			mode := MostPrivate(groupMode, PreviewMode(pref.NotificationPreviewMode))
+			byMode[mode] = append(byMode[mode], pref.ID)
+		}
+	}
+
+	sent := 0
+	if len(silent) > 0 {
+		sent += s.sendSilent(ctx, silent, data)
+	}
+	for mode, ids := range byMode {
+		title, body := messageContent(mode, groupName, senderName, messagePreview, mentioned)
+		sent += s.notifyGroupMembers(ctx, ids, title, body, data, style)
+	}
+	return sent
+}
+
+// notifyGroupMembers sends one notification to every registered device of userIDs and
+// returns the number of messages handed to Expo.
+func (s *NotificationService) notifyGroupMembers(
+	ctx context.Context,
+	userIDs []uuid.UUID,
+	title string,
+	body string,
+	data map[string]string,
+	style PushStyle,
+) int {
+	tokens, err := s.db.GetPushTokensForUsers(ctx, userIDs)
 	if err != nil {
 		log.Printf("NotificationService: Error getting push tokens: %v", err)
+		return 0
+	}
+	if len(tokens) == 0 {
+		log.Printf("NotificationService: No push tokens found for %d offline users", len(userIDs))
+		return 0
+	}
+	return s.sendToTokens(ctx, tokens, title, body, data, style)
+}
+
+// SendUserNotification sends a push notification to every registered device of the given users,
+// regardless of whether they are currently connected.
+func (s *NotificationService) SendUserNotification(
+	ctx context.Context,
+	userIDs []uuid.UUID,
+	title string,
+	body string,
+	data map[string]string,
+) {
+	if len(userIDs) == 0 {
 		return
 	}
 
+	tokens, err := s.db.GetPushTokensForUsers(ctx, userIDs)
+	if err != nil {
+		log.Printf("NotificationService: Error getting push tokens: %v", err)
+		return
+	}
 	if len(tokens) == 0 {
-		log.Printf("NotificationService: No push tokens found for offline users in group %s", groupID.String())
 		return
 	}
 
-	// Build notification messages
-	var messages []expo.PushMessage
-	tokenMap := make(map[int]string) // Index to token for receipt tracking
+	sent := s.sendToTokens(ctx, tokens, title, body, data, PushStyle{})
+	log.Printf("NotificationService: Sent %d notifications to %d users", sent, len(userIDs))
+}
 
-	title := groupName
-	body := fmt.Sprintf("%s: %s", senderName, messagePreview)
+// sendToTokens builds one push message per valid token with style's sound, channel and priority,
+// sends them in batches, stores receipts and prunes tokens Expo reports as unregistered.
+// It returns the number of messages handed to Expo.
+func (s *NotificationService) sendToTokens(
+	ctx context.Context,
+	tokens []db.GetPushTokensForUsersRow,
+	title string,
+	body string,
+	data map[string]string,
+	style PushStyle,
+) int {
+	var pushes []outgoingPush
 
 	for _, tokenRow := range tokens {
 		if !tokenRow.ExpoPushToken.Valid {
@@ -172,43 +324,63 @@ func (s *NotificationService) SendMessageNotification(
 			continue
 		}
 
-		tokenMap[len(messages)] = token
-		messages = append(messages, expo.PushMessage{
-			To:       []expo.ExponentPushToken{pushToken},
-			Title:    title,
-			Body:     body,
-			Sound:    "default",
-			Priority: expo.DefaultPriority,
-			Data: map[string]string{
-				"groupId": groupID.String(),
-			},
-		})
+		message := expo.PushMessage{
+			To:    []expo.ExponentPushToken{pushToken},
+			Title: title,
+			Body:  body,
+			Data:  data,
+		}
+		style.apply(&message)
+		pushes = append(pushes, outgoingPush{userID: tokenRow.UserID, deviceIdentifier: tokenRow.DeviceIdentifier, message: message})
 	}
 
-	if len(messages) == 0 {
-		return
+	if len(pushes) == 0 {
+		return 0
 	}
 
-	// Send in batches of 100
-	for i := 0; i < len(messages); i += maxBatchSize {
+	return s.publish(ctx, pushes)
+}
+
+// publish sends single-recipient messages to Expo in batches of 100 through the
+// circuit breaker. Batches that fail, or that are short-circuited while the breaker is
+// open, are deferred to pending_notifications for the retry job. It returns the number
+// of messages Expo accepted.
+func (s *NotificationService) publish(ctx context.Context, pushes []outgoingPush) int {
+	sent := 0
+	for i := 0; i < len(pushes); i += maxBatchSize {
+		if !s.breaker.Allow() {
+			log.Printf("NotificationService: Expo circuit open, deferring %d notifications", len(pushes)-i)
+			s.deferPushes(ctx, pushes[i:])
+			break
+		}
+
 		end := i + maxBatchSize
-		if end > len(messages) {
-			end = len(messages)
+		if end > len(pushes) {
+			end = len(pushes)
+		}
+		batch := pushes[i:end]
+		messages := make([]expo.PushMessage, len(batch))
+		for j, push := range batch {
+			messages[j] = push.message
 		}
-		batch := messages[i:end]
 
-		responses, err := s.client.PublishMultiple(batch)
+		responses, err := s.client.PublishMultiple(messages)
 		if err != nil {
-			log.Printf("NotificationService: Error sending batch: %v", err)
+			s.breaker.Failure()
+			log.Printf("NotificationService: Error sending batch, deferring for retry: %v", err)
+			s.deferPushes(ctx, batch)
 			continue
 		}
+		s.breaker.Success()
+		sent += len(batch)
+		s.clearPending(ctx, batch)
 
 		// Process responses and store receipts for later verification
 		for j, response := range responses {
+			token := string(messages[j].To[0])
 			if response.Status == expo.SuccessStatus {
 				// Store receipt for later checking
 				if response.ID != "" {
-					token := tokenMap[i+j]
 					if err := s.db.InsertPushReceipt(ctx, db.InsertPushReceiptParams{
 						TicketID:  response.ID,
 						PushToken: token,
@@ -219,11 +391,10 @@ func (s *NotificationService) SendMessageNotification(
 			} else {
 				// Handle immediate errors
 				log.Printf("NotificationService: Push failed for token: %s, error: %s",
-					batch[j].To[0], response.Message)
+					token, response.Message)
 
 				// If token is invalid, remove it
 				if response.Details != nil && response.Details["error"] == expo.ErrorDeviceNotRegistered {
-					token := tokenMap[i+j]
 					if err := s.db.DeletePushTokenByValue(ctx, pgtype.Text{String: token, Valid: true}); err != nil {
 						log.Printf("NotificationService: Error removing invalid token: %v", err)
 					} else {
@@ -234,7 +405,7 @@ func (s *NotificationService) SendMessageNotification(
 		}
 	}
 
-	log.Printf("NotificationService: Sent %d notifications for group %s", len(messages), groupID.String())
+	return sent
 }
 
 // receiptRequest is the request body for the Expo receipts API
@@ -251,6 +422,21 @@ type receiptResponse struct {
 	} `json:"data"`
 }
 
+// receiptErrorsNotAboutToken are receipt errors caused by the server's credentials or
+// by the message itself, which say nothing about whether the device's token works.
+var receiptErrorsNotAboutToken = map[string]bool{
+	"InvalidCredentials":          true,
+	"MismatchSenderId":            true,
+	expo.ErrorMessageTooBig:       true,
+	expo.ErrorMessageRateExceeded: true,
+}
+
+// countsAgainstToken reports whether a receipt error counts as a failure of the
+// device's token. Unknown errors do, so a token that keeps failing is still cleared.
+func countsAgainstToken(reason string) bool {
+	return !receiptErrorsNotAboutToken[reason]
+}
+
 // ProcessReceipts checks pending receipts and removes invalid tokens
 func (s *NotificationService) ProcessReceipts(ctx context.Context) error {
 	// Get pending receipts (older than 15 minutes)
@@ -273,6 +459,8 @@ func (s *NotificationService) ProcessReceipts(ctx context.Context) error {
 
 	// Fetch receipts from Expo in batches
 	processedTickets := []string{}
+	var okTokens []string
+	failures := make(map[string]string)
 	for i := 0; i < len(ticketIDs); i += maxBatchSize {
 		end := i + maxBatchSize
 		if end > len(ticketIDs) {
@@ -293,12 +481,28 @@ func (s *NotificationService) ProcessReceipts(ctx context.Context) error {
 			continue
 		}
 		req.Header.Set("Content-Type", "application/json")
+		if s.accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+s.accessToken)
+		}
 
+		// Unfetched receipts stay pending and are picked up on the next run.
+		if !s.breaker.Allow() {
+			log.Printf("NotificationService: Expo circuit open, deferring receipt checks")
+			break
+		}
 		resp, err := s.httpClient.Do(req)
 		if err != nil {
+			s.breaker.Failure()
 			log.Printf("NotificationService: Error fetching receipts: %v", err)
 			continue
 		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			resp.Body.Close()
+			s.breaker.Failure()
+			log.Printf("NotificationService: Expo receipts API returned %d", resp.StatusCode)
+			continue
+		}
+		s.breaker.Success()
 
 		var receiptResp receiptResponse
 		if err := json.NewDecoder(resp.Body).Decode(&receiptResp); err != nil {
@@ -311,17 +515,40 @@ func (s *NotificationService) ProcessReceipts(ctx context.Context) error {
 		for ticketID, receipt := range receiptResp.Data {
 			processedTickets = append(processedTickets, ticketID)
 
-			if receipt.Status != "ok" {
-				// Check if device is not registered
-				if receipt.Details != nil && receipt.Details["error"] == expo.ErrorDeviceNotRegistered {
-					token := ticketToToken[ticketID]
-					if err := s.db.DeletePushTokenByValue(ctx, pgtype.Text{String: token, Valid: true}); err != nil {
-						log.Printf("NotificationService: Error removing invalid token: %v", err)
-					} else {
-						log.Printf("NotificationService: Removed unregistered device token: %s", token)
-					}
+			if receipt.Status == "ok" {
+				okTokens = append(okTokens, ticketToToken[ticketID])
+				continue
+			}
+			// Check if device is not registered
+			if receipt.Details != nil && receipt.Details["error"] == expo.ErrorDeviceNotRegistered {
+				token := ticketToToken[ticketID]
+				if err := s.db.DeletePushTokenByValue(ctx, pgtype.Text{String: token, Valid: true}); err != nil {
+					log.Printf("NotificationService: Error removing invalid token: %v", err)
+				} else {
+					log.Printf("NotificationService: Removed unregistered device token: %s", token)
 				}
+				continue
 			}
+			// Other token errors may be transient, so they are only counted here;
+			// cleanup_push_tokens removes tokens that keep failing.
+			if reason := receipt.Details["error"]; countsAgainstToken(reason) {
+				failures[ticketToToken[ticketID]] = reason
+			} else {
+				log.Printf("NotificationService: Receipt %s failed with %s, not counted against its token", ticketID, reason)
+			}
+		}
+	}
+
+	// Clear before recording, so a token with both ok and failed receipts in this run
+	// keeps its failure.
+	if len(okTokens) > 0 {
+		if err := s.db.ClearPushTokenFailures(ctx, okTokens); err != nil {
+			log.Printf("NotificationService: Error clearing push token failures: %v", err)
+		}
+	}
+	for token, reason := range failures {
+		if err := s.db.RecordPushTokenFailure(ctx, db.RecordPushTokenFailureParams{PushToken: token, LastError: reason}); err != nil {
+			log.Printf("NotificationService: Error recording push token failure: %v", err)
 		}
 	}
 
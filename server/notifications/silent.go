@@ -0,0 +1,157 @@
+package notifications
+
+import (
+	"bytes"
+	"chat-app-server/rediskeys"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	expo "github.com/oliveroneill/exponent-server-sdk-golang/sdk"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// expoPushURL is the Expo send endpoint. Silent pushes are posted directly because
+// the SDK's PushMessage has no _contentAvailable field.
+const expoPushURL = "https://exp.host/--/api/v2/push/send"
+
+// silentPushMessage is a data-only push: no title, body or sound. _contentAvailable
+// lets iOS wake the app in the background; Android delivers data-only messages as is.
+type silentPushMessage struct {
+	To               string            `json:"to"`
+	Data             map[string]string `json:"data"`
+	Priority         string            `json:"priority"`
+	ContentAvailable bool              `json:"_contentAvailable"`
+}
+
+type silentPushResponse struct {
+	Data []expo.PushResponse `json:"data"`
+}
+
+// sendSilent sends a data-only push carrying data to every device of userIDs, so
+// the app can sync in the background. iOS throttles background pushes, so each user
+// gets at most one per silentPushInterval; later messages are picked up by that sync.
+// The interval is claimed up front so concurrent sends don't both go out, and released
+// for users none of whose pushes Expo accepted, so the next message retries them.
+// Silent pushes are not deferred when Expo is unavailable: a late wake-up is useless.
+func (s *NotificationService) sendSilent(ctx context.Context, userIDs []uuid.UUID, data map[string]string) int {
+	var due []uuid.UUID
+	for _, userID := range userIDs {
+		ok, err := s.redisClient.SetNX(ctx, rediskeys.SilentPushPrefix+userID.String(), 1, s.silentPushInterval).Result()
+		if err != nil {
+			log.Printf("NotificationService: Error checking silent push interval for user %s: %v", userID, err)
+			continue
+		}
+		if ok {
+			due = append(due, userID)
+		}
+	}
+	if len(due) == 0 {
+		return 0
+	}
+
+	delivered := make(map[uuid.UUID]bool, len(due))
+	defer s.releaseSilentInterval(ctx, due, delivered)
+
+	tokens, err := s.db.GetPushTokensForUsers(ctx, due)
+	if err != nil {
+		log.Printf("NotificationService: Error getting push tokens: %v", err)
+		return 0
+	}
+
+	var messages []silentPushMessage
+	var recipients []uuid.UUID
+	for _, tokenRow := range tokens {
+		if !tokenRow.ExpoPushToken.Valid || !ValidateToken(tokenRow.ExpoPushToken.String) {
+			continue
+		}
+		messages = append(messages, silentPushMessage{
+			To:               tokenRow.ExpoPushToken.String,
+			Data:             data,
+			Priority:         expo.NormalPriority,
+			ContentAvailable: true,
+		})
+		recipients = append(recipients, tokenRow.UserID)
+	}
+
+	sent := 0
+	for i := 0; i < len(messages); i += maxBatchSize {
+		batch := messages[i:min(i+maxBatchSize, len(messages))]
+		if !s.breaker.Allow() {
+			log.Printf("NotificationService: Expo circuit open, dropping %d silent pushes", len(messages)-i)
+			break
+		}
+		responses, err := s.postSilent(ctx, batch)
+		if err != nil {
+			s.breaker.Failure()
+			log.Printf("NotificationService: Error sending silent pushes: %v", err)
+			continue
+		}
+		s.breaker.Success()
+		sent += len(batch)
+		for j, response := range responses {
+			if j >= len(batch) {
+				continue
+			}
+			if response.Status == expo.SuccessStatus {
+				delivered[recipients[i+j]] = true
+				continue
+			}
+			if response.Details != nil && response.Details["error"] == expo.ErrorDeviceNotRegistered {
+				if err := s.db.DeletePushTokenByValue(ctx, pgtype.Text{String: batch[j].To, Valid: true}); err != nil {
+					log.Printf("NotificationService: Error removing invalid token: %v", err)
+				}
+			}
+		}
+	}
+	return sent
+}
+
+// releaseSilentInterval clears the interval claimed for each user in due that has no
+// entry in delivered.
+func (s *NotificationService) releaseSilentInterval(ctx context.Context, due []uuid.UUID, delivered map[uuid.UUID]bool) {
+	var keys []string
+	for _, userID := range due {
+		if !delivered[userID] {
+			keys = append(keys, rediskeys.SilentPushPrefix+userID.String())
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	if err := s.redisClient.Del(ctx, keys...).Err(); err != nil {
+		log.Printf("NotificationService: Error releasing silent push interval for %d users: %v", len(keys), err)
+	}
+}
+
+func (s *NotificationService) postSilent(ctx context.Context, batch []silentPushMessage) ([]expo.PushResponse, error) {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", expoPushURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.accessToken)
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("expo push API returned %d", resp.StatusCode)
+	}
+	var decoded silentPushResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return nil, err
+	}
+	return decoded.Data, nil
+}
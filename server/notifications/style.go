@@ -0,0 +1,120 @@
+package notifications
+
+import (
+	"chat-app-server/db"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	expo "github.com/oliveroneill/exponent-server-sdk-golang/sdk"
+)
+
+const (
+	// DefaultSound is the platform notification sound, used unless a group picks another.
+	DefaultSound = "default"
+	// DefaultChannel is the Android channel the app always creates.
+	DefaultChannel = "default"
+)
+
+var styleNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+var (
+	allowedSounds   = map[string]bool{DefaultSound: true}
+	allowedChannels = map[string]bool{DefaultChannel: true}
+)
+
+// PushStyle is how a push sounds, which Android notification channel it posts to and
+// its Expo priority. The zero value is the default sound on Expo's default channel at
+// Expo's default priority.
+type PushStyle struct {
+	Sound     string
+	ChannelID string
+	Priority  string
+}
+
+// apply sets msg's sound, channel and priority, falling back to the defaults.
+func (p PushStyle) apply(msg *expo.PushMessage) {
+	msg.Sound = p.Sound
+	if msg.Sound == "" {
+		msg.Sound = DefaultSound
+	}
+	msg.ChannelID = p.ChannelID
+	msg.Priority = p.Priority
+	if msg.Priority == "" {
+		msg.Priority = expo.DefaultPriority
+	}
+}
+
+// withAutoPriority returns p with priority auto unless p already sets one (a group
+// override).
+func (p PushStyle) withAutoPriority(auto string) PushStyle {
+	if p.Priority == "" {
+		p.Priority = auto
+	}
+	return p
+}
+
+// autoPriority is a message push's priority when its group sets none. Mentions use high
+// so they wake the device promptly; other messages use Expo's default (high on iOS,
+// normal on Android) and control messages normal.
+func autoPriority(messageType db.MessageType, mentioned bool) string {
+	switch {
+	case mentioned:
+		return expo.HighPriority
+	case messageType == db.MessageTypeControl:
+		return expo.NormalPriority
+	default:
+		return expo.DefaultPriority
+	}
+}
+
+// ValidPriority reports whether priority is empty (automatic) or an Expo priority.
+func ValidPriority(priority string) bool {
+	switch priority {
+	case "", expo.DefaultPriority, expo.NormalPriority, expo.HighPriority:
+		return true
+	}
+	return false
+}
+
+// LoadPushStyles reads NOTIFICATION_SOUNDS and NOTIFICATION_CHANNELS, the comma-separated
+// sound files bundled with the app and Android channel IDs it creates, which groups may
+// choose from besides "default". Call once at startup.
+func LoadPushStyles() error {
+	sounds, err := parseStyleNames("NOTIFICATION_SOUNDS", DefaultSound)
+	if err != nil {
+		return err
+	}
+	channels, err := parseStyleNames("NOTIFICATION_CHANNELS", DefaultChannel)
+	if err != nil {
+		return err
+	}
+	allowedSounds, allowedChannels = sounds, channels
+	return nil
+}
+
+func parseStyleNames(env, always string) (map[string]bool, error) {
+	names := map[string]bool{always: true}
+	for _, name := range strings.Split(os.Getenv(env), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !styleNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("%s: invalid name %q", env, name)
+		}
+		names[name] = true
+	}
+	return names, nil
+}
+
+// ValidSound reports whether sound is empty (the default) or allowlisted.
+func ValidSound(sound string) bool {
+	return sound == "" || allowedSounds[sound]
+}
+
+// ValidChannel reports whether channelID is empty (the default) or allowlisted.
+func ValidChannel(channelID string) bool {
+	return channelID == "" || allowedChannels[channelID]
+}
@@ -0,0 +1,83 @@
+// Package ratelimit implements Redis-backed sliding-window limits shared by every
+// server instance.
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// slidingWindowScript keeps one sorted-set member per action, scored by the time it was
+// first seen. It returns 0 when the action is allowed (or was already counted) and
+// otherwise the milliseconds until the oldest action leaves the window.
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local member = ARGV[4]
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+if redis.call('ZSCORE', key, member) then
+	return 0
+end
+if redis.call('ZCARD', key) >= limit then
+	local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+	return math.max(1, tonumber(oldest[2]) + window - now)
+end
+redis.call('ZADD', key, now, member)
+redis.call('PEXPIRE', key, window)
+return 0
+`)
+
+// Limiter allows at most limit distinct actions per key within a sliding window.
+// Repeating an action that is already counted (e.g. retrying the same request) is
+// always allowed and does not count again.
+type Limiter struct {
+	redis  *redis.Client
+	prefix string
+	limit  int
+	window time.Duration
+}
+
+// New returns a Limiter storing its windows under prefix{key}. A limit of 0 or less
+// disables it.
+func New(redisClient *redis.Client, prefix string, limit int, window time.Duration) *Limiter {
+	return &Limiter{redis: redisClient, prefix: prefix, limit: limit, window: window}
+}
+
+// Allow records action for key. It returns how long the caller must wait when the limit
+// is reached, or 0 if the action may proceed. A nil or disabled Limiter always allows.
+func (l *Limiter) Allow(ctx context.Context, key, action string) (time.Duration, error) {
+	if l == nil || l.limit <= 0 {
+		return 0, nil
+	}
+	wait, err := slidingWindowScript.Run(ctx, l.redis, []string{l.prefix + key},
+		time.Now().UnixMilli(), l.window.Milliseconds(), l.limit, action).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
+
+// AllowRequest applies Allow to a request. When the limit is reached it responds 429
+// with a Retry-After header and returns false. Redis errors are logged and the request
+// is let through, so a Redis outage does not block the endpoint.
+func (l *Limiter) AllowRequest(c *gin.Context, key, action string) bool {
+	wait, err := l.Allow(c.Request.Context(), key, action)
+	if err != nil {
+		log.Printf("Rate limiter %s: failed to check %s, allowing: %v", l.prefix, key, err)
+		return true
+	}
+	if wait <= 0 {
+		return true
+	}
+	c.Header("Retry-After", strconv.FormatInt(int64((wait+time.Second-1)/time.Second), 10))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, try again later"})
+	return false
+}
@@ -6,6 +6,29 @@ const (
 	UserGroupsPrefix    = "user:"
 	GroupMembersPrefix  = "group:"
 	GroupInfoPrefix     = "groupinfo:"
+	// UserConnectionsPrefix + id + ":connections" is a sorted set of the user's live
+	// WebSocket connection IDs across all instances.
+	UserConnectionsPrefix = "user:"
+
+	// GroupCreationRatePrefix holds each user's recent group reservations/creations.
+	GroupCreationRatePrefix = "ratelimit:group_create:"
+	// AdminRatePrefix holds each operator's recent admin API requests.
+	AdminRatePrefix = "ratelimit:admin:"
+	// PhoneCodeRatePrefix holds each user's recent phone verification code requests.
+	PhoneCodeRatePrefix = "ratelimit:phone_code:"
+
+	// SilentPushPrefix + user id is set while the user's silent push interval runs.
+	SilentPushPrefix = "push:silent:"
+	// ReactionPushPrefix + author id + ":" + group id collapses bursts of reaction pushes.
+	ReactionPushPrefix = "push:reaction:"
+
+	// TypingPrefix + group id is a sorted set of typing user ids scored by expiry
+	// (Unix ms); TypingThrottlePrefix + group id is held while a snapshot was just sent.
+	TypingPrefix         = "typing:"
+	TypingThrottlePrefix = "typing:throttle:"
+
+	// MaintenanceKey is set while the cluster is in maintenance mode.
+	MaintenanceKey = "maintenance"
 
 	PubSubGroupMessagesChannel = "group_messages"
 	PubSubGroupEventsChannel   = "group_events"
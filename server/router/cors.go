@@ -0,0 +1,74 @@
+package router
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultDevOrigin is allowed when no CORS origins are configured outside release mode.
+const defaultDevOrigin = "http://localhost:8081"
+
+var (
+	allowedOrigins       = map[string]bool{}
+	allowedOriginRegexps []*regexp.Regexp
+)
+
+// LoadCORSOrigins reads CORS_ALLOWED_ORIGINS, a comma-separated list of exact origins,
+// and CORS_ALLOWED_ORIGIN_PATTERNS, a comma-separated list of regular expressions that
+// must match the whole origin (for dev hosts whose address changes). It must be called
+// once before InitRouter. Outside release mode an empty config falls back to
+// http://localhost:8081; in release mode (GIN_MODE=release) it is an error.
+func LoadCORSOrigins() error {
+	origins := make(map[string]bool)
+	for _, raw := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		raw = strings.TrimRight(strings.TrimSpace(raw), "/")
+		if raw == "" {
+			continue
+		}
+		if !strings.HasPrefix(raw, "http://") && !strings.HasPrefix(raw, "https://") {
+			return fmt.Errorf("CORS_ALLOWED_ORIGINS contains an invalid origin %q", raw)
+		}
+		origins[raw] = true
+	}
+
+	var patterns []*regexp.Regexp
+	for _, raw := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGIN_PATTERNS"), ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		re, err := regexp.Compile("^(?:" + raw + ")$")
+		if err != nil {
+			return fmt.Errorf("CORS_ALLOWED_ORIGIN_PATTERNS contains an invalid pattern %q: %w", raw, err)
+		}
+		patterns = append(patterns, re)
+	}
+
+	if len(origins) == 0 && len(patterns) == 0 {
+		if gin.Mode() == gin.ReleaseMode {
+			return fmt.Errorf("CORS_ALLOWED_ORIGINS or CORS_ALLOWED_ORIGIN_PATTERNS must be set in release mode")
+		}
+		origins[defaultDevOrigin] = true
+	}
+
+	allowedOrigins = origins
+	allowedOriginRegexps = patterns
+	return nil
+}
+
+// originAllowed reports whether origin is listed or matches a configured pattern.
+func originAllowed(origin string) bool {
+	if allowedOrigins[origin] {
+		return true
+	}
+	for _, re := range allowedOriginRegexps {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package router
+
+import (
+	"net/http"
+	"regexp"
+
+	"chat-app-server/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// requestIDHeader carries the correlation ID in both directions.
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID limits client-supplied IDs to something safe to log and echo.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestID tags each request with a correlation ID, reusing the caller's
+// X-Request-ID when it is well formed, and echoes it on the response.
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+		c.Set("requestID", id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// recovery turns a handler panic into a logged stack trace and a JSON 500 carrying
+// the request ID, instead of gin's bare 500.
+func recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			id := c.GetString("requestID")
+			user := "anonymous"
+			if userID, ok := c.Get("userID"); ok {
+				if userID, ok := userID.(uuid.UUID); ok {
+					user = userID.String()
+				}
+			}
+			util.LogPanic(c.Request.Method+" "+c.FullPath()+" (request "+id+", user "+user+")", recovered)
+
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":      "Internal server error",
+				"code":       "internal_error",
+				"request_id": id,
+			})
+		}()
+		c.Next()
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"chat-app-server/notifications"
 	"chat-app-server/server"
 	"chat-app-server/ws"
+	"expvar"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -15,18 +16,16 @@ import (
 var r *gin.Engine
 
 func InitRouter(authHandler *auth.AuthHandler, wsHandler *ws.Handler, api *server.API, imageHandler *images.ImageHandler, notificationHandler *notifications.NotificationHandler) {
-	r = gin.Default()
+	r = gin.New()
+	r.Use(gin.Logger(), requestID(), recovery())
 
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:8081", "http://192.168.1.12:8081", "http://192.168.1.32:8081", "http://192.168.1.42:8081", "http://192.168.1.8:8081", "http://192.168.1.18:8081", "http://192.168.1.80:8081", "http://192.168.1.2:8081"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Content-Type", "Authorization", requestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", "Retry-After", requestIDHeader},
 		AllowCredentials: true,
-		AllowOriginFunc: func(origin string) bool {
-			return origin == "http://localhost:8081"
-		},
-		MaxAge: 12 * time.Hour,
+		AllowOriginFunc:  originAllowed,
+		MaxAge:           12 * time.Hour,
 	}))
 
 	// general API
@@ -35,25 +34,58 @@ func InitRouter(authHandler *auth.AuthHandler, wsHandler *ws.Handler, api *serve
 
 	apiRoutes.GET("/users/whoami", api.WhoAmI)
 	apiRoutes.GET("/users/device-keys", api.GetRelevantDeviceKeys)
+	apiRoutes.POST("/users/device-keys/batch", api.GetDeviceKeysBatch)
+	apiRoutes.DELETE("/users/me", wsHandler.DeleteAccount)
+	apiRoutes.POST("/users/me/deactivate", wsHandler.DeactivateAccount)
+	apiRoutes.GET("/users/me/export", api.ExportUserData)
+	apiRoutes.POST("/users/me/phone", api.StartPhoneVerification)
+	apiRoutes.POST("/users/me/phone/verify", api.VerifyPhone)
+	apiRoutes.DELETE("/users/me/phone", api.RemovePhone)
+	apiRoutes.POST("/users/change-email", api.ChangeEmail)
+	apiRoutes.GET("/users/me/notification-preview", api.GetNotificationPreview)
+	apiRoutes.PUT("/users/me/notification-preview", api.SetNotificationPreview)
+	apiRoutes.GET("/users/me/silent-push", api.GetSilentPush)
+	apiRoutes.PUT("/users/me/silent-push", api.SetSilentPush)
+	apiRoutes.GET("/users/me/reaction-push", api.GetReactionPush)
+	apiRoutes.PUT("/users/me/reaction-push", api.SetReactionPush)
+	apiRoutes.POST("/devices/register", wsHandler.RegisterDevice)
+	apiRoutes.POST("/devices/rotate-key", wsHandler.RotateDeviceKey)
 
 	apiRoutes.POST("/groups/reserve/:groupID", api.ReserveGroup)
+	apiRoutes.POST("/groups/release/:groupID", api.ReleaseGroup)
+	apiRoutes.POST("/groups/reserve/:groupID/transfer", api.TransferReservation)
 	apiRoutes.PUT("/groups/:groupID/mute", api.ToggleGroupMuted)
 
 	// Notification routes
 	apiRoutes.POST("/notifications/register-token", notificationHandler.RegisterPushToken)
 	apiRoutes.DELETE("/notifications/token", notificationHandler.ClearPushToken)
+	apiRoutes.POST("/notifications/snooze", notificationHandler.Snooze)
 
 	// Invite routes (authenticated)
 	apiRoutes.POST("/invites", wsHandler.CreateInvite)
 	apiRoutes.POST("/invites/:code/accept", wsHandler.AcceptInvite)
 
+	// Operator routes, limited to ADMIN_USER_IDS
+	adminRoutes := r.Group("/api/admin/")
+	adminRoutes.Use(auth.JWTAuthMiddleware(), auth.AdminMiddleware())
+	adminRoutes.GET("/maintenance", wsHandler.GetMaintenance)
+	adminRoutes.PUT("/maintenance", wsHandler.SetMaintenance)
+	adminRoutes.GET("/users", api.AdminListUsers)
+	adminRoutes.POST("/groups/:groupID/system-message", wsHandler.SendSystemMessage)
+	adminRoutes.GET("/groups/:groupID/stats", wsHandler.AdminGetGroupStats)
+	adminRoutes.GET("/metrics", gin.WrapH(expvar.Handler()))
+
 	// Invite preview (unauthenticated)
 	r.GET("/public/invites/:code", wsHandler.ValidateInvite)
 
+	// Email change confirmation (unauthenticated; the emailed token is the proof)
+	r.POST("/public/email-change/confirm", api.ConfirmEmailChange)
+
 	// auth routes group
 	authRoutes := r.Group("/auth/")
 	authRoutes.POST("/signup", authHandler.Signup)
 	authRoutes.POST("/login", authHandler.Login)
+	authRoutes.POST("/login/keyless", authHandler.LoginWithoutDevice)
 
 	// WS routes
 	wsRoutes := r.Group("/ws/")
@@ -64,13 +96,39 @@ func InitRouter(authHandler *auth.AuthHandler, wsHandler *ws.Handler, api *serve
 	wsRoutes.POST("/invite-users-to-group", wsHandler.InviteUsersToGroup)
 	wsRoutes.POST("/remove-user-from-group", wsHandler.RemoveUserFromGroup)
 	wsRoutes.GET("/get-groups", wsHandler.GetGroups)
+	wsRoutes.POST("/groups/:groupID/read", wsHandler.MarkGroupRead)
+	wsRoutes.POST("/groups/:groupID/ack-sequence", wsHandler.AckSequence)
+	wsRoutes.GET("/groups/read-state", wsHandler.GetReadState)
 	wsRoutes.GET("/get-users-in-group/:groupID", wsHandler.GetUsersInGroup)
 	wsRoutes.POST("/leave-group/:groupID", wsHandler.LeaveGroup)
+	wsRoutes.POST("/leave-all-groups", wsHandler.LeaveAllGroups)
 	wsRoutes.GET("/relevant-users", wsHandler.GetRelevantUsers)
 	wsRoutes.GET("/relevant-messages", wsHandler.GetRelevantMessages)
+	wsRoutes.PUT("/messages/:messageID", wsHandler.EditMessage)
+	wsRoutes.GET("/messages/:messageID/history", wsHandler.GetMessageHistory)
+	wsRoutes.GET("/bookmarks", wsHandler.ListBookmarks)
+	wsRoutes.POST("/bookmarks/:messageID", wsHandler.AddBookmark)
+	wsRoutes.DELETE("/bookmarks/:messageID", wsHandler.RemoveBookmark)
+	wsRoutes.GET("/groups/:groupID/media", wsHandler.GetGroupMedia)
 	wsRoutes.POST("/block-user", wsHandler.BlockUser)
 	wsRoutes.POST("/unblock-user", wsHandler.UnblockUser)
 	wsRoutes.GET("/blocked-users", wsHandler.GetBlockedUsers)
+	wsRoutes.POST("/invites/validate-batch", wsHandler.ValidateInvitesBatch)
+
+	// Admin-only group settings
+	wsRoutes.GET("/groups/:groupID/settings", wsHandler.GetGroupSettings)
+	wsRoutes.PUT("/groups/:groupID/settings", wsHandler.UpdateGroupSettings)
+
+	// Admin-only audit log of membership, invite and settings changes
+	wsRoutes.GET("/groups/:groupID/audit", wsHandler.GetGroupAuditLog)
+	wsRoutes.GET("/groups/:groupID/invites/stats", wsHandler.GetInviteStats)
+	wsRoutes.GET("/groups/:groupID/stats", wsHandler.GetGroupStats)
+
+	// Join requests for approval-only groups
+	wsRoutes.POST("/groups/:groupID/request-join", wsHandler.RequestJoin)
+	wsRoutes.GET("/groups/:groupID/join-requests", wsHandler.GetJoinRequests)
+	wsRoutes.POST("/groups/:groupID/join-requests/:userID/approve", wsHandler.ApproveJoinRequest)
+	wsRoutes.POST("/groups/:groupID/join-requests/:userID/deny", wsHandler.DenyJoinRequest)
 
 	// authenticated after upgrade
 	r.GET("/ws/establish-connection", wsHandler.EstablishConnection)
@@ -80,6 +138,9 @@ func InitRouter(authHandler *auth.AuthHandler, wsHandler *ws.Handler, api *serve
 	imageRoutes.Use(auth.JWTAuthMiddleware())
 	imageRoutes.POST("/presign-upload", imageHandler.PresignUpload)
 	imageRoutes.POST("/presign-download", imageHandler.PresignDownload)
+	imageRoutes.POST("/presign-download-batch", imageHandler.PresignDownloadBatch)
+	imageRoutes.POST("/group-image/presign", imageHandler.PresignGroupImage)
+	imageRoutes.POST("/confirm", imageHandler.ConfirmGroupImage)
 }
 
 func Start(addr string) error {
@@ -0,0 +1,72 @@
+package s3store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// keyPrefix is prepended to every object key, e.g. "env/staging/". It is empty by
+// default, which keeps the original "groups/{groupID}/..." layout.
+var keyPrefix = ""
+
+// prefixSegment is one path segment allowed in S3_KEY_PREFIX.
+var prefixSegment = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// LoadKeyPrefix reads S3_KEY_PREFIX, an optional slash-separated prefix (such as
+// "env/staging") that isolates this deployment's objects within the bucket. It must
+// be called once at startup, before any key is built or parsed.
+func LoadKeyPrefix() error {
+	raw := strings.Trim(strings.TrimSpace(os.Getenv("S3_KEY_PREFIX")), "/")
+	if raw == "" {
+		keyPrefix = ""
+		return nil
+	}
+	for _, segment := range strings.Split(raw, "/") {
+		if !prefixSegment.MatchString(segment) {
+			return fmt.Errorf("S3_KEY_PREFIX segment %q must be letters, digits, '-' or '_'", segment)
+		}
+	}
+	keyPrefix = raw + "/"
+	return nil
+}
+
+// GroupObjectPrefix is the prefix under which all of a group's objects are stored.
+// Upload keys are built under it and cleanup deletes everything under it, so both
+// paths must go through this function.
+func GroupObjectPrefix(groupID uuid.UUID) string {
+	return keyPrefix + "groups/" + groupID.String() + "/"
+}
+
+// GroupObjectKey builds the key for a new object uploaded by uploaderID to groupID:
+// "{prefix}groups/{groupID}/{uploaderID}/{objectID}{ext}".
+func GroupObjectKey(groupID, uploaderID, objectID uuid.UUID, ext string) string {
+	return GroupObjectPrefix(groupID) + uploaderID.String() + "/" + objectID.String() + ext
+}
+
+// ParseGroupObjectKey splits a key built by GroupObjectKey into its group ID and file
+// name ("{objectID}{ext}"). Keys are matched strictly, so segments like ".." or a
+// different deployment's prefix cannot point a signed URL outside the group's objects.
+// Callers still validate the extension.
+func ParseGroupObjectKey(objectKey string) (uuid.UUID, string, error) {
+	rest, ok := strings.CutPrefix(objectKey, keyPrefix+"groups/")
+	if !ok {
+		return uuid.Nil, "", errors.New("Invalid or malformed object key")
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) != 3 {
+		return uuid.Nil, "", errors.New("Invalid or malformed object key")
+	}
+	groupID, err := uuid.Parse(parts[0])
+	if err != nil || groupID == uuid.Nil {
+		return uuid.Nil, "", errors.New("Invalid group ID in object key")
+	}
+	if _, err := uuid.Parse(parts[1]); err != nil {
+		return uuid.Nil, "", errors.New("Invalid or malformed object key")
+	}
+	return groupID, parts[2], nil
+}
@@ -2,15 +2,28 @@ package s3store
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+// ErrObjectNotFound is returned by HeadObject when the key doesn't exist.
+var ErrObjectNotFound = errors.New("object not found")
+
 type Store interface {
 	PresignUpload(ctx context.Context, key string, expires time.Duration, contentLength int64) (string, error)
 	PresignDownload(ctx context.Context, key string, expires time.Duration) (string, error)
+	// GetObject reads an object's body, failing if it is larger than maxBytes.
+	GetObject(ctx context.Context, key string, maxBytes int64) ([]byte, error)
+	// HeadObject returns an object's size, or ErrObjectNotFound if it doesn't exist.
+	HeadObject(ctx context.Context, key string) (int64, error)
+	// DeleteObject removes an object. Deleting a key that doesn't exist succeeds.
+	DeleteObject(ctx context.Context, key string) error
 	GetS3Client() *s3.Client
 	GetBucket() string
 }
@@ -59,6 +72,49 @@ func (s *s3Store) PresignDownload(ctx context.Context, key string, expires time.
 	return out.URL, nil
 }
 
+func (s *s3Store) GetObject(ctx context.Context, key string, maxBytes int64) ([]byte, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &s.bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(out.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, fmt.Errorf("object is larger than %d bytes", maxBytes)
+	}
+	return body, nil
+}
+
+func (s *s3Store) HeadObject(ctx context.Context, key string) (int64, error) {
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &s.bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return 0, ErrObjectNotFound
+		}
+		return 0, err
+	}
+	return aws.ToInt64(out.ContentLength), nil
+}
+
+func (s *s3Store) DeleteObject(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &s.bucket,
+		Key:    &key,
+	})
+	return err
+}
+
 func (s *s3Store) GetS3Client() *s3.Client {
 	return s.client
 }
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var adminUserPageLimits = util.PageLimits{Default: 50, Max: 200}
+
+// AdminUser is a user as shown to operators. It must never carry password hashes,
+// device keys or other secrets.
+type AdminUser struct {
+	ID              uuid.UUID  `json:"id"`
+	Username        string     `json:"username"`
+	Email           string     `json:"email"`
+	CreatedAt       time.Time  `json:"created_at"`
+	PhoneVerified   bool       `json:"phone_verified"`
+	PhoneVerifiedAt *time.Time `json:"phone_verified_at,omitempty"`
+	DeviceCount     int64      `json:"device_count"`
+	GroupCount      int64      `json:"group_count"`
+}
+
+type AdminUsersPage struct {
+	Users      []AdminUser `json:"users"`
+	Limit      int         `json:"limit"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// adminUserCursor is the position after the last user of a page, ordered newest first
+// by (created_at, id). It is sent to clients as opaque base64url JSON.
+type adminUserCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+}
+
+// AdminListUsers serves GET /api/admin/users?query=&cursor=&limit=: every user whose
+// username or email contains query, newest first. Operator only, and rate limited per
+// operator.
+func (api *API) AdminListUsers(c *gin.Context) {
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+	if !api.adminLimiter.AllowRequest(c, user.ID.String(), uuid.NewString()) {
+		return
+	}
+
+	// Start past every real user.
+	cursor := adminUserCursor{CreatedAt: time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC), ID: uuid.Max}
+	limit, ok := util.ParsePage(c, adminUserPageLimits, &cursor)
+	if !ok {
+		return
+	}
+
+	rows, err := api.db.AdminSearchUsers(c.Request.Context(), db.AdminSearchUsersParams{
+		Pattern:         util.ContainsPattern(c.Query("query")),
+		BeforeCreatedAt: pgtype.Timestamp{Time: cursor.CreatedAt, Valid: true},
+		BeforeID:        cursor.ID,
+		PageSize:        int32(limit),
+	})
+	if err != nil {
+		log.Printf("Error listing users for admin %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+		return
+	}
+
+	page := AdminUsersPage{Users: make([]AdminUser, 0, len(rows)), Limit: limit}
+	for _, row := range rows {
+		u := AdminUser{
+			ID:            row.ID,
+			Username:      row.Username,
+			Email:         row.Email,
+			CreatedAt:     row.CreatedAt.Time,
+			PhoneVerified: row.PhoneVerifiedAt.Valid,
+			DeviceCount:   row.DeviceCount,
+			GroupCount:    row.GroupCount,
+		}
+		if row.PhoneVerifiedAt.Valid {
+			u.PhoneVerifiedAt = &row.PhoneVerifiedAt.Time
+		}
+		page.Users = append(page.Users, u)
+	}
+	if len(rows) == limit {
+		last := rows[len(rows)-1]
+		page.NextCursor = util.EncodeCursor(adminUserCursor{CreatedAt: last.CreatedAt.Time, ID: last.ID})
+	}
+	c.JSON(http.StatusOK, page)
+}
@@ -2,6 +2,9 @@ package server
 
 import (
 	"chat-app-server/db"
+	"chat-app-server/email"
+	"chat-app-server/ratelimit"
+	"chat-app-server/sms"
 	"context"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -11,12 +14,26 @@ type API struct {
 	db   *db.Queries
 	ctx  context.Context
 	conn *pgxpool.Pool
+	sms  sms.Sender
+	// email sends email change confirmations.
+	email email.Sender
+	// groupCreationLimiter throttles group reservations; it is shared with ws.Handler's CreateGroup.
+	groupCreationLimiter *ratelimit.Limiter
+	// adminLimiter throttles each operator's calls to the admin endpoints.
+	adminLimiter *ratelimit.Limiter
+	// phoneCodeLimiter caps how many verification codes a user can have texted per day.
+	phoneCodeLimiter *ratelimit.Limiter
 }
 
-func NewAPI(db *db.Queries, ctx context.Context, conn *pgxpool.Pool) *API {
+func NewAPI(db *db.Queries, ctx context.Context, conn *pgxpool.Pool, smsSender sms.Sender, emailSender email.Sender, groupCreationLimiter, adminLimiter, phoneCodeLimiter *ratelimit.Limiter) *API {
 	return &API{
-		db:   db,
-		ctx:  ctx,
-		conn: conn,
+		db:                   db,
+		ctx:                  ctx,
+		conn:                 conn,
+		sms:                  smsSender,
+		email:                emailSender,
+		groupCreationLimiter: groupCreationLimiter,
+		adminLimiter:         adminLimiter,
+		phoneCodeLimiter:     phoneCodeLimiter,
 	}
 }
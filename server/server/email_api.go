@@ -0,0 +1,205 @@
+package server
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/email"
+	"chat-app-server/util"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	emailChangeTTL         = 24 * time.Hour
+	emailChangeResendDelay = time.Minute
+)
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" binding:"required,email,max=255"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ChangeEmail emails a confirmation link to the new address. The account keeps its
+// current email, for login and for being found by invites, until the link is followed.
+func (api *API) ChangeEmail(c *gin.Context) {
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	var req ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	newEmail := util.NormalizeEmail(req.NewEmail)
+
+	internalUser, err := api.db.GetUserByIdInternal(ctx, user.ID)
+	if err != nil {
+		log.Printf("Error loading credentials for email change of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify password"})
+		return
+	}
+	if !internalUser.Password.Valid || bcrypt.CompareHashAndPassword([]byte(internalUser.Password.String), []byte(req.Password)) != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Incorrect password"})
+		return
+	}
+	if strings.EqualFold(newEmail, user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "That is already your email"})
+		return
+	}
+
+	if owner, err := api.db.GetUserByEmail(ctx, newEmail); err == nil && owner.ID != user.ID {
+		c.JSON(http.StatusConflict, gin.H{"error": "This email is already linked to another account"})
+		return
+	} else if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error checking email ownership for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start email change"})
+		return
+	}
+
+	existing, err := api.db.GetEmailChange(ctx, user.ID)
+	if err == nil && time.Since(existing.CreatedAt.Time) < emailChangeResendDelay {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Please wait before requesting another link"})
+		return
+	} else if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error loading email change for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start email change"})
+		return
+	}
+
+	token, err := generateEmailChangeToken()
+	if err != nil {
+		log.Printf("Error generating email change token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start email change"})
+		return
+	}
+
+	if err := api.db.UpsertEmailChange(ctx, db.UpsertEmailChangeParams{
+		UserID:    user.ID,
+		NewEmail:  newEmail,
+		TokenHash: hashEmailChangeToken(token),
+		ExpiresAt: pgtype.Timestamp{Time: time.Now().Add(emailChangeTTL), Valid: true},
+	}); err != nil {
+		log.Printf("Error storing email change for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start email change"})
+		return
+	}
+
+	confirmBaseURL := os.Getenv("EMAIL_CONFIRM_BASE_URL")
+	if confirmBaseURL == "" {
+		confirmBaseURL = "myapp://confirm-email"
+	}
+	body := fmt.Sprintf("Confirm your new email address by opening this link: %s/%s\n\nIf you didn't ask to change your email, ignore this message.", confirmBaseURL, token)
+	if err := api.email.Send(ctx, newEmail, "Confirm your new email address", body); err != nil {
+		api.db.DeleteEmailChange(ctx, user.ID)
+		if errors.Is(err, email.ErrNotConfigured) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Email changes are not available"})
+			return
+		}
+		log.Printf("Error sending email change confirmation for user %s: %v", user.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send confirmation email"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"new_email": newEmail, "expires_in": int(emailChangeTTL.Seconds())})
+}
+
+// ConfirmEmailChange swaps in the new email for the change the token belongs to. It is
+// unauthenticated: the token from the emailed link is the proof.
+func (api *API) ConfirmEmailChange(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req ConfirmEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pending, err := api.db.GetEmailChangeByTokenHash(ctx, hashEmailChangeToken(req.Token))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invalid or already used link"})
+		} else {
+			log.Printf("Error loading email change: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm email change"})
+		}
+		return
+	}
+	if time.Now().After(pending.ExpiresAt.Time) {
+		api.db.DeleteEmailChange(ctx, pending.UserID)
+		c.JSON(http.StatusGone, gin.H{"error": "Link expired, request a new one"})
+		return
+	}
+
+	tx, err := api.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for email change of user %s: %v", pending.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm email change"})
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := api.db.WithTx(tx)
+
+	// The address may have been taken since the change was requested.
+	if owner, err := qtx.GetUserByEmail(ctx, pending.NewEmail); err == nil && owner.ID != pending.UserID {
+		api.db.DeleteEmailChange(ctx, pending.UserID)
+		c.JSON(http.StatusConflict, gin.H{"error": "This email is already linked to another account"})
+		return
+	} else if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error checking email ownership for user %s: %v", pending.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm email change"})
+		return
+	}
+
+	if err := qtx.SetUserEmail(ctx, db.SetUserEmailParams{ID: pending.UserID, Email: pending.NewEmail}); err != nil {
+		log.Printf("Error saving new email for user %s: %v", pending.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm email change"})
+		return
+	}
+	if err := qtx.DeleteEmailChange(ctx, pending.UserID); err != nil {
+		log.Printf("Error clearing email change for user %s: %v", pending.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm email change"})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit email change for user %s: %v", pending.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm email change"})
+		return
+	}
+
+	log.Printf("Email changed for user %s", pending.UserID)
+	c.JSON(http.StatusOK, gin.H{"email": pending.NewEmail})
+}
+
+func generateEmailChangeToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashEmailChangeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
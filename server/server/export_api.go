@@ -0,0 +1,219 @@
+package server
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const exportMessagePageSize = 500
+
+type ExportedProfile struct {
+	ID        uuid.UUID `json:"id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ExportedMembership struct {
+	GroupID   uuid.UUID `json:"group_id"`
+	GroupName string    `json:"group_name"`
+	Admin     bool      `json:"admin"`
+	Muted     bool      `json:"muted"`
+	JoinedAt  time.Time `json:"joined_at"`
+}
+
+type ExportedDeviceKey struct {
+	DeviceIdentifier string    `json:"device_identifier"`
+	PublicKey        []byte    `json:"public_key"`
+	SigningPublicKey []byte    `json:"signing_public_key"`
+	CreatedAt        time.Time `json:"created_at"`
+	LastSeenAt       time.Time `json:"last_seen_at"`
+}
+
+type ExportedMessage struct {
+	ID                     uuid.UUID         `json:"id"`
+	GroupID                *uuid.UUID        `json:"group_id"`
+	CreatedAt              time.Time         `json:"created_at"`
+	MessageType            db.MessageType    `json:"message_type"`
+	MsgNonce               []byte            `json:"msg_nonce"`
+	Ciphertext             []byte            `json:"ciphertext"`
+	Signature              []byte            `json:"signature"`
+	Envelopes              []json.RawMessage `json:"envelopes"`
+	SenderDeviceIdentifier string            `json:"sender_device_identifier,omitempty"`
+}
+
+// ownEnvelopes keeps the entries of a message's key_envelopes addressed to one of the
+// user's devices. Envelopes sealed for other members are of no use to the user. A
+// malformed list yields no envelopes.
+func ownEnvelopes(keyEnvelopes []byte, deviceIDs map[string]bool) ([]json.RawMessage, error) {
+	own := make([]json.RawMessage, 0, 1)
+	if len(keyEnvelopes) == 0 {
+		return own, nil
+	}
+	var envelopes []json.RawMessage
+	if err := json.Unmarshal(keyEnvelopes, &envelopes); err != nil {
+		return own[:0], err
+	}
+	for _, envelope := range envelopes {
+		var addressed struct {
+			DeviceID string `json:"deviceId"`
+		}
+		if err := json.Unmarshal(envelope, &addressed); err != nil {
+			return own[:0], err
+		}
+		if deviceIDs[addressed.DeviceID] {
+			own = append(own, envelope)
+		}
+	}
+	return own, nil
+}
+
+// ExportUserData streams the authenticated user's own data as a single JSON document.
+// Messages are paged from the database so large histories aren't held in memory.
+// Ciphertext is exported as-is with its signature and the envelopes sealed for the
+// user's current devices, so those devices can decrypt it.
+func (api *API) ExportUserData(c *gin.Context) {
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	// Load everything except messages up front so failures can still return a proper error.
+	memberships, err := api.db.GetGroupMembershipsForUser(ctx, &user.ID)
+	if err != nil {
+		log.Printf("Error loading memberships for export of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data"})
+		return
+	}
+	deviceKeys, err := api.db.GetDeviceKeysForUser(ctx, user.ID)
+	if err != nil {
+		log.Printf("Error loading device keys for export of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data"})
+		return
+	}
+
+	exportedMemberships := make([]ExportedMembership, 0, len(memberships))
+	for _, m := range memberships {
+		if m.GroupID == nil {
+			continue
+		}
+		exportedMemberships = append(exportedMemberships, ExportedMembership{
+			GroupID:   *m.GroupID,
+			GroupName: m.Name,
+			Admin:     m.Admin,
+			Muted:     m.Muted,
+			JoinedAt:  m.JoinedAt.Time,
+		})
+	}
+	exportedKeys := make([]ExportedDeviceKey, 0, len(deviceKeys))
+	deviceIDs := make(map[string]bool, len(deviceKeys))
+	for _, k := range deviceKeys {
+		deviceIDs[k.DeviceIdentifier] = true
+		exportedKeys = append(exportedKeys, ExportedDeviceKey{
+			DeviceIdentifier: k.DeviceIdentifier,
+			PublicKey:        k.PublicKey,
+			SigningPublicKey: k.SigningPublicKey,
+			CreatedAt:        k.CreatedAt.Time,
+			LastSeenAt:       k.LastSeenAt.Time,
+		})
+	}
+
+	header, err := json.Marshal(struct {
+		ExportedAt       time.Time            `json:"exported_at"`
+		Profile          ExportedProfile      `json:"profile"`
+		GroupMemberships []ExportedMembership `json:"group_memberships"`
+		DeviceKeys       []ExportedDeviceKey  `json:"device_keys"`
+	}{
+		ExportedAt: time.Now().UTC(),
+		Profile: ExportedProfile{
+			ID:        user.ID,
+			Username:  user.Username,
+			Email:     user.Email,
+			CreatedAt: user.CreatedAt.Time,
+			UpdatedAt: user.UpdatedAt.Time,
+		},
+		GroupMemberships: exportedMemberships,
+		DeviceKeys:       exportedKeys,
+	})
+	if err != nil {
+		log.Printf("Error marshalling export header for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data"})
+		return
+	}
+
+	c.Header("Content-Type", "application/json")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%s.json"`, user.ID))
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	// Splice the messages array into the header object: drop its closing brace.
+	w.Write(header[:len(header)-1])
+	w.WriteString(`,"messages":[`)
+
+	afterCreatedAt := pgtype.Timestamp{InfinityModifier: pgtype.NegativeInfinity, Valid: true}
+	afterID := uuid.Nil
+	first := true
+	for {
+		page, err := api.db.GetMessagesSentByUserPage(ctx, db.GetMessagesSentByUserPageParams{
+			UserID:         &user.ID,
+			AfterCreatedAt: afterCreatedAt,
+			AfterID:        afterID,
+			PageSize:       exportMessagePageSize,
+		})
+		if err != nil {
+			// Headers are already sent; the truncated body makes the failure visible to the client.
+			log.Printf("Error loading messages for export of user %s: %v", user.ID, err)
+			return
+		}
+
+		for _, m := range page {
+			envelopes, err := ownEnvelopes(m.KeyEnvelopes, deviceIDs)
+			if err != nil {
+				log.Printf("Error unmarshalling key_envelopes for message %s in export: %v", m.ID, err)
+			}
+			b, err := json.Marshal(ExportedMessage{
+				ID:                     m.ID,
+				GroupID:                m.GroupID,
+				CreatedAt:              m.CreatedAt.Time,
+				MessageType:            m.MessageType,
+				MsgNonce:               m.MsgNonce,
+				Ciphertext:             m.Ciphertext,
+				Signature:              m.Signature,
+				Envelopes:              envelopes,
+				SenderDeviceIdentifier: m.SenderDeviceIdentifier.String,
+			})
+			if err != nil {
+				log.Printf("Error marshalling message %s for export: %v", m.ID, err)
+				return
+			}
+			if !first {
+				w.WriteString(",")
+			}
+			first = false
+			w.Write(b)
+		}
+		w.Flush()
+
+		if len(page) < exportMessagePageSize {
+			break
+		}
+		last := page[len(page)-1]
+		afterCreatedAt = last.CreatedAt
+		afterID = last.ID
+	}
+
+	w.WriteString("]}")
+	w.Flush()
+}
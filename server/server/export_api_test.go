@@ -0,0 +1,46 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOwnEnvelopesKeepsOnlyTheUsersDevices(t *testing.T) {
+	deviceIDs := map[string]bool{"phone": true, "laptop": true}
+	tests := []struct {
+		name         string
+		keyEnvelopes string
+		want         []string
+		wantErr      bool
+	}{
+		{"none stored", "", []string{}, false},
+		{"mixed recipients", `[{"deviceId":"phone","sealedKey":"a"},{"deviceId":"other","sealedKey":"b"},{"deviceId":"laptop","sealedKey":"c"}]`, []string{"phone", "laptop"}, false},
+		{"no own devices", `[{"deviceId":"other","sealedKey":"b"}]`, []string{}, false},
+		{"malformed", `{"deviceId":"phone"}`, []string{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ownEnvelopes([]byte(tt.keyEnvelopes), deviceIDs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ownEnvelopes error = %v, want error %v", err, tt.wantErr)
+			}
+			if got == nil {
+				t.Fatal("ownEnvelopes returned nil, which exports as null")
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d envelopes, want %d", len(got), len(tt.want))
+			}
+			for i, envelope := range got {
+				var addressed struct {
+					DeviceID string `json:"deviceId"`
+				}
+				if err := json.Unmarshal(envelope, &addressed); err != nil {
+					t.Fatalf("envelope %d: %v", i, err)
+				}
+				if addressed.DeviceID != tt.want[i] {
+					t.Fatalf("envelope %d is for %q, want %q", i, addressed.DeviceID, tt.want[i])
+				}
+			}
+		})
+	}
+}
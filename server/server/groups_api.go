@@ -49,60 +49,226 @@ func (api *API) ToggleGroupMuted(c *gin.Context) {
 }
 
 func (api *API) ReserveGroup(c *gin.Context) {
-  user, err := util.GetUser(c, api.db)
-  if err != nil {
-    c.JSON(http.StatusUnauthorized,
-      gin.H{"error": "User not found or unauthorized"})
-    return
-  }
-
-  id, err := uuid.Parse(c.Param("groupID"))
-  if err != nil {
-    c.JSON(http.StatusBadRequest,
-      gin.H{"error": "Invalid group ID"})
-    return
-  }
-
-  ctx := c.Request.Context()
-
-  if _, err := api.db.GetGroupById(ctx, id); err == nil {
-    c.JSON(http.StatusConflict,
-      gin.H{"error": "Group already exists"})
-    return
-  } else if !errors.Is(err, pgx.ErrNoRows) {
-    log.Printf("db error checking group %s: %v", id, err)
-    c.JSON(http.StatusInternalServerError,
-      gin.H{"error": "Internal error"})
-    return
-  }
-
-  resv, err := api.db.GetGroupReservation(ctx, id)
-  if err == nil {
-    if resv.UserID == user.ID {
-      c.JSON(http.StatusOK,
-        gin.H{"message": "Group already reserved"})
-    } else {
-      c.JSON(http.StatusConflict,
-        gin.H{"error": "Group ID already reserved"})
-    }
-    return
-  } else if !errors.Is(err, pgx.ErrNoRows) {
-    log.Printf("db error checking reservation %s: %v", id, err)
-    c.JSON(http.StatusInternalServerError,
-      gin.H{"error": "Internal error"})
-    return
-  }
-
-  if _, err := api.db.ReserveGroup(ctx, db.ReserveGroupParams{
-    GroupID: id,
-    UserID:  user.ID,
-  }); err != nil {
-    log.Printf("db error inserting reservation %s: %v", id, err)
-    c.JSON(http.StatusInternalServerError,
-      gin.H{"error": "Could not reserve group"})
-    return
-  }
-
-  c.JSON(http.StatusCreated,
-    gin.H{"message": "Group reserved successfully"})
-}
\ No newline at end of file
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized,
+			gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest,
+			gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	if _, err := api.db.GetGroupById(ctx, id); err == nil {
+		c.JSON(http.StatusConflict,
+			gin.H{"error": "Group already exists"})
+		return
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("db error checking group %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError,
+			gin.H{"error": "Internal error"})
+		return
+	}
+
+	resv, err := api.db.GetGroupReservation(ctx, id)
+	if err == nil {
+		if resv.UserID == user.ID {
+			c.JSON(http.StatusOK,
+				gin.H{"message": "Group already reserved"})
+		} else {
+			c.JSON(http.StatusConflict,
+				gin.H{"error": "Group ID already reserved"})
+		}
+		return
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("db error checking reservation %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError,
+			gin.H{"error": "Internal error"})
+		return
+	}
+
+	if !api.groupCreationLimiter.AllowRequest(c, user.ID.String(), id.String()) {
+		return
+	}
+
+	// ON CONFLICT DO NOTHING: when two clients race for the same ID the first insert
+	// wins and the loser sees the winner's row below.
+	if _, err := api.db.ReserveGroup(ctx, db.ReserveGroupParams{
+		GroupID: id,
+		UserID:  user.ID,
+	}); err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("db error inserting reservation %s: %v", id, err)
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "Could not reserve group"})
+			return
+		}
+		winner, err := api.db.GetGroupReservation(ctx, id)
+		if err != nil {
+			log.Printf("db error re-reading reservation %s: %v", id, err)
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "Could not reserve group"})
+			return
+		}
+		if winner.UserID == user.ID {
+			c.JSON(http.StatusOK,
+				gin.H{"message": "Group already reserved"})
+		} else {
+			c.JSON(http.StatusConflict,
+				gin.H{"error": "Group ID already reserved"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated,
+		gin.H{"message": "Group reserved successfully"})
+}
+
+// ReleaseGroup lets the reserver give up a reservation they no longer need, e.g.
+// after abandoning group creation, instead of waiting for the stale reservation job.
+func (api *API) ReleaseGroup(c *gin.Context) {
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized,
+			gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest,
+			gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	released, err := api.db.ReleaseGroupReservation(c.Request.Context(), db.ReleaseGroupReservationParams{
+		GroupID: id,
+		UserID:  user.ID,
+	})
+	if err != nil {
+		log.Printf("db error releasing reservation %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError,
+			gin.H{"error": "Could not release reservation"})
+		return
+	}
+	if released == 0 {
+		c.JSON(http.StatusNotFound,
+			gin.H{"error": "No reservation held for this group ID"})
+		return
+	}
+
+	c.JSON(http.StatusOK,
+		gin.H{"message": "Reservation released"})
+}
+
+type TransferReservationRequest struct {
+	UserID *uuid.UUID `json:"user_id"`
+	Email  string     `json:"email" binding:"omitempty,email"`
+}
+
+// TransferReservation hands the caller's reservation of a group ID to another user,
+// who can then create the group, without a release/re-reserve race.
+func (api *API) TransferReservation(c *gin.Context) {
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized,
+			gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest,
+			gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	var req TransferReservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (req.UserID == nil) == (req.Email == "") {
+		c.JSON(http.StatusBadRequest,
+			gin.H{"error": "Provide exactly one of user_id or email"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	recipientID, ok := api.resolveReservationRecipient(c, req)
+	if !ok {
+		return
+	}
+	if recipientID == user.ID {
+		c.JSON(http.StatusBadRequest,
+			gin.H{"error": "Cannot transfer a reservation to yourself"})
+		return
+	}
+
+	transferred, err := api.db.TransferGroupReservation(ctx, db.TransferGroupReservationParams{
+		ToUserID:   recipientID,
+		GroupID:    id,
+		FromUserID: user.ID,
+	})
+	if err != nil {
+		log.Printf("db error transferring reservation %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError,
+			gin.H{"error": "Could not transfer reservation"})
+		return
+	}
+	if transferred == 0 {
+		c.JSON(http.StatusNotFound,
+			gin.H{"error": "No reservation held for this group ID"})
+		return
+	}
+	log.Printf("Reservation %s transferred from user %s to user %s", id, user.ID, recipientID)
+
+	c.JSON(http.StatusOK,
+		gin.H{"message": "Reservation transferred", "user_id": recipientID})
+}
+
+// resolveReservationRecipient finds the active account a reservation is being
+// transferred to. It writes the error response and returns false if there is none.
+func (api *API) resolveReservationRecipient(c *gin.Context, req TransferReservationRequest) (uuid.UUID, bool) {
+	ctx := c.Request.Context()
+
+	recipientID := uuid.Nil
+	if req.UserID != nil {
+		recipientID = *req.UserID
+	} else {
+		byEmail, err := api.db.GetUserByEmail(ctx, util.NormalizeEmail(req.Email))
+		if err != nil {
+			if !errors.Is(err, pgx.ErrNoRows) {
+				log.Printf("db error looking up reservation recipient: %v", err)
+				c.JSON(http.StatusInternalServerError,
+					gin.H{"error": "Internal error"})
+				return uuid.Nil, false
+			}
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "Recipient not found"})
+			return uuid.Nil, false
+		}
+		recipientID = byEmail.ID
+	}
+
+	// GetUserById skips deactivated accounts, which can't create groups.
+	if _, err := api.db.GetUserById(ctx, recipientID); err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("db error looking up reservation recipient %s: %v", recipientID, err)
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "Internal error"})
+			return uuid.Nil, false
+		}
+		c.JSON(http.StatusNotFound,
+			gin.H{"error": "Recipient not found"})
+		return uuid.Nil, false
+	}
+	return recipientID, true
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/notifications"
+	"chat-app-server/util"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type NotificationPreviewRequest struct {
+	Mode notifications.PreviewMode `json:"mode" binding:"required"`
+}
+
+type SilentPushRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+type ReactionPushRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// GetNotificationPreview returns the caller's own push preview preference and, if
+// pushes are snoozed, when the snooze ends.
+func (api *API) GetNotificationPreview(c *gin.Context) {
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	prefs, err := api.db.GetNotificationPrefs(c.Request.Context(), []uuid.UUID{user.ID})
+	if err != nil || len(prefs) == 0 {
+		log.Printf("Error loading notification preview mode for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load notification preview mode"})
+		return
+	}
+	response := gin.H{"mode": prefs[0].NotificationPreviewMode, "snooze_until": nil}
+	if notifications.SnoozeActive(prefs[0].SnoozeUntil) {
+		response["snooze_until"] = prefs[0].SnoozeUntil.Time
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// SetNotificationPreview sets how much the caller's message pushes reveal. A group's
+// own policy can still make them more private.
+func (api *API) SetNotificationPreview(c *gin.Context) {
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	var req NotificationPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.Mode.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be full, name_only or generic"})
+		return
+	}
+
+	if err := api.db.SetNotificationPreviewMode(c.Request.Context(), db.SetNotificationPreviewModeParams{
+		ID:                      user.ID,
+		NotificationPreviewMode: string(req.Mode),
+	}); err != nil {
+		log.Printf("Error saving notification preview mode for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification preview mode"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"mode": req.Mode})
+}
+
+// GetSilentPush reports whether the caller gets data-only pushes instead of alerts.
+func (api *API) GetSilentPush(c *gin.Context) {
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	prefs, err := api.db.GetNotificationPrefs(c.Request.Context(), []uuid.UUID{user.ID})
+	if err != nil || len(prefs) == 0 {
+		log.Printf("Error loading silent push preference for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load silent push preference"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": prefs[0].SilentPush})
+}
+
+// SetSilentPush opts the caller into (or out of) data-only pushes. Instead of a visible
+// alert the app is woken in the background to sync and can show its own notification.
+func (api *API) SetSilentPush(c *gin.Context) {
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	var req SilentPushRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := api.db.SetSilentPush(c.Request.Context(), db.SetSilentPushParams{
+		ID:         user.ID,
+		SilentPush: *req.Enabled,
+	}); err != nil {
+		log.Printf("Error saving silent push preference for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update silent push preference"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": *req.Enabled})
+}
+
+// GetReactionPush reports whether reactions to the caller's messages send them a push.
+func (api *API) GetReactionPush(c *gin.Context) {
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	prefs, err := api.db.GetNotificationPrefs(c.Request.Context(), []uuid.UUID{user.ID})
+	if err != nil || len(prefs) == 0 {
+		log.Printf("Error loading reaction push preference for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load reaction push preference"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": prefs[0].ReactionPush})
+}
+
+// SetReactionPush opts the caller into (or out of) pushes for reactions to their own
+// messages. It is off by default.
+func (api *API) SetReactionPush(c *gin.Context) {
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	var req ReactionPushRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := api.db.SetReactionPush(c.Request.Context(), db.SetReactionPushParams{
+		ID:           user.ID,
+		ReactionPush: *req.Enabled,
+	}); err != nil {
+		log.Printf("Error saving reaction push preference for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update reaction push preference"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": *req.Enabled})
+}
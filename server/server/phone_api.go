@@ -0,0 +1,242 @@
+package server
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/sms"
+	"chat-app-server/util"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	phoneCodeTTL         = 10 * time.Minute
+	phoneCodeResendDelay = time.Minute
+	phoneCodeMaxAttempts = 5
+	phoneCodeLength      = 6
+)
+
+type StartPhoneVerificationRequest struct {
+	Phone string `json:"phone" binding:"required"`
+}
+
+type VerifyPhoneRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// StartPhoneVerification texts a one-time code to the given number. The number is
+// only attached to the account once the code is confirmed via VerifyPhone. A user can
+// request a code once a minute and at most PHONE_CODES_PER_DAY times a day, which
+// bounds both the texts sent and the guesses against VerifyPhone.
+func (api *API) StartPhoneVerification(c *gin.Context) {
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	var req StartPhoneVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	phone, ok := util.NormalizePhone(req.Phone)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Phone number must include a country code, e.g. +15551234567"})
+		return
+	}
+
+	existing, err := api.db.GetPhoneVerification(ctx, user.ID)
+	if err == nil && time.Since(existing.CreatedAt.Time) < phoneCodeResendDelay {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Please wait before requesting another code"})
+		return
+	} else if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error loading phone verification for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start phone verification"})
+		return
+	}
+	if !api.phoneCodeLimiter.AllowRequest(c, user.ID.String(), uuid.NewString()) {
+		return
+	}
+
+	code, err := generateNumericCode(phoneCodeLength)
+	if err != nil {
+		log.Printf("Error generating phone verification code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start phone verification"})
+		return
+	}
+
+	if err := api.db.UpsertPhoneVerification(ctx, db.UpsertPhoneVerificationParams{
+		UserID:    user.ID,
+		Phone:     phone,
+		CodeHash:  hashPhoneCode(code),
+		ExpiresAt: pgtype.Timestamp{Time: time.Now().Add(phoneCodeTTL), Valid: true},
+	}); err != nil {
+		log.Printf("Error storing phone verification for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start phone verification"})
+		return
+	}
+
+	if err := api.sms.Send(ctx, phone, fmt.Sprintf("Your verification code is %s", code)); err != nil {
+		api.db.DeletePhoneVerification(ctx, user.ID)
+		if errors.Is(err, sms.ErrNotConfigured) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Phone verification is not available"})
+			return
+		}
+		log.Printf("Error sending verification SMS for user %s: %v", user.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send verification code"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"phone": phone, "expires_in": int(phoneCodeTTL.Seconds())})
+}
+
+// VerifyPhone confirms the pending code and attaches the number to the account. Each
+// guess is counted atomically before it is compared, so concurrent requests can't
+// try more than phoneCodeMaxAttempts codes against one pending verification.
+func (api *API) VerifyPhone(c *gin.Context) {
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	var req VerifyPhoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pending, err := api.db.GetPhoneVerification(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No pending phone verification"})
+		} else {
+			log.Printf("Error loading phone verification for user %s: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify phone"})
+		}
+		return
+	}
+	if time.Now().After(pending.ExpiresAt.Time) {
+		api.db.DeletePhoneVerification(ctx, user.ID)
+		c.JSON(http.StatusGone, gin.H{"error": "Verification code expired, request a new one"})
+		return
+	}
+	if _, err := api.db.ConsumePhoneVerificationAttempt(ctx, db.ConsumePhoneVerificationAttemptParams{
+		UserID:   user.ID,
+		Attempts: phoneCodeMaxAttempts,
+	}); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			api.db.DeletePhoneVerification(ctx, user.ID)
+			c.JSON(http.StatusGone, gin.H{"error": "Verification code expired, request a new one"})
+		} else {
+			log.Printf("Error recording phone verification attempt for user %s: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify phone"})
+		}
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(hashPhoneCode(req.Code)), []byte(pending.CodeHash)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	// A deactivated account keeps its number until it is purged, so it counts as an owner.
+	owner, err := api.db.GetVerifiedPhoneOwner(ctx, pgtype.Text{String: pending.Phone, Valid: true})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error checking phone ownership for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify phone"})
+		return
+	}
+	if err == nil && owner != user.ID {
+		c.JSON(http.StatusConflict, gin.H{"error": "This phone number is already linked to another account"})
+		return
+	}
+
+	tx, err := api.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for phone verification: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify phone"})
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := api.db.WithTx(tx)
+
+	if err := qtx.SetVerifiedPhone(ctx, db.SetVerifiedPhoneParams{
+		ID:    user.ID,
+		Phone: pgtype.Text{String: pending.Phone, Valid: true},
+	}); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation: claimed concurrently
+			c.JSON(http.StatusConflict, gin.H{"error": "This phone number is already linked to another account"})
+			return
+		}
+		log.Printf("Error saving verified phone for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify phone"})
+		return
+	}
+	if err := qtx.DeletePhoneVerification(ctx, user.ID); err != nil {
+		log.Printf("Error clearing phone verification for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify phone"})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit phone verification for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify phone"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"phone": pending.Phone, "verified": true})
+}
+
+// RemovePhone detaches the verified number (and any pending verification) from the account.
+func (api *API) RemovePhone(c *gin.Context) {
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	if err := api.db.DeletePhoneVerification(ctx, user.ID); err != nil {
+		log.Printf("Error clearing phone verification for user %s: %v", user.ID, err)
+	}
+	if err := api.db.ClearUserPhone(ctx, user.ID); err != nil {
+		log.Printf("Error removing phone for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove phone"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Phone removed"})
+}
+
+func generateNumericCode(length int) (string, error) {
+	max := big.NewInt(10)
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = byte('0' + n.Int64())
+	}
+	return string(code), nil
+}
+
+func hashPhoneCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
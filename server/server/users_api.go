@@ -1,9 +1,11 @@
 package server
 
 import (
+	"chat-app-server/db"
 	"chat-app-server/util"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 
@@ -59,19 +61,69 @@ func (api *API) GetRelevantDeviceKeys(c *gin.Context) {
 
 	response := make([]UserWithDeviceKeys, 0, len(relevantUserRows))
 	for _, row := range relevantUserRows {
-		var deviceKeyInfos []ClientDeviceKeyInfo
-		if len(row.DeviceKeys) > 0 {
-			if err := json.Unmarshal(row.DeviceKeys, &deviceKeyInfos); err != nil {
-				log.Printf("Error unmarshalling device_keys JSON for user %s: %v. JSON: %s", row.UserID, err, string(row.DeviceKeys))
-				continue
-			}
+		if entry, ok := decodeDeviceKeys(*row.UserID, row.DeviceKeys); ok {
+			response = append(response, entry)
 		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// MaxDeviceKeysBatchSize caps the number of user IDs accepted by GetDeviceKeysBatch.
+const MaxDeviceKeysBatchSize = 200
+
+type deviceKeysBatchReq struct {
+	UserIDs []uuid.UUID `json:"user_ids" binding:"required"`
+}
 
-		response = append(response, UserWithDeviceKeys{
-			UserID:     *row.UserID,
-			DeviceKeys: deviceKeyInfos,
-		})
+// GetDeviceKeysBatch returns device keys for just the requested users, e.g. the members
+// of a group the caller has just joined. Users who share no group with the caller, or
+// have no registered devices, are left out of the response rather than rejected.
+func (api *API) GetDeviceKeysBatch(c *gin.Context) {
+	user, err := util.GetUser(c, api.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	var req deviceKeysBatchReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	if len(req.UserIDs) == 0 || len(req.UserIDs) > MaxDeviceKeysBatchSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("user_ids must contain between 1 and %d IDs", MaxDeviceKeysBatchSize)})
+		return
+	}
+
+	rows, err := api.db.GetCoMemberDeviceKeys(c.Request.Context(), db.GetCoMemberDeviceKeysParams{
+		UserIds:  req.UserIDs,
+		CallerID: user.ID,
+	})
+	if err != nil {
+		log.Printf("Error loading device keys batch for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load device keys"})
+		return
+	}
+
+	response := make([]UserWithDeviceKeys, 0, len(rows))
+	for _, row := range rows {
+		if entry, ok := decodeDeviceKeys(row.UserID, row.DeviceKeys); ok {
+			response = append(response, entry)
+		}
 	}
 
 	c.JSON(http.StatusOK, response)
 }
+
+// decodeDeviceKeys unpacks the jsonb_agg device_keys column built by the device key queries.
+func decodeDeviceKeys(userID uuid.UUID, raw []byte) (UserWithDeviceKeys, bool) {
+	var deviceKeyInfos []ClientDeviceKeyInfo
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &deviceKeyInfos); err != nil {
+			log.Printf("Error unmarshalling device_keys JSON for user %s: %v. JSON: %s", userID, err, string(raw))
+			return UserWithDeviceKeys{}, false
+		}
+	}
+	return UserWithDeviceKeys{UserID: userID, DeviceKeys: deviceKeyInfos}, true
+}
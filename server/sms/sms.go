@@ -0,0 +1,64 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrNotConfigured is returned when no SMS provider has been set up for this deployment.
+var ErrNotConfigured = errors.New("sms: no provider configured")
+
+type Sender interface {
+	Send(ctx context.Context, to string, body string) error
+}
+
+type webhookSender struct {
+	url        string
+	httpClient *http.Client
+}
+
+type unconfiguredSender struct{}
+
+// New returns a Sender that POSTs {"to", "body"} JSON to webhookURL, which is expected to
+// forward the message to an SMS gateway. An empty URL yields a Sender that always fails
+// with ErrNotConfigured.
+func New(webhookURL string) Sender {
+	if webhookURL == "" {
+		return unconfiguredSender{}
+	}
+	return &webhookSender{
+		url:        webhookURL,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *webhookSender) Send(ctx context.Context, to string, body string) error {
+	payload, err := json.Marshal(map[string]string{"to": to, "body": body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("sms: gateway returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (unconfiguredSender) Send(ctx context.Context, to string, body string) error {
+	return ErrNotConfigured
+}
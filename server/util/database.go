@@ -0,0 +1,92 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const defaultQueryTimeout = 5 * time.Second
+
+// queryTimeout bounds critical-path queries run through WithQueryTimeout. It also
+// covers waiting for a pool connection, so an exhausted pool fails fast too.
+var queryTimeout = defaultQueryTimeout
+
+// LoadDBConfig parses DB_URL into a pool config and applies the optional DB_MAX_CONNS,
+// DB_MIN_CONNS, DB_MAX_CONN_LIFETIME_MINUTES and DB_CONNECT_TIMEOUT_SECONDS. It also
+// reads DB_QUERY_TIMEOUT_MS for WithQueryTimeout. Call once at startup. Errors never
+// include DB_URL.
+func LoadDBConfig() (*pgxpool.Config, error) {
+	config, err := pgxpool.ParseConfig(os.Getenv("DB_URL"))
+	if err != nil {
+		return nil, errors.New("DB_URL is not a valid connection string")
+	}
+
+	if n, err := positiveEnvInt("DB_MAX_CONNS"); err != nil {
+		return nil, err
+	} else if n > 0 {
+		config.MaxConns = int32(n)
+	}
+	if n, err := positiveEnvInt("DB_MIN_CONNS"); err != nil {
+		return nil, err
+	} else if n > 0 {
+		config.MinConns = int32(n)
+	}
+	if config.MinConns > config.MaxConns {
+		return nil, fmt.Errorf("DB_MIN_CONNS (%d) must not exceed DB_MAX_CONNS (%d)", config.MinConns, config.MaxConns)
+	}
+	if n, err := positiveEnvInt("DB_MAX_CONN_LIFETIME_MINUTES"); err != nil {
+		return nil, err
+	} else if n > 0 {
+		config.MaxConnLifetime = time.Duration(n) * time.Minute
+	}
+	if n, err := positiveEnvInt("DB_CONNECT_TIMEOUT_SECONDS"); err != nil {
+		return nil, err
+	} else if n > 0 {
+		config.ConnConfig.ConnectTimeout = time.Duration(n) * time.Second
+	}
+
+	queryTimeout = defaultQueryTimeout
+	if n, err := positiveEnvInt("DB_QUERY_TIMEOUT_MS"); err != nil {
+		return nil, err
+	} else if n > 0 {
+		queryTimeout = time.Duration(n) * time.Millisecond
+	}
+	return config, nil
+}
+
+// positiveEnvInt reads an optional positive integer, returning 0 when key is unset.
+func positiveEnvInt(key string) (int, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive integer, got %q", key, raw)
+	}
+	return n, nil
+}
+
+// WithQueryTimeout derives a context that expires after DB_QUERY_TIMEOUT_MS, for
+// queries on paths that must not hang when the database is slow.
+func WithQueryTimeout(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, queryTimeout)
+}
+
+// QueryTimeout returns the deadline WithQueryTimeout applies.
+func QueryTimeout() time.Duration {
+	return queryTimeout
+}
+
+// IsDBTimeout reports whether err came from a query that ran out of time, either on
+// its own deadline or while waiting for a connection.
+func IsDBTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err)
+}
@@ -0,0 +1,73 @@
+package util
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultHardPageLimit is the hard cap on any list endpoint's page size when
+// PAGE_LIMIT_MAX is unset.
+const defaultHardPageLimit = 200
+
+var hardPageLimit = defaultHardPageLimit
+
+// PageLimits are a list endpoint's default and maximum page sizes. Both are further
+// capped by PAGE_LIMIT_MAX.
+type PageLimits struct {
+	Default int
+	Max     int
+}
+
+// LoadPageLimits reads PAGE_LIMIT_MAX, the page size no list endpoint may exceed
+// whatever its own maximum. Call once at startup.
+func LoadPageLimits() error {
+	raw := os.Getenv("PAGE_LIMIT_MAX")
+	if raw == "" {
+		hardPageLimit = defaultHardPageLimit
+		return nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return fmt.Errorf("PAGE_LIMIT_MAX must be a positive integer, got %q", raw)
+	}
+	hardPageLimit = n
+	return nil
+}
+
+// ParsePage reads the limit and cursor query params of a list request. limit defaults
+// to limits.Default and is clamped to limits.Max and PAGE_LIMIT_MAX. A non-empty
+// cursor is decoded into cursor, which should hold the first page's position on entry.
+// It writes a 400 and returns false when either param is invalid.
+func ParsePage(c *gin.Context, limits PageLimits, cursor any) (int, bool) {
+	maxLimit := min(limits.Max, hardPageLimit)
+	limit := min(limits.Default, maxLimit)
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return 0, false
+		}
+		limit = min(n, maxLimit)
+	}
+	if raw := c.Query("cursor"); raw != "" {
+		b, err := base64.RawURLEncoding.DecodeString(raw)
+		if err != nil || json.Unmarshal(b, cursor) != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return 0, false
+		}
+	}
+	return limit, true
+}
+
+// EncodeCursor turns a page position into the opaque base64url JSON sent to clients
+// as next_cursor.
+func EncodeCursor(cursor any) string {
+	b, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,14 @@
+package util
+
+import (
+	"chat-app-server/metrics"
+	"log"
+	"runtime/debug"
+)
+
+// LogPanic logs a recovered panic with where it happened and the stack that raised
+// it, and counts it in metrics.RecoveredPanics. Call it from a deferred recover.
+func LogPanic(where string, recovered any) {
+	metrics.RecoveredPanics.Add(1)
+	log.Printf("Recovered panic in %s: %v\n%s", where, recovered, debug.Stack())
+}
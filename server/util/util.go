@@ -6,7 +6,11 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"log"
 	"math/big"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -65,6 +69,13 @@ func NullablePgTimestamp(s *time.Time) pgtype.Timestamp {
 	return pgtype.Timestamp{Time: *s, Valid: true}
 }
 
+func NullablePgBool(b *bool) pgtype.Bool {
+	if b == nil {
+		return pgtype.Bool{Valid: false}
+	}
+	return pgtype.Bool{Bool: *b, Valid: true}
+}
+
 func GenerateInviteCode(length int) (string, error) {
 	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	max := big.NewInt(int64(len(charset)))
@@ -78,3 +89,79 @@ func GenerateInviteCode(length int) (string, error) {
 	}
 	return string(result), nil
 }
+
+// GetEnvInt reads an integer environment variable, returning def when it is unset or invalid.
+func GetEnvInt(key string, def int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Printf("Invalid value for %s, using default %d: %v", key, def, err)
+		return def
+	}
+	return v
+}
+
+// GetEnvIntAtLeast reads an integer like GetEnvInt, raising values below min to min.
+func GetEnvIntAtLeast(key string, def int, min int) int {
+	v := GetEnvInt(key, def)
+	if v < min {
+		log.Printf("%s must be at least %d, using %d", key, min, min)
+		return min
+	}
+	return v
+}
+
+// likeEscaper escapes LIKE wildcards so a search term matches literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ContainsPattern turns a user-supplied search term into an ILIKE pattern matching
+// any value that contains it.
+func ContainsPattern(term string) string {
+	return "%" + likeEscaper.Replace(strings.TrimSpace(term)) + "%"
+}
+
+// NormalizeEmail trims and lowercases an email address. Stored emails and every
+// lookup go through it so addresses match regardless of how they were typed.
+func NormalizeEmail(raw string) string {
+	return strings.ToLower(strings.TrimSpace(raw))
+}
+
+// NormalizePhone reduces a phone number to E.164 form ("+" followed by 8-15 digits),
+// dropping common separators. Numbers without a country code are rejected.
+func NormalizePhone(raw string) (string, bool) {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(raw) {
+		switch {
+		case r == '+' && i == 0:
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '(' || r == ')' || r == '.':
+			continue
+		default:
+			return "", false
+		}
+	}
+	phone := b.String()
+	if !strings.HasPrefix(phone, "+") || len(phone) < 9 || len(phone) > 16 || phone[1] == '0' {
+		return "", false
+	}
+	return phone, true
+}
+
+// GetEnvBool reads a boolean environment variable, returning def when it is unset or invalid.
+func GetEnvBool(key string, def bool) bool {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Printf("Invalid value for %s, using default %t: %v", key, def, err)
+		return def
+	}
+	return v
+}
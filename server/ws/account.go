@@ -0,0 +1,267 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DeleteAccount permanently removes the authenticated user and everything tied to
+// them except their messages, which stay with no sender. Groups they leave behind are
+// settled the same way as in LeaveGroup.
+func (h *Handler) DeleteAccount(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.checkAccountPassword(c, user.ID, req.Password) {
+		return
+	}
+
+	if err := h.hub.PurgeAccount(ctx, user.ID); err != nil {
+		log.Printf("Error deleting account %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+}
+
+// DeactivateAccount hides the authenticated user and closes every connection they have
+// open on any instance, including ones a newer connection replaced, so none of them can
+// keep posting to the groups the account stays in.
+// The account is purged by the purge_deactivated_accounts job once the grace period
+// passes; logging in before then reactivates it.
+func (h *Handler) DeactivateAccount(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.checkAccountPassword(c, user.ID, req.Password) {
+		return
+	}
+
+	if err := h.db.DeactivateUser(ctx, user.ID); err != nil {
+		log.Printf("Error deactivating account %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate account"})
+		return
+	}
+	log.Printf("Account %s deactivated.", user.ID)
+
+	h.hub.DisconnectUser(user.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deactivated"})
+}
+
+// LeaveAllGroups removes the authenticated user from every group they belong to, one
+// group at a time with the same handling as LeaveGroup. A group that fails is logged
+// and reported in the result without stopping the rest.
+func (h *Handler) LeaveAllGroups(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	memberships, err := h.db.GetAllUserGroupsForUser(ctx, &user.ID)
+	if err != nil {
+		log.Printf("Error fetching memberships of user %s to leave all groups: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load groups"})
+		return
+	}
+
+	result := LeaveAllGroupsResult{Left: []uuid.UUID{}, Deleted: []uuid.UUID{}, Failed: []uuid.UUID{}}
+	for _, membership := range memberships {
+		if membership.GroupID == nil {
+			continue
+		}
+		groupID := *membership.GroupID
+		_, groupIsEmpty, err := h.leaveGroup(ctx, user.ID, groupID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Left concurrently, e.g. via LeaveGroup or a kick.
+			continue
+		}
+		if err != nil {
+			log.Printf("Error leaving group %s for user %s during leave-all: %v", groupID, user.ID, err)
+			result.Failed = append(result.Failed, groupID)
+			continue
+		}
+		h.announceDeparture(ctx, user.ID, groupID, groupIsEmpty)
+		result.Left = append(result.Left, groupID)
+		if groupIsEmpty {
+			result.Deleted = append(result.Deleted, groupID)
+		}
+	}
+	log.Printf("User %s left %d groups (%d deleted as empty, %d failed).", user.ID, len(result.Left), len(result.Deleted), len(result.Failed))
+
+	c.JSON(http.StatusOK, result)
+}
+
+// checkAccountPassword re-verifies the user's password before a destructive account
+// action. It writes the error response and returns false if the check fails.
+func (h *Handler) checkAccountPassword(c *gin.Context, userID uuid.UUID, password string) bool {
+	internalUser, err := h.db.GetUserByIdInternal(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Error loading credentials for account action by user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify password"})
+		return false
+	}
+	if !internalUser.Password.Valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Incorrect password"})
+		return false
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(internalUser.Password.String), []byte(password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Incorrect password"})
+		return false
+	}
+	return true
+}
+
+// PurgeAccount permanently deletes a user, their memberships and device keys, then
+// disconnects them and updates the hub. Their messages stay in the groups with no
+// sender, as messages.user_id is ON DELETE SET NULL. It backs DeleteAccount.
+func (h *Hub) PurgeAccount(ctx context.Context, userID uuid.UUID) error {
+	_, err := h.purgeAccount(ctx, userID, nil)
+	return err
+}
+
+// PurgeDeactivatedAccount is PurgeAccount for the purge_deactivated_accounts job. The
+// user row is locked and the deactivation re-checked against cutoff inside the purge
+// transaction, so an account reactivated after the job listed it is kept. It reports
+// whether the account was deleted.
+func (h *Hub) PurgeDeactivatedAccount(ctx context.Context, userID uuid.UUID, cutoff time.Time) (bool, error) {
+	return h.purgeAccount(ctx, userID, &cutoff)
+}
+
+// purgeAccount deletes userID, only if it has been deactivated since before
+// deactivatedBefore when that is set.
+func (h *Hub) purgeAccount(ctx context.Context, userID uuid.UUID, deactivatedBefore *time.Time) (bool, error) {
+	tx, err := h.pgxPool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	if deactivatedBefore != nil {
+		if _, err := qtx.LockUserDeactivatedBefore(ctx, db.LockUserDeactivatedBeforeParams{
+			ID:     userID,
+			Cutoff: pgtype.Timestamp{Time: *deactivatedBefore, Valid: true},
+		}); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return false, nil
+			}
+			return false, fmt.Errorf("lock user row: %w", err)
+		}
+	}
+
+	memberships, err := qtx.GetAllUserGroupsForUser(ctx, &userID)
+	if err != nil {
+		return false, fmt.Errorf("fetch memberships: %w", err)
+	}
+
+	leftGroupIDs := make([]uuid.UUID, 0, len(memberships))
+	var emptiedGroupIDs []uuid.UUID
+	for _, membership := range memberships {
+		if membership.GroupID == nil {
+			continue
+		}
+		groupID := *membership.GroupID
+		if _, err := qtx.DeleteUserGroup(ctx, db.DeleteUserGroupParams{UserID: &userID, GroupID: &groupID}); err != nil {
+			return false, fmt.Errorf("remove from group %s: %w", groupID, err)
+		}
+		groupIsEmpty, err := settleGroupAfterDeparture(ctx, qtx, groupID, userID, membership.Admin)
+		if err != nil {
+			return false, fmt.Errorf("settle group %s: %w", groupID, err)
+		}
+		leftGroupIDs = append(leftGroupIDs, groupID)
+		if groupIsEmpty {
+			emptiedGroupIDs = append(emptiedGroupIDs, groupID)
+		}
+	}
+
+	// user_groups references users without ON DELETE CASCADE, so it goes first.
+	// Receipts and token failures are keyed by push token and must be removed before
+	// the device keys.
+	if err := qtx.DeleteAllUserGroupsForUser(ctx, &userID); err != nil {
+		return false, fmt.Errorf("delete user_groups: %w", err)
+	}
+	if err := qtx.DeleteReceiptsForUser(ctx, userID); err != nil {
+		return false, fmt.Errorf("delete push receipts: %w", err)
+	}
+	if err := qtx.DeletePushTokenFailuresForUser(ctx, userID); err != nil {
+		return false, fmt.Errorf("delete push token failures: %w", err)
+	}
+	if err := qtx.DeleteAllDeviceKeysForUser(ctx, userID); err != nil {
+		return false, fmt.Errorf("delete device keys: %w", err)
+	}
+	if _, err := qtx.DeleteUser(ctx, userID); err != nil {
+		return false, fmt.Errorf("delete user row: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("commit: %w", err)
+	}
+	log.Printf("Account %s deleted; left %d groups, %d groups emptied.", userID, len(leftGroupIDs), len(emptiedGroupIDs))
+
+	h.DisconnectUser(userID)
+
+	for _, groupID := range leftGroupIDs {
+		select {
+		case h.RemoveUserFromGroupChan <- &RemoveClientFromGroupMsg{UserID: userID, GroupID: groupID}:
+		case <-ctx.Done():
+			log.Printf("Context cancelled while sending RemoveUserFromGroupChan for deleted user %s, group %s", userID, groupID)
+		default:
+			log.Printf("Warning: Hub RemoveUserFromGroupChan full for deleted user %s group %s. Update might be delayed or dropped.", userID, groupID)
+		}
+	}
+	for _, groupID := range emptiedGroupIDs {
+		select {
+		case h.DeleteHubGroupChan <- &DeleteHubGroupMsg{GroupID: groupID}:
+		case <-ctx.Done():
+			log.Printf("Context cancelled while sending DeleteHubGroupChan for group %s", groupID)
+		default:
+			log.Printf("Warning: Hub DeleteHubGroupChan full for group %s. Deletion might be delayed or dropped.", groupID)
+		}
+	}
+
+	// Best effort: the hub removes group membership sets above, and the client key
+	// would otherwise linger until its TTL expires.
+	userGroupsKey := redisUserGroupsPrefix + userID.String() + ":groups"
+	clientKey := redisClientServerPrefix + userID.String() + ":server_id"
+	if err := h.redisClient.Del(ctx, userGroupsKey, clientKey).Err(); err != nil {
+		log.Printf("Error cleaning up Redis state for deleted user %s: %v", userID, err)
+	}
+	return true, nil
+}
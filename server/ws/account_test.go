@@ -0,0 +1,71 @@
+package ws
+
+import (
+	"bytes"
+	"chat-app-server/db"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// deactivateDB is an accountDB that accepts DeactivateUser for its user.
+type deactivateDB struct {
+	accountDB
+	deactivated bool
+}
+
+func (d *deactivateDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if strings.Contains(sql, "-- name: DeactivateUser ") && args[0] == d.id {
+		d.deactivated = true
+		return pgconn.NewCommandTag("UPDATE 1"), nil
+	}
+	return d.accountDB.Exec(ctx, sql, args...)
+}
+
+func TestDeactivateAccountClosesEveryConnection(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse battery"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	hub := runTestHub(t)
+	phone, _ := dialTestClient(t)
+	tablet, _ := dialTestClient(t)
+	tablet.User = phone.User
+	tablet.DeviceIdentifier = "device-2"
+	database := &deactivateDB{accountDB: accountDB{id: phone.User.ID, password: string(hash)}}
+
+	// The tablet replaces the phone in Clients; the phone's socket stays open.
+	phoneDone := runConnection(hub, phone)
+	tabletDone := runConnection(hub, tablet)
+	for !registered(hub, tablet) {
+		time.Sleep(time.Millisecond)
+	}
+
+	body, _ := json.Marshal(DeleteAccountRequest{Password: "correct horse battery"})
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/users/me/deactivate", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("userID", database.id)
+	(&Handler{db: db.New(database), hub: hub}).DeactivateAccount(c)
+
+	if recorder.Code != http.StatusOK || !database.deactivated {
+		t.Fatalf("deactivate got status %d (deactivated %t): %s", recorder.Code, database.deactivated, recorder.Body)
+	}
+	for name, done := range map[string]<-chan struct{}{"replaced": phoneDone, "current": tabletDone} {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("deactivating the account left its %s connection open", name)
+		}
+	}
+}
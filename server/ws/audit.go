@@ -0,0 +1,120 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Actions recorded in audit_log.
+const (
+	auditMemberInvited     = "member_invited"
+	auditMemberRemoved     = "member_removed"
+	auditJoinApproved      = "join_request_approved"
+	auditJoinDenied        = "join_request_denied"
+	auditInviteLinkCreated = "invite_link_created"
+	auditGroupUpdated      = "group_updated"
+	auditSettingsUpdated   = "settings_updated"
+	auditAdminPromoted     = "admin_promoted"
+	auditGroupDeleted      = "group_deleted"
+)
+
+var auditLogPageLimits = util.PageLimits{Default: 50, Max: 200}
+
+// recordAudit appends an audit_log entry. Call it with the transaction's Queries so
+// the entry commits or rolls back with the action. details, if non-nil, is stored as
+// JSON (update actions store the request, i.e. only the fields that changed) and must
+// not contain secrets such as invite codes.
+func recordAudit(ctx context.Context, q *db.Queries, groupID, actorID uuid.UUID, action string, target *uuid.UUID, details any) error {
+	var detailsJSON []byte
+	if details != nil {
+		var err error
+		if detailsJSON, err = json.Marshal(details); err != nil {
+			return err
+		}
+	}
+	return q.InsertAuditLogEntry(ctx, db.InsertAuditLogEntryParams{
+		GroupID:      groupID,
+		ActorID:      &actorID,
+		Action:       action,
+		TargetUserID: target,
+		Details:      detailsJSON,
+	})
+}
+
+// auditCursor is the position after the last entry of a page, ordered by
+// (created_at, id) descending. It is sent to clients as opaque base64url JSON.
+type auditCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+}
+
+// GetGroupAuditLog serves GET /ws/groups/:groupID/audit?cursor=&limit=. Admin only.
+func (h *Handler) GetGroupAuditLog(c *gin.Context) {
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
+		return
+	}
+
+	// Start past every real entry.
+	cursor := auditCursor{CreatedAt: time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC), ID: uuid.Max}
+	limit, ok := util.ParsePage(c, auditLogPageLimits, &cursor)
+	if !ok {
+		return
+	}
+
+	if !h.requireGroupAdmin(c, user.ID, groupID) {
+		return
+	}
+
+	rows, err := h.db.GetGroupAuditLog(c.Request.Context(), db.GetGroupAuditLogParams{
+		GroupID:         groupID,
+		BeforeCreatedAt: pgtype.Timestamp{Time: cursor.CreatedAt, Valid: true},
+		BeforeID:        cursor.ID,
+		PageSize:        int32(limit),
+	})
+	if err != nil {
+		log.Printf("Error loading audit log for group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load audit log"})
+		return
+	}
+
+	page := AuditLogPage{Entries: make([]AuditLogEntry, 0, len(rows)), Limit: limit}
+	for _, row := range rows {
+		entry := AuditLogEntry{
+			ID:           row.ID,
+			Action:       row.Action,
+			ActorID:      row.ActorID,
+			TargetUserID: row.TargetUserID,
+			Details:      row.Details,
+			CreatedAt:    row.CreatedAt.Time,
+		}
+		if row.ActorUsername.Valid {
+			entry.ActorUsername = &row.ActorUsername.String
+		}
+		if row.TargetUsername.Valid {
+			entry.TargetUsername = &row.TargetUsername.String
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+	if len(rows) == limit {
+		last := rows[len(rows)-1]
+		page.NextCursor = util.EncodeCursor(auditCursor{CreatedAt: last.CreatedAt.Time, ID: last.ID})
+	}
+	c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,61 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var blockedUserPageLimits = util.PageLimits{Default: 50, Max: 100}
+
+// blockedUserCursor is the position after the last entry of a page, ordered by
+// (blocked_at, id) descending. It is sent to clients as opaque base64url JSON.
+type blockedUserCursor struct {
+	BlockedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+}
+
+// listBlockedUsersPage serves GET /ws/blocked-users?cursor=&limit=: a page of the
+// users the caller has blocked, for managing blocks from settings. Users who blocked
+// the caller are not listed.
+func (h *Handler) listBlockedUsersPage(c *gin.Context, user db.GetUserByIdRow) {
+	// Start past every real entry.
+	cursor := blockedUserCursor{BlockedAt: time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC), ID: uuid.Max}
+	limit, ok := util.ParsePage(c, blockedUserPageLimits, &cursor)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.GetBlockedUsersPage(c.Request.Context(), db.GetBlockedUsersPageParams{
+		BlockerID:       user.ID,
+		BeforeBlockedAt: pgtype.Timestamp{Time: cursor.BlockedAt, Valid: true},
+		BeforeID:        cursor.ID,
+		PageSize:        int32(limit),
+	})
+	if err != nil {
+		log.Printf("Error listing blocked users for %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve blocked users"})
+		return
+	}
+
+	page := BlockedUsersPage{BlockedUsers: make([]BlockedUser, 0, len(rows)), Limit: limit}
+	for _, row := range rows {
+		page.BlockedUsers = append(page.BlockedUsers, BlockedUser{
+			ID:        row.ID,
+			Username:  row.Username,
+			Email:     row.Email,
+			BlockedAt: row.BlockedAt.Time,
+		})
+	}
+	if len(rows) == limit {
+		last := rows[len(rows)-1]
+		page.NextCursor = util.EncodeCursor(blockedUserCursor{BlockedAt: last.BlockedAt.Time, ID: last.ID})
+	}
+	c.JSON(http.StatusOK, page)
+}
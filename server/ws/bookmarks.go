@@ -0,0 +1,167 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var bookmarkPageLimits = util.PageLimits{Default: 50, Max: 100}
+
+// bookmarkCursor is the position after the last bookmark of a page, ordered by
+// (bookmarked_at, message_id) descending. It is sent to clients as opaque base64url JSON.
+type bookmarkCursor struct {
+	BookmarkedAt time.Time `json:"t"`
+	MessageID    uuid.UUID `json:"id"`
+}
+
+// AddBookmark serves POST /ws/bookmarks/:messageID. Bookmarks are private to the
+// caller and nothing is broadcast. Bookmarking a message twice is a no-op.
+func (h *Handler) AddBookmark(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	messageID, err := uuid.Parse(c.Param("messageID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID format"})
+		return
+	}
+
+	// Same visibility rule as forwarding: a current member who joined before the
+	// message was sent, and the message hasn't expired.
+	message, err := h.db.GetForwardableMessage(ctx, db.GetForwardableMessageParams{
+		MessageID: messageID,
+		UserID:    &user.ID,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		} else {
+			log.Printf("Error loading message %s to bookmark for user %s: %v", messageID, user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to bookmark message"})
+		}
+		return
+	}
+	if message.GroupID == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+
+	if err := h.db.InsertUserBookmark(ctx, db.InsertUserBookmarkParams{
+		UserID:    user.ID,
+		MessageID: messageID,
+		GroupID:   *message.GroupID,
+	}); err != nil {
+		log.Printf("Error bookmarking message %s for user %s: %v", messageID, user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to bookmark message"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message_id": messageID, "group_id": *message.GroupID})
+}
+
+// RemoveBookmark serves DELETE /ws/bookmarks/:messageID.
+func (h *Handler) RemoveBookmark(c *gin.Context) {
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	messageID, err := uuid.Parse(c.Param("messageID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID format"})
+		return
+	}
+
+	removed, err := h.db.DeleteUserBookmark(c.Request.Context(), db.DeleteUserBookmarkParams{
+		UserID:    user.ID,
+		MessageID: messageID,
+	})
+	if err != nil {
+		log.Printf("Error removing bookmark of message %s for user %s: %v", messageID, user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove bookmark"})
+		return
+	}
+	if removed == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bookmark not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message_id": messageID})
+}
+
+// ListBookmarks serves GET /ws/bookmarks?cursor=&limit=: the caller's bookmarked
+// messages, most recently bookmarked first, encrypted for the client to decrypt.
+// Bookmarks in groups the caller has left, or of expired messages, are skipped.
+func (h *Handler) ListBookmarks(c *gin.Context) {
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	// Start past every real entry.
+	cursor := bookmarkCursor{BookmarkedAt: time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC), MessageID: uuid.Max}
+	limit, ok := util.ParsePage(c, bookmarkPageLimits, &cursor)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.GetUserBookmarksPage(c.Request.Context(), db.GetUserBookmarksPageParams{
+		UserID:             user.ID,
+		BeforeBookmarkedAt: pgtype.Timestamp{Time: cursor.BookmarkedAt, Valid: true},
+		BeforeMessageID:    cursor.MessageID,
+		PageSize:           int32(limit),
+	})
+	if err != nil {
+		log.Printf("Error listing bookmarks for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve bookmarks"})
+		return
+	}
+
+	page := BookmarksPage{Bookmarks: make([]Bookmark, 0, len(rows)), Limit: limit}
+	for _, row := range rows {
+		var envelopes []Envelope
+		if err := json.Unmarshal(row.KeyEnvelopes, &envelopes); err != nil {
+			log.Printf("Error unmarshalling key_envelopes for bookmarked message %s: %v", row.MessageID, err)
+			continue
+		}
+		message := RawMessageE2EE{
+			ID:             row.MessageID,
+			GroupID:        row.GroupID,
+			SenderDeviceID: row.SenderDeviceIdentifier.String,
+			SenderUsername: row.SenderUsername.String,
+			MsgNonce:       base64.StdEncoding.EncodeToString(row.MsgNonce),
+			Ciphertext:     base64.StdEncoding.EncodeToString(row.Ciphertext),
+			Signature:      base64.StdEncoding.EncodeToString(row.Signature),
+			MessageType:    row.MessageType,
+			Timestamp:      row.SentAt.Time.Format(time.RFC3339Nano),
+			Envelopes:      envelopes,
+		}
+		if row.SenderID != nil {
+			message.SenderID = *row.SenderID
+		}
+		if row.ExpiresAt.Valid {
+			message.ExpiresAt = &row.ExpiresAt.Time
+		}
+		page.Bookmarks = append(page.Bookmarks, Bookmark{Message: message, BookmarkedAt: row.BookmarkedAt.Time})
+	}
+	if len(rows) == limit {
+		last := rows[len(rows)-1]
+		page.NextCursor = util.EncodeCursor(bookmarkCursor{BookmarkedAt: last.BookmarkedAt.Time, MessageID: last.MessageID})
+	}
+	c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,234 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// broadcastShardQueueSize is the buffer of each shard. A client whose message finds
+// its group's shard full gets a server_busy nack.
+const broadcastShardQueueSize = 64
+
+// startBroadcastWorkers starts one goroutine per shard to persist and publish chat
+// messages. Messages are sharded by group ID, so a busy group (or a slow insert) only
+// delays the groups that share its shard while each group's messages stay in order.
+func (h *Hub) startBroadcastWorkers(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	h.broadcastShards = make([]chan *RawMessageE2EE, workers)
+	for i := range h.broadcastShards {
+		h.broadcastShards[i] = make(chan *RawMessageE2EE, broadcastShardQueueSize)
+		go h.broadcastWorker(h.broadcastShards[i])
+	}
+}
+
+// broadcastShard returns the queue that handles groupID's messages.
+func (h *Hub) broadcastShard(groupID uuid.UUID) chan<- *RawMessageE2EE {
+	hash := fnv.New32a()
+	hash.Write(groupID[:])
+	return h.broadcastShards[hash.Sum32()%uint32(len(h.broadcastShards))]
+}
+
+func (h *Hub) broadcastWorker(queue <-chan *RawMessageE2EE) {
+	for {
+		select {
+		case message := <-queue:
+			h.persistSafely(message)
+		case <-h.ctx.Done():
+			return
+		}
+	}
+}
+
+// persistSafely runs persistAndPublish, recovering from a panic so the shard's worker
+// keeps serving its other groups. The sender gets an internal_error nack.
+func (h *Hub) persistSafely(message *RawMessageE2EE) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			util.LogPanic("broadcast worker for message "+message.ID.String(), recovered)
+			h.ackSender(message, "message_nack", "internal_error")
+		}
+	}()
+	h.persistAndPublish(message)
+}
+
+// persistAndPublish saves a chat message, acks the sender, publishes it to the group's
+// Pub/Sub channel for delivery and queues push notifications.
+func (h *Hub) persistAndPublish(message *RawMessageE2EE) {
+	cipherBytes, err := base64.StdEncoding.DecodeString(message.Ciphertext)
+	if err != nil {
+		log.Printf("Error decoding ciphertext base64 for message in group %s: %v", message.GroupID, err)
+		h.ackSender(message, "message_nack", "invalid_payload")
+		return
+	}
+	nonceBytes, err := base64.StdEncoding.DecodeString(message.MsgNonce)
+	if err != nil {
+		log.Printf("Error decoding msgNonce base64 for message in group %s: %v", message.GroupID, err)
+		h.ackSender(message, "message_nack", "invalid_payload")
+		return
+	}
+	signatureBytes, err := base64.StdEncoding.DecodeString(message.Signature)
+	if err != nil {
+		log.Printf("Error decoding signature base64 for message in group %s: %v", message.GroupID, err)
+		h.ackSender(message, "message_nack", "invalid_payload")
+		return
+	}
+
+	keyEnvelopesJSON, err := json.Marshal(message.Envelopes)
+	if err != nil {
+		log.Printf("Error marshalling key_envelopes for message in group %s: %v", message.GroupID, err)
+		h.ackSender(message, "message_nack", "invalid_payload")
+		return
+	}
+
+	insertParams := db.InsertMessageParams{
+		ID:           message.ID,
+		UserID:       &message.SenderID,
+		GroupID:      &message.GroupID,
+		Ciphertext:   cipherBytes,
+		MessageType:  message.MessageType,
+		MsgNonce:     nonceBytes,
+		KeyEnvelopes: keyEnvelopesJSON,
+		SenderDeviceIdentifier: pgtype.Text{
+			String: message.SenderDeviceID,
+			Valid:  message.SenderDeviceID != "",
+		},
+		Signature: signatureBytes,
+	}
+	if message.ForwardedFrom != nil {
+		insertParams.ForwardedFromMessageID = &message.ForwardedFrom.MessageID
+		insertParams.ForwardedFromGroupID = &message.ForwardedFrom.GroupID
+		insertParams.ForwardedFromSenderID = &message.ForwardedFrom.SenderID
+	}
+	if message.ExpiresAt != nil {
+		insertParams.ExpiresAt = pgtype.Timestamp{Time: message.ExpiresAt.UTC(), Valid: true}
+	}
+
+	// A sender_seq is recorded in the same transaction as the message, so a message that
+	// isn't stored doesn't use up its counter and can be retried with it. An image
+	// message claims its sender's uploads and mentions are saved in the same
+	// transaction too, so a nacked retry doesn't find half of the message stored.
+	// Storing is bounded by DB_QUERY_TIMEOUT_MS so a slow database can't stall the
+	// worker, and with it every other group on this shard.
+	ctx, cancel := util.WithQueryTimeout(h.ctx)
+	defer cancel()
+
+	queries := h.db
+	var tx pgx.Tx
+	if message.SenderSeq != nil || message.MessageType == db.MessageTypeImage || len(message.Mentions) > 0 {
+		tx, err = h.pgxPool.Begin(ctx)
+		if err != nil {
+			log.Printf("Error starting transaction for message in group %s: %v", message.GroupID, err)
+			h.ackSender(message, "message_nack", persistFailureReason(err))
+			return
+		}
+		defer tx.Rollback(h.ctx)
+		queries = h.db.WithTx(tx)
+	}
+
+	savedMessage, err := queries.InsertMessage(ctx, insertParams)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The ID is taken, most likely by an earlier attempt of this same message.
+		h.ackDuplicate(message)
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving E2EE message: %v", err)
+		h.ackSender(message, "message_nack", persistFailureReason(err))
+		return
+	}
+
+	if tx != nil {
+		if message.MessageType == db.MessageTypeImage {
+			// Only uploads the sender presigned for this message ID are claimed; anything
+			// else stays unbound and is removed by cleanup_orphaned_attachments.
+			if _, err := queries.BindMessageAttachments(ctx, db.BindMessageAttachmentsParams{
+				MessageID:  message.ID,
+				GroupID:    message.GroupID,
+				UploaderID: &message.SenderID,
+			}); err != nil {
+				log.Printf("Error binding attachments of message %s: %v", message.ID, err)
+				h.ackSender(message, "message_nack", persistFailureReason(err))
+				return
+			}
+		}
+		if len(message.Mentions) > 0 {
+			if err := queries.InsertMessageMentions(ctx, db.InsertMessageMentionsParams{
+				MessageID: savedMessage.ID,
+				UserIds:   message.Mentions,
+				GroupID:   message.GroupID,
+			}); err != nil {
+				log.Printf("Error saving mentions for message %s: %v", savedMessage.ID, err)
+				h.ackSender(message, "message_nack", persistFailureReason(err))
+				return
+			}
+		}
+		if message.SenderSeq != nil {
+			reason, last, err := h.advanceSenderSeq(ctx, queries, message)
+			if err != nil {
+				log.Printf("Error recording sender_seq for message %s: %v", message.ID, err)
+				h.ackSender(message, "message_nack", persistFailureReason(err))
+				return
+			}
+			if reason != "" {
+				log.Printf("Rejecting message %s from user %s: sender_seq %d after %d (%s)",
+					message.ID, message.SenderID, *message.SenderSeq, last, reason)
+				h.nackSenderSeq(message, reason, last)
+				return
+			}
+		}
+		if err := tx.Commit(ctx); err != nil {
+			log.Printf("Error committing message %s: %v", message.ID, err)
+			h.ackSender(message, "message_nack", persistFailureReason(err))
+			return
+		}
+	}
+
+	message.ID = savedMessage.ID
+	message.Timestamp = savedMessage.CreatedAt.Time.Format(time.RFC3339Nano)
+	h.ackSender(message, "message_ack", "")
+
+	payload := ChatMessagePayload{Message: message}
+	pubSubMsg := PubSubMessage{
+		Type:           "chat_message",
+		Payload:        payload,
+		OriginServerID: h.serverID,
+	}
+	serializedMsg, err := json.Marshal(pubSubMsg)
+	if err != nil {
+		log.Printf("Hub %s: Error marshalling E2EE chat message for PubSub: %v", h.serverID, err)
+		return
+	}
+	channel := pubSubGroupMessagesChannel + ":" + message.GroupID.String()
+	if err := h.redisClient.Publish(h.ctx, channel, serializedMsg).Err(); err != nil {
+		log.Printf("Hub %s: Error publishing E2EE message to Redis PubSub channel %s: %v", h.serverID, channel, err)
+	} else {
+		log.Printf("Hub %s: Published E2EE message for group %s to Redis PubSub channel %s", h.serverID, message.GroupID.String(), channel)
+	}
+
+	// Send push notifications to offline users via the worker pool
+	if h.pushEnabled {
+		h.enqueueNotification(message)
+	}
+}
+
+// persistFailureReason is the nack reason for a message that could not be stored:
+// server_busy when the database timed out, so the client retries, otherwise
+// persist_failed.
+func persistFailureReason(err error) string {
+	if util.IsDBTimeout(err) {
+		return "server_busy"
+	}
+	return "persist_failed"
+}
@@ -1,8 +1,8 @@
 package ws
 
 import (
+	"chat-app-server/auth"
 	"chat-app-server/db"
-	"chat-app-server/util"
 	"context"
 	"crypto/ed25519"
 	"encoding/base64"
@@ -13,45 +13,104 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type Client struct {
-	conn             *websocket.Conn
-	Message          chan *RawMessageE2EE
-	Events           chan *ClientEvent
-	Groups           map[uuid.UUID]bool
+	conn *websocket.Conn
+	// connID identifies this connection in the user's cluster-wide connection set.
+	connID  string
+	Message chan *RawMessageE2EE
+	Events  chan *ClientEvent
+	Acks    chan *MessageAck
+	Control chan *ServerResponseMessage
+	Sync    chan *MembershipDelta
+	Typing  chan *TypingSnapshot
+	Groups  map[uuid.UUID]bool
+	// permissions caches posting permissions for groups in Groups; see permissions.go.
+	permissions map[uuid.UUID]cachedPermission
+	// devices caches the member devices of groups in Groups; see group_devices.go.
+	devices          map[uuid.UUID]cachedDevices
 	DeviceIdentifier string
 	SigningPublicKey ed25519.PublicKey
 	User             *db.GetUserByIdRow `json:"user"`
 	mutex            sync.RWMutex
 	ctx              context.Context
 	cancel           context.CancelFunc
+	// tokenExpiresAt is the exp of the JWT the connection last authenticated with.
+	// reauthRequested records that token_expiring and reauth_required were sent for that token.
+	tokenExpiresAt  time.Time
+	reauthRequested bool
+	// suspended is set, under the hub's lock, while the connection is gone but the
+	// client is kept for a fast reconnect; resumeTimer ends the suspension.
+	suspended   bool
+	resumeTimer *time.Timer
+	// closedNormally is set by the read loop when the peer closed with 1000, which
+	// means it is not coming back and the client is not suspended.
+	closedNormally bool
+	// lostOutbound records that a payload was dropped or failed to write, so a resumed
+	// session must resync instead of trusting the replayed backlog.
+	lostOutbound atomic.Bool
+	// dropLog and busyLog throttle logging of dropped payloads and server_busy nacks;
+	// see drops.go.
+	dropLog logThrottle
+	busyLog logThrottle
+	// lastPong is when the read loop last heard a pong (UnixNano); see reapStaleClients.
+	lastPong atomic.Int64
+	// protocolVersion is the negotiated WebSocket protocol version; see protocol.go.
+	protocolVersion int
+	// idleTimeout closes the connection after this long without inbound application
+	// messages (0 disables it); lastActivity is when the last one arrived (UnixNano).
+	// See idle.go.
+	idleTimeout  time.Duration
+	lastActivity atomic.Int64
 }
 
+// writeWait bounds each write to the socket. It is a variable so tests can shorten it.
+var writeWait = 10 * time.Second
+
 const (
-	writeWait      = 10 * time.Second
-	pongWait       = 60 * time.Second
-	pingPeriod     = (pongWait * 9) / 10
-	maxMessageSize = 16 * 1024
+	pongWait   = 60 * time.Second
+	pingPeriod = (pongWait * 9) / 10
+	// reauthLead is how long before the token expires the client is asked to reauthenticate.
+	reauthLead = 5 * time.Minute
+	// maxMentionsPerMessage caps the plaintext mention list on a single message.
+	maxMentionsPerMessage = 50
+	// maxMessageBatch caps how many chat messages one message_batch frame carries.
+	maxMessageBatch = 32
 )
 
-func NewClient(conn *websocket.Conn, user *db.GetUserByIdRow, deviceIdentifier string, signingPublicKey ed25519.PublicKey) *Client {
+func NewClient(conn *websocket.Conn, user *db.GetUserByIdRow, deviceIdentifier string, signingPublicKey ed25519.PublicKey, tokenExpiresAt time.Time, protocolVersion int, idleTimeout time.Duration) *Client {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Client{
+	client := &Client{
 		conn:             conn,
+		connID:           uuid.NewString(),
 		Message:          make(chan *RawMessageE2EE, 10),
 		Events:           make(chan *ClientEvent, 20),
+		Acks:             make(chan *MessageAck, 20),
+		Control:          make(chan *ServerResponseMessage, 4),
+		Sync:             make(chan *MembershipDelta, 1),
+		Typing:           make(chan *TypingSnapshot, 8),
 		Groups:           make(map[uuid.UUID]bool),
+		permissions:      make(map[uuid.UUID]cachedPermission),
+		devices:          make(map[uuid.UUID]cachedDevices),
 		DeviceIdentifier: deviceIdentifier,
 		SigningPublicKey: signingPublicKey,
 		User:             user,
+		protocolVersion:  protocolVersion,
 		ctx:              ctx,
 		cancel:           cancel,
+		tokenExpiresAt:   tokenExpiresAt,
+		idleTimeout:      idleTimeout,
 	}
+	client.markActive()
+	return client
 }
 
 func (c *Client) AddGroup(groupID uuid.UUID) {
@@ -64,43 +123,118 @@ func (c *Client) RemoveGroup(groupID uuid.UUID) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	delete(c.Groups, groupID)
+	delete(c.permissions, groupID)
+	delete(c.devices, groupID)
+}
+
+// Disconnect sends a close frame and tears down the connection, which unblocks
+// ReadMessage so the normal unregister path runs.
+func (c *Client) Disconnect(closeCode int, reason string) {
+	c.cancel()
+	deadline := time.Now().Add(writeWait)
+	if err := c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, reason), deadline); err != nil {
+		log.Printf("Client %s (%s): Error sending close frame: %v", c.User.ID.String(), c.User.Username, err)
+	}
+	c.conn.Close()
+}
+
+// closeChannels tells the writer the client is gone. Only the hub calls it, with its
+// lock held for writing, so senders holding the read lock never see a closed channel.
+func (c *Client) closeChannels() {
+	close(c.Message)
+	close(c.Events)
+	close(c.Acks)
+	close(c.Control)
+	close(c.Sync)
+	close(c.Typing)
+}
+
+// writeOutbound serializes one queued payload onto the socket. It returns false if the
+// connection should be abandoned.
+func (c *Client) writeOutbound(out Outbound) bool {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+		log.Printf("Client %s (%s): Error setting write deadline: %v", c.User.ID, c.User.Username, err)
+		return false
+	}
+	if err := c.conn.WriteJSON(out); err != nil {
+		log.Printf("Client %s (%s): Error writing %s: %v", c.User.ID, c.User.Username, out.describe(), err)
+		c.lostOutbound.Store(true)
+		return false
+	}
+	return true
+}
+
+// writeMessages writes first along with any chat messages already queued behind it.
+// Clients that support message_batch get them in one frame; a backlog only builds up
+// during catch-up (a burst, or a resumed connection's queue), so steady-state delivery
+// stays one frame per message.
+func (c *Client) writeMessages(first *RawMessageE2EE) bool {
+	if len(c.Message) == 0 || !c.supportsEvent("message_batch") {
+		return c.writeOutbound(first)
+	}
+	batch := &MessageBatch{Type: "message_batch", Messages: []*RawMessageE2EE{first}}
+drain:
+	for len(batch.Messages) < maxMessageBatch {
+		select {
+		case next, ok := <-c.Message:
+			if !ok {
+				// The writer loop sees the closed channel next and sends the close frame.
+				break drain
+			}
+			batch.Messages = append(batch.Messages, next)
+		default:
+			break drain
+		}
+	}
+	return c.writeOutbound(batch)
 }
 
+// WriteMessage drains the client's outbound channels onto the socket until the hub
+// closes them, the client's context ends, or a write fails.
 func (c *Client) WriteMessage() {
 	ticker := time.NewTicker(pingPeriod)
+	var idleWarnedFor int64
 	defer func() {
 		ticker.Stop()
+		// After a failed write nothing more will reach the client, so close the socket:
+		// ReadMessage fails at once and the hub unregisters the client, rather than
+		// waiting up to pongWait for the read deadline. The context is left to the hub,
+		// since cancelling it here would mark the close as deliberate and skip the
+		// reconnect grace in suspendClientLocked.
+		c.conn.Close()
 		log.Printf("WriteMessage goroutine for client %d (%s) exiting.", c.User.ID, c.User.Username)
 	}()
 
 	for {
 		select {
 		case message, ok := <-c.Message:
-			if err := c.conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
-				log.Printf("Client %d (%s): Error setting write deadline: %v", c.User.ID, c.User.Username, err)
-				return
-			}
 			if !ok {
 				log.Printf("Client %d (%s) message channel closed by hub.", c.User.ID, c.User.Username)
+				c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
-
-			err := c.conn.WriteJSON(message)
-			if err != nil {
-				log.Printf("Error writing JSON (E2EE) for client %d (%s): %v", c.User.ID, c.User.Username, err)
+			if !c.writeMessages(message) {
 				return
 			}
 		case event, ok := <-c.Events:
-			if !ok {
+			if !ok || !c.writeOutbound(event) {
 				return
 			}
-			if err := c.conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
-				log.Printf("Client %d (%s): Error setting write deadline for event: %v", c.User.ID, c.User.Username, err)
+		case ack, ok := <-c.Acks:
+			if !ok || !c.writeOutbound(ack) {
+				return
+			}
+		case control, ok := <-c.Control:
+			if !ok || !c.writeOutbound(control) {
+				return
+			}
+		case delta, ok := <-c.Sync:
+			if !ok || !c.writeOutbound(delta) {
 				return
 			}
-			if err := c.conn.WriteJSON(event); err != nil {
-				log.Printf("Error writing event JSON for client %d (%s): %v", c.User.ID, c.User.Username, err)
+		case typing, ok := <-c.Typing:
+			if !ok || !c.writeOutbound(typing) {
 				return
 			}
 		case <-ticker.C:
@@ -108,6 +242,42 @@ func (c *Client) WriteMessage() {
 				log.Printf("Client %d (%s): Error setting write deadline for ping: %v", c.User.ID, c.User.Username, err)
 				return
 			}
+			expiresAt, requestReauth, expired := c.checkTokenExpiry()
+			if expired {
+				log.Printf("Client %s (%s): Token expired without reauth, closing connection.", c.User.ID, c.User.Username)
+				// Same reason code as a rejected auth, so the client asks for a new login
+				// instead of reconnecting with the expired token.
+				if err := c.conn.WriteJSON(ServerResponseMessage{Type: "auth_failure", Error: "Token expired", Reason: authReasonTokenExpired}); err != nil {
+					log.Printf("Error sending token_expired auth_failure for client %s (%s): %v", c.User.ID, c.User.Username, err)
+				}
+				c.Disconnect(websocket.ClosePolicyViolation, "Token expired")
+				return
+			}
+			if requestReauth {
+				expiry := expiresAt.UTC().Format(time.RFC3339)
+				if c.supportsEvent("token_expiring") {
+					if err := c.conn.WriteJSON(ServerResponseMessage{Type: "token_expiring", Message: expiry}); err != nil {
+						log.Printf("Error sending token_expiring for client %s (%s): %v", c.User.ID, c.User.Username, err)
+						return
+					}
+				}
+				if err := c.conn.WriteJSON(ServerResponseMessage{Type: "reauth_required", Message: expiry}); err != nil {
+					log.Printf("Error sending reauth_required for client %s (%s): %v", c.User.ID, c.User.Username, err)
+					return
+				}
+			}
+			warnIdle, idle := c.checkIdle(&idleWarnedFor)
+			if idle {
+				log.Printf("Client %s (%s): Idle for %s, closing connection.", c.User.ID, c.User.Username, c.idleTimeout)
+				c.Disconnect(websocket.CloseNormalClosure, "Idle timeout")
+				return
+			}
+			if warnIdle && c.supportsEvent("idle_warning") {
+				if err := c.conn.WriteJSON(ClientEvent{Type: "group_event", Event: "idle_warning"}); err != nil {
+					log.Printf("Error sending idle_warning for client %s (%s): %v", c.User.ID, c.User.Username, err)
+					return
+				}
+			}
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				log.Printf("Error sending ping for client %d (%s): %v", c.User.ID, c.User.Username, err)
 				return
@@ -124,13 +294,16 @@ func (c *Client) ReadMessage(hub *Hub, queries *db.Queries) {
 		log.Printf("ReadMessage loop for client %d (%s) exiting.", c.User.ID, c.User.Username)
 	}()
 
-	c.conn.SetReadLimit(maxMessageSize)
+	// The frame limit is the largest per-type limit; anything bigger still closes the connection.
+	c.conn.SetReadLimit(int64(hub.messageSizeLimits.frameLimit()))
+	c.lastPong.Store(time.Now().UnixNano())
 	if err := c.conn.SetReadDeadline(time.Now().Add(pongWait)); err != nil {
 		log.Printf("Client %d (%s): Error setting initial read deadline: %v", c.User.ID, c.User.Username, err)
 		return
 	}
 	c.conn.SetPongHandler(func(string) error {
 		log.Printf("Client %d (%s) received pong.", c.User.ID, c.User.Username)
+		c.lastPong.Store(time.Now().UnixNano())
 		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	})
 
@@ -142,9 +315,9 @@ func (c *Client) ReadMessage(hub *Hub, queries *db.Queries) {
 		default:
 		}
 
-		var clientMsg ClientSentE2EMessage
-		err := c.conn.ReadJSON(&clientMsg)
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
+			c.closedNormally = websocket.IsCloseError(err, websocket.CloseNormalClosure)
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNormalClosure, websocket.CloseNoStatusReceived) {
 				log.Printf("Client %d (%s): Unexpected WebSocket close error: %v", c.User.ID, c.User.Username, err)
 			} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
@@ -158,46 +331,179 @@ func (c *Client) ReadMessage(hub *Hub, queries *db.Queries) {
 			}
 			return
 		}
+
+		c.markActive()
+
+		// Check the size against the limit for the declared type before decoding the envelopes.
+		var header clientMessageHeader
+		if err := json.Unmarshal(data, &header); err != nil {
+			log.Printf("Client %s (%s): Received malformed message: %v. Discarding.", c.User.ID, c.User.Username, err)
+			continue
+		}
+		if header.Type == "keepalive" {
+			// Only resets the idle timeout.
+			continue
+		}
+		if header.Type == "typing" {
+			var typingMsg ClientTypingMessage
+			if err := json.Unmarshal(data, &typingMsg); err == nil {
+				hub.setTyping(c, typingMsg.GroupID, typingMsg.Typing)
+			}
+			continue
+		}
+		if header.Type == "reauth" {
+			var reauthMsg AuthMessage
+			if err := json.Unmarshal(data, &reauthMsg); err != nil {
+				c.Send(&ServerResponseMessage{Type: "reauth_failure", Error: "Invalid reauth message."})
+				continue
+			}
+			c.reauthenticate(reauthMsg.Token)
+			continue
+		}
+		if !hub.messageTypes[header.MessageType] {
+			log.Printf("Client %s (%s): message %s has unsupported messageType %q. Discarding.",
+				c.User.ID, c.User.Username, header.ID, header.MessageType)
+			c.nack(header.ID, header.GroupID, "unsupported_message_type")
+			continue
+		}
+		if nack := hub.checkMessageSize(header.ID, header.GroupID, header.MessageType, len(data)); nack != nil {
+			log.Printf("Client %s (%s): %s message %s is %d bytes, over the %d byte limit. Discarding.",
+				c.User.ID, c.User.Username, header.MessageType, header.ID, len(data), nack.MaxBytes)
+			c.Send(nack)
+			continue
+		}
+		var clientMsg ClientSentE2EMessage
+		if err := json.Unmarshal(data, &clientMsg); err != nil {
+			log.Printf("Client %s (%s): Failed to decode message %s: %v. Discarding.", c.User.ID, c.User.Username, header.ID, err)
+			c.nack(header.ID, header.GroupID, "invalid_payload")
+			continue
+		}
 		if clientMsg.ID == uuid.Nil {
 			log.Printf("Client %d (%s): Received E2EE message with missing ID. Discarding.", c.User.ID, c.User.Username)
 			continue
 		}
+		if hub.InMaintenance() {
+			c.nack(clientMsg.ID, clientMsg.GroupID, "maintenance")
+			continue
+		}
 		if strings.TrimSpace(clientMsg.Signature) == "" {
 			log.Printf("Client %d (%s): Received E2EE message with missing signature. Discarding.", c.User.ID, c.User.Username)
+			c.nack(clientMsg.ID, clientMsg.GroupID, "missing_signature")
+			continue
+		}
+		if nack := hub.checkEnvelopeShape(clientMsg); nack != nil {
+			log.Printf("Client %s (%s): Message %s has %d envelopes, rejecting: %s.",
+				c.User.ID, c.User.Username, clientMsg.ID, len(clientMsg.Envelopes), nack.Reason)
+			c.Send(nack)
 			continue
 		}
 		signatureBytes, err := base64.StdEncoding.DecodeString(clientMsg.Signature)
 		if err != nil || len(signatureBytes) != ed25519.SignatureSize {
 			log.Printf("Client %d (%s): Invalid signature encoding/length for message %s. Discarding.", c.User.ID, c.User.Username, clientMsg.ID)
+			c.nack(clientMsg.ID, clientMsg.GroupID, "invalid_signature")
 			continue
 		}
 
-		isMember, err := util.UserInGroup(c.ctx, c.User.ID, clientMsg.GroupID, queries)
+		permission, err := c.postingPermission(queries, clientMsg.GroupID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Non-members get the same answer as for a missing group, so the nack doesn't
+			// reveal which group IDs exist.
+			log.Printf("Client %s (%s) sent E2EE message to group %s it isn't a member of. Discarding.", c.User.ID, c.User.Username, clientMsg.GroupID)
+			c.nack(clientMsg.ID, clientMsg.GroupID, "group_not_found")
+			continue
+		}
 		if err != nil {
 			log.Printf("Client %d (%s): DB error checking group %d authorization for E2EE message: %v. Discarding.",
 				c.User.ID, c.User.Username, clientMsg.GroupID, err)
+			c.nack(clientMsg.ID, clientMsg.GroupID, "internal_error")
 			continue
 		}
-
-		if !isMember {
-			log.Printf("Client %d (%s) attempted to send E2EE message to unauthorized group %d. Discarding.",
-				c.User.ID, c.User.Username, clientMsg.GroupID)
+		if nack := hub.checkPostingPermission(clientMsg, permission); nack != nil {
+			log.Printf("Client %d (%s): Message to group %s rejected: %s.",
+				c.User.ID, c.User.Username, clientMsg.GroupID, nack.Reason)
+			c.Send(nack)
 			continue
 		}
 		if len(c.SigningPublicKey) != ed25519.PublicKeySize {
 			log.Printf("Client %d (%s): Missing/invalid signing public key in session for device %s. Discarding message %s.",
 				c.User.ID, c.User.Username, c.DeviceIdentifier, clientMsg.ID)
+			c.nack(clientMsg.ID, clientMsg.GroupID, "invalid_signature")
 			continue
 		}
 		canonicalPayload, err := buildCanonicalSignedPayload(clientMsg, c.User.ID, c.DeviceIdentifier)
 		if err != nil {
 			log.Printf("Client %d (%s): Failed to build canonical payload for message %s: %v. Discarding.",
 				c.User.ID, c.User.Username, clientMsg.ID, err)
+			c.nack(clientMsg.ID, clientMsg.GroupID, "internal_error")
 			continue
 		}
 		if !ed25519.Verify(c.SigningPublicKey, []byte(canonicalPayload), signatureBytes) {
 			log.Printf("Client %d (%s): Signature verification failed for message %s in group %s. Discarding.",
 				c.User.ID, c.User.Username, clientMsg.ID, clientMsg.GroupID)
+			c.nack(clientMsg.ID, clientMsg.GroupID, "invalid_signature")
+			continue
+		}
+
+		deviceIDs, err := c.groupDevices(queries, clientMsg.GroupID, hub.enforceEnvelopeCoverage)
+		if err != nil {
+			log.Printf("Client %d (%s): DB error loading group devices for message %s: %v. Discarding.",
+				c.User.ID, c.User.Username, clientMsg.ID, err)
+			c.nack(clientMsg.ID, clientMsg.GroupID, "internal_error")
+			continue
+		}
+		if nack := hub.checkEnvelopeCoverage(clientMsg, deviceIDs); nack != nil {
+			log.Printf("Client %s (%s): Message %s has %d envelopes for %d member devices, rejecting: %s.",
+				c.User.ID, c.User.Username, clientMsg.ID, len(clientMsg.Envelopes), len(deviceIDs), nack.Reason)
+			c.Send(nack)
+			continue
+		}
+
+		mentions, reason, err := validateMentions(c.ctx, queries, clientMsg, c.User.ID)
+		if err != nil {
+			log.Printf("Client %d (%s): DB error validating mentions for message %s: %v. Discarding.",
+				c.User.ID, c.User.Username, clientMsg.ID, err)
+			c.nack(clientMsg.ID, clientMsg.GroupID, "internal_error")
+			continue
+		}
+		if reason != "" {
+			log.Printf("Client %d (%s): Rejecting message %s: %s.", c.User.ID, c.User.Username, clientMsg.ID, reason)
+			c.nack(clientMsg.ID, clientMsg.GroupID, reason)
+			continue
+		}
+
+		forwardedFrom, reason, err := resolveForwardedFrom(c.ctx, queries, clientMsg, c.User.ID)
+		if err != nil {
+			log.Printf("Client %d (%s): DB error checking forward source for message %s: %v. Discarding.",
+				c.User.ID, c.User.Username, clientMsg.ID, err)
+			c.nack(clientMsg.ID, clientMsg.GroupID, "internal_error")
+			continue
+		}
+		if reason != "" {
+			log.Printf("Client %d (%s): Rejecting message %s: %s.", c.User.ID, c.User.Username, clientMsg.ID, reason)
+			c.nack(clientMsg.ID, clientMsg.GroupID, reason)
+			continue
+		}
+
+		if clientMsg.SenderSeq != nil && *clientMsg.SenderSeq < 1 {
+			c.nack(clientMsg.ID, clientMsg.GroupID, "invalid_payload")
+			continue
+		}
+		if reason := validateExpiry(clientMsg.ExpiresAt, hub.maxMessageExpiry); reason != "" {
+			log.Printf("Client %d (%s): Rejecting message %s: %s.", c.User.ID, c.User.Username, clientMsg.ID, reason)
+			c.nack(clientMsg.ID, clientMsg.GroupID, reason)
+			continue
+		}
+
+		reactionAuthorID, reason, err := resolveReactionAuthor(c.ctx, queries, clientMsg)
+		if err != nil {
+			log.Printf("Client %d (%s): DB error checking reaction target for message %s: %v. Discarding.",
+				c.User.ID, c.User.Username, clientMsg.ID, err)
+			c.nack(clientMsg.ID, clientMsg.GroupID, "internal_error")
+			continue
+		}
+		if reason != "" {
+			log.Printf("Client %d (%s): Rejecting message %s: %s.", c.User.ID, c.User.Username, clientMsg.ID, reason)
+			c.nack(clientMsg.ID, clientMsg.GroupID, reason)
 			continue
 		}
 
@@ -210,22 +516,185 @@ func (c *Client) ReadMessage(hub *Hub, queries *db.Queries) {
 			Ciphertext:     clientMsg.Ciphertext,
 			Signature:      clientMsg.Signature,
 			Envelopes:      clientMsg.Envelopes,
+			Mentions:       mentions,
+			ForwardedFrom:  forwardedFrom,
+			ExpiresAt:      clientMsg.ExpiresAt,
+			ReactionTo:     clientMsg.ReactionTo,
+			SenderSeq:      clientMsg.SenderSeq,
 			SenderID:       c.User.ID,
 			SenderUsername: c.User.Username,
+
+			reactionAuthorID: reactionAuthorID,
 		}
 
 		select {
-		case hub.Broadcast <- hubMessage:
+		case hub.broadcastShard(hubMessage.GroupID) <- hubMessage:
 			log.Printf("Client %d (%s) sent E2EE message to hub for group %d", c.User.ID, c.User.Username, hubMessage.GroupID)
 		case <-c.ctx.Done():
 			log.Printf("Client %d (%s): Context cancelled while trying to broadcast message.", c.User.ID, c.User.Username)
 			return
 		default:
-			log.Printf("Hub broadcast channel full for client %d (%s). Message for group %d dropped.", c.User.ID, c.User.Username, hubMessage.GroupID)
+			c.recordBroadcastBusy(hubMessage.GroupID)
+			c.nack(hubMessage.ID, hubMessage.GroupID, "server_busy")
 		}
 	}
 }
 
+// nack reports a rejected message back to this client.
+func (c *Client) nack(messageID, groupID uuid.UUID, reason string) {
+	c.Send(&MessageAck{Type: "message_nack", MessageID: messageID, GroupID: groupID, Reason: reason})
+}
+
+// checkTokenExpiry reports whether the connection's token has expired, or is close
+// enough to expiry that the client should be asked (once per token) for a fresh one.
+func (c *Client) checkTokenExpiry() (expiresAt time.Time, requestReauth, expired bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.tokenExpiresAt.IsZero() {
+		return c.tokenExpiresAt, false, false
+	}
+	remaining := time.Until(c.tokenExpiresAt)
+	if remaining <= 0 {
+		return c.tokenExpiresAt, false, true
+	}
+	if remaining <= reauthLead && !c.reauthRequested {
+		c.reauthRequested = true
+		return c.tokenExpiresAt, true, false
+	}
+	return c.tokenExpiresAt, false, false
+}
+
+// reauthenticate swaps in a fresh token for the same user, extending the connection's
+// lifetime. A failed reauth leaves the connection open until the old token expires.
+func (c *Client) reauthenticate(token string) {
+	userID, expiresAt, err := auth.ValidateTokenWithExpiry(token)
+	if err != nil {
+		log.Printf("Client %s (%s): Reauth failed: %v", c.User.ID, c.User.Username, err)
+		c.Send(&ServerResponseMessage{Type: "reauth_failure", Error: err.Error()})
+		return
+	}
+	if userID != c.User.ID {
+		log.Printf("Client %s (%s): Reauth rejected, token belongs to a different user.", c.User.ID, c.User.Username)
+		c.Send(&ServerResponseMessage{Type: "reauth_failure", Error: "Token does not match this connection."})
+		return
+	}
+
+	c.mutex.Lock()
+	c.tokenExpiresAt = expiresAt
+	c.reauthRequested = false
+	c.mutex.Unlock()
+
+	log.Printf("Client %s (%s): Reauthenticated, token valid until %s.", c.User.ID, c.User.Username, expiresAt.UTC().Format(time.RFC3339))
+	c.Send(&ServerResponseMessage{Type: "reauth_success", Message: expiresAt.UTC().Format(time.RFC3339)})
+}
+
+// validateMentions dedupes the message's mention list and drops self-mentions. It
+// returns a nack reason if the list is too long or names anyone who is not a current
+// member of the group. Control messages never carry mentions.
+func validateMentions(ctx context.Context, queries *db.Queries, msg ClientSentE2EMessage, senderID uuid.UUID) ([]uuid.UUID, string, error) {
+	if len(msg.Mentions) == 0 || msg.MessageType == db.MessageTypeControl {
+		return nil, "", nil
+	}
+	seen := make(map[uuid.UUID]bool, len(msg.Mentions))
+	var mentions []uuid.UUID
+	for _, id := range msg.Mentions {
+		if id == senderID || seen[id] {
+			continue
+		}
+		seen[id] = true
+		mentions = append(mentions, id)
+	}
+	if len(mentions) == 0 {
+		return nil, "", nil
+	}
+	if len(mentions) > maxMentionsPerMessage {
+		return nil, "too_many_mentions", nil
+	}
+	members, err := queries.GetGroupMemberIDsAmong(ctx, db.GetGroupMemberIDsAmongParams{
+		GroupID: &msg.GroupID,
+		UserIds: mentions,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if len(members) != len(mentions) {
+		return nil, "invalid_mentions", nil
+	}
+	return mentions, "", nil
+}
+
+// validateExpiry checks a disappearing message's expiry is in the future and no more
+// than maxExpiry away. It returns the nack reason, or "" when the expiry is acceptable.
+func validateExpiry(expiresAt *time.Time, maxExpiry time.Duration) string {
+	if expiresAt == nil {
+		return ""
+	}
+	now := time.Now()
+	if !expiresAt.After(now) || expiresAt.After(now.Add(maxExpiry)) {
+		return "invalid_expiry"
+	}
+	return ""
+}
+
+// resolveReactionAuthor checks that a reaction is a control message reacting to a
+// non-control message in the same group, and returns that message's author. It returns
+// a nack reason when the target is not acceptable.
+func resolveReactionAuthor(ctx context.Context, queries *db.Queries, msg ClientSentE2EMessage) (uuid.UUID, string, error) {
+	if msg.ReactionTo == nil {
+		return uuid.Nil, "", nil
+	}
+	if msg.MessageType != db.MessageTypeControl {
+		return uuid.Nil, "invalid_reaction", nil
+	}
+	target, err := queries.GetMessageById(ctx, *msg.ReactionTo)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, "invalid_reaction", nil
+	}
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+	if target.GroupID == nil || *target.GroupID != msg.GroupID || target.MessageType == db.MessageTypeControl {
+		return uuid.Nil, "invalid_reaction", nil
+	}
+	if target.UserID == nil {
+		// The author's account is gone; there is nobody to notify.
+		return uuid.Nil, "", nil
+	}
+	return *target.UserID, "", nil
+}
+
+// groupEnded reports whether a group's end time is more than grace in the past. Ended
+// groups are read-only until CleanupExpiredGroupsJob deletes them.
+func groupEnded(endTime pgtype.Timestamp, grace time.Duration) bool {
+	return endTime.Valid && endTime.Time.Add(grace).Before(time.Now())
+}
+
+// resolveForwardedFrom checks that a forwarded message's source is one the sender can
+// read: a non-control message in a group they belong to, sent after they joined. It
+// returns the provenance filled in from the source, or a nack reason.
+func resolveForwardedFrom(ctx context.Context, queries *db.Queries, msg ClientSentE2EMessage, senderID uuid.UUID) (*ForwardedFrom, string, error) {
+	if msg.ForwardedFrom == nil {
+		return nil, "", nil
+	}
+	if msg.MessageType == db.MessageTypeControl || msg.ForwardedFrom.MessageID == msg.ID {
+		return nil, "forward_not_allowed", nil
+	}
+	source, err := queries.GetForwardableMessage(ctx, db.GetForwardableMessageParams{
+		MessageID: msg.ForwardedFrom.MessageID,
+		UserID:    &senderID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, "forward_not_allowed", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if source.MessageType == db.MessageTypeControl || source.GroupID == nil || source.UserID == nil {
+		return nil, "forward_not_allowed", nil
+	}
+	return &ForwardedFrom{MessageID: source.ID, GroupID: *source.GroupID, SenderID: *source.UserID}, "", nil
+}
+
 type canonicalEnvelope struct {
 	DeviceID  string `json:"deviceId"`
 	EphPubKey string `json:"ephPubKey"`
@@ -0,0 +1,344 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/redis/go-redis/v9"
+)
+
+// countingDB fails every statement and counts how many were issued.
+type countingDB struct {
+	calls atomic.Int32
+}
+
+func (d *countingDB) Exec(context.Context, string, ...any) (pgconn.CommandTag, error) {
+	d.calls.Add(1)
+	return pgconn.CommandTag{}, errors.New("unexpected exec")
+}
+
+func (d *countingDB) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	d.calls.Add(1)
+	return nil, errors.New("unexpected query")
+}
+
+func (d *countingDB) QueryRow(context.Context, string, ...any) pgx.Row {
+	d.calls.Add(1)
+	return errorRow{errors.New("unexpected query")}
+}
+
+func (d *countingDB) CopyFrom(context.Context, pgx.Identifier, []string, pgx.CopyFromSource) (int64, error) {
+	d.calls.Add(1)
+	return 0, errors.New("unexpected copy")
+}
+
+type errorRow struct{ err error }
+
+func (r errorRow) Scan(...any) error { return r.err }
+
+// newTestHub returns a hub with just the settings the read loop consults.
+func newTestHub() *Hub {
+	return &Hub{
+		maxEnvelopes:      defaultMaxEnvelopes,
+		messageSizeLimits: loadMessageSizeLimits(),
+		messageTypes:      loadMessageTypeAllowlist(),
+	}
+}
+
+// dialTestClient connects a websocket pair over a local test server and returns the
+// server side wrapped in a Client, and the peer's end.
+func dialTestClient(t *testing.T) (*Client, *websocket.Conn) {
+	t.Helper()
+	serverConns := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		serverConns <- conn
+	}))
+	t.Cleanup(server.Close)
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { peer.Close() })
+
+	conn := <-serverConns
+	user := &db.GetUserByIdRow{ID: uuid.New(), Username: "tester"}
+	client := NewClient(conn, user, "device-1", nil, time.Now().Add(time.Hour), protocolVersionCurrent, 0)
+	t.Cleanup(func() { conn.Close() })
+	return client, peer
+}
+
+// startReader runs client's read loop against database and returns a channel closed
+// when it exits.
+func startReader(client *Client, hub *Hub, database db.DBTX) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.ReadMessage(hub, db.New(database))
+	}()
+	return done
+}
+
+// testMessage returns a chat message that passes the read loop's checks up to the
+// envelope cap, with the given number of envelopes.
+func testMessage(messageType db.MessageType, envelopes int) map[string]any {
+	message := map[string]any{
+		"type":        "message",
+		"id":          uuid.New(),
+		"group_id":    uuid.New(),
+		"messageType": messageType,
+		"signature":   base64.StdEncoding.EncodeToString(make([]byte, 64)),
+		"msgNonce":    "bm9uY2U=",
+		"ciphertext":  "Y2lwaGVydGV4dA==",
+	}
+	list := make([]Envelope, envelopes)
+	for i := range list {
+		list[i] = Envelope{DeviceID: uuid.NewString(), EphPubKey: "a2V5", KeyNonce: "bm9uY2U=", SealedKey: "c2VhbGVk"}
+	}
+	message["envelopes"] = list
+	return message
+}
+
+// nextAck waits for the read loop to queue an ack or nack for the client.
+func nextAck(t *testing.T, client *Client) *MessageAck {
+	t.Helper()
+	select {
+	case ack := <-client.Acks:
+		return ack
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a nack")
+		return nil
+	}
+}
+
+func TestReadMessageRejectsTooManyEnvelopesBeforeAnyQuery(t *testing.T) {
+	hub := newTestHub()
+	hub.maxEnvelopes = 3
+	client, peer := dialTestClient(t)
+	database := &countingDB{}
+	done := startReader(client, hub, database)
+
+	message := testMessage(db.MessageTypeText, 4)
+	if err := peer.WriteJSON(message); err != nil {
+		t.Fatalf("write message: %v", err)
+	}
+	ack := nextAck(t, client)
+	if ack.Type != "message_nack" || ack.Reason != "too_many_envelopes" {
+		t.Fatalf("got %s %q, want message_nack too_many_envelopes", ack.Type, ack.Reason)
+	}
+	if ack.MaxEnvelopes != 3 {
+		t.Fatalf("nack carries max_envelopes %d, want 3", ack.MaxEnvelopes)
+	}
+	if ack.MessageID != message["id"] {
+		t.Fatalf("nack is for message %s, want %s", ack.MessageID, message["id"])
+	}
+
+	peer.Close()
+	<-done
+	if calls := database.calls.Load(); calls != 0 {
+		t.Fatalf("read loop issued %d queries for a message over the envelope cap", calls)
+	}
+}
+
+func TestReadMessageRejectsUnsupportedMessageTypes(t *testing.T) {
+	tests := []struct {
+		name        string
+		messageType db.MessageType
+	}{
+		{"missing", ""},
+		{"unknown", "video"},
+		{"disabled", db.MessageTypeImage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ALLOWED_MESSAGE_TYPES", "text")
+			hub := newTestHub()
+			client, peer := dialTestClient(t)
+			database := &countingDB{}
+			done := startReader(client, hub, database)
+
+			message := testMessage(tt.messageType, 1)
+			if tt.messageType == "" {
+				delete(message, "messageType")
+			}
+			if err := peer.WriteJSON(message); err != nil {
+				t.Fatalf("write message: %v", err)
+			}
+			ack := nextAck(t, client)
+			if ack.Type != "message_nack" || ack.Reason != "unsupported_message_type" {
+				t.Fatalf("got %s %q, want message_nack unsupported_message_type", ack.Type, ack.Reason)
+			}
+			if ack.MessageID != message["id"] {
+				t.Fatalf("nack is for message %s, want %s", ack.MessageID, message["id"])
+			}
+
+			peer.Close()
+			<-done
+			if calls := database.calls.Load(); calls != 0 {
+				t.Fatalf("read loop issued %d queries for a %s message type", calls, tt.name)
+			}
+			if queued := len(client.Message); queued != 0 {
+				t.Fatalf("%d messages were queued for delivery", queued)
+			}
+		})
+	}
+}
+
+// runTestHub starts the hub's Run loop with a Redis client that can't connect, so
+// registration bookkeeping fails fast and only the local state is exercised.
+func runTestHub(t *testing.T) *Hub {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	redisClient := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	hub := newTestHub()
+	hub.Clients = make(map[uuid.UUID]*Client)
+	hub.openConns = make(map[uuid.UUID]map[*Client]struct{})
+	hub.Groups = make(map[uuid.UUID]*Group)
+	hub.Register = make(chan *Client)
+	hub.Unregister = make(chan *Client)
+	hub.DisconnectDeviceChan = make(chan *DisconnectDeviceMsg, 1)
+	hub.redisClient = redisClient
+	hub.serverID = "test"
+	hub.ctx = ctx
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		hub.runLoop()
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+		redisClient.Close()
+	})
+	return hub
+}
+
+// registered reports whether client is the hub's current client for its user.
+func registered(hub *Hub, client *Client) bool {
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+	return hub.Clients[client.User.ID] == client
+}
+
+func TestStalledPeerIsUnregistered(t *testing.T) {
+	previousWriteWait := writeWait
+	writeWait = 200 * time.Millisecond
+	t.Cleanup(func() { writeWait = previousWriteWait })
+
+	hub := runTestHub(t)
+	// The peer never reads, so once the socket buffers fill every write blocks.
+	client, _ := dialTestClient(t)
+
+	// Run the connection the way EstablishConnection does.
+	hub.Register <- client
+	readDone := make(chan struct{})
+	go func() {
+		go client.WriteMessage()
+		client.ReadMessage(hub, db.New(&countingDB{}))
+		close(readDone)
+		hub.Unregister <- client
+	}()
+
+	for !registered(hub, client) {
+		time.Sleep(time.Millisecond)
+	}
+	started := time.Now()
+	go func() {
+		payload := strings.Repeat("x", 1<<20)
+		for {
+			// Send needs the hub's read lock, which also keeps unregister from closing
+			// the channels underneath it.
+			hub.mutex.RLock()
+			current := hub.Clients[client.User.ID] == client
+			if current {
+				client.Send(&ServerResponseMessage{Type: "status", Message: payload})
+			}
+			hub.mutex.RUnlock()
+			if !current {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	select {
+	case <-readDone:
+	case <-time.After(writeWait + pongWait):
+		t.Fatal("ReadMessage did not return for a peer that stopped reading")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for registered(hub, client) {
+		if time.Now().After(deadline) {
+			t.Fatal("hub did not unregister the stalled client")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if elapsed := time.Since(started); elapsed > writeWait+pongWait {
+		t.Fatalf("stalled client took %s to clean up, want at most %s", elapsed, writeWait+pongWait)
+	}
+}
+
+// runConnection runs client against hub the way EstablishConnection does and returns a
+// channel closed once its read loop has exited.
+func runConnection(hub *Hub, client *Client) <-chan struct{} {
+	hub.Register <- client
+	readDone := make(chan struct{})
+	go func() {
+		go client.WriteMessage()
+		client.ReadMessage(hub, db.New(&countingDB{}))
+		close(readDone)
+		hub.Unregister <- client
+	}()
+	return readDone
+}
+
+func TestDisconnectClosesReplacedConnections(t *testing.T) {
+	hub := runTestHub(t)
+	phone, _ := dialTestClient(t)
+	tablet, _ := dialTestClient(t)
+	tablet.User = phone.User
+	tablet.DeviceIdentifier = "device-2"
+
+	phoneDone := runConnection(hub, phone)
+	tabletDone := runConnection(hub, tablet)
+	for !registered(hub, tablet) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The tablet replaced the phone in Clients, but the phone's socket is still open.
+	hub.disconnectLocalDevice(phone.User.ID, phone.DeviceIdentifier)
+	select {
+	case <-phoneDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logging out the replaced device left its connection open")
+	}
+	select {
+	case <-tabletDone:
+		t.Fatal("logging out one device closed the other device's connection")
+	default:
+	}
+
+	hub.DisconnectUser(phone.User.ID)
+	select {
+	case <-tabletDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("DisconnectUser left a connection open")
+	}
+}
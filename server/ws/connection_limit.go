@@ -0,0 +1,104 @@
+package ws
+
+import (
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// connectionSlotTTL is how long a connection slot survives without a refresh. It
+// matches the client:{id}:server_id TTL, which is refreshed on the same ticker.
+const connectionSlotTTL = 120 * time.Second
+
+// acquireConnectionSlotScript keeps user:{id}:connections as a sorted set of connection
+// IDs scored by their expiry in milliseconds. Expired slots (from instances that died
+// without cleaning up) are pruned first; the new slot is added only while the user is
+// below the limit. Returns 1 if the slot was acquired, 0 otherwise.
+var acquireConnectionSlotScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local ttl = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now)
+if redis.call('ZCARD', key) >= limit then
+	return 0
+end
+redis.call('ZADD', key, now + ttl, ARGV[4])
+redis.call('PEXPIRE', key, ttl)
+return 1
+`)
+
+func userConnectionsKey(userID uuid.UUID) string {
+	return redisUserConnectionsPrefix + userID.String() + ":connections"
+}
+
+// acquireConnectionSlot reserves one of the user's cluster-wide connection slots for
+// client. It returns false when the user already has maxConnectionsPerUser live
+// connections. Redis errors are logged and the connection allowed, so a Redis outage
+// does not lock users out.
+func (h *Hub) acquireConnectionSlot(client *Client) bool {
+	if h.maxConnectionsPerUser <= 0 {
+		return true
+	}
+	acquired, err := acquireConnectionSlotScript.Run(h.ctx, h.redisClient,
+		[]string{userConnectionsKey(client.User.ID)},
+		time.Now().UnixMilli(), connectionSlotTTL.Milliseconds(), h.maxConnectionsPerUser, client.connID).Int()
+	if err != nil {
+		log.Printf("Hub %s: Failed to check connection limit for user %s, allowing: %v", h.serverID, client.User.ID, err)
+		return true
+	}
+	if acquired != 1 {
+		return false
+	}
+	h.slotMutex.Lock()
+	h.heldSlots[client.connID] = client.User.ID
+	h.slotMutex.Unlock()
+	return true
+}
+
+// releaseConnectionSlot frees the slot taken by acquireConnectionSlot. It is a no-op
+// for slots that were never acquired.
+func (h *Hub) releaseConnectionSlot(client *Client) {
+	if h.maxConnectionsPerUser <= 0 {
+		return
+	}
+	h.slotMutex.Lock()
+	delete(h.heldSlots, client.connID)
+	h.slotMutex.Unlock()
+	if err := h.redisClient.ZRem(h.ctx, userConnectionsKey(client.User.ID), client.connID).Err(); err != nil {
+		log.Printf("Hub %s: Failed to release connection slot for user %s: %v", h.serverID, client.User.ID, err)
+	}
+}
+
+// refreshConnectionSlots extends the slots of every connection on this instance that
+// holds one. That includes connections no longer in Clients because a newer one for the
+// same user replaced them: they stay open and must keep counting against the limit.
+// ZAddXX only touches slots that still exist, so a slot that was pruned is not revived
+// past the limit.
+func (h *Hub) refreshConnectionSlots() {
+	if h.maxConnectionsPerUser <= 0 {
+		return
+	}
+	h.slotMutex.Lock()
+	slots := make(map[string]uuid.UUID, len(h.heldSlots))
+	for connID, userID := range h.heldSlots {
+		slots[connID] = userID
+	}
+	h.slotMutex.Unlock()
+	if len(slots) == 0 {
+		return
+	}
+
+	expiry := float64(time.Now().Add(connectionSlotTTL).UnixMilli())
+	pipe := h.redisClient.Pipeline()
+	for connID, userID := range slots {
+		key := userConnectionsKey(userID)
+		pipe.ZAddXX(h.ctx, key, redis.Z{Score: expiry, Member: connID})
+		pipe.Expire(h.ctx, key, connectionSlotTTL)
+	}
+	if _, err := pipe.Exec(h.ctx); err != nil {
+		log.Printf("Hub %s: Error refreshing connection slots: %v", h.serverID, err)
+	}
+}
@@ -0,0 +1,54 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"time"
+)
+
+// ConnectionReadyMessage follows auth_success on protocol 5 and up. It tells the
+// client what this server enforces so it can configure itself instead of assuming
+// defaults, and the server clock so it can correct for device clock skew.
+type ConnectionReadyMessage struct {
+	Type            string    `json:"type"`
+	ServerTime      time.Time `json:"server_time"`
+	ProtocolVersion int       `json:"protocol_version"`
+	// MaxMessageBytes is the size limit of an encoded message by message_type.
+	MaxMessageBytes     map[db.MessageType]int `json:"max_message_bytes"`
+	AllowedMessageTypes []db.MessageType       `json:"allowed_message_types"`
+	// MaxEnvelopeSurplus is how many envelopes a message may carry beyond the group's
+	// member device count, and MaxSenderSeqGap how far sender_seq may jump ahead.
+	MaxEnvelopeSurplus int   `json:"max_envelope_surplus"`
+	MaxSenderSeqGap    int64 `json:"max_sender_seq_gap"`
+	// MaxEnvelopes is the hard cap on envelopes per message; 0 means none.
+	MaxEnvelopes int `json:"max_envelopes"`
+	// Durations are in seconds; an IdleTimeoutSeconds of 0 means no idle timeout.
+	MaxMessageExpirySeconds int `json:"max_message_expiry_seconds"`
+	IdleTimeoutSeconds      int `json:"idle_timeout_seconds"`
+	ReconnectGraceSeconds   int `json:"reconnect_grace_seconds"`
+	TypingTTLSeconds        int `json:"typing_ttl_seconds"`
+}
+
+// connectionReady describes this server's effective limits for a client speaking
+// protocolVersion.
+func (h *Handler) connectionReady(protocolVersion int) ConnectionReadyMessage {
+	allowed := make([]db.MessageType, 0, len(knownMessageTypes))
+	for _, messageType := range knownMessageTypes {
+		if h.hub.messageTypes[messageType] {
+			allowed = append(allowed, messageType)
+		}
+	}
+	return ConnectionReadyMessage{
+		Type:                    "connection_ready",
+		ServerTime:              time.Now().UTC(),
+		ProtocolVersion:         protocolVersion,
+		MaxMessageBytes:         h.hub.messageSizeLimits,
+		AllowedMessageTypes:     allowed,
+		MaxEnvelopeSurplus:      h.hub.envelopeTolerance,
+		MaxSenderSeqGap:         h.hub.senderSeqMaxGap,
+		MaxEnvelopes:            h.hub.maxEnvelopes,
+		MaxMessageExpirySeconds: int(h.hub.maxMessageExpiry / time.Second),
+		IdleTimeoutSeconds:      int(h.idleTimeout / time.Second),
+		ReconnectGraceSeconds:   int(h.hub.reconnectGrace / time.Second),
+		TypingTTLSeconds:        int(typingTTL / time.Second),
+	}
+}
@@ -0,0 +1,54 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var contactPageLimits = util.PageLimits{Default: 20, Max: 50}
+
+// contactCursor is the position after the last contact of a page, ordered by
+// (username, id). It is sent to clients as opaque base64url JSON.
+type contactCursor struct {
+	Username string    `json:"u"`
+	ID       uuid.UUID `json:"id"`
+}
+
+// searchRelevantUsers serves GET /ws/relevant-users?query=&cursor=&limit=: a page of
+// users sharing a group with the caller whose username or email contains query,
+// excluding anyone blocked in either direction.
+func (h *Handler) searchRelevantUsers(c *gin.Context, user db.GetUserByIdRow) {
+	var cursor contactCursor
+	limit, ok := util.ParsePage(c, contactPageLimits, &cursor)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.SearchRelevantUsers(c.Request.Context(), db.SearchRelevantUsersParams{
+		UserID:        user.ID,
+		Pattern:       util.ContainsPattern(c.Query("query")),
+		AfterUsername: cursor.Username,
+		AfterID:       cursor.ID,
+		PageSize:      int32(limit),
+	})
+	if err != nil {
+		log.Printf("Error searching relevant users for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search users"})
+		return
+	}
+
+	page := ContactsPage{Users: make([]ClientContact, 0, len(rows)), Limit: limit}
+	for _, row := range rows {
+		page.Users = append(page.Users, ClientContact{ID: row.ID, Username: row.Username, Email: row.Email})
+	}
+	if len(rows) == limit {
+		last := rows[len(rows)-1]
+		page.NextCursor = util.EncodeCursor(contactCursor{Username: last.Username, ID: last.ID})
+	}
+	c.JSON(http.StatusOK, page)
+}
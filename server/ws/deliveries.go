@@ -0,0 +1,125 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// deliveryReplayMargin is how far before a device's reported position
+// GetRelevantMessages still returns messages. A message's created_at is when its save
+// began, and saves are cancelled after DB_QUERY_TIMEOUT_MS, so a message that commits
+// after the device's report was created less than that before the reported one.
+// Doubling it leaves room for the commit round trip.
+func deliveryReplayMargin() time.Duration {
+	return 2 * util.QueryTimeout()
+}
+
+// AckSequence records the newest message a device has received in a group. The
+// message must exist in the group, which keeps the report within what the group has
+// actually sent, and a device's position never moves backwards: reporting an older
+// message than last time is a 409 carrying the recorded position. GetRelevantMessages
+// skips what the device has reported.
+func (h *Handler) AckSequence(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
+		return
+	}
+
+	var req AckSequenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	isMember, err := util.UserInGroup(ctx, user.ID, groupID, h.db)
+	if err != nil {
+		log.Printf("Error checking membership of user %s in group %s: %v", user.ID, groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record delivery"})
+		return
+	}
+	if !isMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User does not have access to this group"})
+		return
+	}
+
+	if _, err := h.db.GetDeviceKeyByIdentifier(ctx, db.GetDeviceKeyByIdentifierParams{
+		UserID:           user.ID,
+		DeviceIdentifier: req.DeviceIdentifier,
+	}); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		} else {
+			log.Printf("Error loading device %s for user %s: %v", req.DeviceIdentifier, user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record delivery"})
+		}
+		return
+	}
+
+	message, err := h.db.GetMessageById(ctx, req.MessageID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error loading message %s for delivery report: %v", req.MessageID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record delivery"})
+		return
+	}
+	if err != nil || message.GroupID == nil || *message.GroupID != groupID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found in this group"})
+		return
+	}
+
+	advanced, err := h.db.AdvanceDeviceGroupDelivery(ctx, db.AdvanceDeviceGroupDeliveryParams{
+		UserID:           user.ID,
+		DeviceIdentifier: req.DeviceIdentifier,
+		GroupID:          groupID,
+		MessageID:        message.ID,
+		DeliveredAt:      message.CreatedAt,
+	})
+	if err != nil {
+		log.Printf("Error recording delivery for user %s device %s group %s: %v", user.ID, req.DeviceIdentifier, groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record delivery"})
+		return
+	}
+
+	position := DeliveryPosition{
+		GroupID:          groupID,
+		DeviceIdentifier: req.DeviceIdentifier,
+		MessageID:        message.ID,
+		DeliveredAt:      message.CreatedAt.Time,
+	}
+	if advanced > 0 {
+		c.JSON(http.StatusOK, position)
+		return
+	}
+
+	current, err := h.db.GetDeviceGroupDelivery(ctx, db.GetDeviceGroupDeliveryParams{
+		UserID:           user.ID,
+		DeviceIdentifier: req.DeviceIdentifier,
+		GroupID:          groupID,
+	})
+	if err != nil {
+		log.Printf("Error loading delivery for user %s device %s group %s: %v", user.ID, req.DeviceIdentifier, groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record delivery"})
+		return
+	}
+	position.MessageID = current.MessageID
+	position.DeliveredAt = current.DeliveredAt.Time
+	c.JSON(http.StatusConflict, gin.H{
+		"error":    "A later message was already reported for this device",
+		"position": position,
+	})
+}
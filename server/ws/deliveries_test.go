@@ -0,0 +1,127 @@
+package ws
+
+import (
+	"bytes"
+	"chat-app-server/db"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// deliveryDB serves AckSequence for a member of groupID whose device has already
+// reported recorded, and advances the position only when advance is set.
+type deliveryDB struct {
+	accountDB
+	groupID  uuid.UUID
+	message  uuid.UUID
+	sentAt   time.Time
+	recorded DeliveryPosition
+	advance  bool
+}
+
+func (d *deliveryDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if strings.Contains(sql, "-- name: AdvanceDeviceGroupDelivery ") {
+		if d.advance {
+			return pgconn.NewCommandTag("INSERT 0 1"), nil
+		}
+		return pgconn.NewCommandTag("INSERT 0 0"), nil
+	}
+	return d.accountDB.Exec(ctx, sql, args...)
+}
+
+func (d *deliveryDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	switch {
+	case strings.Contains(sql, "-- name: GetUserGroupByGroupIDAndUserID "),
+		strings.Contains(sql, "-- name: GetDeviceKeyByIdentifier "):
+		return scanRow(func(...any) {})
+	case strings.Contains(sql, "-- name: GetMessageById ") && args[0] == d.message:
+		return scanRow(func(dest ...any) {
+			*dest[0].(*uuid.UUID) = d.message
+			*dest[2].(**uuid.UUID) = &d.groupID
+			*dest[3].(*pgtype.Timestamp) = pgtype.Timestamp{Time: d.sentAt, Valid: true}
+		})
+	case strings.Contains(sql, "-- name: GetDeviceGroupDelivery "):
+		return scanRow(func(dest ...any) {
+			*dest[0].(*uuid.UUID) = d.recorded.MessageID
+			*dest[1].(*pgtype.Timestamp) = pgtype.Timestamp{Time: d.recorded.DeliveredAt, Valid: true}
+		})
+	}
+	return d.accountDB.QueryRow(ctx, sql, args...)
+}
+
+func TestAckSequenceOnlyMovesForward(t *testing.T) {
+	sentAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	later := sentAt.Add(time.Minute)
+	tests := []struct {
+		name     string
+		advance  bool
+		wantCode int
+		wantAt   time.Time
+	}{
+		{"newer message", true, http.StatusOK, sentAt},
+		{"older message", false, http.StatusConflict, later},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := &deliveryDB{
+				accountDB: accountDB{id: uuid.New()},
+				groupID:   uuid.New(),
+				message:   uuid.New(),
+				sentAt:    sentAt,
+				recorded:  DeliveryPosition{MessageID: uuid.New(), DeliveredAt: later},
+				advance:   tt.advance,
+			}
+			handler := &Handler{db: db.New(database)}
+
+			body, _ := json.Marshal(AckSequenceRequest{DeviceIdentifier: "device-1", MessageID: database.message})
+			gin.SetMode(gin.TestMode)
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodPost, "/ws/groups/"+database.groupID.String()+"/ack-sequence", bytes.NewReader(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Params = gin.Params{{Key: "groupID", Value: database.groupID.String()}}
+			c.Set("userID", database.id)
+			handler.AckSequence(c)
+
+			if recorder.Code != tt.wantCode {
+				t.Fatalf("ack got status %d, want %d: %s", recorder.Code, tt.wantCode, recorder.Body)
+			}
+			if len(database.other) != 0 {
+				t.Fatalf("ack issued unexpected statements: %v", database.other)
+			}
+			var position DeliveryPosition
+			if tt.wantCode == http.StatusOK {
+				if err := json.Unmarshal(recorder.Body.Bytes(), &position); err != nil {
+					t.Fatalf("decode position: %v", err)
+				}
+			} else {
+				var conflict struct {
+					Position DeliveryPosition `json:"position"`
+				}
+				if err := json.Unmarshal(recorder.Body.Bytes(), &conflict); err != nil {
+					t.Fatalf("decode conflict: %v", err)
+				}
+				position = conflict.Position
+				if position.MessageID != database.recorded.MessageID {
+					t.Fatalf("conflict reports message %s, want the recorded %s", position.MessageID, database.recorded.MessageID)
+				}
+			}
+			if !position.DeliveredAt.Equal(tt.wantAt) {
+				t.Fatalf("position is at %s, want %s", position.DeliveredAt, tt.wantAt)
+			}
+			if position.GroupID != database.groupID || position.DeviceIdentifier != "device-1" {
+				t.Fatalf("position is for group %s device %q", position.GroupID, position.DeviceIdentifier)
+			}
+		})
+	}
+}
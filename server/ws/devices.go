@@ -0,0 +1,149 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// RotateDeviceKey replaces the public keys of one of the caller's existing devices.
+// Messages encrypted to the old key stay unreadable to the new one; that is expected.
+// As with RegisterDevice, the account password is required so a leaked token alone
+// can't swap in keys that co-members would encrypt to.
+func (h *Handler) RotateDeviceKey(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	var req RotateDeviceKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	publicKey, signingPublicKey, ok := decodeDeviceKeys(c, req.PublicKey, req.SigningPublicKey)
+	if !ok {
+		return
+	}
+
+	if !h.checkAccountPassword(c, user.ID, req.Password) {
+		return
+	}
+
+	_, err = h.db.RotateDeviceKey(ctx, db.RotateDeviceKeyParams{
+		UserID:           user.ID,
+		DeviceIdentifier: req.DeviceIdentifier,
+		PublicKey:        publicKey,
+		SigningPublicKey: signingPublicKey,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Device not registered for this user"})
+		} else {
+			log.Printf("Error rotating device key for user %s device %s: %v", user.ID, req.DeviceIdentifier, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate device key"})
+		}
+		return
+	}
+	log.Printf("Device key rotated for user %s, device %s", user.ID, req.DeviceIdentifier)
+
+	// The live socket verifies signatures with the key loaded at auth time, so drop it
+	// and let the client reconnect with the new signing key.
+	h.hub.DisconnectDevice(user.ID, req.DeviceIdentifier)
+
+	h.notifyDeviceKeysUpdated(ctx, user.ID)
+
+	c.JSON(http.StatusOK, gin.H{"device_identifier": req.DeviceIdentifier, "message": "Device key rotated"})
+}
+
+// RegisterDevice adds a device key for the caller, for devices that logged in through
+// /auth/login/keyless. The WebSocket rejects a device until this succeeds. Like a login
+// with a key, it needs the account password, so a leaked token alone can't add a key
+// that co-members would encrypt to. An already registered device gets 409; its key is
+// changed with RotateDeviceKey instead.
+func (h *Handler) RegisterDevice(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	var req RegisterDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	publicKey, signingPublicKey, ok := decodeDeviceKeys(c, req.PublicKey, req.SigningPublicKey)
+	if !ok {
+		return
+	}
+
+	if !h.checkAccountPassword(c, user.ID, req.Password) {
+		return
+	}
+
+	inserted, err := h.db.InsertDeviceKey(ctx, db.InsertDeviceKeyParams{
+		UserID:           user.ID,
+		DeviceIdentifier: req.DeviceIdentifier,
+		PublicKey:        publicKey,
+		SigningPublicKey: signingPublicKey,
+	})
+	if err != nil {
+		log.Printf("Error registering device key for user %s device %s: %v", user.ID, req.DeviceIdentifier, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register device"})
+		return
+	}
+	if inserted == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Device already registered; rotate its key instead"})
+		return
+	}
+	log.Printf("Device key registered for user %s, device %s", user.ID, req.DeviceIdentifier)
+
+	h.notifyDeviceKeysUpdated(ctx, user.ID)
+
+	c.JSON(http.StatusCreated, gin.H{"device_identifier": req.DeviceIdentifier, "message": "Device registered"})
+}
+
+// decodeDeviceKeys decodes base64 public and signing keys from a device request. It
+// writes a 400 and returns false if either is malformed.
+func decodeDeviceKeys(c *gin.Context, base64PublicKey, base64SigningPublicKey string) ([]byte, []byte, bool) {
+	publicKey, err := base64.StdEncoding.DecodeString(base64PublicKey)
+	if err != nil || len(publicKey) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid public key encoding"})
+		return nil, nil, false
+	}
+	signingPublicKey, err := base64.StdEncoding.DecodeString(base64SigningPublicKey)
+	if err != nil || len(signingPublicKey) != ed25519.PublicKeySize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signing public key"})
+		return nil, nil, false
+	}
+	return publicKey, signingPublicKey, true
+}
+
+// notifyDeviceKeysUpdated tells everyone sharing a group with userID to refetch device
+// keys, so new envelopes cover the changed device.
+func (h *Handler) notifyDeviceKeysUpdated(ctx context.Context, userID uuid.UUID) {
+	coMembers, err := h.db.GetCoMemberIDs(ctx, &userID)
+	if err != nil {
+		log.Printf("Error loading co-members to notify of device key change for user %s: %v", userID, err)
+	}
+	for _, memberID := range coMembers {
+		if memberID != nil {
+			h.hub.NotifyUser(*memberID, "device_keys_updated", uuid.Nil)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package ws
+
+import (
+	"bytes"
+	"chat-app-server/db"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// accountDB answers the user lookups an authenticated account action makes for one
+// user and records every other statement.
+type accountDB struct {
+	id       uuid.UUID
+	password string
+	other    []string
+}
+
+func (d *accountDB) Exec(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+	d.other = append(d.other, sql)
+	return pgconn.CommandTag{}, errors.New("unexpected exec")
+}
+
+func (d *accountDB) Query(_ context.Context, sql string, _ ...any) (pgx.Rows, error) {
+	d.other = append(d.other, sql)
+	return nil, errors.New("unexpected query")
+}
+
+func (d *accountDB) QueryRow(_ context.Context, sql string, args ...any) pgx.Row {
+	switch {
+	case strings.Contains(sql, "-- name: GetUserById ") && args[0] == d.id:
+		return scanRow(func(dest ...any) {
+			*dest[0].(*uuid.UUID) = d.id
+			*dest[1].(*string) = "tester"
+		})
+	case strings.Contains(sql, "-- name: GetUserByIdInternal ") && args[0] == d.id:
+		return scanRow(func(dest ...any) {
+			*dest[0].(*uuid.UUID) = d.id
+			*dest[1].(*string) = "tester"
+			*dest[3].(*pgtype.Text) = pgtype.Text{String: d.password, Valid: true}
+		})
+	}
+	d.other = append(d.other, sql)
+	return errorRow{pgx.ErrNoRows}
+}
+
+func (d *accountDB) CopyFrom(context.Context, pgx.Identifier, []string, pgx.CopyFromSource) (int64, error) {
+	d.other = append(d.other, "copy")
+	return 0, errors.New("unexpected copy")
+}
+
+type scanRow func(dest ...any)
+
+func (r scanRow) Scan(dest ...any) error {
+	r(dest...)
+	return nil
+}
+
+// scanRows serves one scanRow per result row.
+type scanRows struct {
+	rows []scanRow
+	next int
+}
+
+func (r *scanRows) Close()                                       {}
+func (r *scanRows) Err() error                                   { return nil }
+func (r *scanRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (r *scanRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *scanRows) Values() ([]any, error)                       { return nil, nil }
+func (r *scanRows) RawValues() [][]byte                          { return nil }
+func (r *scanRows) Conn() *pgx.Conn                              { return nil }
+
+func (r *scanRows) Next() bool {
+	r.next++
+	return r.next <= len(r.rows)
+}
+
+func (r *scanRows) Scan(dest ...any) error {
+	return r.rows[r.next-1].Scan(dest...)
+}
+
+func TestRotateDeviceKeyRejectsWrongPassword(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse battery"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	database := &accountDB{id: uuid.New(), password: string(hash)}
+	handler := &Handler{db: db.New(database)}
+
+	body, _ := json.Marshal(RotateDeviceKeyRequest{
+		Password:         "wrong password",
+		DeviceIdentifier: "device-1",
+		PublicKey:        base64.StdEncoding.EncodeToString(make([]byte, 32)),
+		SigningPublicKey: base64.StdEncoding.EncodeToString(make([]byte, ed25519.PublicKeySize)),
+	})
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/devices/rotate-key", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("userID", database.id)
+	handler.RotateDeviceKey(c)
+
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("rotate with a wrong password got status %d, want 401", recorder.Code)
+	}
+	if len(database.other) != 0 {
+		t.Fatalf("rotate with a wrong password issued %d other statements: %v", len(database.other), database.other)
+	}
+}
@@ -0,0 +1,56 @@
+package ws
+
+import (
+	"chat-app-server/metrics"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// dropLogInterval is the most often one client logs dropped payloads or a full
+// broadcast queue. Drops in between are counted and reported with the next line.
+const dropLogInterval = 10 * time.Second
+
+// logThrottle lets one log line through per dropLogInterval and counts the events
+// suppressed in between.
+type logThrottle struct {
+	last       atomic.Int64 // UnixNano of the last logged event
+	suppressed atomic.Int64
+}
+
+// allow reports whether to log now and, if so, how many events were suppressed
+// since the last line.
+func (t *logThrottle) allow() (int64, bool) {
+	now := time.Now().UnixNano()
+	last := t.last.Load()
+	if now-last < int64(dropLogInterval) || !t.last.CompareAndSwap(last, now) {
+		t.suppressed.Add(1)
+		return 0, false
+	}
+	return t.suppressed.Swap(0), true
+}
+
+// recordDrop counts out, which was dropped because its send buffer was full, against
+// the client and groupID (uuid.Nil for payloads not about a group).
+func (c *Client) recordDrop(out Outbound, groupID uuid.UUID) {
+	metrics.DroppedOutbound.Add(1)
+	metrics.DroppedOutboundByUser.Add(c.User.ID.String(), 1)
+	if groupID != uuid.Nil {
+		metrics.DroppedOutboundByGroup.Add(groupID.String(), 1)
+	}
+	if suppressed, ok := c.dropLog.allow(); ok {
+		log.Printf("Client %s (%s): Send buffer full, dropping %s (%d more dropped since last report)", c.User.ID, c.User.Username, out.describe(), suppressed)
+	}
+}
+
+// recordBroadcastBusy counts a message from this client refused because its group's
+// broadcast shard was full.
+func (c *Client) recordBroadcastBusy(groupID uuid.UUID) {
+	metrics.BroadcastQueueFull.Add(1)
+	metrics.BroadcastQueueFullByGroup.Add(groupID.String(), 1)
+	if suppressed, ok := c.busyLog.allow(); ok {
+		log.Printf("Hub broadcast channel full for client %s (%s). Message for group %s dropped (%d more since last report).", c.User.ID, c.User.Username, groupID, suppressed)
+	}
+}
@@ -0,0 +1,55 @@
+package ws
+
+const (
+	// defaultMaxEnvelopes is the default hard cap on envelopes per message
+	// (MAX_ENVELOPES_PER_MESSAGE). Groups have no member or device limit, so it is set
+	// well above a large event group's device count; tooManyEnvelopes is the tight check.
+	defaultMaxEnvelopes = 1000
+	// maxEnvelopeDeviceIDLen bounds an envelope's device identifier.
+	maxEnvelopeDeviceIDLen = 256
+	// maxEnvelopeKeyFieldLen bounds each base64 key field of an envelope. The real
+	// values (X25519 public key, nonce, sealed 32-byte key) are well under 100 characters.
+	maxEnvelopeKeyFieldLen = 128
+)
+
+// envelopeFieldsValid reports whether every envelope's fields are within the size caps.
+func envelopeFieldsValid(envelopes []Envelope) bool {
+	for _, env := range envelopes {
+		if len(env.DeviceID) > maxEnvelopeDeviceIDLen ||
+			len(env.EphPubKey) > maxEnvelopeKeyFieldLen ||
+			len(env.KeyNonce) > maxEnvelopeKeyFieldLen ||
+			len(env.SealedKey) > maxEnvelopeKeyFieldLen {
+			return false
+		}
+	}
+	return true
+}
+
+// overEnvelopeCap reports whether a message carries more envelopes than the hard cap.
+// It needs no group lookup, so it runs before any database work.
+func overEnvelopeCap(envelopes []Envelope, maxEnvelopes int) bool {
+	return maxEnvelopes > 0 && len(envelopes) > maxEnvelopes
+}
+
+// tooManyEnvelopes reports whether a message carries more envelopes than the group has
+// member devices plus tolerance. The tolerance covers devices removed after the sender
+// last fetched keys.
+func tooManyEnvelopes(envelopes []Envelope, memberDevices, tolerance int) bool {
+	return len(envelopes) > memberDevices+tolerance
+}
+
+// missingEnvelopeDevices returns the registered devices of current group members that the
+// message carries no envelope for, i.e. devices that would not be able to decrypt it.
+func missingEnvelopeDevices(deviceIDs []string, msg ClientSentE2EMessage) []string {
+	covered := make(map[string]bool, len(msg.Envelopes))
+	for _, env := range msg.Envelopes {
+		covered[env.DeviceID] = true
+	}
+	var missing []string
+	for _, id := range deviceIDs {
+		if !covered[id] {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
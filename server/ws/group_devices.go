@@ -0,0 +1,58 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// groupDevicesTTL bounds how long a cached list of a group's member devices is
+// trusted. Membership events for the group and device_keys_updated drop entries right
+// away; the TTL covers changes that announce neither.
+const groupDevicesTTL = 30 * time.Second
+
+type cachedDevices struct {
+	deviceIDs []string
+	fetchedAt time.Time
+}
+
+// groupDevices returns the device identifiers of groupID's members, for bounding a
+// message's envelopes. Like postingPermission it is served from the client's cache
+// while the group is in c.Groups. fresh skips the cache; envelope coverage enforcement
+// needs it, since a stale list would reject or pass messages on the wrong devices.
+func (c *Client) groupDevices(queries *db.Queries, groupID uuid.UUID, fresh bool) ([]string, error) {
+	if !fresh {
+		c.mutex.RLock()
+		cached, ok := c.devices[groupID]
+		member := c.Groups[groupID]
+		c.mutex.RUnlock()
+		if ok && member && time.Since(cached.fetchedAt) < groupDevicesTTL {
+			return cached.deviceIDs, nil
+		}
+	}
+
+	deviceIDs, err := queries.GetDeviceIdentifiersForGroup(c.ctx, &groupID)
+	if err != nil {
+		c.forgetGroupDevices(groupID)
+		return nil, err
+	}
+	c.mutex.Lock()
+	if c.Groups[groupID] {
+		c.devices[groupID] = cachedDevices{deviceIDs: deviceIDs, fetchedAt: time.Now()}
+	}
+	c.mutex.Unlock()
+	return deviceIDs, nil
+}
+
+// forgetGroupDevices drops the cached device list for groupID, or for every group
+// when groupID is uuid.Nil.
+func (c *Client) forgetGroupDevices(groupID uuid.UUID) {
+	c.mutex.Lock()
+	if groupID == uuid.Nil {
+		clear(c.devices)
+	} else {
+		delete(c.devices, groupID)
+	}
+	c.mutex.Unlock()
+}
@@ -0,0 +1,279 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/notifications"
+	"chat-app-server/util"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// loadGroupSettings assembles a group's settings from its groups row and its
+// group_settings row. Groups that never saved settings get the defaults.
+func loadGroupSettings(ctx context.Context, queries *db.Queries, groupID uuid.UUID) (GroupSettings, error) {
+	group, err := queries.GetGroupById(ctx, groupID)
+	if err != nil {
+		return GroupSettings{}, err
+	}
+	tags, err := queries.GetGroupTags(ctx, groupID)
+	if err != nil {
+		return GroupSettings{}, err
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	settings := GroupSettings{
+		AnnouncementOnly: group.AnnouncementOnly,
+		RequiresApproval: group.RequiresApproval,
+		Tags:             tags,
+	}
+	stored, err := queries.GetGroupSettings(ctx, groupID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return settings, nil
+	}
+	if err != nil {
+		return GroupSettings{}, err
+	}
+	if err := json.Unmarshal(stored, &settings.GroupOptions); err != nil {
+		return GroupSettings{}, err
+	}
+	return settings, nil
+}
+
+// loadGroupOptions reads only the group_settings row, returning the zero options for
+// groups that never saved settings.
+func loadGroupOptions(ctx context.Context, queries *db.Queries, groupID uuid.UUID) (GroupOptions, error) {
+	var options GroupOptions
+	stored, err := queries.GetGroupSettings(ctx, groupID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return options, nil
+	}
+	if err != nil {
+		return options, err
+	}
+	if err := json.Unmarshal(stored, &options); err != nil {
+		return options, err
+	}
+	return options, nil
+}
+
+// previewMode returns the group's notification preview policy.
+func (o GroupOptions) previewMode() notifications.PreviewMode {
+	if o.NotificationPreviewMode == "" {
+		return notifications.PreviewFull
+	}
+	return o.NotificationPreviewMode
+}
+
+// pushStyle returns the sound and channel of the group's pushes.
+func (o GroupOptions) pushStyle() notifications.PushStyle {
+	return notifications.PushStyle{
+		Sound:     o.NotificationSound,
+		ChannelID: o.NotificationChannel,
+		Priority:  o.NotificationPriority,
+	}
+}
+
+// newMemberMuted reports whether joining members start with the group muted: always
+// when the group's default_muted setting is on, otherwise when the joining members
+// would take it past AUTO_MUTE_GROUP_SIZE.
+func (h *Handler) newMemberMuted(ctx context.Context, queries *db.Queries, groupID uuid.UUID, joining int) (bool, error) {
+	options, err := loadGroupOptions(ctx, queries, groupID)
+	if err != nil {
+		return false, err
+	}
+	if options.DefaultMuted {
+		return true, nil
+	}
+	if h.autoMuteGroupSize <= 0 {
+		return false, nil
+	}
+	members, err := queries.CountGroupMembers(ctx, &groupID)
+	if err != nil {
+		return false, err
+	}
+	return members+int64(joining) > int64(h.autoMuteGroupSize), nil
+}
+
+// GetGroupSettings returns the group's settings object. Admin only.
+func (h *Handler) GetGroupSettings(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
+		return
+	}
+	if !h.requireGroupAdmin(c, user.ID, groupID) {
+		return
+	}
+
+	settings, err := loadGroupSettings(ctx, h.db, groupID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		} else {
+			log.Printf("Error loading settings for group %s: %v", groupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load group settings"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateGroupSettings applies a partial settings update and tells group members to
+// refetch. Admin only.
+func (h *Handler) UpdateGroupSettings(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
+		return
+	}
+
+	var req UpdateGroupSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.NotificationPreviewMode != nil && !req.NotificationPreviewMode.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "notification_preview_mode must be full, name_only or generic"})
+		return
+	}
+	if req.NotificationSound != nil && !notifications.ValidSound(*req.NotificationSound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "notification_sound is not an available sound"})
+		return
+	}
+	if req.NotificationChannel != nil && !notifications.ValidChannel(*req.NotificationChannel) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "notification_channel is not an available channel"})
+		return
+	}
+	if req.NotificationPriority != nil && !notifications.ValidPriority(*req.NotificationPriority) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "notification_priority must be default, normal or high"})
+		return
+	}
+	var tags []string
+	if req.Tags != nil {
+		var msg string
+		if tags, msg = normalizeGroupTags(*req.Tags); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+	}
+	if !h.requireGroupAdmin(c, user.ID, groupID) {
+		return
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction for group %s settings: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group settings"})
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := h.db.WithTx(tx)
+
+	settings, err := loadGroupSettings(ctx, qtx, groupID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		} else {
+			log.Printf("Error loading settings for group %s: %v", groupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load group settings"})
+		}
+		return
+	}
+
+	if req.AnnouncementOnly != nil || req.RequiresApproval != nil {
+		if _, err := qtx.UpdateGroup(ctx, db.UpdateGroupParams{
+			ID:               groupID,
+			AnnouncementOnly: util.NullablePgBool(req.AnnouncementOnly),
+			RequiresApproval: util.NullablePgBool(req.RequiresApproval),
+		}); err != nil {
+			log.Printf("Error updating settings columns for group %s: %v", groupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group settings"})
+			return
+		}
+		if req.AnnouncementOnly != nil {
+			settings.AnnouncementOnly = *req.AnnouncementOnly
+		}
+		if req.RequiresApproval != nil {
+			settings.RequiresApproval = *req.RequiresApproval
+		}
+	}
+
+	if req.Tags != nil {
+		if err := qtx.DeleteGroupTags(ctx, groupID); err != nil {
+			log.Printf("Error clearing tags for group %s: %v", groupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group settings"})
+			return
+		}
+		if err := qtx.InsertGroupTags(ctx, db.InsertGroupTagsParams{GroupID: groupID, Tags: tags}); err != nil {
+			log.Printf("Error saving tags for group %s: %v", groupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group settings"})
+			return
+		}
+		settings.Tags = tags
+	}
+
+	if req.NotificationPreviewMode != nil {
+		settings.NotificationPreviewMode = *req.NotificationPreviewMode
+	}
+	if req.DefaultMuted != nil {
+		settings.DefaultMuted = *req.DefaultMuted
+	}
+	if req.NotificationSound != nil {
+		settings.NotificationSound = *req.NotificationSound
+	}
+	if req.NotificationChannel != nil {
+		settings.NotificationChannel = *req.NotificationChannel
+	}
+	if req.NotificationPriority != nil {
+		settings.NotificationPriority = *req.NotificationPriority
+	}
+
+	options, err := json.Marshal(settings.GroupOptions)
+	if err != nil {
+		log.Printf("Error encoding settings for group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group settings"})
+		return
+	}
+	if err := qtx.UpsertGroupSettings(ctx, db.UpsertGroupSettingsParams{GroupID: groupID, Settings: options}); err != nil {
+		log.Printf("Error saving settings for group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group settings"})
+		return
+	}
+
+	if err := recordAudit(ctx, qtx, groupID, user.ID, auditSettingsUpdated, nil, req); err != nil {
+		log.Printf("Error recording settings update for group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group settings"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing settings for group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group settings"})
+		return
+	}
+
+	h.hub.NotifyGroup(groupID, "group_settings_updated")
+	c.JSON(http.StatusOK, settings)
+}
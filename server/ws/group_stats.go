@@ -0,0 +1,70 @@
+package ws
+
+import (
+	"chat-app-server/util"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetGroupStats serves GET /ws/groups/:groupID/stats: message, attachment and member
+// totals for capacity planning. Admin only.
+func (h *Handler) GetGroupStats(c *gin.Context) {
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
+		return
+	}
+	if !h.requireGroupAdmin(c, user.ID, groupID) {
+		return
+	}
+	h.writeGroupStats(c, groupID)
+}
+
+// AdminGetGroupStats serves GET /api/admin/groups/:groupID/stats, the same figures as
+// GetGroupStats for operators looking into any group. Operator only; 404 for a group
+// that doesn't exist or was deleted.
+func (h *Handler) AdminGetGroupStats(c *gin.Context) {
+	groupID, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
+		return
+	}
+	if _, err := h.db.GetGroupById(c.Request.Context(), groupID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		} else {
+			log.Printf("Error loading group %s for stats: %v", groupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load group stats"})
+		}
+		return
+	}
+	h.writeGroupStats(c, groupID)
+}
+
+func (h *Handler) writeGroupStats(c *gin.Context, groupID uuid.UUID) {
+	stats, err := h.db.GetGroupStats(c.Request.Context(), groupID)
+	if err != nil {
+		log.Printf("Error loading stats for group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load group stats"})
+		return
+	}
+	c.JSON(http.StatusOK, GroupStats{
+		GroupID:         groupID,
+		MessageCount:    stats.MessageCount,
+		MessagesLast24h: stats.MessagesLast24h,
+		AttachmentCount: stats.AttachmentCount,
+		AttachmentBytes: stats.AttachmentBytes,
+		MemberCount:     stats.MemberCount,
+	})
+}
@@ -0,0 +1,55 @@
+package ws
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits on the plaintext tags admins put on a group.
+const (
+	maxGroupTags      = 10
+	maxGroupTagLength = 32
+)
+
+// normalizeGroupTags trims, lowercases and de-duplicates tags, keeping their order. It
+// returns a message for the client if any tag is empty, too long or has characters
+// other than letters, digits, spaces, '-' and '_', or if there are too many.
+func normalizeGroupTags(tags []string) ([]string, string) {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, raw := range tags {
+		tag, msg := normalizeGroupTag(raw)
+		if msg != "" {
+			return nil, msg
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxGroupTags {
+		return nil, fmt.Sprintf("A group can have at most %d tags", maxGroupTags)
+	}
+	return normalized, ""
+}
+
+// normalizeGroupTag returns tag in its stored form, or a message for the client if
+// it isn't a valid tag.
+func normalizeGroupTag(raw string) (string, string) {
+	tag := strings.ToLower(strings.Join(strings.Fields(raw), " "))
+	if tag == "" {
+		return "", "Tags cannot be blank"
+	}
+	if utf8.RuneCountInString(tag) > maxGroupTagLength {
+		return "", fmt.Sprintf("Tags can be at most %d characters", maxGroupTagLength)
+	}
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != ' ' && r != '-' && r != '_' {
+			return "", "Tags may only contain letters, digits, spaces, '-' and '_'"
+		}
+	}
+	return tag, ""
+}
@@ -3,6 +3,8 @@ package ws
 import (
 	"chat-app-server/auth"
 	"chat-app-server/db"
+	"chat-app-server/metrics"
+	"chat-app-server/ratelimit"
 	"chat-app-server/util"
 	"context"
 	"crypto/ed25519"
@@ -10,15 +12,20 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -28,10 +35,72 @@ type Handler struct {
 	db   *db.Queries
 	ctx  context.Context
 	conn *pgxpool.Pool
+	// authTimeout is how long a new WebSocket connection has to send its auth message.
+	authTimeout time.Duration
+	// minProtocolVersion is the oldest WebSocket protocol version still accepted.
+	minProtocolVersion int
+	// idleTimeout closes connections that send no application messages for this long; 0 disables it.
+	idleTimeout time.Duration
+	// maxGroupDuration caps the length of a group's start/end window.
+	maxGroupDuration time.Duration
+	// groupCreationLimiter throttles group creation; it is shared with the reserve endpoint.
+	groupCreationLimiter *ratelimit.Limiter
+	// autoMuteGroupSize mutes new members of groups bigger than this; 0 disables it.
+	autoMuteGroupSize int
+	// messageEditHistoryDepth is how many earlier versions of a message are kept and served.
+	messageEditHistoryDepth int
+	// compression offers permessage-deflate to clients that ask for it during the upgrade.
+	compression bool
+	// groupImages fills in a blurhash for group images set without one; may be nil.
+	groupImages GroupImageProcessor
 }
 
-func NewHandler(h *Hub, db *db.Queries, ctx context.Context, conn *pgxpool.Pool) *Handler {
-	return &Handler{hub: h, db: db, ctx: ctx, conn: conn}
+// GroupImageProcessor is told when a group image is set without a blurhash so it can
+// derive one. The images handler implements it.
+type GroupImageProcessor interface {
+	GroupImageSet(groupID uuid.UUID, objectKey string)
+}
+
+func NewHandler(h *Hub, db *db.Queries, ctx context.Context, conn *pgxpool.Pool, groupCreationLimiter *ratelimit.Limiter, groupImages GroupImageProcessor) *Handler {
+	return &Handler{
+		hub:                     h,
+		db:                      db,
+		ctx:                     ctx,
+		conn:                    conn,
+		groupCreationLimiter:    groupCreationLimiter,
+		groupImages:             groupImages,
+		authTimeout:             time.Duration(util.GetEnvInt("WS_AUTH_TIMEOUT_SECONDS", 10)) * time.Second,
+		minProtocolVersion:      util.GetEnvInt("WS_MIN_PROTOCOL_VERSION", protocolVersionLegacy),
+		idleTimeout:             time.Duration(util.GetEnvInt("WS_IDLE_TIMEOUT_SECONDS", 0)) * time.Second,
+		maxGroupDuration:        time.Duration(util.GetEnvInt("MAX_GROUP_DURATION_DAYS", 30)) * 24 * time.Hour,
+		autoMuteGroupSize:       util.GetEnvInt("AUTO_MUTE_GROUP_SIZE", 0),
+		messageEditHistoryDepth: util.GetEnvIntAtLeast("MESSAGE_EDIT_HISTORY_DEPTH", 20, 0),
+		compression:             util.GetEnvBool("WS_COMPRESSION", false),
+	}
+}
+
+// fillMissingBlurhash passes a newly set group image to groupImages when the client
+// didn't supply a blurhash for it.
+func (h *Handler) fillMissingBlurhash(groupID uuid.UUID, imageURL, blurhash *string) {
+	if h.groupImages == nil || imageURL == nil || *imageURL == "" {
+		return
+	}
+	if blurhash != nil && *blurhash != "" {
+		return
+	}
+	h.groupImages.GroupImageSet(groupID, *imageURL)
+}
+
+// validateGroupWindow returns a client-facing error if a group's start/end window is
+// empty, reversed, or longer than the configured maximum.
+func (h *Handler) validateGroupWindow(startTime, endTime time.Time) string {
+	if !endTime.After(startTime) {
+		return "End time must be after start time"
+	}
+	if endTime.Sub(startTime) > h.maxGroupDuration {
+		return fmt.Sprintf("Groups can last at most %d days", int(h.maxGroupDuration.Hours()/24))
+	}
+	return ""
 }
 
 var upgrader = websocket.Upgrader{
@@ -43,26 +112,65 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// Reason codes sent in auth_failure responses. Clients should retry the connection for
+// authReasonTimeout and authReasonUnavailable, and prompt a re-login for the rest.
 const (
-	authTimeout = 10 * time.Second
+	authReasonTimeout             = "timeout"
+	authReasonInvalidMessage      = "invalid_auth_message"
+	authReasonMissingDevice       = "missing_device_identifier"
+	authReasonTokenExpired        = "token_expired"
+	authReasonInvalidToken        = "invalid_token"
+	authReasonUserNotFound        = "user_not_found"
+	authReasonDeviceNotRegistered = "device_not_registered"
+	authReasonInvalidDeviceKey    = "invalid_device_key"
+	authReasonUnavailable         = "unavailable"
+	authReasonUnsupportedProtocol = "unsupported_protocol_version"
 )
 
 type AuthMessage struct {
 	Type             string `json:"type"`
 	Token            string `json:"token"`
 	DeviceIdentifier string `json:"device_identifier"`
+	// ProtocolVersion is the client's WebSocket protocol version; omitted means 1.
+	ProtocolVersion int `json:"protocol_version,omitempty"`
+	// KnownGroups and GroupsSyncedAt describe the groups the client already has; when
+	// GroupsSyncedAt is set the server answers with a membership_delta.
+	KnownGroups    []uuid.UUID `json:"known_groups,omitempty"`
+	GroupsSyncedAt *time.Time  `json:"groups_synced_at,omitempty"`
 }
 
 type ServerResponseMessage struct {
 	Type    string `json:"type"`
 	Message string `json:"message,omitempty"`
 	Error   string `json:"error,omitempty"`
+	// ProtocolVersion is the negotiated protocol version, set on auth_success.
+	ProtocolVersion int `json:"protocol_version,omitempty"`
+	// Reason is a machine-readable code, set on auth_failure.
+	Reason string `json:"reason,omitempty"`
+}
+
+// rejectAuth sends an auth_failure with a reason code, then the close frame.
+func rejectAuth(conn *websocket.Conn, reason, errMsg string, closeCode int, closeText string) {
+	conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if err := conn.WriteJSON(ServerResponseMessage{Type: "auth_failure", Error: errMsg, Reason: reason}); err != nil {
+		log.Printf("Error sending auth_failure (%s): %v", reason, err)
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, closeText))
 }
 
 func (h *Handler) EstablishConnection(c *gin.Context) {
 	requestCtx := c.Request.Context()
 
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if h.hub.AtCapacity() {
+		metrics.RejectedConnections.Add(1)
+		log.Printf("Rejecting WebSocket upgrade from %s: instance at connection capacity", c.Request.RemoteAddr)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Server at capacity, please retry"})
+		return
+	}
+
+	connUpgrader := upgrader
+	connUpgrader.EnableCompression = h.compression
+	conn, err := connUpgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("Failed to upgrade connection: %v", err)
 		return
@@ -76,10 +184,12 @@ func (h *Handler) EstablishConnection(c *gin.Context) {
 	var userID uuid.UUID
 	var user *db.GetUserByIdRow
 	var authMsg AuthMessage
+	var protocolVersion int
 	var authSigningPublicKey ed25519.PublicKey
+	var tokenExpiresAt time.Time
 	isAuthenticated := false
 
-	if err := conn.SetReadDeadline(time.Now().Add(authTimeout)); err != nil {
+	if err := conn.SetReadDeadline(time.Now().Add(h.authTimeout)); err != nil {
 		log.Printf("Error setting read deadline for auth: %v", err)
 		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "Internal error during setup"))
 		return
@@ -93,8 +203,6 @@ func (h *Handler) EstablishConnection(c *gin.Context) {
 
 	if err != nil {
 		log.Printf("Error reading auth message: %v", err)
-		closeCode := websocket.ClosePolicyViolation
-		errMsg := "Authentication error"
 		if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseTryAgainLater) {
 			log.Printf("Client disconnected before authenticating: %v", err)
 			return
@@ -103,78 +211,99 @@ func (h *Handler) EstablishConnection(c *gin.Context) {
 			return
 		} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 			log.Println("Authentication timeout")
-			errMsg = "Authentication timeout"
+			rejectAuth(conn, authReasonTimeout, "No authentication message received in time.", websocket.ClosePolicyViolation, "Authentication timeout")
+			return
 		}
-		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, errMsg))
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Authentication error"))
 		return
 	}
 
 	if messageType == websocket.TextMessage {
 		if err := json.Unmarshal(messageBytes, &authMsg); err == nil && authMsg.Type == "auth" {
 			if authMsg.DeviceIdentifier == "" {
-				response := ServerResponseMessage{Type: "auth_failure", Error: "Missing device_identifier in auth payload."}
-				conn.WriteJSON(response)
-				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Missing device identifier"))
+				rejectAuth(conn, authReasonMissingDevice, "Missing device_identifier in auth payload.", websocket.ClosePolicyViolation, "Missing device identifier")
 				return
 			}
-			extractedUserID, validationErr := auth.ValidateToken(authMsg.Token)
+			negotiated, protocolErr := negotiateProtocol(authMsg.ProtocolVersion, h.minProtocolVersion)
+			if protocolErr != nil {
+				rejectAuth(conn, authReasonUnsupportedProtocol, protocolErr.Error()+". Please update the app.", websocket.ClosePolicyViolation, "Unsupported protocol version")
+				return
+			}
+			protocolVersion = negotiated
+			extractedUserID, expiresAt, validationErr := auth.ValidateTokenWithExpiry(authMsg.Token)
 			if validationErr == nil {
-				fetchedUser, dbErr := h.db.GetUserById(requestCtx, extractedUserID)
+				// Cancelled as soon as the lookups are done rather than deferred, which
+				// would hold the timer for the whole life of the connection.
+				authCtx, cancelAuth := util.WithQueryTimeout(requestCtx)
+				fetchedUser, dbErr := h.db.GetUserById(authCtx, extractedUserID)
+				var deviceKey db.DeviceKey
+				var keyErr error
 				if dbErr == nil {
-					deviceKey, keyErr := h.db.GetDeviceKeyByIdentifier(requestCtx, db.GetDeviceKeyByIdentifierParams{
+					deviceKey, keyErr = h.db.GetDeviceKeyByIdentifier(authCtx, db.GetDeviceKeyByIdentifierParams{
 						UserID:           extractedUserID,
 						DeviceIdentifier: authMsg.DeviceIdentifier,
 					})
+				}
+				cancelAuth()
+				if dbErr == nil {
 					if keyErr != nil {
 						log.Printf("Auth failed: device key lookup failed for user %s and device %s: %v", extractedUserID.String(), authMsg.DeviceIdentifier, keyErr)
-						response := ServerResponseMessage{Type: "auth_failure", Error: "Device is not registered for this account."}
-						conn.WriteJSON(response)
-						conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Device not registered"))
+						if errors.Is(keyErr, pgx.ErrNoRows) {
+							rejectAuth(conn, authReasonDeviceNotRegistered, "Device is not registered for this account.", websocket.ClosePolicyViolation, "Device not registered")
+						} else {
+							rejectAuth(conn, authReasonUnavailable, "Device lookup failed, please retry.", websocket.ClosePolicyViolation, "Authentication failed")
+						}
 						return
 					}
 					if len(deviceKey.SigningPublicKey) != ed25519.PublicKeySize {
 						log.Printf("Auth failed: invalid signing key length for user %s device %s: got %d expected %d",
 							extractedUserID.String(), authMsg.DeviceIdentifier, len(deviceKey.SigningPublicKey), ed25519.PublicKeySize)
-						response := ServerResponseMessage{Type: "auth_failure", Error: "Invalid device signing key registration."}
-						conn.WriteJSON(response)
-						conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Invalid device signing key"))
+						rejectAuth(conn, authReasonInvalidDeviceKey, "Invalid device signing key registration.", websocket.ClosePolicyViolation, "Invalid device signing key")
 						return
 					}
 					authSigningPublicKey = ed25519.PublicKey(deviceKey.SigningPublicKey)
 					userID = extractedUserID
 					user = &fetchedUser
+					tokenExpiresAt = expiresAt
 					isAuthenticated = true
 					log.Printf("User %s (%s) authenticated successfully via WebSocket.", userID.String(), user.Username)
-					response := ServerResponseMessage{Type: "auth_success", Message: "Authentication successful"}
+					response := ServerResponseMessage{Type: "auth_success", Message: "Authentication successful", ProtocolVersion: protocolVersion}
 					if err := conn.WriteJSON(response); err != nil {
 						log.Printf("Error sending auth_success to user %s: %v", userID.String(), err)
 						// Don't immediately close; client might still proceed if they received it.
 						// But this is a bad sign.
 					}
+					if protocolVersion >= eventMinProtocol["connection_ready"] {
+						if err := conn.WriteJSON(h.connectionReady(protocolVersion)); err != nil {
+							log.Printf("Error sending connection_ready to user %s: %v", userID.String(), err)
+						}
+					}
 				} else {
 					log.Printf("Auth failed: could not fetch user data for ID %s: %v", extractedUserID.String(), dbErr)
-					response := ServerResponseMessage{Type: "auth_failure", Error: "Authentication failed: User data unavailable."}
-					conn.WriteJSON(response)
-					conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Authentication failed"))
+					if errors.Is(dbErr, pgx.ErrNoRows) {
+						rejectAuth(conn, authReasonUserNotFound, "Authentication failed: User not found.", websocket.ClosePolicyViolation, "Authentication failed")
+					} else {
+						rejectAuth(conn, authReasonUnavailable, "Authentication failed: User data unavailable.", websocket.ClosePolicyViolation, "Authentication failed")
+					}
 					return
 				}
 			} else {
 				log.Printf("Authentication failed (token validation): %v", validationErr)
-				response := ServerResponseMessage{Type: "auth_failure", Error: validationErr.Error()}
-				conn.WriteJSON(response)
-				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Authentication failed"))
+				reason := authReasonInvalidToken
+				if errors.Is(validationErr, jwt.ErrTokenExpired) {
+					reason = authReasonTokenExpired
+				}
+				rejectAuth(conn, reason, validationErr.Error(), websocket.ClosePolicyViolation, "Authentication failed")
 				return
 			}
 		} else {
 			log.Printf("Invalid or non-auth message received as first message. Type: %d, JSON Err: %v", messageType, err)
-			response := ServerResponseMessage{Type: "auth_failure", Error: "Invalid or missing authentication message."}
-			conn.WriteJSON(response)
-			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Authentication required"))
+			rejectAuth(conn, authReasonInvalidMessage, "Invalid or missing authentication message.", websocket.ClosePolicyViolation, "Authentication required")
 			return
 		}
 	} else {
 		log.Printf("Received non-text message type (%d) during authentication phase.", messageType)
-		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseUnsupportedData, "Expected text message for authentication."))
+		rejectAuth(conn, authReasonInvalidMessage, "Expected a text auth message.", websocket.CloseUnsupportedData, "Expected text message for authentication.")
 		return
 	}
 
@@ -189,10 +318,28 @@ func (h *Handler) EstablishConnection(c *gin.Context) {
 		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Invalid device signing key"))
 		return
 	}
-	client := NewClient(conn, user, authMsg.DeviceIdentifier, authSigningPublicKey)
+	// Re-check after the auth handshake; other connections may have filled the instance meanwhile.
+	if h.hub.AtCapacity() {
+		metrics.RejectedConnections.Add(1)
+		log.Printf("Rejecting authenticated connection for user %s: instance at connection capacity", user.ID.String())
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "Server at capacity"))
+		return
+	}
+
+	client := NewClient(conn, user, authMsg.DeviceIdentifier, authSigningPublicKey, tokenExpiresAt, protocolVersion, h.idleTimeout)
+	if !h.hub.acquireConnectionSlot(client) {
+		metrics.RejectedConnections.Add(1)
+		log.Printf("Rejecting connection for user %s: per-user connection limit reached", user.ID.String())
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Too many connections"))
+		return
+	}
+	defer h.hub.releaseConnectionSlot(client)
 	log.Printf("Client %s (%s) connected. Remote: %s", client.User.ID.String(), client.User.Username, conn.RemoteAddr())
 
 	h.hub.Register <- client
+	if authMsg.GroupsSyncedAt != nil {
+		h.sendMembershipDelta(requestCtx, client, authMsg.KnownGroups, *authMsg.GroupsSyncedAt)
+	}
 
 	defer func() {
 		log.Printf("Initiating cleanup for client %s (%s).", client.User.ID.String(), client.User.Username)
@@ -351,6 +498,12 @@ func (h *Handler) GetBlockedUsers(c *gin.Context) {
 		return
 	}
 
+	// cursor or limit opts into the paginated list, as for GetRelevantUsers.
+	if c.Query("cursor") != "" || c.Query("limit") != "" {
+		h.listBlockedUsersPage(c, user)
+		return
+	}
+
 	blockedUsers, err := h.db.GetBlockedUsers(ctx, user.ID)
 	if err != nil {
 		log.Printf("Error getting blocked users for %s: %v", user.ID, err)
@@ -364,6 +517,9 @@ func (h *Handler) GetBlockedUsers(c *gin.Context) {
 }
 
 func (h *Handler) InviteUsersToGroup(c *gin.Context) {
+	if h.rejectIfMaintenance(c) {
+		return
+	}
 	ctx := c.Request.Context()
 	invitingUser, err := util.GetUser(c, h.db)
 	if err != nil {
@@ -395,9 +551,10 @@ func (h *Handler) InviteUsersToGroup(c *gin.Context) {
 		return
 	}
 
-	usersToInvite, err := h.db.GetUsersByEmails(ctx, req.Emails)
+	usersToInvite, matched, unmatched, err := h.resolveInvitees(ctx, req.Emails, req.Phones)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve users by email: " + err.Error()})
+		log.Printf("Error resolving invitees for group %s: %v", req.GroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up users to invite"})
 		return
 	}
 
@@ -405,6 +562,8 @@ func (h *Handler) InviteUsersToGroup(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"invites":       []db.UserGroup{},
 			"skipped_users": []string{},
+			"matched":       matched,
+			"unmatched":     unmatched,
 		})
 		return
 	}
@@ -418,6 +577,12 @@ func (h *Handler) InviteUsersToGroup(c *gin.Context) {
 	defer tx.Rollback(ctx)
 
 	qtx := h.db.WithTx(tx)
+	muted, err := h.newMemberMuted(ctx, qtx, req.GroupID, len(usersToInvite))
+	if err != nil {
+		log.Printf("Error loading default mute state for group %s: %v", req.GroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add one or more users to the group"})
+		return
+	}
 	var successfulInvites []db.UserGroup
 	var invitedUserIDs []uuid.UUID
 	var skippedUsers []string
@@ -434,7 +599,7 @@ func (h *Handler) InviteUsersToGroup(c *gin.Context) {
 		}
 		if hasConflict {
 			log.Printf("Skipping invite for user %s to group %s due to block conflict", user.ID, req.GroupID)
-			skippedUsers = append(skippedUsers, user.Email)
+			skippedUsers = append(skippedUsers, user.Identifier)
 			continue
 		}
 
@@ -442,6 +607,7 @@ func (h *Handler) InviteUsersToGroup(c *gin.Context) {
 			UserID:  &user.ID,
 			GroupID: &req.GroupID,
 			Admin:   false,
+			Muted:   muted,
 		})
 		if err != nil {
 			if errors.Is(err, pgx.ErrNoRows) { // User already active in group, ON CONFLICT DO NOTHING returned no rows
@@ -452,6 +618,11 @@ func (h *Handler) InviteUsersToGroup(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add one or more users to the group"})
 			return
 		}
+		if err := recordAudit(ctx, qtx, req.GroupID, invitingUser.ID, auditMemberInvited, &user.ID, nil); err != nil {
+			log.Printf("Error recording invite of user %s to group %s: %v", user.ID, req.GroupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add one or more users to the group"})
+			return
+		}
 		successfulInvites = append(successfulInvites, userGroup)
 		invitedUserIDs = append(invitedUserIDs, user.ID)
 	}
@@ -479,9 +650,88 @@ func (h *Handler) InviteUsersToGroup(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"invites":       successfulInvites,
 		"skipped_users": skippedUsers,
+		"matched":       matched,
+		"unmatched":     unmatched,
 	})
 }
 
+type invitee struct {
+	ID uuid.UUID
+	// Identifier is the email or phone number the inviter used to find this user.
+	Identifier string
+}
+
+// resolveInvitees looks up users by email and by verified phone number. It returns the
+// de-duplicated users along with which of the submitted identifiers matched an account,
+// so the client can fall back to invite links for the rest.
+func (h *Handler) resolveInvitees(ctx context.Context, emails, phones []string) ([]invitee, []string, []string, error) {
+	var invitees []invitee
+	seen := make(map[uuid.UUID]bool)
+	matched := []string{}
+	unmatched := []string{}
+
+	if len(emails) > 0 {
+		normalized := make([]string, len(emails))
+		for i, email := range emails {
+			normalized[i] = util.NormalizeEmail(email)
+		}
+		emailUsers, err := h.db.GetUsersByEmails(ctx, normalized)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		byEmail := make(map[string]uuid.UUID, len(emailUsers))
+		for _, u := range emailUsers {
+			byEmail[util.NormalizeEmail(u.Email)] = u.ID
+		}
+		for i, email := range emails {
+			id, ok := byEmail[normalized[i]]
+			if !ok {
+				unmatched = append(unmatched, email)
+				continue
+			}
+			matched = append(matched, email)
+			if !seen[id] {
+				seen[id] = true
+				invitees = append(invitees, invitee{ID: id, Identifier: email})
+			}
+		}
+	}
+
+	if len(phones) > 0 {
+		normalized := make([]string, 0, len(phones))
+		for _, phone := range phones {
+			if n, ok := util.NormalizePhone(phone); ok {
+				normalized = append(normalized, n)
+			}
+		}
+		byPhone := make(map[string]uuid.UUID)
+		if len(normalized) > 0 {
+			phoneUsers, err := h.db.GetUsersByPhones(ctx, normalized)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			for _, u := range phoneUsers {
+				byPhone[u.Phone.String] = u.ID
+			}
+		}
+		for _, phone := range phones {
+			n, _ := util.NormalizePhone(phone)
+			id, ok := byPhone[n]
+			if n == "" || !ok {
+				unmatched = append(unmatched, phone)
+				continue
+			}
+			matched = append(matched, phone)
+			if !seen[id] {
+				seen[id] = true
+				invitees = append(invitees, invitee{ID: id, Identifier: phone})
+			}
+		}
+	}
+
+	return invitees, matched, unmatched, nil
+}
+
 func (h *Handler) RemoveUserFromGroup(c *gin.Context) {
 	ctx := c.Request.Context()
 	requestingUser, err := util.GetUser(c, h.db)
@@ -514,7 +764,7 @@ func (h *Handler) RemoveUserFromGroup(c *gin.Context) {
 		return
 	}
 
-	userToKick, err := h.db.GetUserByEmail(ctx, req.Email)
+	userToKick, err := h.db.GetUserByEmail(ctx, util.NormalizeEmail(req.Email))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User specified for removal not found by email"})
@@ -530,7 +780,16 @@ func (h *Handler) RemoveUserFromGroup(c *gin.Context) {
 		return
 	}
 
-	deletedUserGroup, err := h.db.DeleteUserGroup(ctx, db.DeleteUserGroupParams{
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for removing user from group: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start database operation"})
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := h.db.WithTx(tx)
+
+	deletedUserGroup, err := qtx.DeleteUserGroup(ctx, db.DeleteUserGroupParams{
 		UserID:  &userToKick.ID,
 		GroupID: &req.GroupID,
 	})
@@ -543,6 +802,16 @@ func (h *Handler) RemoveUserFromGroup(c *gin.Context) {
 		}
 		return
 	}
+	if err := recordAudit(ctx, qtx, req.GroupID, requestingUser.ID, auditMemberRemoved, &userToKick.ID, nil); err != nil {
+		log.Printf("Error recording removal of user %s from group %s: %v", userToKick.ID, req.GroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove user from group"})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit removal of user %s from group %s: %v", userToKick.ID, req.GroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove user from group"})
+		return
+	}
 
 	select {
 	case h.hub.RemoveUserFromGroupChan <- &RemoveClientFromGroupMsg{UserID: userToKick.ID, GroupID: req.GroupID}:
@@ -557,6 +826,9 @@ func (h *Handler) RemoveUserFromGroup(c *gin.Context) {
 }
 
 func (h *Handler) CreateGroup(c *gin.Context) {
+	if h.rejectIfMaintenance(c) {
+		return
+	}
 	ctx := c.Request.Context()
 	user, err := util.GetUser(c, h.db)
 	if err != nil {
@@ -570,25 +842,22 @@ func (h *Handler) CreateGroup(c *gin.Context) {
 		return
 	}
 
-	if req.EndTime.Before(req.StartTime) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "End time must be after start time"})
+	// A retry after a lost response finds the group already there; answer it the
+	// same way the first attempt would have.
+	if h.replayCreatedGroup(c, req.ID, user.ID) {
 		return
 	}
-	if req.StartTime.Before(time.Now().Add(-1 * time.Hour)) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Start time must be in the future"})
+
+	if msg := h.validateGroupWindow(req.StartTime, req.EndTime); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
 		return
 	}
-
-	resv, err := h.db.GetGroupReservation(ctx, req.ID)
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		log.Printf("error fetching reservation %s: %v", req.ID, err)
-		c.JSON(http.StatusInternalServerError,
-			gin.H{"error": "Internal error checking reservation"})
+	if req.StartTime.Before(time.Now().Add(-1 * time.Hour)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start time must be in the future"})
 		return
 	}
-	if resv != (db.GroupReservation{}) && resv.UserID != user.ID {
-		c.JSON(http.StatusForbidden,
-			gin.H{"error": "You are not the reserver of this GroupID"})
+	// Keyed by group ID, so creating a group this user just reserved doesn't count twice.
+	if !h.groupCreationLimiter.AllowRequest(c, user.ID.String(), req.ID.String()) {
 		return
 	}
 
@@ -601,18 +870,45 @@ func (h *Handler) CreateGroup(c *gin.Context) {
 	defer tx.Rollback(ctx)
 
 	qtx := h.db.WithTx(tx)
+
+	// A reservation is optional (the client may have released it or never reserved),
+	// but one held by someone else blocks creation. Locking the row keeps a concurrent
+	// release or transfer from slipping in between this check and the delete below.
+	resv, err := qtx.GetGroupReservationForUpdate(ctx, req.ID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("error fetching reservation %s: %v", req.ID, err)
+		c.JSON(http.StatusInternalServerError,
+			gin.H{"error": "Internal error checking reservation"})
+		return
+	}
+	if err == nil && resv.UserID != user.ID {
+		c.JSON(http.StatusForbidden,
+			gin.H{"error": "You are not the reserver of this GroupID"})
+		return
+	}
 	groupParams := db.InsertGroupParams{
-		ID:          req.ID,
-		Name:        req.Name,
-		StartTime:   pgtype.Timestamp{Time: req.StartTime, Valid: true},
-		EndTime:     pgtype.Timestamp{Time: req.EndTime, Valid: true},
-		Description: util.NullablePgText(req.Description),
-		Location:    util.NullablePgText(req.Location),
-		ImageUrl:    util.NullablePgText(req.ImageUrl),
-		Blurhash:    util.NullablePgText(req.Blurhash),
+		ID:               req.ID,
+		Name:             req.Name,
+		StartTime:        pgtype.Timestamp{Time: req.StartTime, Valid: true},
+		EndTime:          pgtype.Timestamp{Time: req.EndTime, Valid: true},
+		Description:      util.NullablePgText(req.Description),
+		Location:         util.NullablePgText(req.Location),
+		ImageUrl:         util.NullablePgText(req.ImageUrl),
+		Blurhash:         util.NullablePgText(req.Blurhash),
+		RequiresApproval: req.RequiresApproval,
 	}
 	group, err := qtx.InsertGroup(ctx, groupParams)
 	if err != nil {
+		// The ID is taken, by a concurrent retry or by a deleted group.
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+			tx.Rollback(ctx)
+			if h.replayCreatedGroup(c, req.ID, user.ID) {
+				return
+			}
+			c.JSON(http.StatusConflict, gin.H{"error": "Group ID already used"})
+			return
+		}
 		log.Printf("Error inserting group: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group"})
 		return
@@ -641,6 +937,7 @@ func (h *Handler) CreateGroup(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to finalize group creation"})
 		return
 	}
+	h.fillMissingBlurhash(group.ID, req.ImageUrl, req.Blurhash)
 
 	select {
 	case h.hub.InitializeGroupChan <- &InitializeGroupMsg{GroupID: group.ID, Name: group.Name, AdminID: user.ID}:
@@ -654,6 +951,54 @@ func (h *Handler) CreateGroup(c *gin.Context) {
 	c.JSON(http.StatusOK, group)
 }
 
+// replayCreatedGroup handles a CreateGroup for a group ID that is already taken. If
+// the caller is an admin of that group it was their own earlier attempt, and the group
+// is returned with 200; anyone else gets 409. It returns false, having written
+// nothing, when no live group has the ID.
+func (h *Handler) replayCreatedGroup(c *gin.Context, groupID, userID uuid.UUID) bool {
+	ctx := c.Request.Context()
+	existing, err := h.db.GetGroupById(ctx, groupID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false
+	}
+	if err != nil {
+		log.Printf("Error checking for existing group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group"})
+		return true
+	}
+
+	membership, err := h.db.GetUserGroupByGroupIDAndUserID(ctx, db.GetUserGroupByGroupIDAndUserIDParams{
+		GroupID: &groupID,
+		UserID:  &userID,
+	})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error checking membership of existing group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group"})
+		return true
+	}
+	if err != nil || !membership.Admin {
+		c.JSON(http.StatusConflict, gin.H{"error": "Group already exists"})
+		return true
+	}
+
+	log.Printf("CreateGroup retry for existing group %s by admin %s; returning it.", groupID, userID)
+	c.JSON(http.StatusOK, db.Group{
+		ID:               existing.ID,
+		Name:             existing.Name,
+		CreatedAt:        existing.CreatedAt,
+		UpdatedAt:        existing.UpdatedAt,
+		StartTime:        existing.StartTime,
+		EndTime:          existing.EndTime,
+		Description:      existing.Description,
+		Location:         existing.Location,
+		ImageUrl:         existing.ImageUrl,
+		Blurhash:         existing.Blurhash,
+		RequiresApproval: existing.RequiresApproval,
+		AnnouncementOnly: existing.AnnouncementOnly,
+	})
+	return true
+}
+
 func (h *Handler) UpdateGroup(c *gin.Context) {
 	ctx := c.Request.Context()
 	user, err := util.GetUser(c, h.db)
@@ -711,9 +1056,13 @@ func (h *Handler) UpdateGroup(c *gin.Context) {
 	if req.EndTime != nil {
 		endTime = *req.EndTime
 	}
-	if endTime.Before(startTime) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "End time must be after start time"})
-		return
+	// Only check the window when it changes, so groups created before the duration cap
+	// can still be edited.
+	if req.StartTime != nil || req.EndTime != nil {
+		if msg := h.validateGroupWindow(startTime, endTime); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
 	}
 	if req.StartTime != nil && req.StartTime.Before(time.Now().Add(-1*time.Hour)) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Start time must be in the future"})
@@ -728,13 +1077,54 @@ func (h *Handler) UpdateGroup(c *gin.Context) {
 	updateParams.Location = util.NullablePgText(req.Location)
 	updateParams.ImageUrl = util.NullablePgText(req.ImageUrl)
 	updateParams.Blurhash = util.NullablePgText(req.Blurhash)
+	updateParams.RequiresApproval = util.NullablePgBool(req.RequiresApproval)
+	updateParams.AnnouncementOnly = util.NullablePgBool(req.AnnouncementOnly)
 
-	_, err = h.db.UpdateGroup(ctx, updateParams)
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for group update: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start database operation"})
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := h.db.WithTx(tx)
+
+	_, err = qtx.UpdateGroup(ctx, updateParams)
 	if err != nil {
 		log.Printf("Error updating group %d: %v", groupID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
 		return
 	}
+	// Invites never outlive the group (CreateInvite caps them at end_time), so pull
+	// existing ones in when the end moves earlier. If it moved into the past, this
+	// expires them all: the group has ended.
+	if req.EndTime != nil && (!oldGroup.EndTime.Valid || req.EndTime.Before(oldGroup.EndTime.Time)) {
+		capped, err := qtx.CapInviteExpiries(ctx, db.CapInviteExpiriesParams{
+			EndTime: pgtype.Timestamptz{Time: *req.EndTime, Valid: true},
+			GroupID: groupID,
+		})
+		if err != nil {
+			log.Printf("Error capping invite expiries for group %s: %v", groupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
+			return
+		}
+		if req.EndTime.Before(time.Now()) {
+			log.Printf("Group %s ended early by admin %s; %d invites expired.", groupID, user.ID, capped)
+		} else if capped > 0 {
+			log.Printf("Shortened %d invites of group %s to its new end time.", capped, groupID)
+		}
+	}
+	if err := recordAudit(ctx, qtx, groupID, user.ID, auditGroupUpdated, nil, req); err != nil {
+		log.Printf("Error recording update of group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit update of group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
+		return
+	}
+	h.fillMissingBlurhash(groupID, req.ImageUrl, req.Blurhash)
 
 	fullGroupData, err := h.db.GetGroupWithUsersByID(
 		ctx,
@@ -778,11 +1168,12 @@ func (h *Handler) UpdateGroup(c *gin.Context) {
 	}
 
 	responseClientGroup := ClientGroup{
-		ID:         fullGroupData.ID,
-		Name:       fullGroupData.Name,
-		CreatedAt:  fullGroupData.CreatedAt.Time,
-		UpdatedAt:  fullGroupData.UpdatedAt.Time,
-		GroupUsers: clientGroupUsers,
+		ID:               fullGroupData.ID,
+		Name:             fullGroupData.Name,
+		CreatedAt:        fullGroupData.CreatedAt.Time,
+		UpdatedAt:        fullGroupData.UpdatedAt.Time,
+		GroupUsers:       clientGroupUsers,
+		AnnouncementOnly: fullGroupData.AnnouncementOnly,
 	}
 
 	if fullGroupData.StartTime.Valid {
@@ -855,19 +1246,198 @@ func (h *Handler) GetGroups(c *gin.Context) {
 	}
 
 	groups, err := h.db.GetGroupsForUser(ctx, user.ID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error retrieving groups for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve groups"})
+		return
+	}
+
+	// ?tag= narrows the list to groups carrying that tag.
+	tagFilter := ""
+	if raw, ok := c.GetQuery("tag"); ok {
+		var msg string
+		if tagFilter, msg = normalizeGroupTag(raw); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+	}
+
+	tagRows, err := h.db.GetGroupTagsForUser(ctx, &user.ID)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			groups = make([]db.GetGroupsForUserRow, 0)
-		} else {
-			log.Printf("Error retrieving groups for user %d: %v", user.ID, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve groups"})
+		log.Printf("Error retrieving group tags for user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve groups"})
+		return
+	}
+	tags := make(map[uuid.UUID][]string)
+	for _, row := range tagRows {
+		tags[row.GroupID] = append(tags[row.GroupID], row.Tag)
+	}
+
+	// The list still loads without activity; clients then show no previews or badges.
+	activity := make(map[uuid.UUID]db.GetGroupActivityForUserRow)
+	activityRows, err := h.db.GetGroupActivityForUser(ctx, &user.ID)
+	if err != nil {
+		log.Printf("Error retrieving group activity for user %s: %v", user.ID, err)
+	}
+	for _, row := range activityRows {
+		if row.GroupID != nil {
+			activity[*row.GroupID] = row
+		}
+	}
+
+	items := make([]GroupListItem, 0, len(groups))
+	for _, group := range groups {
+		if tagFilter != "" && !slices.Contains(tags[group.ID], tagFilter) {
+			continue
+		}
+		item := GroupListItem{GetGroupsForUserRow: group, Tags: tags[group.ID]}
+		if item.Tags == nil {
+			item.Tags = []string{}
+		}
+		if row, ok := activity[group.ID]; ok {
+			item.UnreadCount = row.UnreadCount
+			if row.LastMessageAt.Valid {
+				item.LastMessage = &GroupLastMessage{
+					SenderID:    row.LastSenderID,
+					MessageType: row.LastMessageType.MessageType,
+					Timestamp:   row.LastMessageAt.Time,
+				}
+				if row.LastSenderUsername.Valid {
+					item.LastMessage.SenderUsername = &row.LastSenderUsername.String
+				}
+			}
+		}
+		items = append(items, item)
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// MarkGroupRead records that the caller has read the group up to read_at (default now),
+// resetting its unread count in the group list. With a device_identifier it also moves
+// that device's own read marker; the member's marker is the furthest of any device.
+func (h *Handler) MarkGroupRead(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
+		return
+	}
+
+	// The body is optional; older clients send none.
+	var req MarkGroupReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	readAt := time.Now().UTC()
+	if req.ReadAt != nil && req.ReadAt.Before(readAt) {
+		readAt = req.ReadAt.UTC()
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction to mark group %s read for user %s: %v", groupID, user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark group read"})
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := h.db.WithTx(tx)
+
+	updated, err := qtx.MarkGroupRead(ctx, db.MarkGroupReadParams{
+		ReadAt:  pgtype.Timestamp{Time: readAt, Valid: true},
+		UserID:  &user.ID,
+		GroupID: &groupID,
+	})
+	if err != nil {
+		log.Printf("Error marking group %s read for user %s: %v", groupID, user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark group read"})
+		return
+	}
+	if updated == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User does not have access to this group"})
+		return
+	}
+
+	if req.DeviceIdentifier != "" {
+		if _, err := qtx.GetDeviceKeyByIdentifier(ctx, db.GetDeviceKeyByIdentifierParams{
+			UserID:           user.ID,
+			DeviceIdentifier: req.DeviceIdentifier,
+		}); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+			} else {
+				log.Printf("Error loading device %s for user %s: %v", req.DeviceIdentifier, user.ID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark group read"})
+			}
+			return
+		}
+		if err := qtx.MarkDeviceGroupRead(ctx, db.MarkDeviceGroupReadParams{
+			UserID:           user.ID,
+			DeviceIdentifier: req.DeviceIdentifier,
+			GroupID:          groupID,
+			LastReadAt:       pgtype.Timestamp{Time: readAt, Valid: true},
+		}); err != nil {
+			log.Printf("Error marking group %s read for user %s device %s: %v", groupID, user.ID, req.DeviceIdentifier, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark group read"})
 			return
 		}
 	}
-	if groups == nil {
-		groups = make([]db.GetGroupsForUserRow, 0)
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing read marker for group %s user %s: %v", groupID, user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark group read"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Group marked read"})
+}
+
+// GetReadState serves GET /ws/groups/read-state?device_identifier=: for each of the
+// caller's groups, how far the member has read (the furthest of any device) and how
+// far the given device has read (null if it never marked the group read).
+func (h *Handler) GetReadState(c *gin.Context) {
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	deviceIdentifier := c.Query("device_identifier")
+	if deviceIdentifier == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "device_identifier is required"})
+		return
+	}
+
+	rows, err := h.db.GetDeviceReadStateForUser(c.Request.Context(), db.GetDeviceReadStateForUserParams{
+		DeviceIdentifier: deviceIdentifier,
+		UserID:           &user.ID,
+	})
+	if err != nil {
+		log.Printf("Error loading read state for user %s device %s: %v", user.ID, deviceIdentifier, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load read state"})
+		return
+	}
+
+	states := make([]GroupReadState, 0, len(rows))
+	for _, row := range rows {
+		if row.GroupID == nil {
+			continue
+		}
+		state := GroupReadState{GroupID: *row.GroupID}
+		if row.LastReadAt.Valid {
+			state.LastReadAt = &row.LastReadAt.Time
+		}
+		if row.DeviceLastReadAt.Valid {
+			state.DeviceLastReadAt = &row.DeviceLastReadAt.Time
+		}
+		states = append(states, state)
 	}
-	c.JSON(http.StatusOK, groups)
+	c.JSON(http.StatusOK, states)
 }
 
 func (h *Handler) GetUsersInGroup(c *gin.Context) {
@@ -917,104 +1487,118 @@ func (h *Handler) LeaveGroup(c *gin.Context) {
 		return
 	}
 
-	tx, err := h.conn.Begin(ctx)
+	deletedUserGroup, groupIsEmpty, err := h.leaveGroup(ctx, user.ID, groupID)
 	if err != nil {
-		log.Printf("Failed to begin transaction for leaving group: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start database operation"})
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User is not a member of this group"})
+		} else {
+			log.Printf("Error leaving group %s for user %s: %v", groupID, user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave group"})
+		}
 		return
 	}
+	h.announceDeparture(ctx, user.ID, groupID, groupIsEmpty)
+	c.JSON(http.StatusOK, deletedUserGroup)
+}
+
+// leaveGroup removes userID from groupID in its own transaction and settles the group
+// afterwards. It reports whether the group was deleted as empty, and returns
+// pgx.ErrNoRows if the user wasn't a member.
+func (h *Handler) leaveGroup(ctx context.Context, userID, groupID uuid.UUID) (db.DeleteUserGroupRow, bool, error) {
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		return db.DeleteUserGroupRow{}, false, fmt.Errorf("begin transaction: %w", err)
+	}
 	defer tx.Rollback(ctx)
 
 	qtx := h.db.WithTx(tx)
 
 	deletedUserGroup, err := qtx.DeleteUserGroup(ctx, db.DeleteUserGroupParams{
-		UserID:  &user.ID,
+		UserID:  &userID,
 		GroupID: &groupID,
 	})
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "User is not a member of this group"})
-		} else {
-			log.Printf("Error deleting user_group link for user %d, group %d: %v", user.ID, groupID, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove user from group"})
-		}
-		return
+		return db.DeleteUserGroupRow{}, false, err
 	}
 
-	remainingUserGroups, err := qtx.GetAllUserGroupsForGroup(ctx, &groupID)
-	groupIsEmpty := false
+	groupIsEmpty, err := settleGroupAfterDeparture(ctx, qtx, groupID, userID, deletedUserGroup.Admin)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			groupIsEmpty = true
-		} else {
-			log.Printf("Error retrieving remaining user_groups for group %d: %v", groupID, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check group status after leaving"})
-			return
-		}
-	} else if len(remainingUserGroups) == 0 {
-		groupIsEmpty = true
-	}
-
-	if groupIsEmpty {
-		if _, err = qtx.DeleteGroup(ctx, groupID); err != nil {
-			log.Printf("Error deleting empty group %d: %v", groupID, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clean up empty group"})
-			return
-		}
-		log.Printf("Group %d deleted as it became empty after user %d left.", groupID, user.ID)
-	} else {
-		if deletedUserGroup.Admin {
-			anyAdminLeft := false
-			for _, ug := range remainingUserGroups {
-				if ug.Admin {
-					anyAdminLeft = true
-					break
-				}
-			}
-			if !anyAdminLeft && len(remainingUserGroups) > 0 {
-				promoteParams := db.UpdateUserGroupParams{
-					UserID:  remainingUserGroups[0].UserID,
-					GroupID: remainingUserGroups[0].GroupID,
-					Admin:   true,
-				}
-				if _, err = qtx.UpdateUserGroup(ctx, promoteParams); err != nil {
-					log.Printf("Error promoting new admin for group %d: %v", groupID, err)
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign new admin"})
-					return
-				}
-				log.Printf("User %d promoted to admin in group %d.", remainingUserGroups[0].UserID, groupID)
-			}
-		}
+		return db.DeleteUserGroupRow{}, false, fmt.Errorf("settle group: %w", err)
 	}
 
 	if err := tx.Commit(ctx); err != nil {
-		log.Printf("Failed to commit transaction for leaving group: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to finalize leaving group"})
-		return
+		return db.DeleteUserGroupRow{}, false, fmt.Errorf("commit: %w", err)
 	}
+	return deletedUserGroup, groupIsEmpty, nil
+}
 
+// announceDeparture tells the hub that userID left groupID and, if the group was
+// deleted as empty, to drop its state.
+func (h *Handler) announceDeparture(ctx context.Context, userID, groupID uuid.UUID, groupIsEmpty bool) {
 	select {
-	case h.hub.RemoveUserFromGroupChan <- &RemoveClientFromGroupMsg{UserID: user.ID, GroupID: groupID}:
-		log.Printf("Sent request to hub to process user %d removal from group %d state", user.ID, groupID)
+	case h.hub.RemoveUserFromGroupChan <- &RemoveClientFromGroupMsg{UserID: userID, GroupID: groupID}:
+		log.Printf("Sent request to hub to process user %s removal from group %s state", userID, groupID)
 	case <-ctx.Done():
-		log.Printf("Context cancelled while trying to send RemoveUserFromGroupChan for user %d, group %d", user.ID, groupID)
+		log.Printf("Context cancelled while trying to send RemoveUserFromGroupChan for user %s, group %s", userID, groupID)
 		return
 	default:
-		log.Printf("Warning: Hub RemoveUserFromGroupChan full for user %d group %d. Update might be delayed or dropped.", user.ID, groupID)
+		log.Printf("Warning: Hub RemoveUserFromGroupChan full for user %s group %s. Update might be delayed or dropped.", userID, groupID)
 	}
 
 	if groupIsEmpty {
 		select {
 		case h.hub.DeleteHubGroupChan <- &DeleteHubGroupMsg{GroupID: groupID}:
-			log.Printf("Sent request to hub to delete empty group %d state", groupID)
+			log.Printf("Sent request to hub to delete empty group %s state", groupID)
 		case <-ctx.Done():
-			log.Printf("Context cancelled while trying to send DeleteHubGroupChan for group %d", groupID)
-			return
+			log.Printf("Context cancelled while trying to send DeleteHubGroupChan for group %s", groupID)
 		default:
-			log.Printf("Warning: Hub DeleteHubGroupChan full for group %d. Deletion might be delayed or dropped.", groupID)
+			log.Printf("Warning: Hub DeleteHubGroupChan full for group %s. Deletion might be delayed or dropped.", groupID)
 		}
 	}
-	c.JSON(http.StatusOK, deletedUserGroup)
+}
+
+// settleGroupAfterDeparture soft-deletes the group if the departing member was the
+// last one, or promotes the longest-standing member if the group lost its only admin.
+// Either is recorded in the audit log with the departed user as the actor. It reports
+// whether the group was deleted.
+func settleGroupAfterDeparture(ctx context.Context, qtx *db.Queries, groupID, departedUserID uuid.UUID, departedWasAdmin bool) (bool, error) {
+	remainingUserGroups, err := qtx.GetAllUserGroupsForGroup(ctx, &groupID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return false, fmt.Errorf("error retrieving remaining user_groups: %w", err)
+	}
+
+	if len(remainingUserGroups) == 0 {
+		if _, err := qtx.DeleteGroup(ctx, groupID); err != nil {
+			return false, fmt.Errorf("error deleting empty group: %w", err)
+		}
+		if err := recordAudit(ctx, qtx, groupID, departedUserID, auditGroupDeleted, nil, map[string]string{"reason": "empty"}); err != nil {
+			return false, fmt.Errorf("error recording deletion of empty group: %w", err)
+		}
+		log.Printf("Group %s deleted as it became empty.", groupID)
+		return true, nil
+	}
+
+	if !departedWasAdmin {
+		return false, nil
+	}
+	for _, ug := range remainingUserGroups {
+		if ug.Admin {
+			return false, nil
+		}
+	}
+	promoteParams := db.UpdateUserGroupParams{
+		UserID:  remainingUserGroups[0].UserID,
+		GroupID: remainingUserGroups[0].GroupID,
+		Admin:   true,
+	}
+	if _, err := qtx.UpdateUserGroup(ctx, promoteParams); err != nil {
+		return false, fmt.Errorf("error promoting new admin: %w", err)
+	}
+	if err := recordAudit(ctx, qtx, groupID, departedUserID, auditAdminPromoted, remainingUserGroups[0].UserID, map[string]string{"reason": "last_admin_left"}); err != nil {
+		return false, fmt.Errorf("error recording admin promotion: %w", err)
+	}
+	log.Printf("User %s promoted to admin in group %s.", remainingUserGroups[0].UserID, groupID)
+	return false, nil
 }
 
 func (h *Handler) GetRelevantUsers(c *gin.Context) {
@@ -1025,6 +1609,12 @@ func (h *Handler) GetRelevantUsers(c *gin.Context) {
 		return
 	}
 
+	// Passing query (even empty), cursor or limit opts into the paginated search.
+	if _, search := c.GetQuery("query"); search || c.Query("cursor") != "" || c.Query("limit") != "" {
+		h.searchRelevantUsers(c, user)
+		return
+	}
+
 	users, err := h.db.GetRelevantUsers(ctx, &user.ID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -1041,6 +1631,11 @@ func (h *Handler) GetRelevantUsers(c *gin.Context) {
 	c.JSON(http.StatusOK, users)
 }
 
+// GetRelevantMessages serves GET /ws/relevant-messages?device_identifier=: the messages
+// in the caller's groups since they joined. With a device_identifier it leaves out
+// what that device has reported through AckSequence, so a device catching up doesn't
+// download history it already holds. Messages created shortly before the reported
+// one are still returned (see deliveryReplayMargin) and clients drop them by ID.
 func (h *Handler) GetRelevantMessages(c *gin.Context) {
 	ctx := c.Request.Context()
 	user, err := util.GetUser(c, h.db)
@@ -1049,7 +1644,12 @@ func (h *Handler) GetRelevantMessages(c *gin.Context) {
 		return
 	}
 
-	dbMessages, err := h.db.GetRelevantMessages(ctx, user.ID)
+	deviceIdentifier := c.Query("device_identifier")
+	dbMessages, err := h.db.GetRelevantMessages(ctx, db.GetRelevantMessagesParams{
+		UserID:           user.ID,
+		DeviceIdentifier: pgtype.Text{String: deviceIdentifier, Valid: deviceIdentifier != ""},
+		ReplayMargin:     pgtype.Interval{Microseconds: deliveryReplayMargin().Microseconds(), Valid: true},
+	})
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			c.JSON(http.StatusOK, []RawMessageE2EE{}) // Send empty slice
@@ -1070,10 +1670,10 @@ func (h *Handler) GetRelevantMessages(c *gin.Context) {
 			}
 		}
 
-		senderID := dbMsg.SenderID
-		if *senderID == uuid.Nil {
-			log.Printf("Warning: Message %s has NULL UserID in DB", dbMsg.ID)
-			continue
+		// A deleted account's messages stay in their groups with no sender.
+		var senderID uuid.UUID
+		if dbMsg.SenderID != nil {
+			senderID = *dbMsg.SenderID
 		}
 
 		groupID := dbMsg.GroupID
@@ -1082,18 +1682,34 @@ func (h *Handler) GetRelevantMessages(c *gin.Context) {
 			continue
 		}
 
+		var forwardedFrom *ForwardedFrom
+		if dbMsg.ForwardedFromMessageID != nil {
+			forwardedFrom = &ForwardedFrom{MessageID: *dbMsg.ForwardedFromMessageID}
+			if dbMsg.ForwardedFromGroupID != nil {
+				forwardedFrom.GroupID = *dbMsg.ForwardedFromGroupID
+			}
+			if dbMsg.ForwardedFromSenderID != nil {
+				forwardedFrom.SenderID = *dbMsg.ForwardedFromSenderID
+			}
+		}
+		var expiresAt *time.Time
+		if dbMsg.ExpiresAt.Valid {
+			expiresAt = &dbMsg.ExpiresAt.Time
+		}
 		messagesToClient = append(messagesToClient, RawMessageE2EE{
 			ID:             dbMsg.ID,
 			GroupID:        *groupID,
 			SenderDeviceID: dbMsg.SenderDeviceIdentifier.String,
-			SenderID:       *senderID,
-			SenderUsername: dbMsg.SenderUsername,
+			SenderID:       senderID,
+			SenderUsername: dbMsg.SenderUsername.String,
 			MsgNonce:       base64.StdEncoding.EncodeToString(dbMsg.MsgNonce),
 			Ciphertext:     base64.StdEncoding.EncodeToString(dbMsg.Ciphertext),
 			Signature:      base64.StdEncoding.EncodeToString(dbMsg.Signature),
 			MessageType:    dbMsg.MessageType,
 			Timestamp:      dbMsg.Timestamp.Time.Format(time.RFC3339Nano),
 			Envelopes:      envelopes,
+			ForwardedFrom:  forwardedFrom,
+			ExpiresAt:      expiresAt,
 		})
 	}
 	c.JSON(http.StatusOK, messagesToClient)
@@ -2,20 +2,22 @@ package ws
 
 import (
 	"chat-app-server/db"
+	"chat-app-server/metrics"
 	"chat-app-server/notifications"
 	"chat-app-server/rediskeys"
+	"chat-app-server/util"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 )
@@ -47,6 +49,11 @@ type DeleteHubGroupMsg struct {
 	GroupID uuid.UUID
 }
 
+type DisconnectDeviceMsg struct {
+	UserID           uuid.UUID
+	DeviceIdentifier string
+}
+
 type PubSubMessage struct {
 	Type           string      `json:"type"`
 	Payload        interface{} `json:"payload"`
@@ -72,32 +79,103 @@ type GroupUpdateEventPayload struct {
 	Name    string    `json:"name,omitempty"`
 }
 
+type UserEventPayload struct {
+	UserID  uuid.UUID `json:"user_id"`
+	Event   string    `json:"event"`
+	GroupID uuid.UUID `json:"group_id"`
+}
+
+// GroupBroadcastEventPayload is a group_event sent to every member of a group.
+type GroupBroadcastEventPayload struct {
+	GroupID       uuid.UUID      `json:"group_id"`
+	Event         string         `json:"event"`
+	MessageIDs    []uuid.UUID    `json:"message_ids,omitempty"`
+	SystemMessage *SystemMessage `json:"system_message,omitempty"`
+	MessageEdit   *MessageEdit   `json:"message_edit,omitempty"`
+}
+
+// MaintenancePayload is published when an operator toggles maintenance mode.
+type MaintenancePayload struct {
+	Enabled bool `json:"enabled"`
+}
+
+type DeviceEventPayload struct {
+	UserID           uuid.UUID `json:"user_id"`
+	DeviceIdentifier string    `json:"device_identifier"`
+}
+
 type Hub struct {
 	Clients                 map[uuid.UUID]*Client
 	Groups                  map[uuid.UUID]*Group
 	Register                chan *Client
 	Unregister              chan *Client
-	Broadcast               chan *RawMessageE2EE
 	RemoveUserFromGroupChan chan *RemoveClientFromGroupMsg
 	AddUserToGroupChan      chan *AddClientToGroupMsg
 	InitializeGroupChan     chan *InitializeGroupMsg
 	DeleteHubGroupChan      chan *DeleteHubGroupMsg
 	UpdateGroupInfoChan     chan *GroupUpdateEventPayload
+	DisconnectDeviceChan    chan *DisconnectDeviceMsg
+	UserEventChan           chan *UserEventPayload
+	GroupEventChan          chan *GroupBroadcastEventPayload
 	mutex                   sync.RWMutex
 	redisClient             *redis.Client
 	serverID                string
 	db                      *db.Queries
 	pgxPool                 *pgxpool.Pool
 	ctx                     context.Context
-	notificationService     *notifications.NotificationService
+	// notificationService is never nil; it is a NoopPushProvider when push is off and
+	// pushEnabled is false.
+	notificationService notifications.PushProvider
+	pushEnabled         bool
+	maxConnections      int
+	// maxConnectionsPerUser caps one user's connections across all instances; see connection_limit.go.
+	maxConnectionsPerUser int
+	// openConns holds every connection on this instance whose read loop is still running,
+	// by user. Unlike Clients it also covers connections replaced by a newer one for the
+	// same user, which stay open until their peer or the server closes them. Guarded by mutex.
+	openConns map[uuid.UUID]map[*Client]struct{}
+	// heldSlots maps the connID of every connection holding a slot on this instance to
+	// its user. Unlike Clients it also covers connections replaced by a newer one for
+	// the same user; see connection_limit.go.
+	slotMutex sync.Mutex
+	heldSlots map[string]uuid.UUID
+	// reconnectGrace is how long a dropped client is kept suspended; see resume.go.
+	reconnectGrace time.Duration
+	// maintenance caches the cluster-wide maintenance flag; see maintenance.go.
+	maintenance atomic.Bool
+	// maxMessageExpiry caps how far ahead a sender may set a message's expires_at.
+	maxMessageExpiry time.Duration
+	// endedGroupGrace is how long after its end time a group still accepts messages.
+	endedGroupGrace time.Duration
+	// redisDegraded is set while Redis is unreachable (or was at startup) and is only
+	// touched from the Run goroutine and NewHub.
+	redisDegraded bool
+	// enforceEnvelopeCoverage rejects messages that lack an envelope for some member device.
+	enforceEnvelopeCoverage bool
+	// envelopeTolerance is how many envelopes beyond the group's device count are accepted.
+	envelopeTolerance int
+	// maxEnvelopes caps a message's envelopes regardless of group; 0 disables it.
+	maxEnvelopes int
+	// senderSeqMaxGap is how far ahead of a device's last sender_seq a new one may be.
+	senderSeqMaxGap   int64
+	messageSizeLimits messageSizeLimits
+	// messageTypes are the message types clients may send; see message_types.go.
+	messageTypes messageTypeAllowlist
+	// notifyQueue feeds the push notification workers; see notify.go.
+	notifyQueue chan *RawMessageE2EE
+	// broadcastShards feed the message persistence workers; see broadcast.go.
+	broadcastShards []chan *RawMessageE2EE
+	// typing tracks groups with typing activity; see typing.go.
+	typing typingTracker
 }
 
 const (
-	redisClientServerPrefix  = rediskeys.ClientServerPrefix
-	redisServerClientsPrefix = rediskeys.ServerClientsPrefix
-	redisUserGroupsPrefix    = rediskeys.UserGroupsPrefix
-	redisGroupMembersPrefix  = rediskeys.GroupMembersPrefix
-	redisGroupInfoPrefix     = rediskeys.GroupInfoPrefix
+	redisClientServerPrefix    = rediskeys.ClientServerPrefix
+	redisServerClientsPrefix   = rediskeys.ServerClientsPrefix
+	redisUserGroupsPrefix      = rediskeys.UserGroupsPrefix
+	redisGroupMembersPrefix    = rediskeys.GroupMembersPrefix
+	redisGroupInfoPrefix       = rediskeys.GroupInfoPrefix
+	redisUserConnectionsPrefix = rediskeys.UserConnectionsPrefix
 
 	pubSubGroupMessagesChannel = rediskeys.PubSubGroupMessagesChannel
 	pubSubGroupEventsChannel   = rediskeys.PubSubGroupEventsChannel
@@ -109,25 +187,52 @@ func NewHub(
 	conn *pgxpool.Pool,
 	redisClient *redis.Client,
 	serverID string,
-	notificationService *notifications.NotificationService,
+	notificationService notifications.PushProvider,
 ) *Hub {
+	if notificationService == nil {
+		notificationService = notifications.NoopPushProvider{}
+	}
 	hub := &Hub{
 		Clients:                 make(map[uuid.UUID]*Client),
+		openConns:               make(map[uuid.UUID]map[*Client]struct{}),
 		Groups:                  make(map[uuid.UUID]*Group),
 		Register:                make(chan *Client),
 		Unregister:              make(chan *Client),
-		Broadcast:               make(chan *RawMessageE2EE, 256),
 		RemoveUserFromGroupChan: make(chan *RemoveClientFromGroupMsg, 64),
 		AddUserToGroupChan:      make(chan *AddClientToGroupMsg),
 		InitializeGroupChan:     make(chan *InitializeGroupMsg),
 		DeleteHubGroupChan:      make(chan *DeleteHubGroupMsg),
 		UpdateGroupInfoChan:     make(chan *GroupUpdateEventPayload),
+		DisconnectDeviceChan:    make(chan *DisconnectDeviceMsg, 64),
+		UserEventChan:           make(chan *UserEventPayload, 64),
+		GroupEventChan:          make(chan *GroupBroadcastEventPayload, 64),
 		redisClient:             redisClient,
 		serverID:                serverID,
 		db:                      dbQueries,
 		pgxPool:                 conn,
 		ctx:                     ctx,
 		notificationService:     notificationService,
+		pushEnabled:             notifications.Enabled(notificationService),
+		maxConnections:          util.GetEnvInt("MAX_CONNECTIONS", 10000),
+		maxConnectionsPerUser:   util.GetEnvInt("MAX_CONNECTIONS_PER_USER", 10),
+		heldSlots:               make(map[string]uuid.UUID),
+		reconnectGrace:          time.Duration(util.GetEnvInt("WS_RECONNECT_GRACE_SECONDS", 5)) * time.Second,
+		maxMessageExpiry:        time.Duration(util.GetEnvInt("MAX_MESSAGE_EXPIRY_DAYS", 7)) * 24 * time.Hour,
+		endedGroupGrace:         time.Duration(util.GetEnvInt("ENDED_GROUP_GRACE_SECONDS", 0)) * time.Second,
+		enforceEnvelopeCoverage: util.GetEnvBool("ENFORCE_ENVELOPE_COVERAGE", false),
+		envelopeTolerance:       util.GetEnvIntAtLeast("ENVELOPE_COUNT_TOLERANCE", 10, 0),
+		maxEnvelopes:            util.GetEnvInt("MAX_ENVELOPES_PER_MESSAGE", defaultMaxEnvelopes),
+		senderSeqMaxGap:         int64(util.GetEnvIntAtLeast("SENDER_SEQ_MAX_GAP", 1000, 1)),
+		messageSizeLimits:       loadMessageSizeLimits(),
+		messageTypes:            loadMessageTypeAllowlist(),
+		notifyQueue:             make(chan *RawMessageE2EE, util.GetEnvIntAtLeast("NOTIFICATION_QUEUE_SIZE", 1024, 1)),
+	}
+	metrics.MaxConnections.Set(int64(hub.maxConnections))
+	hub.startBroadcastWorkers(util.GetEnvInt("BROADCAST_WORKERS", 8))
+	hub.typing.groups = make(map[uuid.UUID]string)
+	go hub.runTypingFlusher()
+	if hub.pushEnabled {
+		hub.startNotificationWorkers(util.GetEnvInt("NOTIFICATION_WORKERS", 8))
 	}
 
 	// Populate Redis from DB on startup
@@ -140,26 +245,62 @@ func NewHub(
 		// relying on runtime updates to Redis.
 		// However, this could lead to inconsistencies if Redis was empty.
 		log.Printf("Hub %s: CRITICAL - Failed to synchronize DB to Redis on startup: %v. Redis might be out of sync.", serverID, err)
+		hub.redisDegraded = true
 	} else {
 		log.Printf("Hub %s: Successfully synchronized DB to Redis (or verified sync).", serverID)
 	}
 
-	go hub.listenPubSub()
+	hub.refreshMaintenance()
+
+	go hub.supervisePubSub()
 	return hub
 }
 
-func (h *Hub) listenPubSub() {
+// supervisePubSub keeps the Pub/Sub listener alive. Events published while the
+// listener was down are lost, so every restart tells local clients to resync.
+func (h *Hub) supervisePubSub() {
+	const maxBackoff = 30 * time.Second
+	backoff := time.Second
+	for {
+		started := time.Now()
+		subscribed := h.listenPubSub()
+		if h.ctx.Err() != nil {
+			return
+		}
+		if subscribed && time.Since(started) > maxBackoff {
+			backoff = time.Second
+		}
+		log.Printf("Hub %s: PubSub listener stopped, restarting in %s", h.serverID, backoff)
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+		h.resyncAllClients()
+	}
+}
+
+// listenPubSub consumes Redis Pub/Sub until the subscription ends. It reports
+// whether the subscription was established at all.
+func (h *Hub) listenPubSub() bool {
+	// supervisePubSub restarts the listener after a panic as after any other failure.
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			util.LogPanic("hub "+h.serverID+" PubSub listener", recovered)
+		}
+	}()
 	groupMessagesPattern := pubSubGroupMessagesChannel + ":*"
 	pubsub := h.redisClient.Subscribe(h.ctx, pubSubGroupEventsChannel)
+	defer pubsub.Close()
 	if err := pubsub.PUnsubscribe(h.ctx); err != nil {
 		log.Printf("Hub %s: PUnsubscribe failed", h.serverID)
-		return
+		return false
 	}
 	if err := pubsub.PSubscribe(h.ctx, groupMessagesPattern); err != nil {
 		log.Printf("Hub %s: Error PSubscribing to %s: %v", h.serverID, groupMessagesPattern, err)
-		return
+		return false
 	}
-	defer pubsub.Close()
 
 	ch := pubsub.Channel()
 	log.Printf("Hub %s listening to Redis Pub/Sub (Events: %s, Messages: %s)", h.serverID, pubSubGroupEventsChannel, groupMessagesPattern)
@@ -168,11 +309,11 @@ func (h *Hub) listenPubSub() {
 		select {
 		case <-h.ctx.Done():
 			log.Printf("Hub %s: Context cancelled, stopping PubSub listener.", h.serverID)
-			return
+			return true
 		case msg, ok := <-ch:
 			if !ok {
 				log.Printf("Hub %s: PubSub channel closed.", h.serverID)
-				return
+				return true
 			}
 
 			var pubSubMsg PubSubMessage
@@ -227,6 +368,51 @@ func (h *Hub) listenPubSub() {
 					continue
 				}
 				h.handleGroupUpdatedEvent(payload.GroupID, payload.Name, pubSubMsg.OriginServerID)
+			case "user_event":
+				var payload UserEventPayload
+				if err := mapToStruct(pubSubMsg.Payload, &payload); err != nil {
+					log.Printf("Hub %s: Error decoding user_event payload: %v", h.serverID, err)
+					continue
+				}
+				if pubSubMsg.OriginServerID != h.serverID {
+					h.deliverUserEventLocally(&payload)
+				}
+			case "group_event":
+				var payload GroupBroadcastEventPayload
+				if err := mapToStruct(pubSubMsg.Payload, &payload); err != nil {
+					log.Printf("Hub %s: Error decoding group_event payload: %v", h.serverID, err)
+					continue
+				}
+				if pubSubMsg.OriginServerID != h.serverID {
+					h.deliverGroupEventLocally(&payload)
+				}
+			case "typing":
+				var payload TypingSnapshot
+				if err := mapToStruct(pubSubMsg.Payload, &payload); err != nil {
+					log.Printf("Hub %s: Error decoding typing payload: %v", h.serverID, err)
+					continue
+				}
+				if pubSubMsg.OriginServerID != h.serverID {
+					h.deliverTypingLocally(&payload)
+				}
+			case "maintenance":
+				var payload MaintenancePayload
+				if err := mapToStruct(pubSubMsg.Payload, &payload); err != nil {
+					log.Printf("Hub %s: Error decoding maintenance payload: %v", h.serverID, err)
+					continue
+				}
+				if pubSubMsg.OriginServerID != h.serverID {
+					h.applyMaintenance(payload.Enabled)
+				}
+			case "device_disconnected":
+				var payload DeviceEventPayload
+				if err := mapToStruct(pubSubMsg.Payload, &payload); err != nil {
+					log.Printf("Hub %s: Error decoding device_disconnected payload: %v", h.serverID, err)
+					continue
+				}
+				if pubSubMsg.OriginServerID != h.serverID {
+					h.disconnectLocalDevice(payload.UserID, payload.DeviceIdentifier)
+				}
 			}
 		}
 	}
@@ -295,6 +481,10 @@ func mapToStruct(data interface{}, result interface{}) error {
 	return json.Unmarshal(b, result)
 }
 
+// deliverChatMessage sends message to every connection this instance holds in its
+// group. Connections are per user, not per device (see Hub.Clients), so a user gets
+// it once per instance they are connected to; devices that aren't connected fetch it
+// later from relevant-messages.
 func (h *Hub) deliverChatMessage(message *RawMessageE2EE) {
 	h.mutex.RLock()
 	group, groupExists := h.Groups[message.GroupID]
@@ -313,11 +503,7 @@ func (h *Hub) deliverChatMessage(message *RawMessageE2EE) {
 		h.mutex.RUnlock()
 
 		if stillConnected {
-			select {
-			case client.Message <- message:
-			default:
-				log.Printf("Hub %s: Client %s message channel full for group %s. E2EE Message ID %s dropped.", h.serverID, client.User.ID.String(), message.GroupID.String(), message.ID)
-			}
+			client.Send(message)
 		}
 	}
 }
@@ -335,11 +521,7 @@ func (h *Hub) handleUserAddedToGroupEvent(userID uuid.UUID, groupID uuid.UUID, o
 		h.addClientToLocalGroupStructLocked(client, groupID)
 		log.Printf("Hub %s: Updated local state for user %s added to group %s", h.serverID, userID.String(), groupID.String())
 		if originServerID != h.serverID {
-			select {
-			case client.Events <- &ClientEvent{Type: "group_event", Event: "user_invited", GroupID: groupID}:
-			default:
-				log.Printf("Hub %s: Events channel full for client %s on user_invited for group %s", h.serverID, userID.String(), groupID.String())
-			}
+			client.SendEvent("user_invited", groupID)
 		}
 	}
 
@@ -351,11 +533,7 @@ func (h *Hub) handleUserAddedToGroupEvent(userID uuid.UUID, groupID uuid.UUID, o
 				if c.User.ID == userID {
 					continue
 				}
-				select {
-				case c.Events <- &ClientEvent{Type: "group_event", Event: "user_invited", GroupID: groupID}:
-				default:
-					log.Printf("Hub %s: Events channel full for client %s on user_invited (group broadcast) for group %s", h.serverID, c.User.ID.String(), groupID.String())
-				}
+				c.SendEvent("user_invited", groupID)
 			}
 			group.mutex.RUnlock()
 		}
@@ -371,11 +549,7 @@ func (h *Hub) handleUserRemovedFromGroupEvent(userID uuid.UUID, groupID uuid.UUI
 	client, clientConnectedToThisInstance := h.Clients[userID]
 	if clientConnectedToThisInstance {
 		if originServerID != h.serverID {
-			select {
-			case client.Events <- &ClientEvent{Type: "group_event", Event: "user_removed", GroupID: groupID}:
-			default:
-				log.Printf("Hub %s: Events channel full for client %s on user_removed for group %s", h.serverID, userID.String(), groupID.String())
-			}
+			client.SendEvent("user_removed", groupID)
 		}
 		h.removeClientFromLocalGroupStructLocked(client, groupID)
 		client.RemoveGroup(groupID)
@@ -390,11 +564,7 @@ func (h *Hub) handleUserRemovedFromGroupEvent(userID uuid.UUID, groupID uuid.UUI
 				if c.User.ID == userID {
 					continue
 				}
-				select {
-				case c.Events <- &ClientEvent{Type: "group_event", Event: "group_updated", GroupID: groupID}:
-				default:
-					log.Printf("Hub %s: Events channel full for client %s on group_updated after removal for group %s", h.serverID, c.User.ID.String(), groupID.String())
-				}
+				c.SendEvent("group_updated", groupID)
 			}
 			group.mutex.RUnlock()
 		}
@@ -438,11 +608,7 @@ func (h *Hub) handleGroupDeletedEvent(groupID uuid.UUID, originServerID string)
 		group.mutex.Lock()
 		for clientID, client := range group.Clients {
 			if originServerID != h.serverID {
-				select {
-				case client.Events <- &ClientEvent{Type: "group_event", Event: "group_deleted", GroupID: groupID}:
-				default:
-					log.Printf("Hub %s: Events channel full for client %s on group_deleted for group %s", h.serverID, clientID.String(), groupID.String())
-				}
+				client.SendEvent("group_deleted", groupID)
 			}
 			client.RemoveGroup(groupID)
 			log.Printf("Hub %s: Client %s removed from local cache of deleted group %s", h.serverID, clientID.String(), groupID.String())
@@ -468,11 +634,7 @@ func (h *Hub) handleGroupUpdatedEvent(groupID uuid.UUID, newName string, originS
 		if originServerID != h.serverID {
 			group.mutex.RLock()
 			for _, client := range group.Clients {
-				select {
-				case client.Events <- &ClientEvent{Type: "group_event", Event: "group_updated", GroupID: groupID}:
-				default:
-					log.Printf("Hub %s: Events channel full for client %s on group_updated for group %s", h.serverID, client.User.ID.String(), groupID.String())
-				}
+				client.SendEvent("group_updated", groupID)
 			}
 			group.mutex.RUnlock()
 		}
@@ -481,7 +643,25 @@ func (h *Hub) handleGroupUpdatedEvent(groupID uuid.UUID, newName string, originS
 	}
 }
 
+// Run processes hub events until the hub's context ends. A panic while handling an
+// event is logged and the loop restarted, so one bad event can't take the process
+// down.
 func (h *Hub) Run() {
+	for !h.runLoop() {
+		log.Printf("Hub %s: Restarting Run loop after panic", h.serverID)
+	}
+}
+
+// runLoop is the body of Run. It returns true once the context ends and false after
+// recovering from a panic.
+func (h *Hub) runLoop() (stopped bool) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			util.LogPanic("hub "+h.serverID+" Run loop", recovered)
+			stopped = false
+		}
+	}()
+
 	log.Printf("Hub %s Run loop started", h.serverID)
 	refreshDuration := 30 * time.Second
 	refreshTicker := time.NewTicker(refreshDuration)
@@ -491,12 +671,24 @@ func (h *Hub) Run() {
 		select {
 		case <-h.ctx.Done():
 			log.Printf("Hub %s: Context cancelled, shutting down Run loop.", h.serverID)
-			return
+			return true
 		case <-refreshTicker.C:
+			h.checkRedisHealth()
+			h.reapStaleClients()
 			h.refreshClientRegistrations()
+			h.refreshConnectionSlots()
+			h.refreshMaintenance()
 		case client := <-h.Register:
 			h.mutex.Lock()
+			if previous, ok := h.Clients[client.User.ID]; ok && previous.suspended {
+				h.resumeSuspendedLocked(previous, client)
+			}
 			h.Clients[client.User.ID] = client
+			h.trackOpenConnLocked(client)
+			metrics.ActiveConnections.Set(int64(len(h.Clients)))
+			if h.maintenance.Load() {
+				client.SendEvent("maintenance", uuid.Nil)
+			}
 			h.mutex.Unlock()
 
 			clientKey := redisClientServerPrefix + client.User.ID.String() + ":server_id"
@@ -543,124 +735,19 @@ func (h *Hub) Run() {
 
 		case client := <-h.Unregister:
 			h.mutex.Lock()
-			if _, ok := h.Clients[client.User.ID]; ok {
-				delete(h.Clients, client.User.ID)
-
-				clientKey := redisClientServerPrefix + client.User.ID.String() + ":server_id"
-				serverClientsKey := redisServerClientsPrefix + h.serverID + ":clients"
-
-				pipe := h.redisClient.Pipeline()
-				pipe.Del(h.ctx, clientKey)
-				pipe.SRem(h.ctx, serverClientsKey, client.User.ID.String(), client.User.ID)
-				_, err := pipe.Exec(h.ctx)
-				if err != nil {
-					log.Printf("Hub %s: Error unregistering client %s in Redis: %v", h.serverID, client.User.ID.String(), err)
-				} else {
-					log.Printf("Hub %s: Unregistered client %s from this server in Redis", h.serverID, client.User.ID.String())
+			// The read loop has exited, so the socket is done with either way.
+			h.untrackOpenConnLocked(client)
+			if h.Clients[client.User.ID] == client {
+				if !h.suspendClientLocked(client) {
+					h.unregisterClientLocked(client)
 				}
-
-				client.mutex.RLock()
-				for groupID := range client.Groups {
-					h.removeClientFromLocalGroupStructLocked(client, groupID)
-				}
-				client.mutex.RUnlock()
-				close(client.Message)
-				close(client.Events)
-				log.Printf("Hub %s: Client %s unregistered locally.", h.serverID, client.User.ID.String())
-			}
-			h.mutex.Unlock()
-
-		case message := <-h.Broadcast:
-			cipherBytes, err := base64.StdEncoding.DecodeString(message.Ciphertext)
-			if err != nil {
-				log.Printf("Error decoding ciphertext base64 for message in group %s: %v", message.GroupID, err)
-				continue
-			}
-			nonceBytes, err := base64.StdEncoding.DecodeString(message.MsgNonce)
-			if err != nil {
-				log.Printf("Error decoding msgNonce base64 for message in group %s: %v", message.GroupID, err)
-				continue
-			}
-			signatureBytes, err := base64.StdEncoding.DecodeString(message.Signature)
-			if err != nil {
-				log.Printf("Error decoding signature base64 for message in group %s: %v", message.GroupID, err)
-				continue
-			}
-
-			keyEnvelopesJSON, err := json.Marshal(message.Envelopes)
-			if err != nil {
-				log.Printf("Error marshalling key_envelopes for message in group %s: %v", message.GroupID, err)
-				continue
-			}
-
-			insertParams := db.InsertMessageParams{
-				ID:           message.ID,
-				UserID:       &message.SenderID,
-				GroupID:      &message.GroupID,
-				Ciphertext:   cipherBytes,
-				MessageType:  message.MessageType,
-				MsgNonce:     nonceBytes,
-				KeyEnvelopes: keyEnvelopesJSON,
-				SenderDeviceIdentifier: pgtype.Text{
-					String: message.SenderDeviceID,
-					Valid:  message.SenderDeviceID != "",
-				},
-				Signature: signatureBytes,
-			}
-
-			savedMessage, err := h.db.InsertMessage(h.ctx, insertParams)
-			if err != nil {
-				log.Printf("Error saving E2EE message: %v", err)
-				continue
-			}
-
-			message.ID = savedMessage.ID
-			message.Timestamp = savedMessage.CreatedAt.Time.Format(time.RFC3339Nano)
-
-			payload := ChatMessagePayload{Message: message}
-			pubSubMsg := PubSubMessage{
-				Type:           "chat_message",
-				Payload:        payload,
-				OriginServerID: h.serverID,
-			}
-			serializedMsg, err := json.Marshal(pubSubMsg)
-			if err != nil {
-				log.Printf("Hub %s: Error marshalling E2EE chat message for PubSub: %v", h.serverID, err)
-				continue
-			}
-			channel := pubSubGroupMessagesChannel + ":" + message.GroupID.String()
-			if err := h.redisClient.Publish(h.ctx, channel, serializedMsg).Err(); err != nil {
-				log.Printf("Hub %s: Error publishing E2EE message to Redis PubSub channel %s: %v", h.serverID, channel, err)
 			} else {
-				log.Printf("Hub %s: Published E2EE message for group %s to Redis PubSub channel %s", h.serverID, message.GroupID.String(), channel)
-			}
-
-			// Send push notifications to offline users asynchronously
-			if h.notificationService != nil {
-				go func(msg *RawMessageE2EE) {
-					// Get group name from Redis
-					groupInfoKey := redisGroupInfoPrefix + msg.GroupID.String()
-					groupName, err := h.redisClient.HGet(h.ctx, groupInfoKey, "name").Result()
-					if err != nil {
-						groupName = "Group"
-					}
-
-					// Get sender's username from DB
-					senderName := "Someone"
-					if sender, err := h.db.GetUserById(h.ctx, msg.SenderID); err == nil {
-						senderName = sender.Username
-					}
-
-					h.notificationService.SendMessageNotification(
-						h.ctx,
-						msg.GroupID,
-						groupName,
-						msg.SenderID,
-						senderName,
-						"sent a message",
-					)
-				}(message)
+				// A newer connection for the user replaced this one; its map entry and
+				// Redis registration belong to the new client now.
+				h.releaseClientLocked(client)
+				log.Printf("Hub %s: Released replaced client %s.", h.serverID, client.User.ID.String())
 			}
+			h.mutex.Unlock()
 
 		case removeMsg := <-h.RemoveUserFromGroupChan:
 			groupMembersKey := redisGroupMembersPrefix + removeMsg.GroupID.String() + ":members"
@@ -686,11 +773,7 @@ func (h *Hub) Run() {
 				// Forward event to locally connected client after Redis confirmation
 				h.mutex.RLock()
 				if client, ok := h.Clients[removeMsg.UserID]; ok {
-					select {
-					case client.Events <- &ClientEvent{Type: "group_event", Event: "user_removed", GroupID: removeMsg.GroupID}:
-					default:
-						log.Printf("Hub %s: Events channel full for client %s on user_removed (direct) for group %s", h.serverID, removeMsg.UserID.String(), removeMsg.GroupID.String())
-					}
+					client.SendEvent("user_removed", removeMsg.GroupID)
 				}
 				// Notify remaining local members so they refresh member lists.
 				if group, exists := h.Groups[removeMsg.GroupID]; exists {
@@ -699,11 +782,7 @@ func (h *Hub) Run() {
 						if client.User.ID == removeMsg.UserID {
 							continue
 						}
-						select {
-						case client.Events <- &ClientEvent{Type: "group_event", Event: "group_updated", GroupID: removeMsg.GroupID}:
-						default:
-							log.Printf("Hub %s: Events channel full for client %s on group_updated (direct) for group %s", h.serverID, client.User.ID.String(), removeMsg.GroupID.String())
-						}
+						client.SendEvent("group_updated", removeMsg.GroupID)
 					}
 					group.mutex.RUnlock()
 				}
@@ -734,11 +813,7 @@ func (h *Hub) Run() {
 				// Forward event to locally connected joining client
 				h.mutex.RLock()
 				if client, ok := h.Clients[addMsg.UserID]; ok {
-					select {
-					case client.Events <- &ClientEvent{Type: "group_event", Event: "user_invited", GroupID: addMsg.GroupID}:
-					default:
-						log.Printf("Hub %s: Events channel full for client %s on user_invited (direct) for group %s", h.serverID, addMsg.UserID.String(), addMsg.GroupID.String())
-					}
+					client.SendEvent("user_invited", addMsg.GroupID)
 				}
 				// Notify existing group members so they see the new member
 				if group, exists := h.Groups[addMsg.GroupID]; exists {
@@ -747,11 +822,7 @@ func (h *Hub) Run() {
 						if client.User.ID == addMsg.UserID {
 							continue
 						}
-						select {
-						case client.Events <- &ClientEvent{Type: "group_event", Event: "user_invited", GroupID: addMsg.GroupID}:
-						default:
-							log.Printf("Hub %s: Events channel full for client %s on user_invited (group broadcast) for group %s", h.serverID, client.User.ID.String(), addMsg.GroupID.String())
-						}
+						client.SendEvent("user_invited", addMsg.GroupID)
 					}
 					group.mutex.RUnlock()
 				}
@@ -818,11 +889,7 @@ func (h *Hub) Run() {
 				if group, exists := h.Groups[delMsg.GroupID]; exists {
 					group.mutex.RLock()
 					for _, client := range group.Clients {
-						select {
-						case client.Events <- &ClientEvent{Type: "group_event", Event: "group_deleted", GroupID: delMsg.GroupID}:
-						default:
-							log.Printf("Hub %s: Events channel full for client %s on group_deleted (direct) for group %s", h.serverID, client.User.ID.String(), groupIDStr)
-						}
+						client.SendEvent("group_deleted", delMsg.GroupID)
 					}
 					group.mutex.RUnlock()
 				}
@@ -846,11 +913,7 @@ func (h *Hub) Run() {
 			if group, exists := h.Groups[updateMsg.GroupID]; exists {
 				group.mutex.RLock()
 				for _, client := range group.Clients {
-					select {
-					case client.Events <- &ClientEvent{Type: "group_event", Event: "group_updated", GroupID: updateMsg.GroupID}:
-					default:
-						log.Printf("Hub %s: Events channel full for client %s on group_updated (direct) for group %s", h.serverID, client.User.ID.String(), updateMsg.GroupID.String())
-					}
+					client.SendEvent("group_updated", updateMsg.GroupID)
 				}
 				group.mutex.RUnlock()
 			}
@@ -871,10 +934,291 @@ func (h *Hub) Run() {
 					log.Printf("Hub %s: Published group_updated event for group %s", h.serverID, updateMsg.GroupID.String())
 				}
 			}
+		case userEvt := <-h.UserEventChan:
+			h.deliverUserEventLocally(userEvt)
+
+			pubSubEvt := PubSubMessage{Type: "user_event", Payload: userEvt, OriginServerID: h.serverID}
+			serializedEvt, err := json.Marshal(pubSubEvt)
+			if err != nil {
+				log.Printf("Hub %s: Error marshalling user_event: %v", h.serverID, err)
+			} else if err := h.redisClient.Publish(h.ctx, pubSubGroupEventsChannel, serializedEvt).Err(); err != nil {
+				log.Printf("Hub %s: Error publishing user_event %s for user %s: %v", h.serverID, userEvt.Event, userEvt.UserID.String(), err)
+			}
+		case groupEvt := <-h.GroupEventChan:
+			h.deliverGroupEventLocally(groupEvt)
+
+			pubSubEvt := PubSubMessage{Type: "group_event", Payload: groupEvt, OriginServerID: h.serverID}
+			serializedEvt, err := json.Marshal(pubSubEvt)
+			if err != nil {
+				log.Printf("Hub %s: Error marshalling group_event: %v", h.serverID, err)
+			} else if err := h.redisClient.Publish(h.ctx, pubSubGroupEventsChannel, serializedEvt).Err(); err != nil {
+				log.Printf("Hub %s: Error publishing group_event %s for group %s: %v", h.serverID, groupEvt.Event, groupEvt.GroupID.String(), err)
+			}
+		case disconnectMsg := <-h.DisconnectDeviceChan:
+			h.disconnectLocalDevice(disconnectMsg.UserID, disconnectMsg.DeviceIdentifier)
+
+			// The device may be connected to another instance
+			eventPayload := DeviceEventPayload{UserID: disconnectMsg.UserID, DeviceIdentifier: disconnectMsg.DeviceIdentifier}
+			pubSubEvt := PubSubMessage{Type: "device_disconnected", Payload: eventPayload, OriginServerID: h.serverID}
+			serializedEvt, err := json.Marshal(pubSubEvt)
+			if err != nil {
+				log.Printf("Hub %s: Error marshalling device_disconnected event: %v", h.serverID, err)
+			} else if err := h.redisClient.Publish(h.ctx, pubSubGroupEventsChannel, serializedEvt).Err(); err != nil {
+				log.Printf("Hub %s: Error publishing device_disconnected event for user %s: %v", h.serverID, disconnectMsg.UserID.String(), err)
+			}
 		}
 	}
 }
 
+// unregisterClientLocked removes client from this instance and from Redis and closes
+// its channels. Callers must hold h.mutex for writing.
+func (h *Hub) unregisterClientLocked(client *Client) {
+	delete(h.Clients, client.User.ID)
+	metrics.ActiveConnections.Set(int64(len(h.Clients)))
+
+	clientKey := redisClientServerPrefix + client.User.ID.String() + ":server_id"
+	serverClientsKey := redisServerClientsPrefix + h.serverID + ":clients"
+
+	pipe := h.redisClient.Pipeline()
+	pipe.Del(h.ctx, clientKey)
+	pipe.SRem(h.ctx, serverClientsKey, client.User.ID.String(), client.User.ID)
+	_, err := pipe.Exec(h.ctx)
+	if err != nil {
+		log.Printf("Hub %s: Error unregistering client %s in Redis: %v", h.serverID, client.User.ID.String(), err)
+	} else {
+		log.Printf("Hub %s: Unregistered client %s from this server in Redis", h.serverID, client.User.ID.String())
+	}
+
+	h.releaseClientLocked(client)
+	log.Printf("Hub %s: Client %s unregistered locally.", h.serverID, client.User.ID.String())
+}
+
+// trackOpenConnLocked records client as an open connection of its user. Callers must
+// hold h.mutex for writing.
+func (h *Hub) trackOpenConnLocked(client *Client) {
+	conns, ok := h.openConns[client.User.ID]
+	if !ok {
+		conns = make(map[*Client]struct{})
+		h.openConns[client.User.ID] = conns
+	}
+	conns[client] = struct{}{}
+}
+
+// untrackOpenConnLocked forgets client once its read loop has exited. Callers must
+// hold h.mutex for writing.
+func (h *Hub) untrackOpenConnLocked(client *Client) {
+	conns := h.openConns[client.User.ID]
+	delete(conns, client)
+	if len(conns) == 0 {
+		delete(h.openConns, client.User.ID)
+	}
+}
+
+// releaseClientLocked drops client from the local group caches and closes its
+// channels. Callers must hold h.mutex for writing.
+func (h *Hub) releaseClientLocked(client *Client) {
+	client.mutex.RLock()
+	for groupID := range client.Groups {
+		h.removeClientFromLocalGroupStructLocked(client, groupID)
+	}
+	client.mutex.RUnlock()
+	client.closeChannels()
+}
+
+// AtCapacity reports whether this instance has reached its configured connection limit.
+// A limit of 0 or less disables the check.
+func (h *Hub) AtCapacity() bool {
+	if h.maxConnections <= 0 {
+		return false
+	}
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.Clients) >= h.maxConnections
+}
+
+// NotifyUser sends a group_event to a single user on whichever server instance they are connected to.
+func (h *Hub) NotifyUser(userID uuid.UUID, event string, groupID uuid.UUID) {
+	select {
+	case h.UserEventChan <- &UserEventPayload{UserID: userID, Event: event, GroupID: groupID}:
+	case <-h.ctx.Done():
+	default:
+		log.Printf("Hub %s: UserEventChan full, dropping %s for user %s", h.serverID, event, userID.String())
+	}
+}
+
+func (h *Hub) deliverUserEventLocally(evt *UserEventPayload) {
+	// Hold the read lock while sending so Unregister can't close the channel underneath us.
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	client, ok := h.Clients[evt.UserID]
+	if !ok {
+		return
+	}
+	client.SendEvent(evt.Event, evt.GroupID)
+}
+
+// NotifyGroup sends a group_event to every member of a group, on every server instance.
+func (h *Hub) NotifyGroup(groupID uuid.UUID, event string) {
+	select {
+	case h.GroupEventChan <- &GroupBroadcastEventPayload{GroupID: groupID, Event: event}:
+	case <-h.ctx.Done():
+	default:
+		log.Printf("Hub %s: GroupEventChan full, dropping %s for group %s", h.serverID, event, groupID.String())
+	}
+}
+
+// NotifyMessagesDeleted tells every member of a group, on every server instance, that
+// the given messages no longer exist and should be removed locally.
+func (h *Hub) NotifyMessagesDeleted(groupID uuid.UUID, messageIDs []uuid.UUID) {
+	select {
+	case h.GroupEventChan <- &GroupBroadcastEventPayload{GroupID: groupID, Event: "message_deleted", MessageIDs: messageIDs}:
+	case <-h.ctx.Done():
+	default:
+		log.Printf("Hub %s: GroupEventChan full, dropping message_deleted for group %s", h.serverID, groupID.String())
+	}
+}
+
+// NotifyMessageEdited sends the new version of an edited message to every member of
+// its group, on every server instance.
+func (h *Hub) NotifyMessageEdited(groupID uuid.UUID, edit *MessageEdit) {
+	select {
+	case h.GroupEventChan <- &GroupBroadcastEventPayload{GroupID: groupID, Event: "message_edited", MessageEdit: edit}:
+	case <-h.ctx.Done():
+	default:
+		log.Printf("Hub %s: GroupEventChan full, dropping message_edited for group %s", h.serverID, groupID.String())
+	}
+}
+
+// NotifySystemMessage sends an operator's notice to every member of a group, on every
+// server instance.
+func (h *Hub) NotifySystemMessage(groupID uuid.UUID, message *SystemMessage) {
+	select {
+	case h.GroupEventChan <- &GroupBroadcastEventPayload{GroupID: groupID, Event: "system_message", SystemMessage: message}:
+	case <-h.ctx.Done():
+	default:
+		log.Printf("Hub %s: GroupEventChan full, dropping system_message for group %s", h.serverID, groupID.String())
+	}
+}
+
+func (h *Hub) deliverGroupEventLocally(evt *GroupBroadcastEventPayload) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	group, ok := h.Groups[evt.GroupID]
+	if !ok {
+		return
+	}
+	group.mutex.RLock()
+	defer group.mutex.RUnlock()
+	for _, client := range group.Clients {
+		client.Send(&ClientEvent{Type: "group_event", Event: evt.Event, GroupID: evt.GroupID, MessageIDs: evt.MessageIDs, SystemMessage: evt.SystemMessage, MessageEdit: evt.MessageEdit})
+	}
+}
+
+// DisconnectDevice asks the hub to close the WebSocket connection belonging to a
+// specific device of a user, on whichever server instance it is connected to.
+func (h *Hub) DisconnectDevice(userID uuid.UUID, deviceIdentifier string) {
+	select {
+	case h.DisconnectDeviceChan <- &DisconnectDeviceMsg{UserID: userID, DeviceIdentifier: deviceIdentifier}:
+		log.Printf("Hub %s: Sent disconnect request for user %s device %s to hub", h.serverID, userID.String(), deviceIdentifier)
+	case <-h.ctx.Done():
+	default:
+		log.Printf("Hub %s: DisconnectDeviceChan full, dropping disconnect for user %s device %s", h.serverID, userID.String(), deviceIdentifier)
+	}
+}
+
+// ackSender reports the outcome of a broadcast back to the device that sent it,
+// if that device is still connected to this instance.
+func (h *Hub) ackSender(message *RawMessageE2EE, ackType string, reason string) {
+	ack := &MessageAck{Type: ackType, MessageID: message.ID, GroupID: message.GroupID, Reason: reason}
+	if ackType == "message_ack" {
+		ack.Timestamp = message.Timestamp
+	}
+	h.sendToSenderDevice(message, ack)
+}
+
+// sendToSenderDevice sends ack to the device that sent message, if it is connected here.
+func (h *Hub) sendToSenderDevice(message *RawMessageE2EE, ack *MessageAck) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	client, ok := h.Clients[message.SenderID]
+	if !ok || client.DeviceIdentifier != message.SenderDeviceID {
+		return
+	}
+	client.Send(ack)
+}
+
+// ackDuplicate answers a message whose client-generated ID already exists. A resend of
+// a message that was already persisted (e.g. the ack was lost to a reconnect) is acked
+// again with the original timestamp and not re-broadcast; an ID that belongs to some
+// other message is nacked.
+func (h *Hub) ackDuplicate(message *RawMessageE2EE) {
+	existing, err := h.db.GetMessageById(h.ctx, message.ID)
+	if err != nil {
+		log.Printf("Error loading existing message %s after ID conflict: %v", message.ID, err)
+		h.ackSender(message, "message_nack", "persist_failed")
+		return
+	}
+	if existing.UserID == nil || *existing.UserID != message.SenderID ||
+		existing.GroupID == nil || *existing.GroupID != message.GroupID {
+		log.Printf("Rejecting message %s from user %s: ID already used by another message", message.ID, message.SenderID)
+		h.ackSender(message, "message_nack", "duplicate_id")
+		return
+	}
+	message.Timestamp = existing.CreatedAt.Time.Format(time.RFC3339Nano)
+	h.ackSender(message, "message_ack", "")
+}
+
+// resyncAllClients asks every locally connected client to re-fetch its groups and messages.
+func (h *Hub) resyncAllClients() {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for userID := range h.Clients {
+		h.sendResyncLocked(userID)
+	}
+	log.Printf("Hub %s: Sent resync to %d local clients", h.serverID, len(h.Clients))
+}
+
+// sendResyncLocked assumes h.mutex is held (read or write) by the caller.
+func (h *Hub) sendResyncLocked(userID uuid.UUID) {
+	client, ok := h.Clients[userID]
+	if !ok {
+		return
+	}
+	client.SendEvent("resync", uuid.Nil)
+}
+
+// DisconnectUser closes every connection belonging to the user, regardless of device.
+func (h *Hub) DisconnectUser(userID uuid.UUID) {
+	h.DisconnectDevice(userID, "")
+}
+
+// disconnectLocalDevice closes every connection of the given device on this instance,
+// including ones a newer connection for the user has replaced in Clients, and drops a
+// suspended session of the device. An empty deviceIdentifier matches any device.
+// Unregistration happens through the normal read-loop exit path.
+func (h *Hub) disconnectLocalDevice(userID uuid.UUID, deviceIdentifier string) {
+	matches := func(client *Client) bool {
+		return deviceIdentifier == "" || client.DeviceIdentifier == deviceIdentifier
+	}
+	h.mutex.RLock()
+	current, ok := h.Clients[userID]
+	var open []*Client
+	for client := range h.openConns[userID] {
+		if matches(client) {
+			open = append(open, client)
+		}
+	}
+	h.mutex.RUnlock()
+
+	if ok && matches(current) && h.expireSuspendedClient(current) {
+		log.Printf("Hub %s: Dropped suspended session for user %s device %s", h.serverID, userID.String(), current.DeviceIdentifier)
+	}
+	for _, client := range open {
+		client.Disconnect(websocket.ClosePolicyViolation, "Session ended")
+		log.Printf("Hub %s: Disconnected user %s device %s", h.serverID, userID.String(), client.DeviceIdentifier)
+	}
+}
+
 // addClientToLocalGroupStructLocked assumes h.mutex is already WLocked by the caller.
 func (h *Hub) addClientToLocalGroupStructLocked(client *Client, groupID uuid.UUID) {
 	group, exists := h.Groups[groupID]
@@ -911,6 +1255,11 @@ func (h *Hub) removeClientFromLocalGroupStructLocked(client *Client, groupID uui
 	}
 
 	group.mutex.Lock()
+	// A replaced client must not remove the connection that took its place.
+	if group.Clients[client.User.ID] != client {
+		group.mutex.Unlock()
+		return
+	}
 	delete(group.Clients, client.User.ID)
 	log.Printf("Hub %s: Removed client %s from local cache for group %s", h.serverID, client.User.ID.String(), groupID.String())
 	isEmpty := len(group.Clients) == 0
@@ -922,6 +1271,58 @@ func (h *Hub) removeClientFromLocalGroupStructLocked(client *Client, groupID uui
 	}
 }
 
+// checkRedisHealth tracks Redis availability. When Redis comes back after an outage it
+// may have lost its data, so group membership is re-seeded from the database; the
+// registration refresh that follows restores client keys and asks those clients to resync.
+func (h *Hub) checkRedisHealth() {
+	if err := h.redisClient.Ping(h.ctx).Err(); err != nil {
+		if !h.redisDegraded {
+			log.Printf("Hub %s: Redis unreachable, running degraded: %v", h.serverID, err)
+			h.redisDegraded = true
+		}
+		return
+	}
+	if !h.redisDegraded {
+		return
+	}
+	if err := h.synchronizeDbToRedis(); err != nil {
+		log.Printf("Hub %s: Redis reachable again but re-synchronization failed: %v", h.serverID, err)
+		return
+	}
+	h.redisDegraded = false
+	log.Printf("Hub %s: Redis recovered, state re-synchronized from DB", h.serverID)
+}
+
+// reapStaleClients closes connections that have not answered a ping within pongWait.
+// The read deadline normally catches these, but a reader stuck elsewhere would keep
+// the user's presence key alive through refreshClientRegistrations. Closing the socket
+// ends the read loop, which unregisters the client as for any other drop.
+func (h *Hub) reapStaleClients() {
+	cutoff := time.Now().Add(-pongWait).UnixNano()
+	var stale []*Client
+	h.mutex.RLock()
+	for _, client := range h.Clients {
+		// Suspended clients have no socket; their resume timer handles them. A zero
+		// lastPong means the read loop hasn't started yet.
+		if client.suspended {
+			continue
+		}
+		if last := client.lastPong.Load(); last != 0 && last < cutoff {
+			stale = append(stale, client)
+		}
+	}
+	h.mutex.RUnlock()
+
+	metrics.StaleConnections.Set(int64(len(stale)))
+	for _, client := range stale {
+		log.Printf("Hub %s: Reaping client %s (%s), no pong since %s", h.serverID, client.User.ID, client.User.Username,
+			time.Unix(0, client.lastPong.Load()).Format(time.RFC3339))
+		metrics.ReapedConnections.Add(1)
+		// Disconnect writes a close frame with a deadline; don't hold up the Run loop.
+		go client.Disconnect(websocket.CloseGoingAway, "Heartbeat timeout")
+	}
+}
+
 func (h *Hub) refreshClientRegistrations() {
 	h.mutex.RLock()
 	clientsToRefresh := make([]uuid.UUID, 0, len(h.Clients))
@@ -945,12 +1346,18 @@ func (h *Hub) refreshClientRegistrations() {
 		return
 	}
 	var successfulRefreshCount int
-	for _, cmd := range cmds {
+	var expiredUserIDs []uuid.UUID
+	for i, cmd := range cmds {
 		if cmd.Err() == nil {
-			// For Expire, success means the key existed or was set to expire.
-			// If Expire returns 1, it was set. If 0, key doesn't exist (which is odd here)
-			if val, ok := cmd.(*redis.BoolCmd); ok && val.Val() {
-				successfulRefreshCount++
+			// Expire returns false when the key no longer exists: the registration lapsed
+			// (e.g. Redis was flushed or a refresh was missed) and other instances may have
+			// treated this user as offline in the meantime.
+			if val, ok := cmd.(*redis.BoolCmd); ok {
+				if val.Val() {
+					successfulRefreshCount++
+				} else {
+					expiredUserIDs = append(expiredUserIDs, clientsToRefresh[i])
+				}
 			}
 		} else if cmd.Err() != redis.Nil {
 			log.Printf("Hub %s: Error refreshing a client Redis key: %v", h.serverID, cmd.Err())
@@ -959,4 +1366,22 @@ func (h *Hub) refreshClientRegistrations() {
 	if successfulRefreshCount > 0 {
 		log.Printf("Hub %s: Refreshed %d client Redis key expirations", h.serverID, successfulRefreshCount)
 	}
+
+	if len(expiredUserIDs) == 0 {
+		return
+	}
+	repairPipe := h.redisClient.Pipeline()
+	for _, userID := range expiredUserIDs {
+		clientKey := redisClientServerPrefix + userID.String() + ":server_id"
+		repairPipe.Set(h.ctx, clientKey, h.serverID, 120*time.Second)
+	}
+	if _, err := repairPipe.Exec(h.ctx); err != nil {
+		log.Printf("Hub %s: Error re-registering %d expired client keys: %v", h.serverID, len(expiredUserIDs), err)
+	}
+	h.mutex.RLock()
+	for _, userID := range expiredUserIDs {
+		h.sendResyncLocked(userID)
+	}
+	h.mutex.RUnlock()
+	log.Printf("Hub %s: Re-registered %d clients with expired Redis keys and requested resync", h.serverID, len(expiredUserIDs))
 }
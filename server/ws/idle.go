@@ -0,0 +1,33 @@
+package ws
+
+import "time"
+
+// idleWarningLead is how long before an idle close the client gets an idle_warning.
+// Timeouts shorter than twice the lead warn halfway through instead.
+const idleWarningLead = time.Minute
+
+// markActive records inbound application traffic; pongs don't count.
+func (c *Client) markActive() {
+	c.lastActivity.Store(time.Now().UnixNano())
+}
+
+// checkIdle reports whether the client has been idle long enough to be warned or
+// closed. warnedFor is the writer's record of the activity timestamp it last warned
+// about, so each idle stretch is warned once. It is a no-op when the idle timeout is
+// disabled.
+func (c *Client) checkIdle(warnedFor *int64) (warn, expired bool) {
+	if c.idleTimeout <= 0 {
+		return false, false
+	}
+	last := c.lastActivity.Load()
+	idle := time.Since(time.Unix(0, last))
+	if idle >= c.idleTimeout {
+		return false, true
+	}
+	lead := min(idleWarningLead, c.idleTimeout/2)
+	if idle >= c.idleTimeout-lead && *warnedFor != last {
+		*warnedFor = last
+		return true, false
+	}
+	return false, false
+}
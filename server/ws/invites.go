@@ -3,8 +3,10 @@ package ws
 import (
 	"chat-app-server/db"
 	"chat-app-server/util"
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
 	"math"
 	"net/http"
@@ -12,6 +14,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 )
@@ -85,8 +88,17 @@ func (h *Handler) CreateInvite(c *gin.Context) {
 		return
 	}
 
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for invite creation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := h.db.WithTx(tx)
+
 	maxUses := int32(req.MaxUses)
-	invite, err := h.db.InsertInvite(ctx, db.InsertInviteParams{
+	invite, err := qtx.InsertInvite(ctx, db.InsertInviteParams{
 		Code:      code,
 		GroupID:   req.GroupID,
 		CreatedBy: user.ID,
@@ -98,6 +110,18 @@ func (h *Handler) CreateInvite(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
 		return
 	}
+	// The code itself grants access to the group, so it is deliberately not audited.
+	if err := recordAudit(ctx, qtx, req.GroupID, user.ID, auditInviteLinkCreated, nil,
+		gin.H{"max_uses": req.MaxUses, "expires_at": expiresAt}); err != nil {
+		log.Printf("Error recording invite creation for group %s: %v", req.GroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit invite for group %s: %v", req.GroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
 
 	inviteBaseURL := os.Getenv("INVITE_BASE_URL")
 	if inviteBaseURL == "" {
@@ -113,50 +137,54 @@ func (h *Handler) CreateInvite(c *gin.Context) {
 	})
 }
 
-func (h *Handler) ValidateInvite(c *gin.Context) {
-	ctx := c.Request.Context()
-	code := c.Param("code")
+// Invite statuses reported by ValidateInvitesBatch.
+const (
+	inviteStatusValid    = "valid"
+	inviteStatusExpired  = "expired"
+	inviteStatusMaxed    = "maxed"
+	inviteStatusNotFound = "not_found"
+)
 
+// MaxInviteValidationBatchSize caps the number of codes accepted by ValidateInvitesBatch.
+const MaxInviteValidationBatchSize = 20
+
+// previewInvite looks up an invite code and returns its status and, for a usable
+// invite, the preview of its group. groupGone is set when the invite exists but its
+// group has been deleted; the status is then not_found.
+func (h *Handler) previewInvite(ctx context.Context, code string) (status string, preview *InvitePreviewResponse, groupGone bool, err error) {
 	invite, err := h.db.GetInviteByCode(ctx, code)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
-		} else {
-			log.Printf("Error looking up invite by code: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up invite"})
+			return inviteStatusNotFound, nil, false, nil
 		}
-		return
+		return "", nil, false, err
 	}
 
 	// Check expired by time
 	if invite.ExpiresAt.Valid && invite.ExpiresAt.Time.Before(time.Now()) {
-		c.JSON(http.StatusGone, gin.H{"error": "Invite has expired"})
-		return
+		return inviteStatusExpired, nil, false, nil
 	}
 
 	// Check expired by max uses
 	if invite.MaxUses > 0 && invite.UseCount >= invite.MaxUses {
-		c.JSON(http.StatusGone, gin.H{"error": "Invite has reached maximum uses"})
-		return
+		return inviteStatusMaxed, nil, false, nil
 	}
 
 	// Get group preview
 	groupPreview, err := h.db.GetGroupPreviewByID(ctx, invite.GroupID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Group no longer exists"})
-		} else {
-			log.Printf("Error fetching group preview for invite: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve group info"})
+			return inviteStatusNotFound, nil, true, nil
 		}
-		return
+		return "", nil, false, err
 	}
 
-	response := InvitePreviewResponse{
-		GroupID:     groupPreview.ID,
-		GroupName:   groupPreview.Name,
-		MemberCount: groupPreview.MemberCount,
-		ExpiresAt:   invite.ExpiresAt.Time,
+	response := &InvitePreviewResponse{
+		GroupID:          groupPreview.ID,
+		GroupName:        groupPreview.Name,
+		MemberCount:      groupPreview.MemberCount,
+		ExpiresAt:        invite.ExpiresAt.Time,
+		RequiresApproval: groupPreview.RequiresApproval,
 	}
 
 	if groupPreview.Description.Valid {
@@ -174,8 +202,63 @@ func (h *Handler) ValidateInvite(c *gin.Context) {
 	if groupPreview.EndTime.Valid {
 		response.EndTime = &groupPreview.EndTime.Time
 	}
+	return inviteStatusValid, response, false, nil
+}
+
+func (h *Handler) ValidateInvite(c *gin.Context) {
+	status, preview, groupGone, err := h.previewInvite(c.Request.Context(), c.Param("code"))
+	if err != nil {
+		log.Printf("Error looking up invite by code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up invite"})
+		return
+	}
+
+	switch status {
+	case inviteStatusNotFound:
+		if groupGone {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group no longer exists"})
+		} else {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		}
+	case inviteStatusExpired:
+		c.JSON(http.StatusGone, gin.H{"error": "Invite has expired"})
+	case inviteStatusMaxed:
+		c.JSON(http.StatusGone, gin.H{"error": "Invite has reached maximum uses"})
+	default:
+		c.JSON(http.StatusOK, preview)
+	}
+}
+
+// ValidateInvitesBatch checks several invite codes at once, e.g. for a screen listing
+// a user's pending invites. Each code gets a status and, when valid, its group preview.
+func (h *Handler) ValidateInvitesBatch(c *gin.Context) {
+	var req ValidateInvitesBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Codes) == 0 || len(req.Codes) > MaxInviteValidationBatchSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("codes must contain between 1 and %d codes", MaxInviteValidationBatchSize)})
+		return
+	}
 
-	c.JSON(http.StatusOK, response)
+	results := make([]InviteValidationResult, 0, len(req.Codes))
+	seen := make(map[string]bool, len(req.Codes))
+	for _, code := range req.Codes {
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+
+		status, preview, _, err := h.previewInvite(c.Request.Context(), code)
+		if err != nil {
+			log.Printf("Error looking up invite in batch validation: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up invites"})
+			return
+		}
+		results = append(results, InviteValidationResult{Code: code, Status: status, Preview: preview})
+	}
+	c.JSON(http.StatusOK, gin.H{"invites": results})
 }
 
 func (h *Handler) AcceptInvite(c *gin.Context) {
@@ -212,7 +295,7 @@ func (h *Handler) AcceptInvite(c *gin.Context) {
 	}
 
 	// Check group still exists
-	_, err = h.db.GetGroupById(ctx, invite.GroupID)
+	group, err := h.db.GetGroupById(ctx, invite.GroupID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Group no longer exists"})
@@ -237,6 +320,10 @@ func (h *Handler) AcceptInvite(c *gin.Context) {
 		})
 		return
 	}
+	if group.RequiresApproval {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This group requires admin approval to join", "requires_approval": true})
+		return
+	}
 
 	// Check block conflicts
 	hasConflict, err := h.db.CheckBlockConflictWithGroup(ctx, db.CheckBlockConflictWithGroupParams{
@@ -264,10 +351,17 @@ func (h *Handler) AcceptInvite(c *gin.Context) {
 
 	qtx := h.db.WithTx(tx)
 
+	muted, err := h.newMemberMuted(ctx, qtx, invite.GroupID, 1)
+	if err != nil {
+		log.Printf("Error loading default mute state for group %s: %v", invite.GroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join group"})
+		return
+	}
 	_, err = qtx.InsertUserGroup(ctx, db.InsertUserGroupParams{
 		UserID:  &user.ID,
 		GroupID: &invite.GroupID,
 		Admin:   false,
+		Muted:   muted,
 	})
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -293,6 +387,11 @@ func (h *Handler) AcceptInvite(c *gin.Context) {
 		c.JSON(http.StatusGone, gin.H{"error": "Invite has reached maximum uses"})
 		return
 	}
+	if err := qtx.RecordInviteJoin(ctx, db.RecordInviteJoinParams{InviteID: invite.ID, UserID: user.ID}); err != nil {
+		log.Printf("Error recording join via invite %s: %v", invite.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process invite"})
+		return
+	}
 
 	if err := tx.Commit(ctx); err != nil {
 		log.Printf("Failed to commit invite acceptance transaction: %v", err)
@@ -314,5 +413,80 @@ func (h *Handler) AcceptInvite(c *gin.Context) {
 	c.JSON(http.StatusOK, AcceptInviteResponse{
 		GroupID: groupID,
 		Message: "Successfully joined group",
+		Muted:   &muted,
 	})
 }
+
+// inviteStatsJoinsPerInvite caps the recent joins listed for each invite.
+const inviteStatsJoinsPerInvite = 50
+
+// GetInviteStats serves GET /ws/groups/:groupID/invites/stats: every invite link of the
+// group, newest first, with its use counts and most recent joins. Admin only.
+func (h *Handler) GetInviteStats(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
+		return
+	}
+	if !h.requireGroupAdmin(c, user.ID, groupID) {
+		return
+	}
+
+	invites, err := h.db.GetInvitesByGroup(ctx, groupID)
+	if err != nil {
+		log.Printf("Error loading invites for group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load invite stats"})
+		return
+	}
+	joins, err := h.db.GetRecentInviteJoinsForGroup(ctx, db.GetRecentInviteJoinsForGroupParams{
+		GroupID:        groupID,
+		JoinsPerInvite: inviteStatsJoinsPerInvite,
+	})
+	if err != nil {
+		log.Printf("Error loading invite joins for group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load invite stats"})
+		return
+	}
+	joinsByInvite := make(map[uuid.UUID][]InviteJoin)
+	for _, join := range joins {
+		joinsByInvite[join.InviteID] = append(joinsByInvite[join.InviteID], InviteJoin{
+			UserID:   join.UserID,
+			Username: join.Username,
+			JoinedAt: join.JoinedAt.Time,
+		})
+	}
+
+	now := time.Now()
+	stats := make([]InviteStats, 0, len(invites))
+	for _, invite := range invites {
+		entry := InviteStats{
+			ID:        invite.ID,
+			Code:      invite.Code,
+			CreatedBy: invite.CreatedBy,
+			CreatedAt: invite.CreatedAt.Time,
+			UseCount:  int(invite.UseCount),
+			MaxUses:   int(invite.MaxUses),
+			Joins:     joinsByInvite[invite.ID],
+		}
+		if invite.MaxUses > 0 {
+			remaining := max(int(invite.MaxUses-invite.UseCount), 0)
+			entry.RemainingUses = &remaining
+		}
+		if invite.ExpiresAt.Valid {
+			entry.ExpiresAt = &invite.ExpiresAt.Time
+			entry.Expired = invite.ExpiresAt.Time.Before(now)
+		}
+		if entry.Joins == nil {
+			entry.Joins = []InviteJoin{}
+		}
+		stats = append(stats, entry)
+	}
+	c.JSON(http.StatusOK, InviteStatsResponse{Invites: stats})
+}
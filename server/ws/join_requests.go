@@ -0,0 +1,344 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// RequestJoin lets a user holding a valid invite link to an approval-only group
+// ask the group's admins to let them in.
+func (h *Handler) RequestJoin(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
+		return
+	}
+
+	var req RequestJoinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invite, err := h.db.GetInviteByCode(ctx, req.Code)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		} else {
+			log.Printf("Error looking up invite for join request: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up invite"})
+		}
+		return
+	}
+	if invite.GroupID != groupID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		return
+	}
+	if invite.ExpiresAt.Valid && invite.ExpiresAt.Time.Before(time.Now()) {
+		c.JSON(http.StatusGone, gin.H{"error": "Invite has expired"})
+		return
+	}
+	if invite.MaxUses > 0 && invite.UseCount >= invite.MaxUses {
+		c.JSON(http.StatusGone, gin.H{"error": "Invite has reached maximum uses"})
+		return
+	}
+
+	group, err := h.db.GetGroupById(ctx, groupID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group no longer exists"})
+		} else {
+			log.Printf("Error fetching group for join request: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check group"})
+		}
+		return
+	}
+	if !group.RequiresApproval {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This group does not require approval; accept the invite instead"})
+		return
+	}
+
+	isMember, err := util.UserInGroup(ctx, user.ID, groupID, h.db)
+	if err != nil {
+		log.Printf("Error checking group membership for join request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check membership"})
+		return
+	}
+	if isMember {
+		c.JSON(http.StatusOK, gin.H{"group_id": groupID, "message": "Already a member"})
+		return
+	}
+
+	_, err = h.db.InsertJoinRequest(ctx, db.InsertJoinRequestParams{GroupID: groupID, UserID: user.ID})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// ON CONFLICT DO NOTHING — a pending request already exists
+			c.JSON(http.StatusOK, gin.H{"group_id": groupID, "message": "Join request already pending"})
+			return
+		}
+		log.Printf("Error inserting join request for user %s group %s: %v", user.ID, groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create join request"})
+		return
+	}
+
+	adminIDs, err := h.groupAdminIDs(ctx, groupID)
+	if err != nil {
+		log.Printf("Error loading admins to notify for join request in group %s: %v", groupID, err)
+	}
+	for _, adminID := range adminIDs {
+		h.hub.NotifyUser(adminID, "join_requested", groupID)
+	}
+	if len(adminIDs) > 0 {
+		go h.hub.notificationService.SendUserNotification(
+			h.hub.ctx,
+			adminIDs,
+			group.Name,
+			fmt.Sprintf("%s asked to join", user.Username),
+			map[string]string{"groupId": groupID.String(), "type": "join_requested"},
+		)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"group_id": groupID, "message": "Join request sent"})
+}
+
+// GetJoinRequests lists pending join requests for a group. Admin only.
+func (h *Handler) GetJoinRequests(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
+		return
+	}
+	if !h.requireGroupAdmin(c, user.ID, groupID) {
+		return
+	}
+
+	rows, err := h.db.GetPendingJoinRequestsForGroup(ctx, groupID)
+	if err != nil {
+		log.Printf("Error fetching join requests for group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch join requests"})
+		return
+	}
+
+	response := make([]ClientJoinRequest, 0, len(rows))
+	for _, row := range rows {
+		response = append(response, ClientJoinRequest{
+			ID:          row.ID,
+			UserID:      row.UserID,
+			Username:    row.Username,
+			RequestedAt: row.CreatedAt.Time,
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *Handler) ApproveJoinRequest(c *gin.Context) {
+	h.decideJoinRequest(c, true)
+}
+
+func (h *Handler) DenyJoinRequest(c *gin.Context) {
+	h.decideJoinRequest(c, false)
+}
+
+func (h *Handler) decideJoinRequest(c *gin.Context, approve bool) {
+	ctx := c.Request.Context()
+	admin, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
+		return
+	}
+	requesterID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+	if !h.requireGroupAdmin(c, admin.ID, groupID) {
+		return
+	}
+
+	group, err := h.db.GetGroupById(ctx, groupID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		} else {
+			log.Printf("Error fetching group for join request decision: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check group"})
+		}
+		return
+	}
+
+	if approve {
+		// Same eligibility rule as AcceptInvite
+		hasConflict, err := h.db.CheckBlockConflictWithGroup(ctx, db.CheckBlockConflictWithGroupParams{
+			BlockedID: requesterID,
+			GroupID:   &groupID,
+		})
+		if err != nil {
+			log.Printf("Error checking block conflict for join request approval: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify eligibility"})
+			return
+		}
+		if hasConflict {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This user cannot be added to the group"})
+			return
+		}
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to begin transaction for join request decision: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start database operation"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.db.WithTx(tx)
+
+	status := "denied"
+	if approve {
+		status = "approved"
+	}
+	_, err = qtx.DecideJoinRequest(ctx, db.DecideJoinRequestParams{
+		Status:    status,
+		DecidedBy: &admin.ID,
+		GroupID:   groupID,
+		UserID:    requesterID,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No pending join request for this user"})
+		} else {
+			log.Printf("Error updating join request for user %s group %s: %v", requesterID, groupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update join request"})
+		}
+		return
+	}
+
+	if approve {
+		muted, err := h.newMemberMuted(ctx, qtx, groupID, 1)
+		if err != nil {
+			log.Printf("Error loading default mute state for group %s: %v", groupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add user to group"})
+			return
+		}
+		_, err = qtx.InsertUserGroup(ctx, db.InsertUserGroupParams{
+			UserID:  &requesterID,
+			GroupID: &groupID,
+			Admin:   false,
+			Muted:   muted,
+		})
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("Error inserting user_group for approved join request: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add user to group"})
+			return
+		}
+	}
+
+	auditAction := auditJoinDenied
+	if approve {
+		auditAction = auditJoinApproved
+	}
+	if err := recordAudit(ctx, qtx, groupID, admin.ID, auditAction, &requesterID, nil); err != nil {
+		log.Printf("Error recording join request decision for user %s group %s: %v", requesterID, groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update join request"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to commit join request decision: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to finalize join request"})
+		return
+	}
+
+	event := "join_request_denied"
+	pushBody := fmt.Sprintf("Your request to join %s was declined", group.Name)
+	if approve {
+		event = "join_request_approved"
+		pushBody = fmt.Sprintf("You've been added to %s", group.Name)
+
+		select {
+		case h.hub.AddUserToGroupChan <- &AddClientToGroupMsg{UserID: requesterID, GroupID: groupID}:
+			log.Printf("Sent request to hub to process user %s addition to group %s via join request", requesterID, groupID)
+		case <-ctx.Done():
+			log.Printf("Context cancelled while sending AddUserToGroupChan for join request approval")
+		case <-time.After(2 * time.Second):
+			log.Printf("Warning: Timed out sending AddUserToGroupChan for join request user %s group %s", requesterID, groupID)
+		}
+	}
+
+	h.hub.NotifyUser(requesterID, event, groupID)
+	go h.hub.notificationService.SendUserNotification(
+		h.hub.ctx,
+		[]uuid.UUID{requesterID},
+		group.Name,
+		pushBody,
+		map[string]string{"groupId": groupID.String(), "type": event},
+	)
+
+	c.JSON(http.StatusOK, gin.H{"group_id": groupID, "user_id": requesterID, "status": status})
+}
+
+// requireGroupAdmin writes an error response and returns false unless userID is an admin of groupID.
+func (h *Handler) requireGroupAdmin(c *gin.Context, userID, groupID uuid.UUID) bool {
+	userGroup, err := h.db.GetUserGroupByGroupIDAndUserID(c.Request.Context(), db.GetUserGroupByGroupIDAndUserIDParams{
+		UserID:  &userID,
+		GroupID: &groupID,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "User not part of the group"})
+		} else {
+			log.Printf("Error checking admin status for user %s group %s: %v", userID, groupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user permissions"})
+		}
+		return false
+	}
+	if !userGroup.Admin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can perform this action"})
+		return false
+	}
+	return true
+}
+
+func (h *Handler) groupAdminIDs(ctx context.Context, groupID uuid.UUID) ([]uuid.UUID, error) {
+	members, err := h.db.GetAllUserGroupsForGroup(ctx, &groupID)
+	if err != nil {
+		return nil, err
+	}
+	var adminIDs []uuid.UUID
+	for _, m := range members {
+		if m.Admin && m.UserID != nil {
+			adminIDs = append(adminIDs, *m.UserID)
+		}
+	}
+	return adminIDs, nil
+}
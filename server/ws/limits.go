@@ -0,0 +1,49 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/util"
+
+	"github.com/google/uuid"
+)
+
+// messageSizeLimits caps the encoded size of an incoming E2EE message, in bytes, by
+// its declared messageType. Image messages carry attachment metadata in every
+// envelope and so get more room than text.
+type messageSizeLimits map[db.MessageType]int
+
+func loadMessageSizeLimits() messageSizeLimits {
+	return messageSizeLimits{
+		db.MessageTypeText:    util.GetEnvInt("MAX_TEXT_MESSAGE_BYTES", 16*1024),
+		db.MessageTypeImage:   util.GetEnvInt("MAX_IMAGE_MESSAGE_BYTES", 256*1024),
+		db.MessageTypeControl: util.GetEnvInt("MAX_CONTROL_MESSAGE_BYTES", 16*1024),
+	}
+}
+
+// limitFor returns the limit for messageType. Unknown types get the text limit.
+func (l messageSizeLimits) limitFor(messageType db.MessageType) int {
+	if limit, ok := l[messageType]; ok {
+		return limit
+	}
+	return l[db.MessageTypeText]
+}
+
+// frameLimit is the largest per-type limit, used as the WebSocket read limit.
+func (l messageSizeLimits) frameLimit() int {
+	max := 0
+	for _, limit := range l {
+		if limit > max {
+			max = limit
+		}
+	}
+	return max
+}
+
+// clientMessageHeader is the part of an inbound frame needed to route it: Type is set
+// only on control messages such as "reauth"; chat messages are sized by MessageType.
+type clientMessageHeader struct {
+	Type        string         `json:"type"`
+	ID          uuid.UUID      `json:"id"`
+	GroupID     uuid.UUID      `json:"group_id"`
+	MessageType db.MessageType `json:"messageType"`
+}
@@ -0,0 +1,104 @@
+package ws
+
+import (
+	"chat-app-server/rediskeys"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// InMaintenance reports whether writes are currently refused. The flag lives in Redis
+// under rediskeys.MaintenanceKey; each hub caches it, updating on Pub/Sub and on the
+// refresh ticker.
+func (h *Hub) InMaintenance() bool {
+	return h.maintenance.Load()
+}
+
+// SetMaintenance turns cluster-wide maintenance mode on or off.
+func (h *Hub) SetMaintenance(ctx context.Context, enabled bool) error {
+	var err error
+	if enabled {
+		err = h.redisClient.Set(ctx, rediskeys.MaintenanceKey, "1", 0).Err()
+	} else {
+		err = h.redisClient.Del(ctx, rediskeys.MaintenanceKey).Err()
+	}
+	if err != nil {
+		return err
+	}
+	h.applyMaintenance(enabled)
+
+	serialized, err := json.Marshal(PubSubMessage{Type: "maintenance", Payload: MaintenancePayload{Enabled: enabled}, OriginServerID: h.serverID})
+	if err != nil {
+		return err
+	}
+	if err := h.redisClient.Publish(ctx, pubSubGroupEventsChannel, serialized).Err(); err != nil {
+		// Other instances still pick the flag up on their next refresh.
+		log.Printf("Hub %s: Error publishing maintenance event: %v", h.serverID, err)
+	}
+	return nil
+}
+
+// refreshMaintenance re-reads the flag, covering Pub/Sub events this instance missed.
+// The cached value is kept when Redis can't be reached.
+func (h *Hub) refreshMaintenance() {
+	err := h.redisClient.Get(h.ctx, rediskeys.MaintenanceKey).Err()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		log.Printf("Hub %s: Error reading maintenance flag: %v", h.serverID, err)
+		return
+	}
+	h.applyMaintenance(err == nil)
+}
+
+// applyMaintenance updates the cached flag and, if it changed, tells every local client.
+func (h *Hub) applyMaintenance(enabled bool) {
+	if h.maintenance.Swap(enabled) == enabled {
+		return
+	}
+	event := "maintenance_ended"
+	if enabled {
+		event = "maintenance"
+	}
+	log.Printf("Hub %s: Maintenance mode set to %t", h.serverID, enabled)
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for _, client := range h.Clients {
+		client.SendEvent(event, uuid.Nil)
+	}
+}
+
+// rejectIfMaintenance answers 503 when maintenance mode is on. Handlers for write
+// endpoints call it first and return if it reports true.
+func (h *Handler) rejectIfMaintenance(c *gin.Context) bool {
+	if !h.hub.InMaintenance() {
+		return false
+	}
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Server is in maintenance mode, try again shortly", "maintenance": true})
+	return true
+}
+
+// GetMaintenance reports whether maintenance mode is on. Operator only.
+func (h *Handler) GetMaintenance(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"enabled": h.hub.InMaintenance()})
+}
+
+// SetMaintenance turns maintenance mode on or off for every instance. Operator only.
+func (h *Handler) SetMaintenance(c *gin.Context) {
+	var req SetMaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.hub.SetMaintenance(c.Request.Context(), *req.Enabled); err != nil {
+		log.Printf("Error setting maintenance mode: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update maintenance mode"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": *req.Enabled})
+}
@@ -0,0 +1,91 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var groupMediaPageLimits = util.PageLimits{Default: 50, Max: 100}
+
+// mediaCursor is the position after the last attachment of a page, ordered by the
+// message's sent time, then attachment ID, descending. It is sent to clients as
+// opaque base64url JSON.
+type mediaCursor struct {
+	SentAt time.Time `json:"t"`
+	ID     uuid.UUID `json:"id"`
+}
+
+// GetGroupMedia serves GET /ws/groups/:groupID/media?cursor=&limit=: attachment
+// metadata for the group's messages, newest first, so clients can build a media view
+// and presign just those objects. Members only see attachments of messages they can
+// see in history.
+func (h *Handler) GetGroupMedia(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
+		return
+	}
+
+	// Start past every real entry.
+	cursor := mediaCursor{SentAt: time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC), ID: uuid.Max}
+	limit, ok := util.ParsePage(c, groupMediaPageLimits, &cursor)
+	if !ok {
+		return
+	}
+
+	isMember, err := util.UserInGroup(ctx, user.ID, groupID, h.db)
+	if err != nil {
+		log.Printf("Error checking membership of user %s in group %s: %v", user.ID, groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load group media"})
+		return
+	}
+	if !isMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User does not have access to this group"})
+		return
+	}
+
+	rows, err := h.db.GetGroupMediaPage(ctx, db.GetGroupMediaPageParams{
+		UserID:       &user.ID,
+		GroupID:      groupID,
+		BeforeSentAt: pgtype.Timestamp{Time: cursor.SentAt, Valid: true},
+		BeforeID:     cursor.ID,
+		PageSize:     int32(limit),
+	})
+	if err != nil {
+		log.Printf("Error loading media for group %s: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load group media"})
+		return
+	}
+
+	page := GroupMediaPage{Media: make([]GroupMediaItem, 0, len(rows)), Limit: limit}
+	for _, row := range rows {
+		page.Media = append(page.Media, GroupMediaItem{
+			ID:          row.ID,
+			MessageID:   row.MessageID,
+			SenderID:    row.SenderID,
+			ObjectKey:   row.S3Key,
+			ContentType: row.ContentType,
+			Size:        row.Size,
+			SentAt:      row.SentAt.Time,
+		})
+	}
+	if len(rows) == limit {
+		last := rows[len(rows)-1]
+		page.NextCursor = util.EncodeCursor(mediaCursor{SentAt: last.SentAt.Time, ID: last.ID})
+	}
+	c.JSON(http.StatusOK, page)
+}
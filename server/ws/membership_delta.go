@@ -0,0 +1,100 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxKnownGroups caps the known_groups list accepted in the auth message. Larger lists
+// get a resync instead of a delta.
+const maxKnownGroups = 1000
+
+// MembershipDelta is sent once after auth to a client that declared the groups it
+// already has and when it last synced them. It carries only what changed: groups the
+// user joined, groups whose info or member list changed, and groups the user left or
+// that were deleted. Ended groups stay until cleanup_expired_groups deletes them, as in
+// GetGroupsForUser. The client stores SyncedAt for its next reconnect.
+type MembershipDelta struct {
+	Type     string                   `json:"type"`
+	Joined   []db.GetGroupsForUserRow `json:"joined"`
+	Updated  []db.GetGroupsForUserRow `json:"updated"`
+	Left     []uuid.UUID              `json:"left"`
+	SyncedAt time.Time                `json:"synced_at"`
+}
+
+func (d *MembershipDelta) describe() string {
+	return d.Type
+}
+
+// buildMembershipDelta compares the user's current groups with known, the group IDs
+// the client already has as of since.
+func buildMembershipDelta(ctx context.Context, queries *db.Queries, userID uuid.UUID, known []uuid.UUID, since time.Time) (*MembershipDelta, error) {
+	// Taken before reading so a change racing with the queries is sent again next time.
+	syncedAt := time.Now().UTC()
+
+	groups, err := queries.GetGroupsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	changeTimes, err := queries.GetGroupChangeTimesForUser(ctx, &userID)
+	if err != nil {
+		return nil, err
+	}
+	changedAt := make(map[uuid.UUID]time.Time, len(changeTimes))
+	for _, row := range changeTimes {
+		changedAt[row.ID] = row.ChangedAt.Time
+	}
+	knownSet := make(map[uuid.UUID]bool, len(known))
+	for _, id := range known {
+		knownSet[id] = true
+	}
+
+	delta := &MembershipDelta{
+		Type:     "membership_delta",
+		Joined:   []db.GetGroupsForUserRow{},
+		Updated:  []db.GetGroupsForUserRow{},
+		Left:     []uuid.UUID{},
+		SyncedAt: syncedAt,
+	}
+	current := make(map[uuid.UUID]bool, len(groups))
+	for _, group := range groups {
+		current[group.ID] = true
+		switch {
+		case !knownSet[group.ID]:
+			delta.Joined = append(delta.Joined, group)
+		case !changedAt[group.ID].Before(since.UTC()):
+			delta.Updated = append(delta.Updated, group)
+		}
+	}
+	for id := range knownSet {
+		if !current[id] {
+			delta.Left = append(delta.Left, id)
+		}
+	}
+	return delta, nil
+}
+
+// sendMembershipDelta queues the delta for a client that asked for one, or a resync
+// event when it can't be built so the client falls back to a full fetch.
+func (h *Handler) sendMembershipDelta(ctx context.Context, client *Client, known []uuid.UUID, since time.Time) {
+	var delta *MembershipDelta
+	var err error
+	if len(known) <= maxKnownGroups {
+		delta, err = buildMembershipDelta(ctx, h.db, client.User.ID, known, since)
+		if err != nil {
+			log.Printf("Error building membership delta for user %s: %v", client.User.ID, err)
+		}
+	}
+
+	h.hub.mutex.RLock()
+	defer h.hub.mutex.RUnlock()
+	if delta == nil {
+		client.SendEvent("resync", uuid.Nil)
+		return
+	}
+	client.Send(delta)
+}
@@ -0,0 +1,76 @@
+package ws
+
+import (
+	"chat-app-server/db"
+
+	"github.com/google/uuid"
+)
+
+// The checks below apply to every message version a sender stores, whether it arrives
+// as a new message over the socket or as an edit. Each returns the nack to send, or
+// nil when the version passes.
+
+// checkMessageSize rejects a version whose encoded size is over the limit for its type.
+func (h *Hub) checkMessageSize(messageID, groupID uuid.UUID, messageType db.MessageType, size int) *MessageAck {
+	if limit := h.messageSizeLimits.limitFor(messageType); size > limit {
+		return &MessageAck{
+			Type:      "message_nack",
+			MessageID: messageID,
+			GroupID:   groupID,
+			Reason:    "message_too_large",
+			MaxBytes:  limit,
+		}
+	}
+	return nil
+}
+
+// checkEnvelopeShape rejects a version with more envelopes than the hard cap or with an
+// oversized envelope field. It needs no group lookup, so it runs before any database work.
+func (h *Hub) checkEnvelopeShape(msg ClientSentE2EMessage) *MessageAck {
+	if overEnvelopeCap(msg.Envelopes, h.maxEnvelopes) {
+		return &MessageAck{
+			Type:         "message_nack",
+			MessageID:    msg.ID,
+			GroupID:      msg.GroupID,
+			Reason:       "too_many_envelopes",
+			MaxEnvelopes: h.maxEnvelopes,
+		}
+	}
+	if !envelopeFieldsValid(msg.Envelopes) {
+		return &MessageAck{Type: "message_nack", MessageID: msg.ID, GroupID: msg.GroupID, Reason: "invalid_envelopes"}
+	}
+	return nil
+}
+
+// checkPostingPermission rejects a version the sender may not post to the group: content
+// from a non-admin in an announcement-only group, or anything once the group has ended.
+// Control messages carry no user-visible content, so they stay open to everyone.
+func (h *Hub) checkPostingPermission(msg ClientSentE2EMessage, permission db.GetPostingPermissionRow) *MessageAck {
+	if permission.AnnouncementOnly && !permission.Admin && msg.MessageType != db.MessageTypeControl {
+		return &MessageAck{Type: "message_nack", MessageID: msg.ID, GroupID: msg.GroupID, Reason: "announcement_only"}
+	}
+	if groupEnded(permission.EndTime, h.endedGroupGrace) {
+		return &MessageAck{Type: "message_nack", MessageID: msg.ID, GroupID: msg.GroupID, Reason: "event_ended"}
+	}
+	return nil
+}
+
+// checkEnvelopeCoverage rejects a version with more envelopes than the group's member
+// devices allow and, when coverage is enforced, one missing an envelope for some of them.
+func (h *Hub) checkEnvelopeCoverage(msg ClientSentE2EMessage, deviceIDs []string) *MessageAck {
+	if tooManyEnvelopes(msg.Envelopes, len(deviceIDs), h.envelopeTolerance) {
+		return &MessageAck{Type: "message_nack", MessageID: msg.ID, GroupID: msg.GroupID, Reason: "too_many_envelopes"}
+	}
+	if h.enforceEnvelopeCoverage {
+		if missing := missingEnvelopeDevices(deviceIDs, msg); len(missing) > 0 {
+			return &MessageAck{
+				Type:           "message_nack",
+				MessageID:      msg.ID,
+				GroupID:        msg.GroupID,
+				Reason:         "missing_devices",
+				MissingDevices: missing,
+			}
+		}
+	}
+	return nil
+}
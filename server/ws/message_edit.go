@@ -0,0 +1,283 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// EditMessage serves PUT /ws/messages/:messageID: the sender replaces one of their
+// messages with a new version, signed by one of their devices over the same canonical
+// payload as a new message. The replaced version goes to message_edits in the same
+// transaction, and members are sent the new version in a message_edited group_event.
+// The new version must pass the size, envelope and posting checks of a new message, so
+// a non-admin can't edit in an announcement-only group. Control messages can't be edited.
+func (h *Handler) EditMessage(c *gin.Context) {
+	if h.rejectIfMaintenance(c) {
+		return
+	}
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	messageID, err := uuid.Parse(c.Param("messageID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID format"})
+		return
+	}
+
+	// No message type allows more than the frame limit, so a bigger body isn't read.
+	frameLimit := h.hub.messageSizeLimits.frameLimit()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(frameLimit))
+	var req EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Message too large", "reason": "message_too_large", "max_bytes": frameLimit})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Same visibility rule as the history: a sender who has since left can't edit.
+	message, err := h.db.GetForwardableMessage(ctx, db.GetForwardableMessageParams{
+		MessageID: messageID,
+		UserID:    &user.ID,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		} else {
+			log.Printf("Error loading message %s to edit for user %s: %v", messageID, user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to edit message"})
+		}
+		return
+	}
+	if message.GroupID == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if message.UserID == nil || *message.UserID != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the sender can edit a message"})
+		return
+	}
+	if message.MessageType == db.MessageTypeControl {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Control messages can't be edited"})
+		return
+	}
+
+	permission, err := h.db.GetPostingPermission(ctx, db.GetPostingPermissionParams{
+		UserID:  &user.ID,
+		GroupID: message.GroupID,
+	})
+	if err != nil {
+		log.Printf("Error loading posting permission of user %s in group %s: %v", user.ID, *message.GroupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to edit message"})
+		return
+	}
+	version := ClientSentE2EMessage{
+		ID:          messageID,
+		GroupID:     *message.GroupID,
+		MessageType: message.MessageType,
+		Signature:   req.Signature,
+		MsgNonce:    req.MsgNonce,
+		Ciphertext:  req.Ciphertext,
+		Envelopes:   req.Envelopes,
+	}
+	// The new version must pass the same checks as a new message sent over the socket.
+	encoded, err := json.Marshal(version)
+	if err != nil {
+		log.Printf("Error encoding edit of message %s: %v", messageID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to edit message"})
+		return
+	}
+	if nack := h.hub.checkMessageSize(messageID, *message.GroupID, message.MessageType, len(encoded)); nack != nil {
+		rejectEdit(c, nack)
+		return
+	}
+	if nack := h.hub.checkEnvelopeShape(version); nack != nil {
+		rejectEdit(c, nack)
+		return
+	}
+	if nack := h.hub.checkPostingPermission(version, permission); nack != nil {
+		rejectEdit(c, nack)
+		return
+	}
+	deviceIDs, err := h.db.GetDeviceIdentifiersForGroup(ctx, message.GroupID)
+	if err != nil {
+		log.Printf("Error loading devices of group %s to edit message %s: %v", *message.GroupID, messageID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to edit message"})
+		return
+	}
+	if nack := h.hub.checkEnvelopeCoverage(version, deviceIDs); nack != nil {
+		rejectEdit(c, nack)
+		return
+	}
+
+	deviceKey, err := h.db.GetDeviceKeyByIdentifier(ctx, db.GetDeviceKeyByIdentifierParams{
+		UserID:           user.ID,
+		DeviceIdentifier: req.DeviceIdentifier,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		} else {
+			log.Printf("Error loading device %s for user %s: %v", req.DeviceIdentifier, user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to edit message"})
+		}
+		return
+	}
+
+	stored, ok := decodeMessageVersion(req)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message encoding"})
+		return
+	}
+	canonicalPayload, err := buildCanonicalSignedPayload(version, user.ID, req.DeviceIdentifier)
+	if err != nil {
+		log.Printf("Error building canonical payload for edit of message %s: %v", messageID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to edit message"})
+		return
+	}
+	if len(deviceKey.SigningPublicKey) != ed25519.PublicKeySize ||
+		!ed25519.Verify(ed25519.PublicKey(deviceKey.SigningPublicKey), []byte(canonicalPayload), stored.Signature) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signature"})
+		return
+	}
+
+	tx, err := h.conn.Begin(ctx)
+	if err != nil {
+		log.Printf("Error starting transaction to edit message %s: %v", messageID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to edit message"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	stored.ID = messageID
+	stored.UserID = &user.ID
+	editedAt, err := replaceMessageVersion(ctx, h.db.WithTx(tx), stored, h.messageEditHistoryDepth)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		} else {
+			log.Printf("Error editing message %s: %v", messageID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to edit message"})
+		}
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Error committing edit of message %s: %v", messageID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to edit message"})
+		return
+	}
+
+	edit := &MessageEdit{
+		MessageID:      messageID,
+		SenderDeviceID: req.DeviceIdentifier,
+		MsgNonce:       req.MsgNonce,
+		Ciphertext:     req.Ciphertext,
+		Signature:      req.Signature,
+		Envelopes:      req.Envelopes,
+		EditedAt:       editedAt.Time,
+	}
+	h.hub.NotifyMessageEdited(*message.GroupID, edit)
+	c.JSON(http.StatusOK, edit)
+}
+
+// editRejections maps the nack reasons of the shared message checks to the status and
+// error an edit is refused with.
+var editRejections = map[string]struct {
+	status int
+	error  string
+}{
+	"message_too_large":  {http.StatusRequestEntityTooLarge, "Message too large"},
+	"too_many_envelopes": {http.StatusBadRequest, "Too many envelopes"},
+	"invalid_envelopes":  {http.StatusBadRequest, "Invalid envelopes"},
+	"missing_devices":    {http.StatusBadRequest, "Missing envelopes for member devices"},
+	"announcement_only":  {http.StatusForbidden, "Only admins can post in this group"},
+	"event_ended":        {http.StatusForbidden, "This event has ended"},
+}
+
+// rejectEdit responds to an edit refused by one of the shared message checks, carrying
+// the nack's reason and any limit or devices the client needs to retry.
+func rejectEdit(c *gin.Context, nack *MessageAck) {
+	rejection, ok := editRejections[nack.Reason]
+	if !ok {
+		rejection.status, rejection.error = http.StatusBadRequest, "Invalid message"
+	}
+	body := gin.H{"error": rejection.error, "reason": nack.Reason}
+	if nack.MaxBytes > 0 {
+		body["max_bytes"] = nack.MaxBytes
+	}
+	if nack.MaxEnvelopes > 0 {
+		body["max_envelopes"] = nack.MaxEnvelopes
+	}
+	if len(nack.MissingDevices) > 0 {
+		body["missing_devices"] = nack.MissingDevices
+	}
+	c.JSON(rejection.status, body)
+}
+
+// decodeMessageVersion decodes an edit's base64 fields into the columns of a message
+// version. It reports false when any of them is malformed.
+func decodeMessageVersion(req EditMessageRequest) (db.UpdateMessageVersionParams, bool) {
+	signature, err := base64.StdEncoding.DecodeString(req.Signature)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return db.UpdateMessageVersionParams{}, false
+	}
+	msgNonce, err := base64.StdEncoding.DecodeString(req.MsgNonce)
+	if err != nil {
+		return db.UpdateMessageVersionParams{}, false
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(req.Ciphertext)
+	if err != nil {
+		return db.UpdateMessageVersionParams{}, false
+	}
+	envelopes, err := json.Marshal(req.Envelopes)
+	if err != nil {
+		return db.UpdateMessageVersionParams{}, false
+	}
+	return db.UpdateMessageVersionParams{
+		Ciphertext:             ciphertext,
+		MsgNonce:               msgNonce,
+		KeyEnvelopes:           envelopes,
+		SenderDeviceIdentifier: pgtype.Text{String: req.DeviceIdentifier, Valid: true},
+		Signature:              signature,
+	}, true
+}
+
+// replaceMessageVersion copies a message's current version into message_edits,
+// overwrites it with version and prunes the history to the newest depth versions.
+// queries must be bound to a transaction so the copy and the overwrite land together.
+// It returns pgx.ErrNoRows when the message isn't version.UserID's.
+func replaceMessageVersion(ctx context.Context, queries *db.Queries, version db.UpdateMessageVersionParams, depth int) (pgtype.Timestamp, error) {
+	if err := queries.InsertMessageEdit(ctx, version.ID); err != nil {
+		return pgtype.Timestamp{}, err
+	}
+	editedAt, err := queries.UpdateMessageVersion(ctx, version)
+	if err != nil {
+		return pgtype.Timestamp{}, err
+	}
+	if err := queries.PruneMessageEdits(ctx, db.PruneMessageEditsParams{
+		MessageID: version.ID,
+		Keep:      int32(depth),
+	}); err != nil {
+		return pgtype.Timestamp{}, err
+	}
+	return editedAt, nil
+}
@@ -0,0 +1,232 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type storedVersion struct {
+	id         uuid.UUID
+	ciphertext []byte
+	replacedAt time.Time
+}
+
+// editDB holds one message sent by the account user and its message_edits rows.
+type editDB struct {
+	accountDB
+	groupID    uuid.UUID
+	message    uuid.UUID
+	ciphertext []byte
+	edits      []storedVersion
+	clock      time.Time
+	// announcementOnly marks the group announcement-only; the account user isn't an admin.
+	announcementOnly bool
+}
+
+func (d *editDB) tick() time.Time {
+	d.clock = d.clock.Add(time.Second)
+	return d.clock
+}
+
+func (d *editDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	switch {
+	case strings.Contains(sql, "-- name: InsertMessageEdit ") && args[0] == d.message:
+		d.edits = append(d.edits, storedVersion{id: uuid.New(), ciphertext: d.ciphertext, replacedAt: d.tick()})
+		return pgconn.NewCommandTag("INSERT 0 1"), nil
+	case strings.Contains(sql, "-- name: PruneMessageEdits ") && args[0] == d.message:
+		keep := int(args[1].(int32))
+		sort.Slice(d.edits, func(i, j int) bool { return d.edits[i].replacedAt.After(d.edits[j].replacedAt) })
+		if len(d.edits) > keep {
+			d.edits = d.edits[:keep]
+		}
+		return pgconn.NewCommandTag("DELETE"), nil
+	}
+	return d.accountDB.Exec(ctx, sql, args...)
+}
+
+func (d *editDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	switch {
+	case strings.Contains(sql, "-- name: UpdateMessageVersion ") && args[5] == d.message && *args[6].(*uuid.UUID) == d.id:
+		d.ciphertext = args[0].([]byte)
+		editedAt := d.tick()
+		return scanRow(func(dest ...any) {
+			*dest[0].(*pgtype.Timestamp) = pgtype.Timestamp{Time: editedAt, Valid: true}
+		})
+	case strings.Contains(sql, "-- name: GetForwardableMessage ") && args[0] == d.message:
+		return scanRow(func(dest ...any) {
+			*dest[0].(*uuid.UUID) = d.message
+			*dest[1].(**uuid.UUID) = &d.groupID
+			*dest[2].(**uuid.UUID) = &d.id
+			*dest[3].(*db.MessageType) = db.MessageTypeText
+		})
+	case strings.Contains(sql, "-- name: GetPostingPermission ") && *args[0].(*uuid.UUID) == d.id && *args[1].(*uuid.UUID) == d.groupID:
+		return scanRow(func(dest ...any) {
+			*dest[1].(*bool) = d.announcementOnly
+		})
+	}
+	return d.accountDB.QueryRow(ctx, sql, args...)
+}
+
+func (d *editDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if strings.Contains(sql, "-- name: GetDeviceIdentifiersForGroup ") && *args[0].(*uuid.UUID) == d.groupID {
+		return &scanRows{rows: []scanRow{func(dest ...any) { *dest[0].(*string) = "device-1" }}}, nil
+	}
+	if !strings.Contains(sql, "-- name: GetMessageEditHistory ") || args[0] != d.message {
+		return d.accountDB.Query(ctx, sql, args...)
+	}
+	rows := &scanRows{}
+	for i, edit := range d.edits {
+		if i == int(args[1].(int32)) {
+			break
+		}
+		rows.rows = append(rows.rows, func(dest ...any) {
+			*dest[0].(*uuid.UUID) = edit.id
+			*dest[1].(*[]byte) = edit.ciphertext
+			*dest[2].(*[]byte) = []byte("nonce")
+			*dest[3].(*[]byte) = []byte("[]")
+			*dest[4].(*pgtype.Text) = pgtype.Text{String: "device-1", Valid: true}
+			*dest[6].(*pgtype.Timestamp) = pgtype.Timestamp{Time: edit.replacedAt, Valid: true}
+		})
+	}
+	return rows, nil
+}
+
+func TestEditedMessageHistoryKeepsNewestVersions(t *testing.T) {
+	database := &editDB{
+		accountDB:  accountDB{id: uuid.New()},
+		groupID:    uuid.New(),
+		message:    uuid.New(),
+		ciphertext: []byte("v1"),
+		clock:      time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	queries := db.New(database)
+	const depth = 2
+
+	for _, next := range []string{"v2", "v3", "v4"} {
+		if _, err := replaceMessageVersion(context.Background(), queries, db.UpdateMessageVersionParams{
+			ID:         database.message,
+			UserID:     &database.id,
+			Ciphertext: []byte(next),
+		}, depth); err != nil {
+			t.Fatalf("edit to %s: %v", next, err)
+		}
+	}
+	if string(database.ciphertext) != "v4" {
+		t.Fatalf("message holds %q after the edits, want v4", database.ciphertext)
+	}
+
+	handler := &Handler{db: queries, messageEditHistoryDepth: depth}
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/ws/messages/"+database.message.String()+"/history", nil)
+	c.Params = gin.Params{{Key: "messageID", Value: database.message.String()}}
+	c.Set("userID", database.id)
+	handler.GetMessageHistory(c)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("history got status %d: %s", recorder.Code, recorder.Body)
+	}
+	var history MessageHistoryResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &history); err != nil {
+		t.Fatalf("decode history: %v", err)
+	}
+	var got []string
+	for _, version := range history.Versions {
+		ciphertext, err := base64.StdEncoding.DecodeString(version.Ciphertext)
+		if err != nil {
+			t.Fatalf("decode version ciphertext: %v", err)
+		}
+		got = append(got, string(ciphertext))
+	}
+	if strings.Join(got, ",") != "v3,v2" {
+		t.Fatalf("history holds %v, want the replaced versions newest first [v3 v2]", got)
+	}
+	if len(database.other) != 0 {
+		t.Fatalf("edits issued unexpected statements: %v", database.other)
+	}
+}
+
+// putEdit sends an edit of database's message carrying ciphertext to a handler with
+// the given text message limit.
+func putEdit(t *testing.T, database *editDB, ciphertext string, textLimit int) *httptest.ResponseRecorder {
+	t.Helper()
+	handler := &Handler{
+		db: db.New(database),
+		hub: &Hub{
+			messageSizeLimits: messageSizeLimits{db.MessageTypeText: textLimit, db.MessageTypeImage: 4 * textLimit},
+			maxEnvelopes:      defaultMaxEnvelopes,
+			envelopeTolerance: 10,
+		},
+		messageEditHistoryDepth: 2,
+	}
+	body, err := json.Marshal(EditMessageRequest{
+		DeviceIdentifier: "device-1",
+		Signature:        base64.StdEncoding.EncodeToString(make([]byte, 64)),
+		MsgNonce:         base64.StdEncoding.EncodeToString([]byte("nonce")),
+		Ciphertext:       ciphertext,
+		Envelopes:        []Envelope{{DeviceID: "device-1"}},
+	})
+	if err != nil {
+		t.Fatalf("encode edit: %v", err)
+	}
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPut, "/ws/messages/"+database.message.String(), strings.NewReader(string(body)))
+	c.Params = gin.Params{{Key: "messageID", Value: database.message.String()}}
+	c.Set("userID", database.id)
+	handler.EditMessage(c)
+	return recorder
+}
+
+func TestEditOverSizeLimitIsRejected(t *testing.T) {
+	database := &editDB{accountDB: accountDB{id: uuid.New()}, groupID: uuid.New(), message: uuid.New(), ciphertext: []byte("v1")}
+	const textLimit = 1024
+
+	recorder := putEdit(t, database, base64.StdEncoding.EncodeToString(make([]byte, textLimit)), textLimit)
+
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized edit got status %d, want %d: %s", recorder.Code, http.StatusRequestEntityTooLarge, recorder.Body)
+	}
+	if !strings.Contains(recorder.Body.String(), `"max_bytes":`+strconv.Itoa(textLimit)) {
+		t.Fatalf("oversized edit response %s doesn't carry the text limit", recorder.Body)
+	}
+	if string(database.ciphertext) != "v1" || len(database.edits) != 0 {
+		t.Fatalf("oversized edit replaced the message: holds %q with %d edits", database.ciphertext, len(database.edits))
+	}
+}
+
+func TestEditInAnnouncementOnlyGroupIsRejected(t *testing.T) {
+	database := &editDB{
+		accountDB:        accountDB{id: uuid.New()},
+		groupID:          uuid.New(),
+		message:          uuid.New(),
+		ciphertext:       []byte("v1"),
+		announcementOnly: true,
+	}
+
+	recorder := putEdit(t, database, base64.StdEncoding.EncodeToString([]byte("v2")), 16*1024)
+
+	if recorder.Code != http.StatusForbidden || !strings.Contains(recorder.Body.String(), "announcement_only") {
+		t.Fatalf("edit by a non-admin in an announcement-only group got status %d: %s", recorder.Code, recorder.Body)
+	}
+	if string(database.ciphertext) != "v1" || len(database.edits) != 0 {
+		t.Fatalf("rejected edit replaced the message: holds %q with %d edits", database.ciphertext, len(database.edits))
+	}
+}
@@ -0,0 +1,77 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"chat-app-server/util"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetMessageHistory serves GET /ws/messages/:messageID/history: the message's earlier
+// versions, newest first, at most MESSAGE_EDIT_HISTORY_DEPTH of them. Versions stay
+// encrypted; the client decrypts them with the envelope for its device. Only members
+// who can see the message may read its history.
+func (h *Handler) GetMessageHistory(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := util.GetUser(c, h.db)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or unauthorized"})
+		return
+	}
+
+	messageID, err := uuid.Parse(c.Param("messageID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID format"})
+		return
+	}
+
+	// Same visibility rule as forwarding: a current member who joined before the
+	// message was sent, and the message hasn't expired.
+	if _, err := h.db.GetForwardableMessage(ctx, db.GetForwardableMessageParams{
+		MessageID: messageID,
+		UserID:    &user.ID,
+	}); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		} else {
+			log.Printf("Error loading message %s for user %s: %v", messageID, user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load message history"})
+		}
+		return
+	}
+
+	rows, err := h.db.GetMessageEditHistory(ctx, db.GetMessageEditHistoryParams{
+		MessageID: messageID,
+		PageSize:  int32(h.messageEditHistoryDepth),
+	})
+	if err != nil {
+		log.Printf("Error loading edit history for message %s: %v", messageID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load message history"})
+		return
+	}
+
+	history := MessageHistoryResponse{MessageID: messageID, Versions: make([]MessageVersion, 0, len(rows))}
+	for _, row := range rows {
+		var envelopes []Envelope
+		if err := json.Unmarshal(row.KeyEnvelopes, &envelopes); err != nil {
+			log.Printf("Error unmarshalling key_envelopes for edit %s of message %s: %v", row.ID, messageID, err)
+			continue
+		}
+		history.Versions = append(history.Versions, MessageVersion{
+			SenderDeviceID: row.SenderDeviceIdentifier.String,
+			MsgNonce:       base64.StdEncoding.EncodeToString(row.MsgNonce),
+			Ciphertext:     base64.StdEncoding.EncodeToString(row.Ciphertext),
+			Signature:      base64.StdEncoding.EncodeToString(row.Signature),
+			Envelopes:      envelopes,
+			ReplacedAt:     row.CreatedAt.Time,
+		})
+	}
+	c.JSON(http.StatusOK, history)
+}
@@ -0,0 +1,54 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"log"
+	"os"
+	"strings"
+)
+
+// knownMessageTypes lists every value of the message_type enum. It is the one place
+// the server enumerates them; size limits, notification priority and clients all key
+// off these values.
+var knownMessageTypes = []db.MessageType{
+	db.MessageTypeText,
+	db.MessageTypeImage,
+	db.MessageTypeControl,
+}
+
+// messageTypeAllowlist is the set of message types clients may send.
+type messageTypeAllowlist map[db.MessageType]bool
+
+// loadMessageTypeAllowlist reads ALLOWED_MESSAGE_TYPES, an optional comma-separated
+// subset of knownMessageTypes (such as "text,control" to turn off images). Unknown
+// names are logged and ignored. control is always allowed, since clients use it for
+// protocol messages.
+func loadMessageTypeAllowlist() messageTypeAllowlist {
+	allowed := messageTypeAllowlist{db.MessageTypeControl: true}
+	raw := strings.TrimSpace(os.Getenv("ALLOWED_MESSAGE_TYPES"))
+	if raw == "" {
+		for _, messageType := range knownMessageTypes {
+			allowed[messageType] = true
+		}
+		return allowed
+	}
+
+	for _, name := range strings.Split(raw, ",") {
+		messageType := db.MessageType(strings.TrimSpace(name))
+		if !isKnownMessageType(messageType) {
+			log.Printf("ALLOWED_MESSAGE_TYPES: ignoring unknown message type %q", messageType)
+			continue
+		}
+		allowed[messageType] = true
+	}
+	return allowed
+}
+
+func isKnownMessageType(messageType db.MessageType) bool {
+	for _, known := range knownMessageTypes {
+		if messageType == known {
+			return true
+		}
+	}
+	return false
+}
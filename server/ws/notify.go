@@ -0,0 +1,112 @@
+package ws
+
+import (
+	"chat-app-server/metrics"
+	"chat-app-server/notifications"
+	"chat-app-server/util"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// startNotificationWorkers starts a fixed pool of goroutines that send push
+// notifications for persisted messages, so a burst of messages cannot spawn an
+// unbounded number of Redis/DB/Expo calls.
+func (h *Hub) startNotificationWorkers(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go h.notificationWorker()
+	}
+}
+
+func (h *Hub) notificationWorker() {
+	for {
+		select {
+		case msg := <-h.notifyQueue:
+			metrics.NotificationQueueDepth.Set(int64(len(h.notifyQueue)))
+			h.notifySafely(msg)
+		case <-h.ctx.Done():
+			return
+		}
+	}
+}
+
+// notifySafely sends msg's pushes, recovering from a panic so the worker survives it.
+func (h *Hub) notifySafely(msg *RawMessageE2EE) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			util.LogPanic("notification worker for message "+msg.ID.String(), recovered)
+		}
+	}()
+	h.notifyOfflineMembers(msg)
+}
+
+// enqueueNotification hands msg to the worker pool without blocking the hub. When the
+// queue is full the notification is dropped; the message itself is already delivered
+// and persisted, so only the push is lost.
+func (h *Hub) enqueueNotification(msg *RawMessageE2EE) {
+	select {
+	case h.notifyQueue <- msg:
+		metrics.NotificationQueueDepth.Set(int64(len(h.notifyQueue)))
+	default:
+		metrics.NotificationsDropped.Add(1)
+		log.Printf("Hub %s: Notification queue full, dropping push for message %s in group %s", h.serverID, msg.ID, msg.GroupID)
+	}
+}
+
+func (h *Hub) notifyOfflineMembers(msg *RawMessageE2EE) {
+	// Get group name from Redis
+	groupInfoKey := redisGroupInfoPrefix + msg.GroupID.String()
+	groupName, err := h.redisClient.HGet(h.ctx, groupInfoKey, "name").Result()
+	if err != nil {
+		groupName = "Group"
+	}
+
+	// Get sender's username from DB
+	senderName := "Someone"
+	if sender, err := h.db.GetUserById(h.ctx, msg.SenderID); err == nil {
+		senderName = sender.Username
+	}
+
+	// If the settings can't be read, fall back to the most private preview and the
+	// default sound and channel.
+	groupMode := notifications.PreviewGeneric
+	var style notifications.PushStyle
+	if options, err := loadGroupOptions(h.ctx, h.db, msg.GroupID); err != nil {
+		log.Printf("Hub %s: Error loading notification settings for group %s: %v", h.serverID, msg.GroupID, err)
+	} else {
+		groupMode = options.previewMode()
+		style = options.pushStyle()
+	}
+
+	if msg.ReactionTo != nil {
+		if msg.reactionAuthorID != uuid.Nil {
+			h.notificationService.SendReactionNotification(
+				h.ctx,
+				msg.GroupID,
+				groupName,
+				msg.SenderID,
+				senderName,
+				msg.reactionAuthorID,
+				groupMode,
+				style,
+			)
+		}
+		return
+	}
+
+	h.notificationService.SendMessageNotification(
+		h.ctx,
+		msg.GroupID,
+		groupName,
+		msg.SenderID,
+		senderName,
+		msg.MessageType,
+		"sent a message",
+		msg.Mentions,
+		groupMode,
+		style,
+	)
+}
@@ -0,0 +1,108 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// ErrSendBufferFull is returned by Client.Send when the payload was dropped because
+// the client's buffer for that kind of payload is full.
+var ErrSendBufferFull = errors.New("client send buffer full")
+
+// Outbound is a payload the hub or a client's read loop can queue for the client's
+// writer goroutine. Each implementation is routed to its own buffered channel so a
+// burst of one kind (e.g. chat messages) cannot crowd out another (e.g. acks).
+type Outbound interface {
+	// describe identifies the payload in drop logs.
+	describe() string
+}
+
+func (m *RawMessageE2EE) describe() string {
+	return fmt.Sprintf("message %s for group %s", m.ID, m.GroupID)
+}
+
+func (b *MessageBatch) describe() string {
+	return fmt.Sprintf("batch of %d messages", len(b.Messages))
+}
+
+func (e *ClientEvent) describe() string {
+	return fmt.Sprintf("%s event for group %s", e.Event, e.GroupID)
+}
+
+func (a *MessageAck) describe() string {
+	return fmt.Sprintf("%s for message %s", a.Type, a.MessageID)
+}
+
+func (r *ServerResponseMessage) describe() string {
+	return r.Type
+}
+
+// Send queues out for the writer without blocking. If the matching buffer is full the
+// payload is dropped, counted (see drops.go), and ErrSendBufferFull returned; callers that don't need
+// to react to a drop can ignore the error. Events the client's protocol version
+// doesn't know are skipped silently.
+//
+// The hub closes the channels on unregister, so callers must hold the hub's read lock
+// or be the client's own read loop (which finishes before unregister).
+func (c *Client) Send(out Outbound) error {
+	var queued bool
+	groupID := uuid.Nil
+	switch o := out.(type) {
+	case *RawMessageE2EE:
+		groupID = o.GroupID
+		queued = trySend(c.Message, o)
+	case *ClientEvent:
+		groupID = o.GroupID
+		// Any group event may announce a settings, role or membership change.
+		if o.GroupID != uuid.Nil {
+			c.forgetPermission(o.GroupID)
+			c.forgetGroupDevices(o.GroupID)
+		} else if o.Event == "device_keys_updated" {
+			// Sent without a group; the changed device may be in any shared group.
+			c.forgetGroupDevices(uuid.Nil)
+		}
+		if !c.supportsEvent(o.Event) {
+			return nil
+		}
+		queued = trySend(c.Events, o)
+	case *MessageAck:
+		groupID = o.GroupID
+		queued = trySend(c.Acks, o)
+	case *ServerResponseMessage:
+		queued = trySend(c.Control, o)
+	case *MembershipDelta:
+		queued = trySend(c.Sync, o)
+	case *TypingSnapshot:
+		if !c.supportsEvent(o.Type) {
+			return nil
+		}
+		// Snapshots are superseded by the next one, so a drop doesn't need a resync.
+		trySend(c.Typing, o)
+		return nil
+	default:
+		return fmt.Errorf("unsupported outbound payload %T", out)
+	}
+	if !queued {
+		c.recordDrop(out, groupID)
+		c.lostOutbound.Store(true)
+		return ErrSendBufferFull
+	}
+	return nil
+}
+
+// SendEvent queues a group_event lifecycle event. groupID is uuid.Nil for events
+// that are not about a single group.
+func (c *Client) SendEvent(event string, groupID uuid.UUID) error {
+	return c.Send(&ClientEvent{Type: "group_event", Event: event, GroupID: groupID})
+}
+
+func trySend[T any](ch chan T, v T) bool {
+	select {
+	case ch <- v:
+		return true
+	default:
+		return false
+	}
+}
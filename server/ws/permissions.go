@@ -0,0 +1,54 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// postingPermissionTTL bounds how long a cached posting permission is trusted. Changes
+// announced by a group event drop the entry right away; the TTL covers changes that
+// aren't, such as an admin role change.
+const postingPermissionTTL = 30 * time.Second
+
+type cachedPermission struct {
+	permission db.GetPostingPermissionRow
+	fetchedAt  time.Time
+}
+
+// postingPermission returns the client's posting permission in groupID. It is served
+// from the client's cache while the group is in c.Groups, which the hub keeps in step
+// with membership; anything else goes to the database, so a group the client was just
+// added to still works before the hub catches up.
+func (c *Client) postingPermission(queries *db.Queries, groupID uuid.UUID) (db.GetPostingPermissionRow, error) {
+	c.mutex.RLock()
+	cached, ok := c.permissions[groupID]
+	member := c.Groups[groupID]
+	c.mutex.RUnlock()
+	if ok && member && time.Since(cached.fetchedAt) < postingPermissionTTL {
+		return cached.permission, nil
+	}
+
+	permission, err := queries.GetPostingPermission(c.ctx, db.GetPostingPermissionParams{
+		UserID:  &c.User.ID,
+		GroupID: &groupID,
+	})
+	if err != nil {
+		c.forgetPermission(groupID)
+		return permission, err
+	}
+	c.mutex.Lock()
+	if c.Groups[groupID] {
+		c.permissions[groupID] = cachedPermission{permission: permission, fetchedAt: time.Now()}
+	}
+	c.mutex.Unlock()
+	return permission, nil
+}
+
+// forgetPermission drops the cached posting permission for groupID.
+func (c *Client) forgetPermission(groupID uuid.UUID) {
+	c.mutex.Lock()
+	delete(c.permissions, groupID)
+	c.mutex.Unlock()
+}
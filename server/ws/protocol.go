@@ -0,0 +1,51 @@
+package ws
+
+import "fmt"
+
+// WebSocket protocol versions. Clients declare theirs as protocol_version in the auth
+// message and auth_success echoes the version the server will speak, which is the
+// lower of the two. Bump protocolVersionCurrent when adding server-to-client payloads
+// that older clients can't handle, and register them in eventMinProtocol.
+const (
+	// protocolVersionLegacy is assumed for clients that don't declare a version.
+	protocolVersionLegacy = 1
+	// protocolVersionCurrent is the newest protocol this server speaks.
+	protocolVersionCurrent = 9
+)
+
+// eventMinProtocol maps group_event types to the protocol version that introduced
+// them. Clients on an older version never receive them; events not listed here go to
+// everyone.
+var eventMinProtocol = map[string]int{
+	"maintenance":       2,
+	"maintenance_ended": 2,
+	"message_deleted":   2,
+	"session_resumed":   2,
+	"idle_warning":      3,
+	"system_message":    6,
+	"message_edited":    9,
+	// typing, connection_ready, message_batch and token_expiring are frame types of
+	// their own rather than group_events.
+	"typing":           4,
+	"connection_ready": 5,
+	"message_batch":    7,
+	"token_expiring":   8,
+}
+
+// negotiateProtocol returns the version to speak with a client that declared
+// requested (0 when it declared none). It returns an error when the client is older
+// than minVersion.
+func negotiateProtocol(requested, minVersion int) (int, error) {
+	if requested == 0 {
+		requested = protocolVersionLegacy
+	}
+	if requested < minVersion {
+		return 0, fmt.Errorf("protocol version %d is no longer supported, minimum is %d", requested, minVersion)
+	}
+	return min(requested, protocolVersionCurrent), nil
+}
+
+// supportsEvent reports whether the client's protocol version knows event.
+func (c *Client) supportsEvent(event string) bool {
+	return c.protocolVersion >= eventMinProtocol[event]
+}
@@ -0,0 +1,101 @@
+package ws
+
+import (
+	"chat-app-server/metrics"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Mobile clients drop and reconnect constantly as the network flaps. Rather than tear
+// a client down the moment its read loop exits, the hub keeps it registered, still in
+// its groups and still listed in Redis, for reconnectGrace. Payloads for it queue in its
+// buffered channels. If the same device reconnects in time the new client takes over
+// the queue; otherwise the suspension expires and the client is unregistered as usual.
+
+// suspendClientLocked puts client into the suspended state instead of unregistering it.
+// It returns false when the client should be unregistered now: the grace period is
+// disabled, a newer connection already replaced it, the peer closed normally, or the
+// server closed it on purpose (Disconnect cancels the client's context first). Callers
+// must hold h.mutex for writing.
+func (h *Hub) suspendClientLocked(client *Client) bool {
+	if h.reconnectGrace <= 0 || h.Clients[client.User.ID] != client || client.closedNormally || client.ctx.Err() != nil {
+		return false
+	}
+	// Stop the writer so it can't pull queued payloads and lose them on the dead socket.
+	client.cancel()
+	client.suspended = true
+	client.resumeTimer = time.AfterFunc(h.reconnectGrace, func() {
+		if h.expireSuspendedClient(client) {
+			log.Printf("Hub %s: Reconnect grace expired for client %s", h.serverID, client.User.ID)
+		}
+	})
+	log.Printf("Hub %s: Client %s suspended for %s awaiting reconnect", h.serverID, client.User.ID, h.reconnectGrace)
+	return true
+}
+
+// expireSuspendedClient unregisters client if it is still suspended and has not been
+// replaced. It reports whether it did.
+func (h *Hub) expireSuspendedClient(client *Client) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if !client.suspended || h.Clients[client.User.ID] != client {
+		return false
+	}
+	client.suspended = false
+	client.resumeTimer.Stop()
+	h.unregisterClientLocked(client)
+	return true
+}
+
+// resumeSuspendedLocked hands a suspended client's place over to next, a new connection
+// for the same user. next takes over its group slots straight away so nothing broadcast
+// in between is missed. When it is the same device, payloads queued during the gap are
+// moved to next; if any were lost along the way next is asked to resync instead.
+// Redis keys are left in place since next re-registers them. Callers must hold
+// h.mutex for writing.
+func (h *Hub) resumeSuspendedLocked(previous, next *Client) {
+	previous.suspended = false
+	previous.resumeTimer.Stop()
+
+	previous.mutex.RLock()
+	for groupID := range previous.Groups {
+		next.AddGroup(groupID)
+		h.addClientToLocalGroupStructLocked(next, groupID)
+	}
+	previous.mutex.RUnlock()
+
+	if previous.DeviceIdentifier == next.DeviceIdentifier {
+		lost := previous.lostOutbound.Load()
+		lost = !drainInto(previous.Message, next.Message) || lost
+		lost = !drainInto(previous.Events, next.Events) || lost
+		lost = !drainInto(previous.Acks, next.Acks) || lost
+		lost = !drainInto(previous.Control, next.Control) || lost
+		lost = !drainInto(previous.Sync, next.Sync) || lost
+		drainInto(previous.Typing, next.Typing)
+		if lost {
+			next.SendEvent("resync", uuid.Nil)
+		} else {
+			next.SendEvent("session_resumed", uuid.Nil)
+		}
+		metrics.ResumedConnections.Add(1)
+		log.Printf("Hub %s: Client %s resumed suspended session (resync: %t)", h.serverID, next.User.ID, lost)
+	}
+	previous.closeChannels()
+}
+
+// drainInto moves everything currently buffered in from to to without blocking. It
+// returns false if to filled up and something was dropped.
+func drainInto[T any](from, to chan T) bool {
+	for {
+		select {
+		case v := <-from:
+			if !trySend(to, v) {
+				return false
+			}
+		default:
+			return true
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package ws
+
+import (
+	"chat-app-server/db"
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// advanceSenderSeq records message's sender_seq as the sending device's latest in the
+// group, using queries' transaction so the counter only moves if the message is stored.
+// When the counter is rejected it returns the nack reason and the last accepted one.
+func (h *Hub) advanceSenderSeq(ctx context.Context, queries *db.Queries, message *RawMessageE2EE) (string, int64, error) {
+	advanced, err := queries.AdvanceSenderSequence(ctx, db.AdvanceSenderSequenceParams{
+		UserID:           message.SenderID,
+		DeviceIdentifier: message.SenderDeviceID,
+		GroupID:          message.GroupID,
+		Seq:              *message.SenderSeq,
+		MaxGap:           h.senderSeqMaxGap,
+	})
+	if err != nil || advanced > 0 {
+		return "", 0, err
+	}
+
+	last, err := queries.GetSenderSequence(ctx, db.GetSenderSequenceParams{
+		UserID:           message.SenderID,
+		DeviceIdentifier: message.SenderDeviceID,
+		GroupID:          message.GroupID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", 0, errors.New("sender sequence not recorded")
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if *message.SenderSeq <= last {
+		return "stale_sequence", last, nil
+	}
+	return "sequence_gap", last, nil
+}
+
+// nackSenderSeq rejects message for its sender_seq, telling the device the last counter
+// accepted so it can renumber its outbox.
+func (h *Hub) nackSenderSeq(message *RawMessageE2EE, reason string, last int64) {
+	h.sendToSenderDevice(message, &MessageAck{
+		Type:          "message_nack",
+		MessageID:     message.ID,
+		GroupID:       message.GroupID,
+		Reason:        reason,
+		LastSenderSeq: &last,
+	})
+}
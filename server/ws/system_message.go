@@ -0,0 +1,73 @@
+package ws
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// SendSystemMessage serves POST /api/admin/groups/:groupID/system-message: it shows an
+// operator's plaintext notice to every connected member of a group and, if asked,
+// pushes it to members who haven't muted the group. Operator only. The notice is not
+// stored, so members who are offline and don't get the push never see it.
+func (h *Handler) SendSystemMessage(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	groupID, err := uuid.Parse(c.Param("groupID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID format"})
+		return
+	}
+
+	var req SendSystemMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group, err := h.db.GetGroupById(ctx, groupID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			return
+		}
+		log.Printf("Error loading group %s for system message: %v", groupID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load group"})
+		return
+	}
+
+	message := &SystemMessage{ID: uuid.New(), Text: req.Text, SentAt: time.Now().UTC()}
+	h.hub.NotifySystemMessage(groupID, message)
+
+	pushed := 0
+	if req.Push && h.hub.pushEnabled {
+		memberships, err := h.db.GetAllUserGroupsForGroup(ctx, &groupID)
+		if err != nil {
+			log.Printf("Error loading members of group %s for system message push: %v", groupID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Notice sent, but push notifications failed"})
+			return
+		}
+		var userIDs []uuid.UUID
+		for _, membership := range memberships {
+			if membership.UserID != nil && !membership.Muted {
+				userIDs = append(userIDs, *membership.UserID)
+			}
+		}
+		pushed = len(userIDs)
+		go h.hub.notificationService.SendUserNotification(
+			h.hub.ctx,
+			userIDs,
+			group.Name,
+			req.Text,
+			map[string]string{"groupId": groupID.String(), "type": "system_message", "systemMessageId": message.ID.String()},
+		)
+	}
+	log.Printf("System message %s sent to group %s (%d members pushed).", message.ID, groupID, pushed)
+
+	c.JSON(http.StatusOK, gin.H{"system_message": message, "pushed": pushed})
+}
@@ -2,6 +2,8 @@ package ws
 
 import (
 	"chat-app-server/db"
+	"chat-app-server/notifications"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -26,7 +28,42 @@ type RawMessageE2EE struct {
 	SenderID       uuid.UUID      `json:"sender_id"`
 	SenderUsername string         `json:"sender_username"`
 	Envelopes      []Envelope     `json:"envelopes"`
+	// Mentions lists mentioned user IDs in plaintext, outside the encrypted content.
+	Mentions []uuid.UUID `json:"mentions,omitempty"`
+	// ForwardedFrom is set on messages forwarded from another group.
+	ForwardedFrom *ForwardedFrom `json:"forwarded_from,omitempty"`
+	// ExpiresAt is set on disappearing messages.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// ReactionTo is set on control messages that react to another message.
+	ReactionTo *uuid.UUID `json:"reaction_to,omitempty"`
+	// SenderSeq is the sending device's counter for the group, if it sent one.
+	SenderSeq *int64 `json:"sender_seq,omitempty"`
+	// reactionAuthorID is the author of the ReactionTo message, resolved on the
+	// receiving instance for the reaction push.
+	reactionAuthorID uuid.UUID
 }
+
+// MessageBatch carries several chat messages in one frame, oldest first. It is only
+// sent to clients on protocol 7 and up, when messages queue up faster than they can
+// be written.
+type MessageBatch struct {
+	Type     string            `json:"type"` // always "message_batch"
+	Messages []*RawMessageE2EE `json:"messages"`
+}
+
+// ForwardedFrom identifies the message a forwarded message was copied from. Clients
+// send only MessageID; the server fills in the source group and sender.
+type ForwardedFrom struct {
+	MessageID uuid.UUID `json:"message_id"`
+	GroupID   uuid.UUID `json:"group_id"`
+	SenderID  uuid.UUID `json:"sender_id"`
+}
+
+// ClientSentE2EMessage is a message as sent by a device. The client generates ID and
+// the server stores the message under it, so a client can render the message
+// optimistically and reconcile it with the MessageAck carrying the same ID. Resending
+// an already persisted message with the same ID is safe: it is acked again with the
+// original timestamp and not delivered twice.
 type ClientSentE2EMessage struct {
 	ID          uuid.UUID      `json:"id" binding:"required"`
 	GroupID     uuid.UUID      `json:"group_id"`
@@ -35,6 +72,42 @@ type ClientSentE2EMessage struct {
 	Ciphertext  string         `json:"ciphertext"` // Base64 encoded
 	MessageType db.MessageType `json:"messageType"`
 	Envelopes   []Envelope     `json:"envelopes"`
+	// Mentions must all be members of the group; they are not covered by the signature.
+	Mentions []uuid.UUID `json:"mentions,omitempty"`
+	// ForwardedFrom marks a re-encrypted copy of a message the sender can read in
+	// another group. Like Mentions, it is not covered by the signature.
+	ForwardedFrom *ForwardedFrom `json:"forwarded_from,omitempty"`
+	// ExpiresAt makes the message disappear for everyone at that time. It must be in
+	// the future and within MAX_MESSAGE_EXPIRY_DAYS, and is not covered by the signature.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// ReactionTo marks a control message as a reaction to another message in the same
+	// group, so its author can be notified. It is not covered by the signature.
+	ReactionTo *uuid.UUID `json:"reaction_to,omitempty"`
+	// SenderSeq is an optional per-device, per-group counter. When present it must be
+	// above the last one the device's messages to the group were stored with, and at
+	// most SENDER_SEQ_MAX_GAP ahead of it. It is not covered by the signature.
+	SenderSeq *int64 `json:"sender_seq,omitempty"`
+}
+
+type SetMaintenanceRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// LeaveAllGroupsResult summarizes POST /ws/leave-all-groups. Left lists every group
+// the user left, Deleted the subset that was deleted because it became empty, and
+// Failed the groups that couldn't be left and still include the user.
+type LeaveAllGroupsResult struct {
+	Left    []uuid.UUID `json:"left"`
+	Deleted []uuid.UUID `json:"deleted"`
+	Failed  []uuid.UUID `json:"failed"`
+}
+
+// SendSystemMessageRequest is the body of POST /api/admin/groups/:groupID/system-message.
+type SendSystemMessageRequest struct {
+	Text string `json:"text" binding:"required,max=1000"`
+	// Push also sends the notice as a push notification to members who haven't muted
+	// the group.
+	Push bool `json:"push"`
 }
 
 type CreateGroupRequest struct {
@@ -46,16 +119,21 @@ type CreateGroupRequest struct {
 	Location    *string   `json:"location,omitempty"`
 	ImageUrl    *string   `json:"image_url,omitempty"`
 	Blurhash    *string   `json:"blurhash,omitempty"`
+	// RequiresApproval makes invite links create join requests instead of joining directly.
+	RequiresApproval bool `json:"requires_approval"`
 }
 
 type UpdateGroupRequest struct {
-	Name        *string    `json:"name,omitempty"`
-	StartTime   *time.Time `json:"start_time,omitempty"`
-	EndTime     *time.Time `json:"end_time,omitempty"`
-	Description *string    `json:"description,omitempty"`
-	Location    *string    `json:"location,omitempty"`
-	ImageUrl    *string    `json:"image_url,omitempty"`
-	Blurhash    *string    `json:"blurhash,omitempty"`
+	Name             *string    `json:"name,omitempty"`
+	StartTime        *time.Time `json:"start_time,omitempty"`
+	EndTime          *time.Time `json:"end_time,omitempty"`
+	Description      *string    `json:"description,omitempty"`
+	Location         *string    `json:"location,omitempty"`
+	ImageUrl         *string    `json:"image_url,omitempty"`
+	Blurhash         *string    `json:"blurhash,omitempty"`
+	RequiresApproval *bool      `json:"requires_approval,omitempty"`
+	// AnnouncementOnly restricts posting to group admins.
+	AnnouncementOnly *bool `json:"announcement_only,omitempty"`
 }
 
 type ClientGroup struct {
@@ -71,6 +149,66 @@ type ClientGroup struct {
 	UpdatedAt   time.Time         `json:"updated_at"`
 	Admin       bool              `json:"admin"`
 	GroupUsers  []ClientGroupUser `json:"group_users"`
+	// AnnouncementOnly means only admins may post; clients should disable the composer for everyone else.
+	AnnouncementOnly bool `json:"announcement_only"`
+}
+
+// GroupListItem is one GetGroups entry: the group plus its latest message's metadata
+// (content stays E2EE) and the caller's unread count.
+type GroupListItem struct {
+	db.GetGroupsForUserRow
+	Tags        []string          `json:"tags"`
+	LastMessage *GroupLastMessage `json:"last_message"`
+	UnreadCount int64             `json:"unread_count"`
+}
+
+type GroupLastMessage struct {
+	SenderID       *uuid.UUID     `json:"sender_id"`
+	SenderUsername *string        `json:"sender_username,omitempty"`
+	MessageType    db.MessageType `json:"message_type"`
+	Timestamp      time.Time      `json:"timestamp"`
+}
+
+// GroupSettings is the admin-configurable settings object for a group. The first two
+// fields are columns on groups because the message path reads them, and tags live in
+// group_tags so group lists can be filtered by them; the rest are GroupOptions stored
+// as JSONB in group_settings.
+type GroupSettings struct {
+	AnnouncementOnly bool     `json:"announcement_only"`
+	RequiresApproval bool     `json:"requires_approval"`
+	Tags             []string `json:"tags"`
+	GroupOptions
+}
+
+// GroupOptions holds settings persisted in group_settings.settings. Fields missing from
+// the stored JSON keep their zero value, so new options must default to zero.
+type GroupOptions struct {
+	// NotificationPreviewMode is the least private push preview members get; empty
+	// means notifications.PreviewFull.
+	NotificationPreviewMode notifications.PreviewMode `json:"notification_preview_mode,omitempty"`
+	// DefaultMuted makes new members join with the group muted; they can unmute.
+	DefaultMuted bool `json:"default_muted,omitempty"`
+	// NotificationSound and NotificationChannel pick the iOS sound and Android channel of
+	// the group's pushes from the NOTIFICATION_SOUNDS / NOTIFICATION_CHANNELS allowlists;
+	// empty means the defaults.
+	NotificationSound   string `json:"notification_sound,omitempty"`
+	NotificationChannel string `json:"notification_channel,omitempty"`
+	// NotificationPriority overrides the Expo priority of the group's pushes; empty
+	// picks it per push (see notifications.autoPriority).
+	NotificationPriority string `json:"notification_priority,omitempty"`
+}
+
+// UpdateGroupSettingsRequest changes only the settings that are present.
+type UpdateGroupSettingsRequest struct {
+	AnnouncementOnly        *bool                      `json:"announcement_only,omitempty"`
+	RequiresApproval        *bool                      `json:"requires_approval,omitempty"`
+	NotificationPreviewMode *notifications.PreviewMode `json:"notification_preview_mode,omitempty"`
+	DefaultMuted            *bool                      `json:"default_muted,omitempty"`
+	NotificationSound       *string                    `json:"notification_sound,omitempty"`
+	NotificationChannel     *string                    `json:"notification_channel,omitempty"`
+	NotificationPriority    *string                    `json:"notification_priority,omitempty"`
+	// Tags replaces the group's tags; an empty list clears them.
+	Tags *[]string `json:"tags,omitempty"`
 }
 
 type UpdateGroupResponse struct {
@@ -84,6 +222,7 @@ type JoinGroupRequest struct {
 type InviteUsersToGroupRequest struct {
 	GroupID uuid.UUID `json:"group_id"`
 	Emails  []string  `json:"emails"`
+	Phones  []string  `json:"phones"`
 }
 
 type RemoveUserFromGroupRequest struct {
@@ -101,6 +240,103 @@ type ClientGroupUser struct {
 	InvitedAt string    `json:"invited_at"`
 }
 
+type ClientContact struct {
+	ID       uuid.UUID `json:"id"`
+	Username string    `json:"username"`
+	Email    string    `json:"email"`
+}
+
+// ContactsPage is one page of GET /ws/relevant-users search results. NextCursor is
+// empty on the last page.
+type ContactsPage struct {
+	Users      []ClientContact `json:"users"`
+	Limit      int             `json:"limit"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// AuditLogEntry is one admin action as returned by GET /ws/groups/:groupID/audit.
+// Actor and target are nil once the account has been deleted.
+type AuditLogEntry struct {
+	ID             uuid.UUID       `json:"id"`
+	Action         string          `json:"action"`
+	ActorID        *uuid.UUID      `json:"actor_id"`
+	ActorUsername  *string         `json:"actor_username"`
+	TargetUserID   *uuid.UUID      `json:"target_user_id,omitempty"`
+	TargetUsername *string         `json:"target_username,omitempty"`
+	Details        json.RawMessage `json:"details,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// AuditLogPage is one page of a group's audit log, newest first. NextCursor is empty
+// on the last page.
+type AuditLogPage struct {
+	Entries    []AuditLogEntry `json:"entries"`
+	Limit      int             `json:"limit"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// GroupMediaItem is one attachment in GET /ws/groups/:groupID/media. ObjectKey is
+// what POST /images/presign-download takes.
+type GroupMediaItem struct {
+	ID          uuid.UUID  `json:"id"`
+	MessageID   uuid.UUID  `json:"message_id"`
+	SenderID    *uuid.UUID `json:"sender_id"`
+	ObjectKey   string     `json:"object_key"`
+	ContentType string     `json:"content_type"`
+	Size        int64      `json:"size"`
+	SentAt      time.Time  `json:"sent_at"`
+}
+
+// GroupMediaPage is one page of a group's attachments, newest message first.
+// NextCursor is empty on the last page.
+type GroupMediaPage struct {
+	Media      []GroupMediaItem `json:"media"`
+	Limit      int              `json:"limit"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// BlockedUser is one entry of a GET /ws/blocked-users page.
+type BlockedUser struct {
+	ID        uuid.UUID `json:"id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	BlockedAt time.Time `json:"blocked_at"`
+}
+
+// BlockedUsersPage is one page of the caller's blocked users, most recently blocked
+// first. NextCursor is empty on the last page.
+type BlockedUsersPage struct {
+	BlockedUsers []BlockedUser `json:"blocked_users"`
+	Limit        int           `json:"limit"`
+	NextCursor   string        `json:"next_cursor,omitempty"`
+}
+
+// GroupStats is the response of GET /ws/groups/:groupID/stats. AttachmentBytes is the
+// total size recorded for the group's attachments in S3.
+type GroupStats struct {
+	GroupID         uuid.UUID `json:"group_id"`
+	MessageCount    int64     `json:"message_count"`
+	MessagesLast24h int64     `json:"messages_last_24h"`
+	AttachmentCount int64     `json:"attachment_count"`
+	AttachmentBytes int64     `json:"attachment_bytes"`
+	MemberCount     int64     `json:"member_count"`
+}
+
+// Bookmark is one entry of GET /ws/bookmarks: the message as it would be delivered,
+// still encrypted, and when the caller bookmarked it.
+type Bookmark struct {
+	Message      RawMessageE2EE `json:"message"`
+	BookmarkedAt time.Time      `json:"bookmarked_at"`
+}
+
+// BookmarksPage is one page of the caller's bookmarks, most recently bookmarked
+// first. NextCursor is empty on the last page.
+type BookmarksPage struct {
+	Bookmarks  []Bookmark `json:"bookmarks"`
+	Limit      int        `json:"limit"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
 type BlockUserRequest struct {
 	UserID uuid.UUID `json:"user_id" binding:"required"`
 }
@@ -109,6 +345,24 @@ type UnblockUserRequest struct {
 	UserID uuid.UUID `json:"user_id" binding:"required"`
 }
 
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type RegisterDeviceRequest struct {
+	Password         string `json:"password" binding:"required"`
+	DeviceIdentifier string `json:"device_identifier" binding:"required"`
+	PublicKey        string `json:"public_key" binding:"required"`         // Base64 encoded
+	SigningPublicKey string `json:"signing_public_key" binding:"required"` // Base64 encoded
+}
+
+type RotateDeviceKeyRequest struct {
+	Password         string `json:"password" binding:"required"`
+	DeviceIdentifier string `json:"device_identifier" binding:"required"`
+	PublicKey        string `json:"public_key" binding:"required"`         // Base64 encoded
+	SigningPublicKey string `json:"signing_public_key" binding:"required"` // Base64 encoded
+}
+
 type CreateInviteRequest struct {
 	GroupID uuid.UUID `json:"group_id" binding:"required"`
 	MaxUses int       `json:"max_uses" binding:"min=0"`
@@ -122,25 +376,182 @@ type CreateInviteResponse struct {
 }
 
 type InvitePreviewResponse struct {
-	GroupID     uuid.UUID  `json:"group_id"`
-	GroupName   string     `json:"group_name"`
-	Description *string    `json:"description,omitempty"`
-	ImageUrl    *string    `json:"image_url,omitempty"`
-	Blurhash    *string    `json:"blurhash,omitempty"`
-	MemberCount int32      `json:"member_count"`
-	StartTime   *time.Time `json:"start_time,omitempty"`
-	EndTime     *time.Time `json:"end_time,omitempty"`
-	ExpiresAt   time.Time  `json:"expires_at"`
+	GroupID          uuid.UUID  `json:"group_id"`
+	GroupName        string     `json:"group_name"`
+	Description      *string    `json:"description,omitempty"`
+	ImageUrl         *string    `json:"image_url,omitempty"`
+	Blurhash         *string    `json:"blurhash,omitempty"`
+	MemberCount      int32      `json:"member_count"`
+	StartTime        *time.Time `json:"start_time,omitempty"`
+	EndTime          *time.Time `json:"end_time,omitempty"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	RequiresApproval bool       `json:"requires_approval"`
+}
+
+// InviteStatsResponse is the body of GET /ws/groups/:groupID/invites/stats.
+type InviteStatsResponse struct {
+	Invites []InviteStats `json:"invites"`
+}
+
+// InviteStats describes one invite link. MaxUses 0 means unlimited, in which case
+// RemainingUses is omitted. Joins lists the most recent joins through the link (up to
+// 50), newest first; UseCount is the total.
+type InviteStats struct {
+	ID            uuid.UUID    `json:"id"`
+	Code          string       `json:"code"`
+	CreatedBy     uuid.UUID    `json:"created_by"`
+	CreatedAt     time.Time    `json:"created_at"`
+	ExpiresAt     *time.Time   `json:"expires_at,omitempty"`
+	Expired       bool         `json:"expired"`
+	UseCount      int          `json:"use_count"`
+	MaxUses       int          `json:"max_uses"`
+	RemainingUses *int         `json:"remaining_uses,omitempty"`
+	Joins         []InviteJoin `json:"joins"`
+}
+
+type InviteJoin struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type ValidateInvitesBatchRequest struct {
+	Codes []string `json:"codes" binding:"required"`
+}
+
+type InviteValidationResult struct {
+	Code    string                 `json:"code"`
+	Status  string                 `json:"status"`
+	Preview *InvitePreviewResponse `json:"preview,omitempty"`
+}
+
+type RequestJoinRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type ClientJoinRequest struct {
+	ID          uuid.UUID `json:"id"`
+	UserID      uuid.UUID `json:"user_id"`
+	Username    string    `json:"username"`
+	RequestedAt time.Time `json:"requested_at"`
 }
 
 type AcceptInviteResponse struct {
 	GroupID uuid.UUID `json:"group_id"`
 	Message string    `json:"message"`
+	// Muted is the caller's mute state for the group; only set when this call joined it.
+	Muted *bool `json:"muted,omitempty"`
+}
+
+// MessageAck tells the sending device whether a message it sent was persisted and broadcast.
+// MessageID is always the client-generated ID of the message being answered. On
+// message_ack, Timestamp is the authoritative created_at the client should replace its
+// optimistic one with; on message_nack the optimistic copy should be marked failed.
+// Retrying is worthwhile for server_busy, persist_failed and internal_error.
+type MessageAck struct {
+	Type      string    `json:"type"` // "message_ack" or "message_nack"
+	MessageID uuid.UUID `json:"message_id"`
+	GroupID   uuid.UUID `json:"group_id"`
+	Timestamp string    `json:"timestamp,omitempty"` // authoritative created_at, set on ack
+	Reason    string    `json:"reason,omitempty"`    // set on nack
+	// MissingDevices lists member devices with no envelope when Reason is "missing_devices".
+	MissingDevices []string `json:"missing_devices,omitempty"`
+	// MaxBytes is the size limit for the message's type when Reason is "message_too_large".
+	MaxBytes int `json:"max_bytes,omitempty"`
+	// MaxEnvelopes is the per-message envelope cap when Reason is "too_many_envelopes"
+	// because of it rather than the group's device count.
+	MaxEnvelopes int `json:"max_envelopes,omitempty"`
+	// LastSenderSeq is the device's last accepted sender_seq when Reason is
+	// "stale_sequence" or "sequence_gap".
+	LastSenderSeq *int64 `json:"last_sender_seq,omitempty"`
 }
 
 // ClientEvent is a server-to-client lifecycle event sent over WebSocket.
 type ClientEvent struct {
 	Type    string    `json:"type"`  // always "group_event"
-	Event   string    `json:"event"` // "user_invited", "user_removed", "group_updated", "group_deleted"
+	Event   string    `json:"event"` // "user_invited", "user_removed", "group_updated", "group_deleted", "join_requested", "join_request_approved", "join_request_denied", "resync", "device_keys_updated", "message_deleted", "maintenance", "maintenance_ended", "idle_warning", "system_message", "message_edited", "session_resumed"
 	GroupID uuid.UUID `json:"group_id"`
+	// MessageIDs lists the affected messages for message_deleted.
+	MessageIDs []uuid.UUID `json:"message_ids,omitempty"`
+	// SystemMessage carries the notice for system_message.
+	SystemMessage *SystemMessage `json:"system_message,omitempty"`
+	// MessageEdit carries the new version for message_edited.
+	MessageEdit *MessageEdit `json:"message_edit,omitempty"`
+}
+
+// SystemMessage is a plaintext notice posted to a group by an operator. Unlike chat
+// messages it is not end-to-end encrypted, has no sender and is never stored, so
+// clients must render it apart from the group's messages.
+type SystemMessage struct {
+	ID     uuid.UUID `json:"id"`
+	Text   string    `json:"text"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// MarkGroupReadRequest is the optional body of POST /ws/groups/:groupID/read. ReadAt
+// defaults to now and is capped at now.
+type MarkGroupReadRequest struct {
+	DeviceIdentifier string     `json:"device_identifier"`
+	ReadAt           *time.Time `json:"read_at"`
+}
+
+// GroupReadState is one group's read markers as returned by GET /ws/groups/read-state.
+type GroupReadState struct {
+	GroupID          uuid.UUID  `json:"group_id"`
+	LastReadAt       *time.Time `json:"last_read_at"`
+	DeviceLastReadAt *time.Time `json:"device_last_read_at"`
+}
+
+// AckSequenceRequest is the body of POST /ws/groups/:groupID/ack-sequence. MessageID
+// is the newest message the device has received in the group.
+type AckSequenceRequest struct {
+	DeviceIdentifier string    `json:"device_identifier" binding:"required"`
+	MessageID        uuid.UUID `json:"message_id" binding:"required"`
+}
+
+// DeliveryPosition is the newest message a device has reported receiving in a group.
+type DeliveryPosition struct {
+	GroupID          uuid.UUID `json:"group_id"`
+	DeviceIdentifier string    `json:"device_identifier"`
+	MessageID        uuid.UUID `json:"message_id"`
+	DeliveredAt      time.Time `json:"delivered_at"`
+}
+
+// MessageVersion is one earlier, still encrypted version of an edited message.
+// ReplacedAt is when the edit replaced it.
+type MessageVersion struct {
+	SenderDeviceID string     `json:"sender_device_id"`
+	MsgNonce       string     `json:"msgNonce"`   // Base64 encoded
+	Ciphertext     string     `json:"ciphertext"` // Base64 encoded
+	Signature      string     `json:"signature"`  // Base64 encoded Ed25519 signature
+	Envelopes      []Envelope `json:"envelopes"`
+	ReplacedAt     time.Time  `json:"replaced_at"`
+}
+
+// MessageHistoryResponse is returned by GET /ws/messages/:messageID/history.
+type MessageHistoryResponse struct {
+	MessageID uuid.UUID        `json:"message_id"`
+	Versions  []MessageVersion `json:"versions"`
+}
+
+// EditMessageRequest is the body of PUT /ws/messages/:messageID: a new version of the
+// message, encrypted and signed like a new message by one of the sender's devices.
+type EditMessageRequest struct {
+	DeviceIdentifier string     `json:"device_identifier" binding:"required"`
+	Signature        string     `json:"signature" binding:"required"`  // Base64 encoded Ed25519 signature
+	MsgNonce         string     `json:"msgNonce" binding:"required"`   // Base64 encoded
+	Ciphertext       string     `json:"ciphertext" binding:"required"` // Base64 encoded
+	Envelopes        []Envelope `json:"envelopes" binding:"required"`
+}
+
+// MessageEdit is the current version of an edited message, returned by
+// PUT /ws/messages/:messageID and sent to members in a message_edited group_event.
+type MessageEdit struct {
+	MessageID      uuid.UUID  `json:"message_id"`
+	SenderDeviceID string     `json:"sender_device_id"`
+	MsgNonce       string     `json:"msgNonce"`   // Base64 encoded
+	Ciphertext     string     `json:"ciphertext"` // Base64 encoded
+	Signature      string     `json:"signature"`  // Base64 encoded Ed25519 signature
+	Envelopes      []Envelope `json:"envelopes"`
+	EditedAt       time.Time  `json:"edited_at"`
 }
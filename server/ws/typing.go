@@ -0,0 +1,174 @@
+package ws
+
+import (
+	"chat-app-server/rediskeys"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// typingTTL is how long a typing update lasts; clients refresh it while typing.
+	typingTTL = 5 * time.Second
+	// typingFlushInterval is how often snapshots are published, and the most often a
+	// group gets one across the cluster.
+	typingFlushInterval = time.Second
+)
+
+// ClientTypingMessage is sent by a client while it is typing in a group (and with
+// Typing false when it stops).
+type ClientTypingMessage struct {
+	Type    string    `json:"type"` // "typing"
+	GroupID uuid.UUID `json:"group_id"`
+	Typing  bool      `json:"typing"`
+}
+
+// TypingSnapshot lists everyone currently typing in a group. It replaces the previous
+// snapshot for the group; an empty UserIDs means nobody is typing.
+type TypingSnapshot struct {
+	Type    string      `json:"type"` // "typing"
+	GroupID uuid.UUID   `json:"group_id"`
+	UserIDs []uuid.UUID `json:"user_ids"`
+}
+
+func (t *TypingSnapshot) describe() string {
+	return fmt.Sprintf("typing snapshot for group %s", t.GroupID)
+}
+
+// typingTracker remembers the groups this instance has seen typing in and the last
+// snapshot it saw for each, so the flusher only publishes changes.
+type typingTracker struct {
+	mu     sync.Mutex
+	groups map[uuid.UUID]string
+}
+
+// setTyping records that c started or stopped typing in groupID. Typing state lives in
+// a Redis sorted set per group scored by expiry, so it is shared across instances and
+// lapses on its own if the client stops refreshing it.
+func (h *Hub) setTyping(c *Client, groupID uuid.UUID, typing bool) {
+	c.mutex.RLock()
+	member := c.Groups[groupID]
+	c.mutex.RUnlock()
+	if !member {
+		return
+	}
+
+	key := rediskeys.TypingPrefix + groupID.String()
+	var err error
+	if typing {
+		pipe := h.redisClient.Pipeline()
+		pipe.ZAdd(h.ctx, key, redis.Z{Score: float64(time.Now().Add(typingTTL).UnixMilli()), Member: c.User.ID.String()})
+		pipe.Expire(h.ctx, key, 2*typingTTL)
+		_, err = pipe.Exec(h.ctx)
+	} else {
+		err = h.redisClient.ZRem(h.ctx, key, c.User.ID.String()).Err()
+	}
+	if err != nil {
+		log.Printf("Hub %s: Error updating typing state for user %s in group %s: %v", h.serverID, c.User.ID, groupID, err)
+		return
+	}
+
+	h.typing.mu.Lock()
+	if _, tracked := h.typing.groups[groupID]; !tracked {
+		h.typing.groups[groupID] = ""
+	}
+	h.typing.mu.Unlock()
+}
+
+// runTypingFlusher publishes typing snapshots for tracked groups until the hub stops.
+func (h *Hub) runTypingFlusher() {
+	ticker := time.NewTicker(typingFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+			h.flushTyping()
+		}
+	}
+}
+
+// flushTyping drops expired typers from each tracked group and publishes the group's
+// snapshot if it changed. A per-group Redis lock limits the cluster to one snapshot
+// per group per interval; a group that loses the race is retried on the next tick.
+// Groups stop being tracked once nobody is typing and that has been published.
+func (h *Hub) flushTyping() {
+	h.typing.mu.Lock()
+	groups := make(map[uuid.UUID]string, len(h.typing.groups))
+	for groupID, last := range h.typing.groups {
+		groups[groupID] = last
+	}
+	h.typing.mu.Unlock()
+
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	for groupID, last := range groups {
+		key := rediskeys.TypingPrefix + groupID.String()
+		pipe := h.redisClient.Pipeline()
+		pipe.ZRemRangeByScore(h.ctx, key, "-inf", now)
+		members := pipe.ZRange(h.ctx, key, 0, -1)
+		if _, err := pipe.Exec(h.ctx); err != nil {
+			log.Printf("Hub %s: Error reading typing state for group %s: %v", h.serverID, groupID, err)
+			continue
+		}
+		ids := members.Val()
+		sort.Strings(ids)
+		snapshot := strings.Join(ids, ",")
+		if snapshot != last {
+			acquired, err := h.redisClient.SetNX(h.ctx, rediskeys.TypingThrottlePrefix+groupID.String(), h.serverID, typingFlushInterval).Result()
+			if err != nil || !acquired {
+				continue
+			}
+			h.publishTyping(groupID, ids)
+		}
+
+		h.typing.mu.Lock()
+		if snapshot == "" {
+			delete(h.typing.groups, groupID)
+		} else {
+			h.typing.groups[groupID] = snapshot
+		}
+		h.typing.mu.Unlock()
+	}
+}
+
+// publishTyping delivers a snapshot to this instance's group members and publishes it
+// for the other instances.
+func (h *Hub) publishTyping(groupID uuid.UUID, ids []string) {
+	snapshot := &TypingSnapshot{Type: "typing", GroupID: groupID, UserIDs: make([]uuid.UUID, 0, len(ids))}
+	for _, id := range ids {
+		if userID, err := uuid.Parse(id); err == nil {
+			snapshot.UserIDs = append(snapshot.UserIDs, userID)
+		}
+	}
+	h.deliverTypingLocally(snapshot)
+
+	serialized, err := json.Marshal(PubSubMessage{Type: "typing", Payload: snapshot, OriginServerID: h.serverID})
+	if err != nil {
+		log.Printf("Hub %s: Error marshalling typing snapshot: %v", h.serverID, err)
+	} else if err := h.redisClient.Publish(h.ctx, pubSubGroupEventsChannel, serialized).Err(); err != nil {
+		log.Printf("Hub %s: Error publishing typing snapshot for group %s: %v", h.serverID, groupID, err)
+	}
+}
+
+func (h *Hub) deliverTypingLocally(snapshot *TypingSnapshot) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	group, ok := h.Groups[snapshot.GroupID]
+	if !ok {
+		return
+	}
+	group.mutex.RLock()
+	defer group.mutex.RUnlock()
+	for _, client := range group.Clients {
+		client.Send(snapshot)
+	}
+}